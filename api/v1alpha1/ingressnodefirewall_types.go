@@ -22,6 +22,7 @@ import (
 )
 
 // IngressNodeFirewallICMPRule define ingress node firewall rule for ICMP and ICMPv6 protocols
+// +kubebuilder:validation:XValidation:rule="!(has(self.icmpAnyCode) && self.icmpAnyCode && has(self.icmpCode))",message="icmpCode and icmpAnyCode are mutually exclusive"
 type IngressNodeFirewallICMPRule struct {
 	// imcpType defines ICMP Type Numbers (RFC 792).
 	// if configured, this field matches against the ICMP/ICMPv6 header otherwise its ignored.
@@ -30,12 +31,23 @@ type IngressNodeFirewallICMPRule struct {
 	// +kubebuilder:validation:Minimum:=0
 	ICMPType uint8 `json:"icmpType,omitempty"`
 
+	// icmpTypeEnd defines the last ICMP type of a range of types that starts at icmpType, both included.
+	// if not configured, only icmpType is matched.
+	// +optional
+	// +kubebuilder:validation:Maximum:=255
+	// +kubebuilder:validation:Minimum:=0
+	ICMPTypeEnd uint8 `json:"icmpTypeEnd,omitempty"`
+
 	// icmpCode defines ICMP Code ID (RFC 792).
-	// if configured, this field matches against the ICMP/ICMPv6 header otherwise its ignored.
+	// if configured, this field matches against the ICMP/ICMPv6 header otherwise code 0 is matched.
 	// +optional
 	// +kubebuilder:validation:Maximum:=255
 	// +kubebuilder:validation:Minimum:=0
 	ICMPCode uint8 `json:"icmpCode,omitempty"`
+
+	// icmpAnyCode matches every code of the ICMP types instead of icmpCode. It cannot be combined with icmpCode.
+	// +optional
+	ICMPAnyCode bool `json:"icmpAnyCode,omitempty"`
 }
 
 // IngressNodeFirewallProtoRule define ingress node firewall rule for TCP, UDP and SCTP protocols
@@ -54,11 +66,12 @@ type IngressNodeFirewallProtoRule struct {
 // +kubebuilder:validation:XValidation:rule="has(self.protocol) && self.protocol == 'SCTP' ?  has(self.sctp) : !has(self.sctp)",message="sctp is required when protocol is SCTP, and forbidden otherwise"
 // +kubebuilder:validation:XValidation:rule="has(self.protocol) && self.protocol == 'ICMP' ?  has(self.icmp) : !has(self.icmp)",message="icmp is required when protocol is ICMP, and forbidden otherwise"
 // +kubebuilder:validation:XValidation:rule="has(self.protocol) && self.protocol == 'ICMPv6' ?  has(self.icmpv6) : !has(self.icmpv6)",message="icmpv6 is required when protocol is ICMPv6, and forbidden otherwise"
+// +kubebuilder:validation:XValidation:rule="has(self.protocol) && self.protocol == 'IPProtocol' ?  has(self.ipProtocol) : !has(self.ipProtocol)",message="ipProtocol is required when protocol is IPProtocol, and forbidden otherwise"
 type IngressNodeProtocolConfig struct {
-	// protocol can be ICMP, ICMPv6, TCP, SCTP or UDP.
+	// protocol can be ICMP, ICMPv6, TCP, SCTP, UDP or IPProtocol.
 	// +unionDiscriminator
 	// +kubebuilder:validation:Required
-	// +kubebuilder:validation:Enum="ICMP";"ICMPv6";"TCP";"UDP";"SCTP";""
+	// +kubebuilder:validation:Enum="ICMP";"ICMPv6";"TCP";"UDP";"SCTP";"IPProtocol";""
 	Protocol IngressNodeFirewallRuleProtocolType `json:"protocol"`
 
 	// tcp defines an ingress node firewall rule for TCP protocol.
@@ -85,9 +98,20 @@ type IngressNodeProtocolConfig struct {
 	// +unionMember
 	// +optional
 	ICMPv6 *IngressNodeFirewallICMPRule `json:"icmpv6,omitempty"`
+
+	// ipProtocol defines an ingress node firewall rule for any IP protocol, such as VRRP (112), GRE (47), ESP (50) or
+	// OSPF (89). Packets are matched on the protocol field of the IPv4 header or the next header field of the IPv6
+	// header alone, IPv6 extension headers are not followed. TCP, UDP, SCTP, ICMP and ICMPv6 must use their own
+	// protocol type.
+	// +unionMember
+	// +optional
+	// +kubebuilder:validation:Maximum:=255
+	// +kubebuilder:validation:Minimum:=1
+	IPProtocol *uint8 `json:"ipProtocol,omitempty"`
 }
 
 // IngressNodeFirewallProtocolRule defines an ingress node firewall rule per protocol.
+// +kubebuilder:validation:XValidation:rule="!has(self.autoBan) || (has(self.action) && self.action == 'Deny')",message="autoBan is only allowed for rules with the Deny action"
 type IngressNodeFirewallProtocolRule struct {
 	// order defines the order of execution of ingress firewall rules.
 	// The minimum order value is 1 and the values must be unique.
@@ -96,7 +120,8 @@ type IngressNodeFirewallProtocolRule struct {
 	// +kubebuilder:validation:Minimum:=1
 	Order uint32 `json:"order"`
 
-	// protocolConfig is a discriminated union of a protocol's specific configuration for TCP, UDP, SCTP, ICMP and ICMPv6.
+	// protocolConfig is a discriminated union of a protocol's specific configuration for TCP, UDP, SCTP, ICMP, ICMPv6
+	// and other IP protocols.
 	// If not specified, packet matching will be based on the protocol value and protocol configuration, such as dstPort/type/code, will be ignored
 	// +optional
 	ProtocolConfig IngressNodeProtocolConfig `json:"protocolConfig"`
@@ -104,6 +129,49 @@ type IngressNodeFirewallProtocolRule struct {
 	// action can be Allow or Deny, default action is Allow.
 	// +optional
 	Action IngressNodeFirewallActionType `json:"action,omitempty"`
+
+	// schedule restricts the rule to recurring time windows. Outside of them, the rule is not applied to the nodes.
+	// +optional
+	Schedule *IngressNodeFirewallSchedule `json:"schedule,omitempty"`
+
+	// autoBan bans the sources from which the rule denies too many packets. All packets of a banned source are
+	// dropped on the interfaces of the node before any rule is evaluated. It requires the Deny action.
+	// +optional
+	AutoBan *IngressNodeFirewallAutoBan `json:"autoBan,omitempty"`
+}
+
+// IngressNodeFirewallAutoBan defines when a rule bans a source and for how long.
+type IngressNodeFirewallAutoBan struct {
+	// threshold is the number of packets that the rule denies from a source within period after which the source is
+	// banned.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Minimum:=1
+	Threshold uint32 `json:"threshold"`
+
+	// period is the duration in which denied packets are counted, such as 60s. It is rounded down to seconds.
+	// +kubebuilder:validation:Required
+	Period metav1.Duration `json:"period"`
+
+	// banDuration is how long a source stays banned, such as 10m. It is rounded down to seconds.
+	// +kubebuilder:validation:Required
+	BanDuration metav1.Duration `json:"banDuration"`
+}
+
+// IngressNodeFirewallSchedule defines recurring time windows during which a rule is applied.
+type IngressNodeFirewallSchedule struct {
+	// start is a cron expression with the fields minute, hour, day of month, month and day of week, such as
+	// "0 22 * * 1-5", at which each window opens.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength:=1
+	Start string `json:"start"`
+
+	// duration is how long each window stays open, such as 2h.
+	// +kubebuilder:validation:Required
+	Duration metav1.Duration `json:"duration"`
+
+	// timeZone is the IANA time zone in which start is evaluated, such as Europe/Paris. The default is UTC.
+	// +optional
+	TimeZone string `json:"timeZone,omitempty"`
 }
 
 // ProtocolType defines the protocol types that are supported
@@ -124,6 +192,9 @@ const (
 
 	// ProtocolTypeSCTP refers to the SCTP protocol, for either IPv4 or IPv6.
 	ProtocolTypeSCTP IngressNodeFirewallRuleProtocolType = "SCTP"
+
+	// ProtocolTypeIPProtocol refers to any IP protocol by number, for either IPv4 or IPv6.
+	ProtocolTypeIPProtocol IngressNodeFirewallRuleProtocolType = "IPProtocol"
 )
 
 // IngressNodeFirewallActionType indicates whether an IngressNodeFirewallRule allows or denies traffic.
@@ -135,15 +206,51 @@ const (
 	IngressNodeFirewallDeny  IngressNodeFirewallActionType = "Deny"
 )
 
+// IngressNodeFirewallClusterNetworkType defines the cluster networks that can be used as the origin of packets.
+// +kubebuilder:validation:Enum="PodNetwork";"ServiceNetwork"
+type IngressNodeFirewallClusterNetworkType string
+
+const (
+	// ClusterNetworkTypePod refers to the CIDRs that pod IP addresses are allocated from.
+	ClusterNetworkTypePod IngressNodeFirewallClusterNetworkType = "PodNetwork"
+
+	// ClusterNetworkTypeService refers to the CIDRs that service IP addresses are allocated from.
+	ClusterNetworkTypeService IngressNodeFirewallClusterNetworkType = "ServiceNetwork"
+)
+
 // IngressNodeFirewallRules define ingress node firewall rule.
+// +kubebuilder:validation:XValidation:rule="(has(self.sourceCIDRs) && size(self.sourceCIDRs) > 0) || (has(self.sourceAddressSetRefs) && size(self.sourceAddressSetRefs) > 0) || has(self.fromNodes) || (has(self.fromClusterNetworks) && size(self.fromClusterNetworks) > 0)",message="at least one of sourceCIDRs, sourceAddressSetRefs, fromNodes or fromClusterNetworks must be specified"
+// +kubebuilder:validation:XValidation:rule="!(has(self.expiresAt) && has(self.ttl))",message="expiresAt and ttl are mutually exclusive"
 type IngressNodeFirewallRules struct {
 	// sourceCIDRs defines the origin of packets that FirewallProtocolRules will be applied to.
-	// +kubebuilder:validation:MinItems:=1
-	SourceCIDRs []string `json:"sourceCIDRs"`
+	// +optional
+	SourceCIDRs []string `json:"sourceCIDRs,omitempty"`
+	// sourceAddressSetRefs is a list of IngressNodeFirewallAddressSet names. The CIDRs of the referenced address
+	// sets are added to sourceCIDRs when the rules are applied to the nodes.
+	// +optional
+	SourceAddressSetRefs []string `json:"sourceAddressSetRefs,omitempty"`
+	// fromNodes selects cluster nodes by label. The InternalIP and ExternalIP addresses of the selected nodes are
+	// added to sourceCIDRs and kept up to date when nodes join or leave the cluster. An empty selector selects all
+	// nodes.
+	// +optional
+	FromNodes *metav1.LabelSelector `json:"fromNodes,omitempty"`
+	// fromClusterNetworks is a list of cluster networks, PodNetwork and/or ServiceNetwork, whose CIDRs are added to
+	// sourceCIDRs.
+	// +optional
+	FromClusterNetworks []IngressNodeFirewallClusterNetworkType `json:"fromClusterNetworks,omitempty"`
 	// rules is a list of per protocol ingress node firewall rules.
 	// +listType:=map
 	// +listMapKey:=order
 	FirewallProtocolRules []IngressNodeFirewallProtocolRule `json:"rules,omitempty"`
+	// expiresAt is the time after which the rules are removed from the nodes. The expired rules remain in the
+	// IngressNodeFirewall until it is updated or deleted.
+	// +optional
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+	// ttl is the duration after which the rules are removed from the nodes, such as 1h. It counts from the time at
+	// which the operator first sees the ingress rules with their sources and ttl, as recorded in the ttlStarts of the
+	// status, so changing the sources or the ttl restarts it. It cannot be combined with expiresAt.
+	// +optional
+	TTL *metav1.Duration `json:"ttl,omitempty"`
 }
 
 // IngressNodeFirewallSpec defines the desired state of IngressNodeFirewall.
@@ -161,6 +268,16 @@ type IngressNodeFirewallSpec struct {
 	// +kubebuilder:validation:Required
 	// +kubebuilder:validation:MinItems:=1
 	Interfaces []string `json:"interfaces"`
+
+	// priority defines the evaluation order of the rules of this object relative to the rules of other
+	// IngressNodeFirewall objects that apply to the same node, interface and sourceCIDR. Rules of objects with a lower
+	// priority value are evaluated first. Within the same priority, rules are evaluated by their order, which must be
+	// unique. Rules of objects with different priorities may use the same order. The daemon reports the rules of
+	// objects with a priority above the lowest priority on a node under rule IDs that are offset by a multiple of
+	// 1024, the ruleOwners of the IngressNodeFirewallNodeState map the rule IDs to their objects.
+	// +optional
+	// +kubebuilder:validation:Minimum:=0
+	Priority int32 `json:"priority,omitempty"`
 }
 
 type IngressNodeFirewallSyncStatus string
@@ -175,6 +292,39 @@ var (
 // IngressNodeFirewallStatus defines the observed state of IngressNodeFirewall.
 type IngressNodeFirewallStatus struct {
 	SyncStatus IngressNodeFirewallSyncStatus `json:"syncStatus,omitempty"`
+	// expiredIngress lists the indices of the ingress rules that have expired and are no longer applied to the nodes.
+	// +optional
+	ExpiredIngress []int32 `json:"expiredIngress,omitempty"`
+	// nextExpiry is the time at which the next of the ingress rules that are applied to the nodes expires.
+	// +optional
+	NextExpiry *metav1.Time `json:"nextExpiry,omitempty"`
+	// scheduledRules reports whether each rule with a schedule is currently applied to the nodes.
+	// +optional
+	ScheduledRules []IngressNodeFirewallScheduledRuleStatus `json:"scheduledRules,omitempty"`
+	// ttlStarts records the times at which the ttl of the ingress rules with a ttl started.
+	// +optional
+	TTLStarts []IngressNodeFirewallTTLStart `json:"ttlStarts,omitempty"`
+}
+
+// IngressNodeFirewallTTLStart defines the time at which the ttl of ingress rules started.
+type IngressNodeFirewallTTLStart struct {
+	// ingress identifies the ingress rules by a hash of their sources and ttl.
+	Ingress string `json:"ingress"`
+	// startTime is the time at which the operator first saw the ingress rules.
+	StartTime metav1.Time `json:"startTime"`
+}
+
+// IngressNodeFirewallScheduledRuleStatus defines the observed state of a rule with a schedule.
+type IngressNodeFirewallScheduledRuleStatus struct {
+	// ingress is the index of the ingress rules that the rule belongs to.
+	Ingress int32 `json:"ingress"`
+	// order is the order of the rule.
+	Order uint32 `json:"order"`
+	// active is set when one of the windows of the rule is open and the rule is applied to the nodes.
+	Active bool `json:"active"`
+	// nextTransition is the time at which the rule is next applied to or removed from the nodes.
+	// +optional
+	NextTransition *metav1.Time `json:"nextTransition,omitempty"`
 }
 
 //+kubebuilder:object:root=true
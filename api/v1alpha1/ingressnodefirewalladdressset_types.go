@@ -0,0 +1,54 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// IngressNodeFirewallAddressSetSpec defines the desired state of IngressNodeFirewallAddressSet.
+type IngressNodeFirewallAddressSetSpec struct {
+	// cidrs is a list of IPv4 or IPv6 CIDRs that make up this address set.
+	// IngressNodeFirewall rules can reference the address set by name through sourceAddressSetRefs.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinItems:=1
+	CIDRs []string `json:"cidrs"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+
+// IngressNodeFirewallAddressSet is the Schema for the ingressnodefirewalladdresssets API.
+type IngressNodeFirewallAddressSet struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec IngressNodeFirewallAddressSetSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// IngressNodeFirewallAddressSetList contains a list of IngressNodeFirewallAddressSet.
+type IngressNodeFirewallAddressSetList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []IngressNodeFirewallAddressSet `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&IngressNodeFirewallAddressSet{}, &IngressNodeFirewallAddressSetList{})
+}
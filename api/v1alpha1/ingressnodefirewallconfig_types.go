@@ -31,6 +31,286 @@ type IngressNodeFirewallConfigSpec struct {
 	//+kubebuilder:default:=false
 	// +optional
 	Debug *bool `json:"debug,omitempty"`
+	// RuleInheritance makes packets that do not match any rule of the most specific sourceCIDR fall through to the
+	// rules of less specific sourceCIDRs on the same interface, instead of being allowed.
+	//+kubebuilder:default:=false
+	// +optional
+	RuleInheritance *bool `json:"ruleInheritance,omitempty"`
+	// AllowEssentialICMPv6 makes the daemon allow ICMPv6 neighbor discovery messages from link-local sources and
+	// ICMPv6 packet too big messages from all sources ahead of the rules of IPv6 sourceCIDRs, so that deny rules do
+	// not break IPv6 connectivity to the nodes. These built-in rules count against MaxRulesPerTarget.
+	//+kubebuilder:default:=false
+	// +optional
+	AllowEssentialICMPv6 *bool `json:"allowEssentialICMPv6,omitempty"`
+	// MaxTargets is the maximum number of source CIDR and interface combinations that can be programmed on each
+	// node. Every slave of a bond interface counts as a separate interface.
+	//+kubebuilder:default:=1024
+	//+kubebuilder:validation:Minimum:=1
+	//+kubebuilder:validation:Maximum:=65536
+	// +optional
+	MaxTargets *int32 `json:"maxTargets,omitempty"`
+	// MaxRulesPerTarget is the maximum number of rules that can be programmed for a single source CIDR and
+	// interface, including inherited rules.
+	//+kubebuilder:default:=100
+	//+kubebuilder:validation:Minimum:=1
+	//+kubebuilder:validation:Maximum:=1024
+	// +optional
+	MaxRulesPerTarget *int32 `json:"maxRulesPerTarget,omitempty"`
+	// RuleAnalysis selects what the admission webhook does with rules of an IngressNodeFirewall that never match
+	// because earlier rules of the same sourceCIDRs match all of their packets, or that partially overlap an earlier
+	// rule with the opposite action. Warn admits the IngressNodeFirewall with warnings, Reject rejects it.
+	//+kubebuilder:default:=Warn
+	// +optional
+	RuleAnalysis RuleAnalysisMode `json:"ruleAnalysis,omitempty"`
+	// Blocklist is a list of source addresses and CIDRs whose packets are dropped on every interface that the
+	// firewall is attached to, before the rules are evaluated. It is kept in a separate eBPF map so that it can hold
+	// large threat intelligence lists, and changes of the list are applied incrementally.
+	// +optional
+	Blocklist *IngressNodeFirewallBlocklist `json:"blocklist,omitempty"`
+	// Capture makes the daemons capture the headers of the packets that generate deny events in pcapng format,
+	// with the rule ID in the comment of each packet, so that drops can be opened in Wireshark or tcpdump.
+	// +optional
+	Capture *IngressNodeFirewallCapture `json:"capture,omitempty"`
+	// Events limits the events that the eBPF program generates for denied packets, so that floods of denied packets
+	// do not saturate the events buffer, the daemons and syslog. Events that were not generated are counted in the
+	// statistics. Events of packets that make a rule with autoBan ban their source are always generated.
+	// +optional
+	Events *IngressNodeFirewallEvents `json:"events,omitempty"`
+	// DropReports makes the daemons publish periodic summaries of the packets that the rules deny as Kubernetes
+	// Events on the IngressNodeFirewalls that own the rules, and optionally as a PolicyReport per node.
+	// +optional
+	DropReports *IngressNodeFirewallDropReports `json:"dropReports,omitempty"`
+}
+
+// IngressNodeFirewallEvents configures the sampling and the rate limit of the events of denied packets.
+type IngressNodeFirewallEvents struct {
+	// SampleRate makes the eBPF program generate an event for one in SampleRate denied packets, chosen at random.
+	//+kubebuilder:default:=1
+	//+kubebuilder:validation:Minimum:=1
+	//+kubebuilder:validation:Maximum:=65536
+	// +optional
+	SampleRate int32 `json:"sampleRate,omitempty"`
+	// MaxEventsPerSecond is the maximum number of events that the eBPF program generates per second on each node,
+	// with bursts of up to one second worth of events. Events are not rate limited if it is not set.
+	//+kubebuilder:validation:Minimum:=1
+	//+kubebuilder:validation:Maximum:=1000000
+	// +optional
+	MaxEventsPerSecond int32 `json:"maxEventsPerSecond,omitempty"`
+	// AggregationWindowSeconds is the duration of the window over which the daemons aggregate the events of the
+	// same interface, rule, source address, protocol and destination port in syslog. The first event is logged
+	// immediately and the repeated events are logged as a single summary at the end of the window. Events are not
+	// aggregated if it is 0.
+	//+kubebuilder:default:=10
+	//+kubebuilder:validation:Minimum:=0
+	//+kubebuilder:validation:Maximum:=3600
+	// +optional
+	AggregationWindowSeconds *int32 `json:"aggregationWindowSeconds,omitempty"`
+}
+
+const (
+	// DefaultEventAggregationWindowSeconds is the duration of the window over which events are aggregated if
+	// AggregationWindowSeconds is not set.
+	DefaultEventAggregationWindowSeconds = 10
+)
+
+// GetSampleRate returns SampleRate or 1 if SampleRate is not set.
+func (e *IngressNodeFirewallEvents) GetSampleRate() int {
+	if e.SampleRate == 0 {
+		return 1
+	}
+	return int(e.SampleRate)
+}
+
+// GetAggregationWindowSeconds returns AggregationWindowSeconds or DefaultEventAggregationWindowSeconds if
+// AggregationWindowSeconds is not set.
+func (e *IngressNodeFirewallEvents) GetAggregationWindowSeconds() int {
+	if e.AggregationWindowSeconds == nil {
+		return DefaultEventAggregationWindowSeconds
+	}
+	return int(*e.AggregationWindowSeconds)
+}
+
+// IngressNodeFirewallDropReports configures the summaries of denied packets that the daemons publish to the
+// Kubernetes API.
+type IngressNodeFirewallDropReports struct {
+	// IntervalSeconds is the period at which each daemon summarizes the denied packets of its node.
+	//+kubebuilder:default:=60
+	//+kubebuilder:validation:Minimum:=10
+	//+kubebuilder:validation:Maximum:=3600
+	// +optional
+	IntervalSeconds int32 `json:"intervalSeconds,omitempty"`
+	// MaxEvents is the maximum number of Kubernetes Events that each daemon creates per interval, for the
+	// interfaces, rules, sources, protocols and destination ports with the most denied packets.
+	//+kubebuilder:default:=10
+	//+kubebuilder:validation:Minimum:=1
+	//+kubebuilder:validation:Maximum:=100
+	// +optional
+	MaxEvents int32 `json:"maxEvents,omitempty"`
+	// PolicyReport makes each daemon publish the summaries of its node as a PolicyReport of the wgpolicyk8s.io API
+	// in the namespace of the operator. The PolicyReport CRD must be installed.
+	// +optional
+	PolicyReport bool `json:"policyReport,omitempty"`
+}
+
+const (
+	// DefaultDropReportIntervalSeconds is the period of the drop reports if IntervalSeconds is not set.
+	DefaultDropReportIntervalSeconds = 60
+	// DefaultDropReportMaxEvents is the number of Kubernetes Events per interval if MaxEvents is not set.
+	DefaultDropReportMaxEvents = 10
+)
+
+// GetIntervalSeconds returns IntervalSeconds or DefaultDropReportIntervalSeconds if IntervalSeconds is not set.
+func (d *IngressNodeFirewallDropReports) GetIntervalSeconds() int {
+	if d.IntervalSeconds == 0 {
+		return DefaultDropReportIntervalSeconds
+	}
+	return int(d.IntervalSeconds)
+}
+
+// GetMaxEvents returns MaxEvents or DefaultDropReportMaxEvents if MaxEvents is not set.
+func (d *IngressNodeFirewallDropReports) GetMaxEvents() int {
+	if d.MaxEvents == 0 {
+		return DefaultDropReportMaxEvents
+	}
+	return int(d.MaxEvents)
+}
+
+// IngressNodeFirewallBlocklist references a plaintext list with one IP address or CIDR per line. Empty lines and
+// everything after a # are ignored.
+// +kubebuilder:validation:XValidation:rule="has(self.configMapName) != has(self.hostPath)",message="exactly one of configMapName and hostPath must be set"
+type IngressNodeFirewallBlocklist struct {
+	// ConfigMapName is the name of a ConfigMap in the namespace of the operator that holds the list.
+	// +optional
+	ConfigMapName string `json:"configMapName,omitempty"`
+	// Key is the key of the list in the ConfigMap.
+	//+kubebuilder:default:=blocklist
+	// +optional
+	Key string `json:"key,omitempty"`
+	// HostPath is the absolute path of a file on the nodes that holds the list, for lists that exceed the size
+	// limit of ConfigMaps.
+	//+kubebuilder:validation:Pattern=`^/.*[^/]$`
+	// +optional
+	HostPath string `json:"hostPath,omitempty"`
+}
+
+const (
+	// DefaultBlocklistKey is the key of the blocklist in its ConfigMap if Key is not set.
+	DefaultBlocklistKey = "blocklist"
+)
+
+// GetKey returns Key or DefaultBlocklistKey if Key is not set.
+func (b *IngressNodeFirewallBlocklist) GetKey() string {
+	if b.Key == "" {
+		return DefaultBlocklistKey
+	}
+	return b.Key
+}
+
+// CaptureMode selects where the daemons write the captured packets.
+// +kubebuilder:validation:Enum=File;Stream
+type CaptureMode string
+
+const (
+	// CaptureModeFile writes the captured packets to rotating pcapng files in a directory on the nodes.
+	CaptureModeFile CaptureMode = "File"
+	// CaptureModeStream streams the captured packets in pcapng format to the clients of the /debug/capture endpoint
+	// of the metrics port of the daemons.
+	CaptureModeStream CaptureMode = "Stream"
+)
+
+// IngressNodeFirewallCapture configures the capture of the packets that generate deny events. Events carry up to the
+// first 256 bytes of each packet.
+type IngressNodeFirewallCapture struct {
+	// Mode selects whether the packets are written to files on the nodes or streamed over HTTP.
+	Mode CaptureMode `json:"mode"`
+	// HostPath is the absolute path of the directory on the nodes into which the pcapng files are written in File
+	// mode.
+	//+kubebuilder:default:=/var/log/ingress-node-firewall
+	//+kubebuilder:validation:Pattern=`^/.*[^/]$`
+	// +optional
+	HostPath string `json:"hostPath,omitempty"`
+	// MaxFileSizeMiB is the size in MiB at which a pcapng file is closed and a new file is started in File mode.
+	//+kubebuilder:default:=10
+	//+kubebuilder:validation:Minimum:=1
+	//+kubebuilder:validation:Maximum:=1024
+	// +optional
+	MaxFileSizeMiB int32 `json:"maxFileSizeMiB,omitempty"`
+	// MaxFiles is the number of pcapng files that are kept in File mode, the oldest file is removed when a new file
+	// is started.
+	//+kubebuilder:default:=5
+	//+kubebuilder:validation:Minimum:=1
+	//+kubebuilder:validation:Maximum:=100
+	// +optional
+	MaxFiles int32 `json:"maxFiles,omitempty"`
+}
+
+const (
+	// DefaultCaptureHostPath is the directory of the pcapng files if HostPath is not set.
+	DefaultCaptureHostPath = "/var/log/ingress-node-firewall"
+	// DefaultCaptureMaxFileSizeMiB is the size at which a pcapng file is rotated if MaxFileSizeMiB is not set.
+	DefaultCaptureMaxFileSizeMiB = 10
+	// DefaultCaptureMaxFiles is the number of pcapng files that are kept if MaxFiles is not set.
+	DefaultCaptureMaxFiles = 5
+)
+
+// GetHostPath returns HostPath or DefaultCaptureHostPath if HostPath is not set.
+func (c *IngressNodeFirewallCapture) GetHostPath() string {
+	if c.HostPath == "" {
+		return DefaultCaptureHostPath
+	}
+	return c.HostPath
+}
+
+// GetMaxFileSizeMiB returns MaxFileSizeMiB or DefaultCaptureMaxFileSizeMiB if MaxFileSizeMiB is not set.
+func (c *IngressNodeFirewallCapture) GetMaxFileSizeMiB() int {
+	if c.MaxFileSizeMiB == 0 {
+		return DefaultCaptureMaxFileSizeMiB
+	}
+	return int(c.MaxFileSizeMiB)
+}
+
+// GetMaxFiles returns MaxFiles or DefaultCaptureMaxFiles if MaxFiles is not set.
+func (c *IngressNodeFirewallCapture) GetMaxFiles() int {
+	if c.MaxFiles == 0 {
+		return DefaultCaptureMaxFiles
+	}
+	return int(c.MaxFiles)
+}
+
+// RuleAnalysisMode selects what the admission webhook does with shadowed, redundant and conflicting rules.
+// +kubebuilder:validation:Enum=Warn;Reject
+type RuleAnalysisMode string
+
+const (
+	// RuleAnalysisWarn admits IngressNodeFirewalls with shadowed, redundant or conflicting rules with warnings.
+	RuleAnalysisWarn RuleAnalysisMode = "Warn"
+	// RuleAnalysisReject rejects IngressNodeFirewalls with shadowed, redundant or conflicting rules.
+	RuleAnalysisReject RuleAnalysisMode = "Reject"
+)
+
+const (
+	// DefaultMaxTargets is the number of source CIDR and interface combinations that can be programmed on each node
+	// if MaxTargets is not set.
+	DefaultMaxTargets = 1024
+	// DefaultMaxRulesPerTarget is the number of rules per source CIDR and interface that can be programmed if
+	// MaxRulesPerTarget is not set.
+	DefaultMaxRulesPerTarget = 100
+)
+
+// GetMaxTargets returns MaxTargets or DefaultMaxTargets if MaxTargets is not set.
+func (s *IngressNodeFirewallConfigSpec) GetMaxTargets() int {
+	if s.MaxTargets == nil {
+		return DefaultMaxTargets
+	}
+	return int(*s.MaxTargets)
+}
+
+// GetMaxRulesPerTarget returns MaxRulesPerTarget or DefaultMaxRulesPerTarget if MaxRulesPerTarget is not set.
+func (s *IngressNodeFirewallConfigSpec) GetMaxRulesPerTarget() int {
+	if s.MaxRulesPerTarget == nil {
+		return DefaultMaxRulesPerTarget
+	}
+	return int(*s.MaxRulesPerTarget)
 }
 
 // IngressNodeFirewallConfigStatus defines the observed state of IngressNodeFirewallConfig.
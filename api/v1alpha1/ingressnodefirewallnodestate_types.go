@@ -29,6 +29,26 @@ type IngressNodeFirewallNodeStateSpec struct {
 	// An empty map indicates no ingress firewall rules shall be applied, i.e allow all incoming traffic.
 	// +kubebuilder:validation:Required
 	InterfaceIngressRules map[string][]IngressNodeFirewallRules `json:"interfaceIngressRules"`
+	// ruleOwners maps the rules of interfaceIngressRules to the IngressNodeFirewalls that the rules originate from.
+	// The rule ID of a rule is its order in interfaceIngressRules, which the daemon reports in the rule statistics and
+	// in the events of denied packets.
+	// +optional
+	RuleOwners []IngressNodeFirewallRuleOwner `json:"ruleOwners,omitempty"`
+}
+
+// IngressNodeFirewallRuleOwner is the IngressNodeFirewall that a rule of an IngressNodeFirewallNodeState originates
+// from.
+type IngressNodeFirewallRuleOwner struct {
+	// interface is the interface of the rule in the IngressNodeFirewallNodeState.
+	Interface string `json:"interface"`
+	// sourceCIDR is the source CIDR of the rule in the IngressNodeFirewallNodeState.
+	SourceCIDR string `json:"sourceCIDR"`
+	// ruleID is the order of the rule in the IngressNodeFirewallNodeState.
+	RuleID uint32 `json:"ruleID"`
+	// firewall is the name of the IngressNodeFirewall that defines the rule.
+	Firewall string `json:"firewall"`
+	// order is the order of the rule in the IngressNodeFirewall.
+	Order uint32 `json:"order"`
 }
 
 // IngressNodeFirewallNodeStateStatus defines the observed state of IngressNodeFirewallNodeState.
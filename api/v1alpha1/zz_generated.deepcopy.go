@@ -32,7 +32,7 @@ func (in *IngressNodeFirewall) DeepCopyInto(out *IngressNodeFirewall) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IngressNodeFirewall.
@@ -53,6 +53,131 @@ func (in *IngressNodeFirewall) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IngressNodeFirewallAddressSet) DeepCopyInto(out *IngressNodeFirewallAddressSet) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IngressNodeFirewallAddressSet.
+func (in *IngressNodeFirewallAddressSet) DeepCopy() *IngressNodeFirewallAddressSet {
+	if in == nil {
+		return nil
+	}
+	out := new(IngressNodeFirewallAddressSet)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *IngressNodeFirewallAddressSet) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IngressNodeFirewallAddressSetList) DeepCopyInto(out *IngressNodeFirewallAddressSetList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]IngressNodeFirewallAddressSet, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IngressNodeFirewallAddressSetList.
+func (in *IngressNodeFirewallAddressSetList) DeepCopy() *IngressNodeFirewallAddressSetList {
+	if in == nil {
+		return nil
+	}
+	out := new(IngressNodeFirewallAddressSetList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *IngressNodeFirewallAddressSetList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IngressNodeFirewallAddressSetSpec) DeepCopyInto(out *IngressNodeFirewallAddressSetSpec) {
+	*out = *in
+	if in.CIDRs != nil {
+		in, out := &in.CIDRs, &out.CIDRs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IngressNodeFirewallAddressSetSpec.
+func (in *IngressNodeFirewallAddressSetSpec) DeepCopy() *IngressNodeFirewallAddressSetSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(IngressNodeFirewallAddressSetSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IngressNodeFirewallAutoBan) DeepCopyInto(out *IngressNodeFirewallAutoBan) {
+	*out = *in
+	out.Period = in.Period
+	out.BanDuration = in.BanDuration
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IngressNodeFirewallAutoBan.
+func (in *IngressNodeFirewallAutoBan) DeepCopy() *IngressNodeFirewallAutoBan {
+	if in == nil {
+		return nil
+	}
+	out := new(IngressNodeFirewallAutoBan)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IngressNodeFirewallBlocklist) DeepCopyInto(out *IngressNodeFirewallBlocklist) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IngressNodeFirewallBlocklist.
+func (in *IngressNodeFirewallBlocklist) DeepCopy() *IngressNodeFirewallBlocklist {
+	if in == nil {
+		return nil
+	}
+	out := new(IngressNodeFirewallBlocklist)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IngressNodeFirewallCapture) DeepCopyInto(out *IngressNodeFirewallCapture) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IngressNodeFirewallCapture.
+func (in *IngressNodeFirewallCapture) DeepCopy() *IngressNodeFirewallCapture {
+	if in == nil {
+		return nil
+	}
+	out := new(IngressNodeFirewallCapture)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IngressNodeFirewallConfig) DeepCopyInto(out *IngressNodeFirewallConfig) {
 	*out = *in
@@ -127,6 +252,46 @@ func (in *IngressNodeFirewallConfigSpec) DeepCopyInto(out *IngressNodeFirewallCo
 		*out = new(bool)
 		**out = **in
 	}
+	if in.RuleInheritance != nil {
+		in, out := &in.RuleInheritance, &out.RuleInheritance
+		*out = new(bool)
+		**out = **in
+	}
+	if in.AllowEssentialICMPv6 != nil {
+		in, out := &in.AllowEssentialICMPv6, &out.AllowEssentialICMPv6
+		*out = new(bool)
+		**out = **in
+	}
+	if in.MaxTargets != nil {
+		in, out := &in.MaxTargets, &out.MaxTargets
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxRulesPerTarget != nil {
+		in, out := &in.MaxRulesPerTarget, &out.MaxRulesPerTarget
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Blocklist != nil {
+		in, out := &in.Blocklist, &out.Blocklist
+		*out = new(IngressNodeFirewallBlocklist)
+		**out = **in
+	}
+	if in.Capture != nil {
+		in, out := &in.Capture, &out.Capture
+		*out = new(IngressNodeFirewallCapture)
+		**out = **in
+	}
+	if in.Events != nil {
+		in, out := &in.Events, &out.Events
+		*out = new(IngressNodeFirewallEvents)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DropReports != nil {
+		in, out := &in.DropReports, &out.DropReports
+		*out = new(IngressNodeFirewallDropReports)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IngressNodeFirewallConfigSpec.
@@ -176,6 +341,41 @@ func (in *IngressNodeFirewallICMPRule) DeepCopy() *IngressNodeFirewallICMPRule {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IngressNodeFirewallDropReports) DeepCopyInto(out *IngressNodeFirewallDropReports) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IngressNodeFirewallDropReports.
+func (in *IngressNodeFirewallDropReports) DeepCopy() *IngressNodeFirewallDropReports {
+	if in == nil {
+		return nil
+	}
+	out := new(IngressNodeFirewallDropReports)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IngressNodeFirewallEvents) DeepCopyInto(out *IngressNodeFirewallEvents) {
+	*out = *in
+	if in.AggregationWindowSeconds != nil {
+		in, out := &in.AggregationWindowSeconds, &out.AggregationWindowSeconds
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IngressNodeFirewallEvents.
+func (in *IngressNodeFirewallEvents) DeepCopy() *IngressNodeFirewallEvents {
+	if in == nil {
+		return nil
+	}
+	out := new(IngressNodeFirewallEvents)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IngressNodeFirewallList) DeepCopyInto(out *IngressNodeFirewallList) {
 	*out = *in
@@ -287,6 +487,11 @@ func (in *IngressNodeFirewallNodeStateSpec) DeepCopyInto(out *IngressNodeFirewal
 			(*out)[key] = outVal
 		}
 	}
+	if in.RuleOwners != nil {
+		in, out := &in.RuleOwners, &out.RuleOwners
+		*out = make([]IngressNodeFirewallRuleOwner, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IngressNodeFirewallNodeStateSpec.
@@ -334,6 +539,16 @@ func (in *IngressNodeFirewallProtoRule) DeepCopy() *IngressNodeFirewallProtoRule
 func (in *IngressNodeFirewallProtocolRule) DeepCopyInto(out *IngressNodeFirewallProtocolRule) {
 	*out = *in
 	in.ProtocolConfig.DeepCopyInto(&out.ProtocolConfig)
+	if in.Schedule != nil {
+		in, out := &in.Schedule, &out.Schedule
+		*out = new(IngressNodeFirewallSchedule)
+		**out = **in
+	}
+	if in.AutoBan != nil {
+		in, out := &in.AutoBan, &out.AutoBan
+		*out = new(IngressNodeFirewallAutoBan)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IngressNodeFirewallProtocolRule.
@@ -346,6 +561,21 @@ func (in *IngressNodeFirewallProtocolRule) DeepCopy() *IngressNodeFirewallProtoc
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IngressNodeFirewallRuleOwner) DeepCopyInto(out *IngressNodeFirewallRuleOwner) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IngressNodeFirewallRuleOwner.
+func (in *IngressNodeFirewallRuleOwner) DeepCopy() *IngressNodeFirewallRuleOwner {
+	if in == nil {
+		return nil
+	}
+	out := new(IngressNodeFirewallRuleOwner)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IngressNodeFirewallRules) DeepCopyInto(out *IngressNodeFirewallRules) {
 	*out = *in
@@ -354,6 +584,21 @@ func (in *IngressNodeFirewallRules) DeepCopyInto(out *IngressNodeFirewallRules)
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.SourceAddressSetRefs != nil {
+		in, out := &in.SourceAddressSetRefs, &out.SourceAddressSetRefs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.FromNodes != nil {
+		in, out := &in.FromNodes, &out.FromNodes
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.FromClusterNetworks != nil {
+		in, out := &in.FromClusterNetworks, &out.FromClusterNetworks
+		*out = make([]IngressNodeFirewallClusterNetworkType, len(*in))
+		copy(*out, *in)
+	}
 	if in.FirewallProtocolRules != nil {
 		in, out := &in.FirewallProtocolRules, &out.FirewallProtocolRules
 		*out = make([]IngressNodeFirewallProtocolRule, len(*in))
@@ -361,6 +606,15 @@ func (in *IngressNodeFirewallRules) DeepCopyInto(out *IngressNodeFirewallRules)
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.ExpiresAt != nil {
+		in, out := &in.ExpiresAt, &out.ExpiresAt
+		*out = (*in).DeepCopy()
+	}
+	if in.TTL != nil {
+		in, out := &in.TTL, &out.TTL
+		*out = new(v1.Duration)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IngressNodeFirewallRules.
@@ -373,6 +627,41 @@ func (in *IngressNodeFirewallRules) DeepCopy() *IngressNodeFirewallRules {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IngressNodeFirewallSchedule) DeepCopyInto(out *IngressNodeFirewallSchedule) {
+	*out = *in
+	out.Duration = in.Duration
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IngressNodeFirewallSchedule.
+func (in *IngressNodeFirewallSchedule) DeepCopy() *IngressNodeFirewallSchedule {
+	if in == nil {
+		return nil
+	}
+	out := new(IngressNodeFirewallSchedule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IngressNodeFirewallScheduledRuleStatus) DeepCopyInto(out *IngressNodeFirewallScheduledRuleStatus) {
+	*out = *in
+	if in.NextTransition != nil {
+		in, out := &in.NextTransition, &out.NextTransition
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IngressNodeFirewallScheduledRuleStatus.
+func (in *IngressNodeFirewallScheduledRuleStatus) DeepCopy() *IngressNodeFirewallScheduledRuleStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(IngressNodeFirewallScheduledRuleStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IngressNodeFirewallSpec) DeepCopyInto(out *IngressNodeFirewallSpec) {
 	*out = *in
@@ -404,6 +693,29 @@ func (in *IngressNodeFirewallSpec) DeepCopy() *IngressNodeFirewallSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IngressNodeFirewallStatus) DeepCopyInto(out *IngressNodeFirewallStatus) {
 	*out = *in
+	if in.ExpiredIngress != nil {
+		in, out := &in.ExpiredIngress, &out.ExpiredIngress
+		*out = make([]int32, len(*in))
+		copy(*out, *in)
+	}
+	if in.NextExpiry != nil {
+		in, out := &in.NextExpiry, &out.NextExpiry
+		*out = (*in).DeepCopy()
+	}
+	if in.ScheduledRules != nil {
+		in, out := &in.ScheduledRules, &out.ScheduledRules
+		*out = make([]IngressNodeFirewallScheduledRuleStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.TTLStarts != nil {
+		in, out := &in.TTLStarts, &out.TTLStarts
+		*out = make([]IngressNodeFirewallTTLStart, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IngressNodeFirewallStatus.
@@ -416,6 +728,22 @@ func (in *IngressNodeFirewallStatus) DeepCopy() *IngressNodeFirewallStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IngressNodeFirewallTTLStart) DeepCopyInto(out *IngressNodeFirewallTTLStart) {
+	*out = *in
+	in.StartTime.DeepCopyInto(&out.StartTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IngressNodeFirewallTTLStart.
+func (in *IngressNodeFirewallTTLStart) DeepCopy() *IngressNodeFirewallTTLStart {
+	if in == nil {
+		return nil
+	}
+	out := new(IngressNodeFirewallTTLStart)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IngressNodeProtocolConfig) DeepCopyInto(out *IngressNodeProtocolConfig) {
 	*out = *in
@@ -437,11 +765,16 @@ func (in *IngressNodeProtocolConfig) DeepCopyInto(out *IngressNodeProtocolConfig
 	if in.ICMP != nil {
 		in, out := &in.ICMP, &out.ICMP
 		*out = new(IngressNodeFirewallICMPRule)
-		**out = **in
+		(*in).DeepCopyInto(*out)
 	}
 	if in.ICMPv6 != nil {
 		in, out := &in.ICMPv6, &out.ICMPv6
 		*out = new(IngressNodeFirewallICMPRule)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.IPProtocol != nil {
+		in, out := &in.IPProtocol, &out.IPProtocol
+		*out = new(uint8)
 		**out = **in
 	}
 }
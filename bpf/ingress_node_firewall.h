@@ -10,10 +10,36 @@
 #define UNDEF XDP_ABORTED
 #define DENY XDP_DROP
 #define ALLOW XDP_PASS
+// MAX_TARGETS and MAX_RULES_PER_TARGET are the default map sizes. User space
+// resizes the maps at load time through the map specs' max_entries.
 #define MAX_TARGETS (1024)
 #define MAX_RULES_PER_TARGET (100)
+// MAX_RULES_PER_TARGET_LIMIT bounds the rules loop for the verifier and is the
+// upper limit of the configurable number of rules per target.
+#define MAX_RULES_PER_TARGET_LIMIT (1024)
 #define MAX_EVENT_DATA 256
+// MAX_FAILSAFE_PORTS is the number of fail safe TCP and UDP ports that user
+// space can set.
+#define MAX_FAILSAFE_PORTS (8)
 #define INVALID_RULE_ID 0
+// MAX_BANNED_SOURCES is the size of the ban map, the least recently used bans
+// are evicted when it is full. MAX_BAN_COUNTERS is the size of the map that
+// counts the denied packets of sources for rules with autoBan.
+#define MAX_BANNED_SOURCES (16384)
+#define MAX_BAN_COUNTERS (65536)
+#define NSEC_PER_SEC (1000000000ULL)
+// MAX_BLOCKLIST_ENTRIES is the number of source addresses and CIDRs that the
+// blocklist map can hold.
+#define MAX_BLOCKLIST_ENTRIES (262144)
+// MAX_SOURCE_STATISTICS is the size of the map that counts the denied packets
+// of each source per interface, the least recently used sources are evicted
+// when it is full.
+#define MAX_SOURCE_STATISTICS (65536)
+
+// Flags of event_hdr_st.
+#define EVENT_FLAG_SOURCE_BANNED (1) // the packet was dropped because its source is banned
+#define EVENT_FLAG_BAN_STARTED (2)   // the packet made the rule ban its source
+#define EVENT_FLAG_BLOCKLISTED (4)   // the packet was dropped because its source is in the blocklist
 
 #define GET_ACTION(a) (__u8)((a)&0xFF)
 #define SET_ACTION(a) (__u32)(((__u32)a) & 0xFF)
@@ -51,6 +77,12 @@ struct ruleStatistics_st {
         __u64 packets;
         __u64 bytes;
     } deny_stats;
+    // events of the rule that were not generated because of event sampling
+    // or the event rate limit.
+    struct event_stats_st {
+        __u64 sampledOut;
+        __u64 rateLimited;
+    } event_stats;
 };
 // Force emitting struct ruleStatistics_st into the ELF.
 const struct ruleStatistics_st *unused3 __attribute__((unused));
@@ -59,21 +91,34 @@ struct event_hdr_st {
     __u16 ifId;
     __u16 ruleId;
     __u8 action;
-    __u8 pad;
+    __u8 flags;
     __u16 pktLength;
 } __attribute__((packed));
 
 // Force emitting struct event_hdr_st into the ELF.
 const struct event_hdr_st *unused1 __attribute__((unused));
 
+// autoBan_st bans the sources from which a deny rule drops threshold packets
+// within period seconds for duration seconds. A threshold of 0 disables it.
+struct autoBan_st {
+    __u32 threshold;
+    __u32 period;
+    __u32 duration;
+} __attribute__((packed));
+// Force emitting struct autoBan_st into the ELF.
+const struct autoBan_st *unused4 __attribute__((unused));
+
 struct ruleType_st {
     __u32 ruleId;
     __u8 protocol;
     __u16 dstPortStart;
     __u16 dstPortEnd;
     __u8 icmpType;
+    __u8 icmpTypeEnd; // last ICMP type of a range of types, 0 for a single type
     __u8 icmpCode;
+    __u8 icmpAnyCode; // 1 if the rule matches every ICMP code
     __u8 action;
+    struct autoBan_st autoBan;
 } __attribute__((packed));
 // Force emitting struct ruleType_st into the ELF.
 const struct ruleType_st *unused2 __attribute__((unused));
@@ -86,9 +131,92 @@ struct lpm_ip_key_st {
     __u8 ip_data[16];
 } __attribute__((packed));
 
+// rulesVal_st references the rules of a target. The rules are stored in
+// ingress_node_firewall_rules_map with keys {rulesId, 0} to
+// {rulesId, numRules - 1} and are evaluated in this order.
 struct rulesVal_st {
-    struct ruleType_st rules[MAX_RULES_PER_TARGET];
+    __u32 rulesId;
+    __u32 numRules;
+} __attribute__((packed));
+
+struct ruleKey_st {
+    __u32 rulesId;
+    __u32 index;
+} __attribute__((packed));
+
+// classKey_st is the key of the rule classifier. The classifier holds the
+// first matching rule of a target for each protocol and destination port, or
+// protocol and ICMP type and code. A prefix that ends within the ICMP type or
+// at the end of the type matches several types or every code of a type. User space compiles the rules of a target
+// into prefixes of this key. A prefix that only covers the rulesId matches
+// every packet.
+struct classKey_st {
+    __u32 prefixLen;
+    __u32 rulesId;
+    __u8 protocol;
+    __u8 data[2]; // destination port in network byte order or ICMP type and code
+} __attribute__((packed));
+
+#define CLASS_KEY_RULES_ID_PREFIX_LEN (32) // rulesId
+#define CLASS_KEY_MAX_PREFIX_LEN (56) // rulesId + protocol + data
+
+struct classVal_st {
+    __u32 ruleId;
+    __u8 action;
+    struct autoBan_st autoBan;
+} __attribute__((packed));
+
+// banKey_st is the address of a banned source, IPv4 addresses are stored as
+// IPv4-mapped IPv6 addresses.
+struct banKey_st {
+    __u8 ip_data[16];
+} __attribute__((packed));
+
+struct banVal_st {
+    __u64 expires; // bpf_ktime_get_ns() at which the ban ends
+    __u32 ruleId;  // rule that banned the source
 } __attribute__((packed));
 
+// banCounterKey_st counts the packets that a rule with autoBan denied from a
+// source.
+struct banCounterKey_st {
+    __u8 ip_data[16];
+    __u32 ruleId;
+} __attribute__((packed));
+
+struct banCounterVal_st {
+    __u64 periodStart; // bpf_ktime_get_ns() at which counting started
+    __u32 packets;
+};
+
+// blocklistKey_st is a blocklisted source address or CIDR, IPv4 addresses are
+// stored as IPv4-mapped IPv6 addresses so that prefixLen of IPv4 CIDRs is the
+// CIDR prefix length plus 96.
+struct blocklistKey_st {
+    __u32 prefixLen;
+    __u8 ip_data[16];
+} __attribute__((packed));
+
+// eventRateLimit_st is the token bucket that limits the number of events per
+// second. A token is worth NSEC_PER_SEC so that refilling the bucket does not
+// need a division.
+struct eventRateLimit_st {
+    struct bpf_spin_lock lock;
+    __u64 tokens;
+    __u64 lastRefill; // bpf_ktime_get_ns() at which the bucket was last refilled
+};
+
+// sourceStatisticsKey_st counts the packets that were denied from a source on
+// an interface, IPv4 addresses are stored as IPv4-mapped IPv6 addresses.
+struct sourceStatisticsKey_st {
+    __u32 ifId;
+    __u8 ip_data[16];
+} __attribute__((packed));
+
+struct sourceStatisticsVal_st {
+    __u64 packets;
+    __u64 bytes;
+};
+
 
 #endif
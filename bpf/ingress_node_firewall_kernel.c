@@ -56,6 +56,105 @@ struct {
     __uint(pinning, LIBBPF_PIN_BY_NAME);
 } ingress_node_firewall_table_map SEC(".maps");
 
+/*
+ * ingress_node_firewall_rules_map: is hash map type
+ * key is the rules id of a target and the index of the rule.
+ * lookup returns the rule to evaluate at that index.
+ * Note: this map is pinned to specific path in bpffs and user space sizes it to hold the rules of all targets
+ * while the rules of one target are being replaced.
+ */
+struct {
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __type(key, struct ruleKey_st);
+    __type(value, struct ruleType_st);
+    __uint(max_entries, (MAX_TARGETS + 1) * MAX_RULES_PER_TARGET);
+    __uint(map_flags, BPF_F_NO_PREALLOC);
+    __uint(pinning, LIBBPF_PIN_BY_NAME);
+} ingress_node_firewall_rules_map SEC(".maps");
+
+/*
+ * ingress_node_firewall_classifier_map: is LPM trie map type
+ * key is the rules id of a target, the protocol and the destination port or ICMP type and code.
+ * lookup returns the rule id and action of the first rule of the target that matches the packet, so that the
+ * lookup cost does not depend on the number of rules.
+ * Note: this map is pinned to specific path in bpffs and user space sizes it.
+ */
+struct {
+    __uint(type, BPF_MAP_TYPE_LPM_TRIE);
+    __type(key, struct classKey_st);
+    __type(value, struct classVal_st);
+    __uint(max_entries, (MAX_TARGETS + 1) * MAX_RULES_PER_TARGET);
+    __uint(map_flags, BPF_F_NO_PREALLOC);
+    __uint(pinning, LIBBPF_PIN_BY_NAME);
+} ingress_node_firewall_classifier_map SEC(".maps");
+
+/*
+ * ingress_node_firewall_ban_map: is LRU hash map type
+ * key is the address of a source that a rule with autoBan banned.
+ * lookup returns the time at which the ban ends and the rule that banned the source, packets of banned sources are
+ * dropped before the table map is looked up.
+ * Note: this map is pinned to specific path in bpffs so that bans survive restarts of the daemon.
+ */
+struct {
+    __uint(type, BPF_MAP_TYPE_LRU_HASH);
+    __type(key, struct banKey_st);
+    __type(value, struct banVal_st);
+    __uint(max_entries, MAX_BANNED_SOURCES);
+    __uint(pinning, LIBBPF_PIN_BY_NAME);
+} ingress_node_firewall_ban_map SEC(".maps");
+
+/*
+ * ingress_node_firewall_ban_counter_map: is LRU hash map type
+ * key is the address of a source and the id of a rule with autoBan.
+ * lookup returns the number of packets that the rule denied from the source since the start of the current period.
+ */
+struct {
+    __uint(type, BPF_MAP_TYPE_LRU_HASH);
+    __type(key, struct banCounterKey_st);
+    __type(value, struct banCounterVal_st);
+    __uint(max_entries, MAX_BAN_COUNTERS);
+} ingress_node_firewall_ban_counter_map SEC(".maps");
+
+/*
+ * ingress_node_firewall_blocklist_map: is LPM trie map type
+ * key is a blocklisted source address or CIDR.
+ * lookup returns the verdict for the packets of the source, packets of blocklisted sources are dropped before the
+ * ban map and the table map are looked up. The statistics of these packets are counted under INVALID_RULE_ID.
+ * Note: this map is pinned to specific path in bpffs so that user space only needs to apply changes of the list.
+ */
+struct {
+    __uint(type, BPF_MAP_TYPE_LPM_TRIE);
+    __type(key, struct blocklistKey_st);
+    __type(value, __u8);
+    __uint(max_entries, MAX_BLOCKLIST_ENTRIES);
+    __uint(map_flags, BPF_F_NO_PREALLOC);
+    __uint(pinning, LIBBPF_PIN_BY_NAME);
+} ingress_node_firewall_blocklist_map SEC(".maps");
+
+/*
+ * ingress_node_firewall_source_statistics_map: is LRU hash map type
+ * key is the ingress interface index and the address of a source.
+ * lookup returns the number of packets and bytes that were denied from the source on the interface, user space
+ * reports the sources with the most denied packets.
+ */
+struct {
+    __uint(type, BPF_MAP_TYPE_LRU_HASH);
+    __type(key, struct sourceStatisticsKey_st);
+    __type(value, struct sourceStatisticsVal_st);
+    __uint(max_entries, MAX_SOURCE_STATISTICS);
+} ingress_node_firewall_source_statistics_map SEC(".maps");
+
+/*
+ * ingress_node_firewall_event_rate_limit_map: is array map type
+ * the single entry is the token bucket that limits the number of events per second to event_rate_limit.
+ */
+struct {
+    __uint(type, BPF_MAP_TYPE_ARRAY);
+    __type(key, __u32);
+    __type(value, struct eventRateLimit_st);
+    __uint(max_entries, 1);
+} ingress_node_firewall_event_rate_limit_map SEC(".maps");
+
 struct {
     __uint(type, BPF_MAP_TYPE_HASH);
     __type(key, struct lpm_ip_key_st);
@@ -77,6 +176,24 @@ struct {
 // Global used to enable lookup debug hashmap
 static volatile const __u32 debug_lookup = 0;
 
+// Global used to evaluate the rules of a target one by one instead of using the rule classifier
+static volatile const __u32 linear_lookup = 0;
+
+// Global used to bound the loop of the linear lookup by the configured number of rules per target, the verifier
+// explores every iteration of the loop
+static volatile const __u32 max_rules_per_target = MAX_RULES_PER_TARGET;
+
+// Global used to generate an event for one in event_sample_rate denied packets
+static volatile const __u32 event_sample_rate = 1;
+
+// Global used to limit the number of events per second, 0 disables the limit
+static volatile const __u32 event_rate_limit = 0;
+
+// Globals holding the fail safe TCP and UDP ports in host byte order, 0 marks an unused entry. Banned sources can
+// still reach them, as the rules of the sources cannot deny them either.
+static volatile const __u16 failsafe_tcp_ports[MAX_FAILSAFE_PORTS] = {0};
+static volatile const __u16 failsafe_udp_ports[MAX_FAILSAFE_PORTS] = {0};
+
 /*
  * ip_extract_l4info(): extracts L4 info for the supported protocols from
  * the incoming packet's headers.
@@ -84,7 +201,7 @@ static volatile const __u32 debug_lookup = 0;
  * struct xdp_md *ctx: pointer to XDP context which contains packet pointer and input interface index.
  * bool is_v4: true for ipv4 and false for ipv6.
  * Output:
- * __u8 *proto: L4 protocol type supported types are TCP/UDP/SCTP/ICMP/ICMPv6.
+ * __u8 *proto: L4 protocol type, ports and ICMP type and code are extracted for TCP/UDP/SCTP/ICMP/ICMPv6.
  * __u16 *dstPort: pointer to L4 destination port for TCP/UDP/SCTP protocols.
  * __u8 *icmpType: pointer to ICMP or ICMPv6's type value.
  * __u8 *icmpCode: pointer to ICMP or ICMPv6's code value.
@@ -168,11 +285,297 @@ ip_extract_l4info(struct xdp_md *ctx, __u8 *proto, __u16 *dstPort,
             break;
         }
     default:
-        return -1;
+        // Other protocols are matched on the protocol alone.
+        break;
+    }
+    return 0;
+}
+
+/*
+ * l4Info_st: L4 info of a packet that rules are matched against.
+ * proto: L4 protocol of the packet.
+ * icmpType: ICMP or ICMPv6 type of the packet.
+ * icmpCode: ICMP or ICMPv6 code of the packet.
+ * icmpProto: IPPROTO_ICMP for ipv4 and IPPROTO_ICMPV6 for ipv6 packets.
+ * dstPort: L4 destination port of the packet in network byte order.
+ */
+struct l4Info_st {
+    __u8 proto;
+    __u8 icmpType;
+    __u8 icmpCode;
+    __u8 icmpProto;
+    __u16 dstPort;
+};
+
+/*
+ * rule_matches(): returns whether a rule matches the packet's L4 info.
+ * Input:
+ * struct ruleType_st *rule: the rule.
+ * struct l4Info_st *l4: L4 info of the packet.
+ * Output:
+ * none.
+ * Return:
+ * 1 if the rule matches, 0 otherwise.
+ */
+__attribute__((__always_inline__)) static inline int
+rule_matches(struct ruleType_st *rule, struct l4Info_st *l4) {
+    // Protocol is not set so just apply the action
+    if (rule->protocol == 0) {
+        return 1;
+    }
+    if (rule->protocol != l4->proto) {
+        return 0;
+    }
+    switch (rule->protocol) {
+    case IPPROTO_TCP:
+    case IPPROTO_UDP:
+    case IPPROTO_SCTP:
+        {
+            __u16 dstPort = bpf_ntohs(l4->dstPort);
+            ingress_node_firewall_printk("TCP/UDP/SCTP packet rule_dstPortStart %d rule_dstPortEnd %d pkt_dstPort %d",
+            rule->dstPortStart, rule->dstPortEnd, dstPort);
+            if (rule->dstPortEnd == 0) {
+                return rule->dstPortStart == dstPort;
+            }
+            return (dstPort >= rule->dstPortStart) && (dstPort < rule->dstPortEnd);
+        }
+    case IPPROTO_ICMP:
+    case IPPROTO_ICMPV6:
+        {
+            // ICMP rules only match the ICMP version of the address family.
+            if (rule->protocol != l4->icmpProto) {
+                return 0;
+            }
+            ingress_node_firewall_printk("ICMP/ICMPV6 packet rule(type:%d-%d, code:%d) pkt(type:%d, code %d)",
+            rule->icmpType, rule->icmpTypeEnd, rule->icmpCode, l4->icmpType, l4->icmpCode);
+            __u8 icmpTypeEnd = rule->icmpTypeEnd == 0 ? rule->icmpType : rule->icmpTypeEnd;
+            return (l4->icmpType >= rule->icmpType) && (l4->icmpType <= icmpTypeEnd) &&
+                (rule->icmpAnyCode || (rule->icmpCode == l4->icmpCode));
+        }
+    default:
+        // Rules of other protocols match on the protocol alone.
+        return 1;
+    }
+}
+
+/*
+ * rules_lookup(): matches the packet's L4 info with the rules of a target one by one, in order, and returns the
+ * action of the first matching rule. The cost of this lookup grows with the number of rules. It is not inlined so
+ * that the verifier does not explore the rest of the program for the match of each iteration.
+ * Input:
+ * __u32 rulesId: the rules id of the target that matches the packet's source address.
+ * __u32 numRules: the number of rules of the target.
+ * struct l4Info_st *l4: L4 info of the packet.
+ * Output:
+ * struct autoBan_st *autoBan: the autoBan settings of the matching rule.
+ * Return:
+ * __u32 action: returned action is the logical or of the rule id and action field
+ * from the matching rule, in case of no match it returns UNDEF.
+ */
+static __attribute__((noinline)) __u32
+rules_lookup(__u32 rulesId, __u32 numRules, struct l4Info_st *l4, struct autoBan_st *autoBan) {
+    __u32 i;
+
+    for (i = 0; i < MAX_RULES_PER_TARGET_LIMIT; ++i) {
+        if (i >= max_rules_per_target || i >= numRules) {
+            break;
+        }
+        struct ruleKey_st ruleKey = {.rulesId = rulesId, .index = i};
+        struct ruleType_st *rule = (struct ruleType_st *)bpf_map_lookup_elem(
+            &ingress_node_firewall_rules_map, &ruleKey);
+        if (NULL == rule || rule->ruleId == INVALID_RULE_ID) {
+            continue;
+        }
+        if (rule_matches(rule, l4)) {
+            memcpy(autoBan, &rule->autoBan, sizeof(*autoBan));
+            return SET_ACTIONRULE_RESPONSE(rule->action, rule->ruleId);
+        }
+    }
+    ingress_node_firewall_printk("Packet didn't match any rule proto %d port %d", l4->proto, bpf_ntohs(l4->dstPort));
+    return SET_ACTION(UNDEF);
+}
+
+/*
+ * rules_classify(): looks up the first rule of a target that matches the packet's L4 info in the rule classifier.
+ * The cost of this lookup does not depend on the number of rules.
+ * Input:
+ * struct rulesVal_st *rulesVal: the rules of the target that matches the packet's source address.
+ * __u8 proto: L4 protocol of the packet.
+ * __u16 dstPort: L4 destination port of the packet in network byte order.
+ * __u8 icmpType: ICMP or ICMPv6 type of the packet.
+ * __u8 icmpCode: ICMP or ICMPv6 code of the packet.
+ * __u8 icmpProto: IPPROTO_ICMP for ipv4 and IPPROTO_ICMPV6 for ipv6 packets.
+ * Output:
+ * struct autoBan_st *autoBan: the autoBan settings of the matching rule.
+ * Return:
+ * __u32 action: returned action is the logical or of the rule id and action field
+ * from the matching rule, in case of no match it returns UNDEF.
+ */
+__attribute__((__always_inline__)) static inline __u32
+rules_classify(struct rulesVal_st *rulesVal, __u8 proto, __u16 dstPort, __u8 icmpType, __u8 icmpCode, __u8 icmpProto,
+               struct autoBan_st *autoBan) {
+    struct classKey_st key;
+
+    memset(&key, 0, sizeof(key));
+    key.prefixLen = CLASS_KEY_MAX_PREFIX_LEN;
+    key.rulesId = rulesVal->rulesId;
+    key.protocol = proto;
+    switch (proto) {
+    case IPPROTO_TCP:
+    case IPPROTO_UDP:
+    case IPPROTO_SCTP:
+        memcpy(key.data, &dstPort, sizeof(dstPort));
+        break;
+    case IPPROTO_ICMP:
+    case IPPROTO_ICMPV6:
+        if (proto != icmpProto) {
+            // ICMP rules only match the ICMP version of the address family, only a rule without protocol applies.
+            key.prefixLen = CLASS_KEY_RULES_ID_PREFIX_LEN;
+            break;
+        }
+        key.data[0] = icmpType;
+        key.data[1] = icmpCode;
+        break;
+    default:
+        // Rules of other protocols are stored with a prefix that only covers the protocol.
+        break;
+    }
+
+    struct classVal_st *classVal = (struct classVal_st *)bpf_map_lookup_elem(
+        &ingress_node_firewall_classifier_map, &key);
+    if (NULL != classVal) {
+        ingress_node_firewall_printk("classifier match (Id %d, action %d)", classVal->ruleId, classVal->action);
+        memcpy(autoBan, &classVal->autoBan, sizeof(*autoBan));
+        return SET_ACTIONRULE_RESPONSE(classVal->action, classVal->ruleId);
+    }
+    ingress_node_firewall_printk("Packet didn't match any rule proto %d port %d", proto, bpf_ntohs(dstPort));
+    return SET_ACTION(UNDEF);
+}
+
+/*
+ * blocklist_lookup(): looks up whether the source of a packet is in the blocklist.
+ * Input:
+ * struct banKey_st *banKey: the source address of the packet.
+ * Output:
+ * none.
+ * Return:
+ * __u32 action: the verdict of the blocklist with INVALID_RULE_ID if the source is in the blocklist, UNDEF otherwise.
+ */
+__attribute__((__always_inline__)) static inline __u32
+blocklist_lookup(struct banKey_st *banKey) {
+    struct blocklistKey_st key;
+    __u8 *verdict;
+
+    memset(&key, 0, sizeof(key));
+    key.prefixLen = 128;
+    memcpy(key.ip_data, banKey->ip_data, sizeof(key.ip_data));
+    verdict = (__u8 *)bpf_map_lookup_elem(&ingress_node_firewall_blocklist_map, &key);
+    if (likely(NULL == verdict)) {
+        return SET_ACTION(UNDEF);
+    }
+    ingress_node_firewall_printk("source in blocklist, action %d", *verdict);
+    return SET_ACTIONRULE_RESPONSE(*verdict, INVALID_RULE_ID);
+}
+
+/*
+ * is_failsafe_port(): checks whether a packet is destined to a fail safe TCP or UDP port.
+ * Input:
+ * __u8 proto: L4 protocol of the packet.
+ * __u16 dstPort: L4 destination port of the packet in network byte order.
+ * Output:
+ * none.
+ * Return:
+ * __u8: 1 if the destination port is a fail safe port of the protocol, 0 otherwise.
+ */
+__attribute__((__always_inline__)) static inline __u8
+is_failsafe_port(__u8 proto, __u16 dstPort) {
+    __u16 port = bpf_ntohs(dstPort);
+    __u32 i;
+
+    if (port == 0) {
+        return 0;
+    }
+    for (i = 0; i < MAX_FAILSAFE_PORTS; ++i) {
+        if ((proto == IPPROTO_TCP && failsafe_tcp_ports[i] == port) ||
+            (proto == IPPROTO_UDP && failsafe_udp_ports[i] == port)) {
+            return 1;
+        }
     }
     return 0;
 }
 
+/*
+ * ban_lookup(): looks up whether the source of a packet is banned, and removes the ban once it ended.
+ * Input:
+ * struct banKey_st *banKey: the source address of the packet.
+ * Output:
+ * none.
+ * Return:
+ * __u32 action: DENY with the id of the rule that banned the source if the source is banned, UNDEF otherwise.
+ */
+__attribute__((__always_inline__)) static inline __u32
+ban_lookup(struct banKey_st *banKey) {
+    struct banVal_st *ban = (struct banVal_st *)bpf_map_lookup_elem(&ingress_node_firewall_ban_map, banKey);
+
+    if (likely(NULL == ban)) {
+        return SET_ACTION(UNDEF);
+    }
+    if (bpf_ktime_get_ns() >= ban->expires) {
+        (void)bpf_map_delete_elem(&ingress_node_firewall_ban_map, banKey);
+        return SET_ACTION(UNDEF);
+    }
+    ingress_node_firewall_printk("source banned by rule %d", ban->ruleId);
+    return SET_ACTIONRULE_RESPONSE(DENY, ban->ruleId);
+}
+
+/*
+ * ban_count(): counts a packet that a rule with autoBan denied from a source, and bans the source once the rule
+ * denied threshold packets from it within the period.
+ * Input:
+ * struct banKey_st *banKey: the source address of the packet.
+ * __u32 ruleId: the id of the rule that denied the packet.
+ * struct autoBan_st *autoBan: the autoBan settings of the rule.
+ * Output:
+ * none.
+ * Return:
+ * __u8 flags: EVENT_FLAG_BAN_STARTED if the source was banned, 0 otherwise.
+ */
+__attribute__((__always_inline__)) static inline __u8
+ban_count(struct banKey_st *banKey, __u32 ruleId, struct autoBan_st *autoBan) {
+    struct banCounterKey_st counterKey;
+    struct banCounterVal_st *counter, initialCounter;
+    struct banVal_st ban;
+    __u64 now = bpf_ktime_get_ns();
+
+    memset(&counterKey, 0, sizeof(counterKey));
+    memcpy(counterKey.ip_data, banKey->ip_data, sizeof(counterKey.ip_data));
+    counterKey.ruleId = ruleId;
+    counter = bpf_map_lookup_elem(&ingress_node_firewall_ban_counter_map, &counterKey);
+    if (NULL == counter || now - counter->periodStart >= (__u64)autoBan->period * NSEC_PER_SEC) {
+        // Start a new period with this packet.
+        memset(&initialCounter, 0, sizeof(initialCounter));
+        initialCounter.periodStart = now;
+        initialCounter.packets = 1;
+        (void)bpf_map_update_elem(&ingress_node_firewall_ban_counter_map, &counterKey, &initialCounter, BPF_ANY);
+        if (autoBan->threshold > 1) {
+            return 0;
+        }
+    } else {
+        __sync_fetch_and_add(&counter->packets, 1);
+        if (counter->packets < autoBan->threshold) {
+            return 0;
+        }
+    }
+
+    memset(&ban, 0, sizeof(ban));
+    ban.expires = now + (__u64)autoBan->duration * NSEC_PER_SEC;
+    ban.ruleId = ruleId;
+    (void)bpf_map_update_elem(&ingress_node_firewall_ban_map, banKey, &ban, BPF_ANY);
+    (void)bpf_map_delete_elem(&ingress_node_firewall_ban_counter_map, &counterKey);
+    ingress_node_firewall_printk("rule %d banned source for %d seconds", ruleId, autoBan->duration);
+    return EVENT_FLAG_BAN_STARTED;
+}
+
 /*
  * ipv4_firewall_lookup(): matches ipv4 packet with LPM map's key,
  * match L4 headers with the result rules in order and return the action.
@@ -181,20 +584,22 @@ ip_extract_l4info(struct xdp_md *ctx, __u8 *proto, __u16 *dstPort,
  * struct xdp_md *ctx: pointer to XDP context which contains packet pointer and input interface index.
  * __u32 ifID: ingress interface index where the packet is received from.
  * Output:
- * none.
+ * struct banKey_st *source: the source address of the packet.
+ * __u8 *eventFlags: EVENT_FLAG_BLOCKLISTED if the source is in the blocklist, EVENT_FLAG_SOURCE_BANNED or
+ * EVENT_FLAG_BAN_STARTED if the source is or was just banned.
  * Return:
  * __u32 action: returned action is the logical or of the rule id and action field
  * from the matching rule, in case of no match it returns UNDEF.
  */
 __attribute__((__always_inline__)) static inline __u32
-ipv4_firewall_lookup(struct xdp_md *ctx, __u32 ifId) {
+ipv4_firewall_lookup(struct xdp_md *ctx, __u32 ifId, struct banKey_st *source, __u8 *eventFlags) {
     void *data = (void *)(long)ctx->data;
     struct iphdr *iph = data + sizeof(struct ethhdr);
     struct lpm_ip_key_st key;
-    __u32 srcAddr = 0;
+    struct autoBan_st autoBan;
+    __u32 srcAddr = 0, result;
     __u16 dstPort = 0;
     __u8 icmpCode = 0, icmpType = 0, proto = 0;
-    int i;
 
     if (unlikely(ip_extract_l4info(ctx, &proto, &dstPort, &icmpType, &icmpCode, 1) < 0)) {
         ingress_node_firewall_printk("failed to extract l4 info");
@@ -203,6 +608,22 @@ ipv4_firewall_lookup(struct xdp_md *ctx, __u32 ifId) {
 
     srcAddr = iph->saddr;
 
+    // Drop the packets of blocklisted and banned sources before any rule is evaluated. Banned sources can still reach
+    // the fail safe ports.
+    source->ip_data[10] = 0xFF;
+    source->ip_data[11] = 0xFF;
+    memcpy(&source->ip_data[12], &srcAddr, sizeof(srcAddr));
+    result = blocklist_lookup(source);
+    if (unlikely(GET_ACTION(result) != UNDEF)) {
+        *eventFlags = EVENT_FLAG_BLOCKLISTED;
+        return result;
+    }
+    result = is_failsafe_port(proto, dstPort) ? SET_ACTION(UNDEF) : ban_lookup(source);
+    if (unlikely(GET_ACTION(result) == DENY)) {
+        *eventFlags = EVENT_FLAG_SOURCE_BANNED;
+        return result;
+    }
+
     memset(&key, 0, sizeof(key));
     key.prefixLen = 64; // ipv4 address + ifId
     key.ip_data[0] = srcAddr & 0xFF;
@@ -219,44 +640,18 @@ ipv4_firewall_lookup(struct xdp_md *ctx, __u32 ifId) {
         &ingress_node_firewall_table_map, &key);
 
     if (likely(NULL != rulesVal)) {
-#pragma clang loop unroll(full)
-        for (i = 0; i < MAX_RULES_PER_TARGET; ++i) {
-            struct ruleType_st *rule = &rulesVal->rules[i];
-            if (rule->ruleId == INVALID_RULE_ID) {
-                continue;
-            }
-
-            if (likely((rule->protocol != 0) && (rule->protocol == proto))) {
-                ingress_node_firewall_printk("ruleInfo (protocol %d, Id %d, action %d)", rule->protocol, rule->ruleId, rule->action);
-                if ((rule->protocol == IPPROTO_TCP) ||
-                    (rule->protocol == IPPROTO_UDP) ||
-                    (rule->protocol == IPPROTO_SCTP)) {
-                    ingress_node_firewall_printk("TCP/UDP/SCTP packet rule_dstPortStart %d rule_dstPortEnd %d pkt_dstPort %d",
-                    rule->dstPortStart, rule->dstPortEnd, bpf_ntohs(dstPort));
-                    if (rule->dstPortEnd == 0 ) {
-                        if (rule->dstPortStart == bpf_ntohs(dstPort)) {
-                            return SET_ACTIONRULE_RESPONSE(rule->action, rule->ruleId);
-                        }
-                    } else {
-                        if ((bpf_ntohs(dstPort) >= rule->dstPortStart) && (bpf_ntohs(dstPort) < rule->dstPortEnd)) {
-                            return SET_ACTIONRULE_RESPONSE(rule->action, rule->ruleId);
-                        }
-                    }
-                }
-
-                if (rule->protocol == IPPROTO_ICMP) {
-                    ingress_node_firewall_printk("ICMP packet rule(type:%d, code:%d) pkt(type:%d, code %d)", rule->icmpType, rule->icmpCode, icmpType, icmpCode);
-                    if ((rule->icmpType == icmpType) && (rule->icmpCode == icmpCode)) {
-                        return SET_ACTIONRULE_RESPONSE(rule->action, rule->ruleId);
-                    }
-                }
-            }
-            // Protocol is not set so just apply the action
-            if (rule->protocol == 0) {
-                return SET_ACTIONRULE_RESPONSE(rule->action, rule->ruleId);
-            }
+        memset(&autoBan, 0, sizeof(autoBan));
+        if (unlikely(linear_lookup != 0)) {
+            struct l4Info_st l4 = {.proto = proto, .icmpType = icmpType, .icmpCode = icmpCode, .icmpProto = IPPROTO_ICMP,
+                                   .dstPort = dstPort};
+            result = rules_lookup(rulesVal->rulesId, rulesVal->numRules, &l4, &autoBan);
+        } else {
+            result = rules_classify(rulesVal, proto, dstPort, icmpType, icmpCode, IPPROTO_ICMP, &autoBan);
         }
-        ingress_node_firewall_printk("Packet didn't match any rule proto %d port %d", proto, bpf_ntohs(dstPort));
+        if (GET_ACTION(result) == DENY && autoBan.threshold != 0) {
+            *eventFlags = ban_count(source, GET_RULE_ID(result), &autoBan);
+        }
+        return result;
     }
     return SET_ACTION(UNDEF);
 }
@@ -269,26 +664,44 @@ ipv4_firewall_lookup(struct xdp_md *ctx, __u32 ifId) {
  * struct xdp_md *ctx: pointer to XDP context which contains packet pointer and input interface index.
  * __u32 ifID: ingress interface index where the packet is received from.
  * Output:
- * none.
+ * struct banKey_st *source: the source address of the packet.
+ * __u8 *eventFlags: EVENT_FLAG_BLOCKLISTED if the source is in the blocklist, EVENT_FLAG_SOURCE_BANNED or
+ * EVENT_FLAG_BAN_STARTED if the source is or was just banned.
  * Return:
  __u32 action: returned action is the logical or of the rule id and action field
  * from the matching rule, in case of no match it returns UNDEF.
  */
 __attribute__((__always_inline__)) static inline __u32
-ipv6_firewall_lookup(struct xdp_md *ctx, __u32 ifId) {
+ipv6_firewall_lookup(struct xdp_md *ctx, __u32 ifId, struct banKey_st *source, __u8 *eventFlags) {
     void *data = (void *)(long)ctx->data;
     struct ipv6hdr *iph = data + sizeof(struct ethhdr);
     struct lpm_ip_key_st key;
+    struct autoBan_st autoBan;
     __u8 *srcAddr = NULL;
+    __u32 result;
     __u16 dstPort = 0;
     __u8 icmpCode = 0, icmpType = 0, proto = 0;
-    int i;
 
     if (unlikely(ip_extract_l4info(ctx, &proto, &dstPort, &icmpType, &icmpCode, 0) < 0)) {
         ingress_node_firewall_printk("failed to extract l4 info");
         return SET_ACTION(UNDEF);
     }
     srcAddr = iph->saddr.in6_u.u6_addr8;
+
+    // Drop the packets of blocklisted and banned sources before any rule is evaluated. Banned sources can still reach
+    // the fail safe ports.
+    memcpy(source->ip_data, srcAddr, sizeof(source->ip_data));
+    result = blocklist_lookup(source);
+    if (unlikely(GET_ACTION(result) != UNDEF)) {
+        *eventFlags = EVENT_FLAG_BLOCKLISTED;
+        return result;
+    }
+    result = is_failsafe_port(proto, dstPort) ? SET_ACTION(UNDEF) : ban_lookup(source);
+    if (unlikely(GET_ACTION(result) == DENY)) {
+        *eventFlags = EVENT_FLAG_SOURCE_BANNED;
+        return result;
+    }
+
     memset(&key, 0, sizeof(key));
     key.prefixLen = 160; // ipv6 address + ifId
     memcpy(key.ip_data, srcAddr, 16);
@@ -302,47 +715,64 @@ ipv6_firewall_lookup(struct xdp_md *ctx, __u32 ifId) {
         &ingress_node_firewall_table_map, &key);
 
     if (NULL != rulesVal) {
-#pragma clang loop unroll(full)
-        for (i = 0; i < MAX_RULES_PER_TARGET; ++i) {
-            struct ruleType_st *rule = &rulesVal->rules[i];
-            if (rule->ruleId == INVALID_RULE_ID) {
-                continue;
-            }
-            if (likely((rule->protocol != 0) && (rule->protocol == proto))) {
-                ingress_node_firewall_printk("ruleInfo (protocol %d, Id %d, action %d)", rule->protocol, rule->ruleId, rule->action);
-                if ((rule->protocol == IPPROTO_TCP) ||
-                    (rule->protocol == IPPROTO_UDP) ||
-                    (rule->protocol == IPPROTO_SCTP)) {
-                    ingress_node_firewall_printk("TCP/UDP/SCTP packet rule_dstPortStart %d rule_dstPortEnd %d pkt_dstPort %d",
-                        rule->dstPortStart, rule->dstPortEnd, bpf_ntohs(dstPort));
-                    if (rule->dstPortEnd == 0) {
-                        if (rule->dstPortStart == bpf_ntohs(dstPort)) {
-                            return SET_ACTIONRULE_RESPONSE(rule->action, rule->ruleId);
-                        }
-                    } else {
-                        if ((bpf_ntohs(dstPort) >= rule->dstPortStart) && (bpf_ntohs(dstPort) < rule->dstPortEnd)) {
-                            return SET_ACTIONRULE_RESPONSE(rule->action, rule->ruleId);
-                        }
-                    }
-                }
-
-                if (rule->protocol == IPPROTO_ICMPV6) {
-                    ingress_node_firewall_printk("ICMPV6 packet rule(type:%d, code:%d) pkt(type:%d, code %d)", rule->icmpType, rule->icmpCode, icmpType, icmpCode);
-                    if ((rule->icmpType == icmpType) && (rule->icmpCode == icmpCode)) {
-                        return SET_ACTIONRULE_RESPONSE(rule->action, rule->ruleId);
-                    }
-                }
-            }
-            // Protocol is not set so just apply the action
-            if (rule->protocol == 0) {
-                return SET_ACTIONRULE_RESPONSE(rule->action, rule->ruleId);
-            }
+        memset(&autoBan, 0, sizeof(autoBan));
+        if (unlikely(linear_lookup != 0)) {
+            struct l4Info_st l4 = {.proto = proto, .icmpType = icmpType, .icmpCode = icmpCode, .icmpProto = IPPROTO_ICMPV6,
+                                   .dstPort = dstPort};
+            result = rules_lookup(rulesVal->rulesId, rulesVal->numRules, &l4, &autoBan);
+        } else {
+            result = rules_classify(rulesVal, proto, dstPort, icmpType, icmpCode, IPPROTO_ICMPV6, &autoBan);
+        }
+        if (GET_ACTION(result) == DENY && autoBan.threshold != 0) {
+            *eventFlags = ban_count(source, GET_RULE_ID(result), &autoBan);
         }
-        ingress_node_firewall_printk("Packet didn't match any rule proto %d port %d", proto, bpf_ntohs(dstPort));
+        return result;
     }
     return SET_ACTION(UNDEF);
 }
 
+/*
+ * event_rate_limit_take(): takes a token from the event rate limit bucket, which holds up to one second worth of
+ * tokens and is refilled with event_rate_limit tokens per second.
+ * Input:
+ * none.
+ * Output:
+ * none.
+ * Return:
+ * __u8: 1 if a token was taken and the event can be generated, 0 otherwise.
+ */
+__attribute__((__always_inline__)) static inline __u8
+event_rate_limit_take(void) {
+    struct eventRateLimit_st *bucket;
+    __u64 now = bpf_ktime_get_ns(), elapsed = 0, capacity = (__u64)event_rate_limit * NSEC_PER_SEC;
+    __u32 key = 0;
+    __u8 taken = 0;
+
+    bucket = bpf_map_lookup_elem(&ingress_node_firewall_event_rate_limit_map, &key);
+    if (unlikely(!bucket)) {
+        return 0;
+    }
+    bpf_spin_lock(&bucket->lock);
+    // Another CPU may have refilled the bucket after now was read.
+    if (now > bucket->lastRefill) {
+        elapsed = now - bucket->lastRefill;
+        bucket->lastRefill = now;
+    }
+    if (elapsed > NSEC_PER_SEC) {
+        elapsed = NSEC_PER_SEC;
+    }
+    bucket->tokens += elapsed * event_rate_limit;
+    if (bucket->tokens > capacity) {
+        bucket->tokens = capacity;
+    }
+    if (bucket->tokens >= NSEC_PER_SEC) {
+        bucket->tokens -= NSEC_PER_SEC;
+        taken = 1;
+    }
+    bpf_spin_unlock(&bucket->lock);
+    return taken;
+}
+
 /*
  * generate_event_and_update_statistics() : it will generate eBPF event including the packet header
  * and update statistics for the specificed rule id.
@@ -351,16 +781,21 @@ ipv6_firewall_lookup(struct xdp_md *ctx, __u32 ifId) {
  * __u64 packet_len: packet length in bytes including layer2 header.
  * __u8 action: valid actions ALLOW/DENY/UNDEF.
  * __u16 ruleId: ruled id where the packet matches against (in case of match of course).
- * __u8 generateEvent: need to generate event for this packet or not.
+ * __u8 generateEvent: need to generate event for this packet or not, subject to event sampling and the event rate limit.
+ * __u8 eventFlags: flags of the event, EVENT_FLAG_BLOCKLISTED, EVENT_FLAG_SOURCE_BANNED or EVENT_FLAG_BAN_STARTED.
  * __u32 ifID: input interface index where the packet is arrived from.
+ * struct banKey_st *source: the source address of the packet, the denied packets are counted per source.
  * Output:
  * none.
  * Return:
  * none.
  */
 __attribute__((__always_inline__)) static inline void
-generate_event_and_update_statistics(struct xdp_md *ctx, __u64 packet_len, __u8 action, __u16 ruleId, __u8 generateEvent, __u32 ifId) {
+generate_event_and_update_statistics(struct xdp_md *ctx, __u64 packet_len, __u8 action, __u16 ruleId, __u8 generateEvent,
+                                     __u8 eventFlags, __u32 ifId, struct banKey_st *source) {
     struct ruleStatistics_st *statistics, initialStats;
+    struct sourceStatisticsKey_st sourceKey;
+    struct sourceStatisticsVal_st *sourceStatistics, initialSourceStats;
     struct event_hdr_st hdr;
     __u64 flags = BPF_F_CURRENT_CPU;
     __u16 headerSize;
@@ -369,6 +804,7 @@ generate_event_and_update_statistics(struct xdp_md *ctx, __u64 packet_len, __u8
     memset(&hdr, 0, sizeof(hdr));
     hdr.ruleId = ruleId;
     hdr.action = action;
+    hdr.flags = eventFlags;
     hdr.pktLength = (__u16)packet_len;
     hdr.ifId = (__u16)ifId;
 
@@ -389,6 +825,38 @@ generate_event_and_update_statistics(struct xdp_md *ctx, __u64 packet_len, __u8
         bpf_map_update_elem(&ingress_node_firewall_statistics_map, &key, &initialStats, BPF_ANY);
     }
 
+    if (action == DENY) {
+        memset(&sourceKey, 0, sizeof(sourceKey));
+        sourceKey.ifId = ifId;
+        memcpy(sourceKey.ip_data, source->ip_data, sizeof(sourceKey.ip_data));
+        sourceStatistics = bpf_map_lookup_elem(&ingress_node_firewall_source_statistics_map, &sourceKey);
+        if (likely(sourceStatistics)) {
+            __sync_fetch_and_add(&sourceStatistics->packets, 1);
+            __sync_fetch_and_add(&sourceStatistics->bytes, packet_len);
+        } else {
+            initialSourceStats.packets = 1;
+            initialSourceStats.bytes = packet_len;
+            (void)bpf_map_update_elem(&ingress_node_firewall_source_statistics_map, &sourceKey, &initialSourceStats,
+                                      BPF_NOEXIST);
+        }
+    }
+
+    // Events that start a ban are always generated, the others are sampled and rate limited and counted when they
+    // are suppressed.
+    if (generateEvent && !(eventFlags & EVENT_FLAG_BAN_STARTED)) {
+        if (event_sample_rate > 1 && bpf_get_prandom_u32() % event_sample_rate != 0) {
+            generateEvent = 0;
+            if (likely(statistics)) {
+                __sync_fetch_and_add(&statistics->event_stats.sampledOut, 1);
+            }
+        } else if (event_rate_limit != 0 && !event_rate_limit_take()) {
+            generateEvent = 0;
+            if (likely(statistics)) {
+                __sync_fetch_and_add(&statistics->event_stats.rateLimited, 1);
+            }
+        }
+    }
+
     if (generateEvent) {
         headerSize = packet_len < MAX_EVENT_DATA ? packet_len : MAX_EVENT_DATA;
         // enable the following flag to dump packet header
@@ -417,6 +885,8 @@ ingress_node_firewall_main(struct xdp_md *ctx) {
     void *dataStart = data + sizeof(struct ethhdr);
     __u32 result = UNDEF;
     __u32 ifId = ctx->ingress_ifindex;
+    struct banKey_st source;
+    __u8 eventFlags = 0;
 
     ingress_node_firewall_printk("Ingress node firewall start processing a packet on %d", ifId);
 
@@ -424,14 +894,15 @@ ingress_node_firewall_main(struct xdp_md *ctx) {
         ingress_node_firewall_printk("Ingress node firewall bad packet XDP_DROP");
         return XDP_DROP;
     }
+    memset(&source, 0, sizeof(source));
     switch (eth->h_proto) {
     case bpf_htons(ETH_P_IP):
         ingress_node_firewall_printk("Ingress node firewall process IPv4 packet");
-        result = ipv4_firewall_lookup(ctx, ifId);
+        result = ipv4_firewall_lookup(ctx, ifId, &source, &eventFlags);
         break;
     case bpf_htons(ETH_P_IPV6):
         ingress_node_firewall_printk("Ingress node firewall process IPv6 packet");
-        result = ipv6_firewall_lookup(ctx, ifId);
+        result = ipv6_firewall_lookup(ctx, ifId, &source, &eventFlags);
         break;
     default:
         ingress_node_firewall_printk("Ingress node firewall unknown L3 protocol XDP_PASS");
@@ -443,11 +914,11 @@ ingress_node_firewall_main(struct xdp_md *ctx) {
 
     switch (action) {
     case DENY:
-        generate_event_and_update_statistics(ctx, bpf_xdp_get_buff_len(ctx), DENY, ruleId, 1, ifId);
+        generate_event_and_update_statistics(ctx, bpf_xdp_get_buff_len(ctx), DENY, ruleId, 1, eventFlags, ifId, &source);
         ingress_node_firewall_printk("Ingress node firewall action DENY -> XDP_DROP");
         return XDP_DROP;
     case ALLOW:
-        generate_event_and_update_statistics(ctx, bpf_xdp_get_buff_len(ctx), ALLOW, ruleId, 0, ifId);
+        generate_event_and_update_statistics(ctx, bpf_xdp_get_buff_len(ctx), ALLOW, ruleId, 0, eventFlags, ifId, &source);
         ingress_node_firewall_printk("Ingress node firewall action ALLOW -> XDP_PASS");
         return XDP_PASS;
     default:
@@ -15,11 +15,16 @@ package main
 
 import (
 	"flag"
+	"net/http"
 	"os"
 
 	ingressnodefwiov1alpha1 "github.com/openshift/ingress-node-firewall/api/v1alpha1"
 	ingressnodefwv1alpha1 "github.com/openshift/ingress-node-firewall/api/v1alpha1"
 	"github.com/openshift/ingress-node-firewall/controllers"
+	"github.com/openshift/ingress-node-firewall/pkg/capture"
+	"github.com/openshift/ingress-node-firewall/pkg/dropreport"
+	nodefwloader "github.com/openshift/ingress-node-firewall/pkg/ebpf"
+	"github.com/openshift/ingress-node-firewall/pkg/ebpfsyncer"
 	"github.com/openshift/ingress-node-firewall/pkg/metrics"
 	"github.com/openshift/ingress-node-firewall/pkg/version"
 
@@ -83,9 +88,31 @@ func main() {
 		os.Exit(1)
 	}
 
+	stats, err := metrics.NewStatistics(pollPeriod)
+	if err != nil {
+		setupLog.Error(err, "unable to create new metrics")
+		os.Exit(1)
+	}
+	stats.Register()
+	defer stats.StopPoll()
+
+	// The sources with the most denied packets and the capture stream are served next to the metrics, behind the
+	// same proxy.
+	extraHandlers := map[string]http.Handler{metrics.TopSourcesPath: stats.TopSourcesHandler()}
+	capturer, err := capture.NewFromEnv()
+	if err != nil {
+		setupLog.Error(err, "unable to set up packet capture")
+		os.Exit(1)
+	}
+	if capturer != nil {
+		nodefwloader.RegisterEventHandler(capturer.HandleEvent)
+		extraHandlers[capture.Path] = capturer
+		defer capturer.Close()
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
-		Metrics:                metricsserver.Options{BindAddress: metricsAddr},
+		Metrics:                metricsserver.Options{BindAddress: metricsAddr, ExtraHandlers: extraHandlers},
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         false,
 		Cache: cache.Options{
@@ -100,14 +127,6 @@ func main() {
 		os.Exit(1)
 	}
 
-	stats, err := metrics.NewStatistics(pollPeriod)
-	if err != nil {
-		setupLog.Error(err, "unable to create new metrics")
-		os.Exit(1)
-	}
-	stats.Register()
-	defer stats.StopPoll()
-
 	if err = (&controllers.IngressNodeFirewallNodeStateReconciler{
 		Client:    mgr.GetClient(),
 		Scheme:    mgr.GetScheme(),
@@ -120,11 +139,28 @@ func main() {
 		os.Exit(1)
 	}
 
+	// The denied packets are summarized as Kubernetes Events on the IngressNodeFirewalls that own the rules.
+	reporter, err := dropreport.NewFromEnv(mgr.GetClient(), mgr.GetAPIReader(),
+		mgr.GetEventRecorderFor("ingress-node-firewall-daemon"), ctrl.Log.WithName("dropreport"), nodeName, namespace)
+	if err != nil {
+		setupLog.Error(err, "unable to set up drop reports")
+		os.Exit(1)
+	}
+	if reporter != nil {
+		nodefwloader.RegisterEventHandler(reporter.HandleEvent)
+		if err := mgr.Add(reporter); err != nil {
+			setupLog.Error(err, "unable to add drop reports to the manager")
+			os.Exit(1)
+		}
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
 	}
-	if err := mgr.AddReadyzCheck("readyz", healthz.Ping); err != nil {
+	// The daemon is ready while the XDP program is attached to the managed interfaces, the last sync succeeded
+	// and the events reader runs.
+	if err := mgr.AddReadyzCheck("readyz", ebpfsyncer.HealthCheck); err != nil {
 		setupLog.Error(err, "unable to set up ready check")
 		os.Exit(1)
 	}
@@ -0,0 +1,197 @@
+/*
+Copyright 2022.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// infwctl inspects ingress node firewall rules and the state of the firewall on a node.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	infv1alpha1 "github.com/openshift/ingress-node-firewall/api/v1alpha1"
+	"github.com/openshift/ingress-node-firewall/pkg/explain"
+
+	"sigs.k8s.io/yaml"
+)
+
+const usage = `Usage: infwctl <command> [flags]
+
+Commands:
+  explain    explain the verdict of the ingress node firewall rules of a node for a packet
+
+Commands that inspect the firewall on the node, run them in the daemon container:
+  rules      list the source CIDRs and rules of every interface
+  stats      list the statistics of the rules
+  links      list the interfaces the firewall is attached to
+  events     print the recent events of denied packets
+  bans       list the sources that rules with autoBan banned
+  blocklist  list the source addresses and CIDRs of the blocklist
+
+Run infwctl <command> -h for the flags of a command.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var err error
+	switch os.Args[1] {
+	case "explain":
+		err = runExplain(os.Args[2:], os.Stdout)
+	case "rules":
+		err = runRules(os.Args[2:], os.Stdout)
+	case "stats":
+		err = runStats(os.Args[2:], os.Stdout)
+	case "links":
+		err = runLinks(os.Args[2:], os.Stdout)
+	case "events":
+		err = runEvents(os.Args[2:], os.Stdout)
+	case "bans":
+		err = runBans(os.Args[2:], os.Stdout)
+	case "blocklist":
+		err = runBlocklist(os.Args[2:], os.Stdout)
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(os.Stdout, usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// runExplain runs the explain command with the provided arguments and writes the explanation to out.
+func runExplain(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("explain", flag.ContinueOnError)
+	nodeStateFile := flags.String("node-state", "", "YAML or JSON file with the IngressNodeFirewallNodeState of the node, "+
+		"e.g. the output of kubectl get ingressnodefirewallnodestates <node> -o yaml")
+	nodeName := flags.String("node", "", "name of the node if the node state file contains a list")
+	ruleInheritance := flags.Bool("rule-inheritance", false, "set if ruleInheritance is enabled in the IngressNodeFirewallConfig")
+	allowEssentialICMPv6 := flags.Bool("allow-essential-icmpv6", false,
+		"set if allowEssentialICMPv6 is enabled in the IngressNodeFirewallConfig")
+	iface := flags.String("interface", "", "interface that receives the packet, the bond for packets received on a bond slave")
+	sourceIP := flags.String("source", "", "source IP address of the packet")
+	protocol := flags.String("protocol", "TCP", "protocol of the packet, TCP, UDP, SCTP, ICMP, ICMPv6 or an IP protocol number")
+	port := flags.Uint("port", 0, "destination port of TCP, UDP and SCTP packets")
+	icmpType := flags.Uint("icmp-type", 0, "type of ICMP and ICMPv6 packets")
+	icmpCode := flags.Uint("icmp-code", 0, "code of ICMP and ICMPv6 packets")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *nodeStateFile == "" || *iface == "" || *sourceIP == "" {
+		return fmt.Errorf("--node-state, --interface and --source are required")
+	}
+	packet := explain.Packet{Interface: *iface, SourceIP: net.ParseIP(*sourceIP)}
+	if packet.SourceIP == nil {
+		return fmt.Errorf("invalid source IP address %q", *sourceIP)
+	}
+	var err error
+	if packet.Protocol, err = explain.ParseProtocol(*protocol); err != nil {
+		return err
+	}
+	if *port > 65535 || *icmpType > 255 || *icmpCode > 255 {
+		return fmt.Errorf("port, ICMP type or ICMP code out of range")
+	}
+	packet.DstPort, packet.ICMPType, packet.ICMPCode = uint16(*port), uint8(*icmpType), uint8(*icmpCode)
+
+	nodeState, err := readNodeState(*nodeStateFile, *nodeName)
+	if err != nil {
+		return err
+	}
+	options := explain.Options{RuleInheritance: *ruleInheritance, AllowEssentialICMPv6: *allowEssentialICMPv6}
+	evaluator, err := explain.NewEvaluator(nodeState.Spec, options)
+	if err != nil {
+		return err
+	}
+	result, err := evaluator.Explain(packet)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Verdict:     %s\n", result.Verdict)
+	fmt.Fprintf(out, "Reason:      %s\n", result.Reason)
+	if result.SourceCIDR != "" {
+		fmt.Fprintf(out, "Source CIDR: %s\n", result.SourceCIDR)
+	}
+	if result.Rule != nil {
+		rule, err := json.Marshal(result.Rule)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Rule:        %s\n", rule)
+		if result.RuleSourceCIDR != result.SourceCIDR {
+			fmt.Fprintf(out, "Inherited:   from source CIDR %s\n", result.RuleSourceCIDR)
+		}
+		if len(result.Owners) > 0 {
+			fmt.Fprintf(out, "Owners:      %s\n", strings.Join(result.Owners, ", "))
+		}
+	}
+	return nil
+}
+
+// listObject is a list of Kubernetes objects of any kind.
+type listObject struct {
+	Kind  string            `json:"kind"`
+	Items []json.RawMessage `json:"items"`
+}
+
+// readObjects returns the objects in a YAML or JSON file that holds a single object or a list.
+func readObjects(fileName string) ([]json.RawMessage, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	data, err = yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", fileName, err)
+	}
+	var list listObject
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", fileName, err)
+	}
+	if strings.HasSuffix(list.Kind, "List") {
+		return list.Items, nil
+	}
+	return []json.RawMessage{data}, nil
+}
+
+// readNodeState returns the IngressNodeFirewallNodeState in fileName. If the file holds a list, the node state of
+// nodeName is returned.
+func readNodeState(fileName, nodeName string) (*infv1alpha1.IngressNodeFirewallNodeState, error) {
+	objects, err := readObjects(fileName)
+	if err != nil {
+		return nil, err
+	}
+	for _, object := range objects {
+		nodeState := &infv1alpha1.IngressNodeFirewallNodeState{}
+		if err := json.Unmarshal(object, nodeState); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", fileName, err)
+		}
+		if len(objects) == 1 || nodeState.Name == nodeName {
+			return nodeState, nil
+		}
+	}
+	if nodeName == "" {
+		return nil, fmt.Errorf("%s holds %d node states, select one with --node", fileName, len(objects))
+	}
+	return nil, fmt.Errorf("%s holds no node state for node %s", fileName, nodeName)
+}
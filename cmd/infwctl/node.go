@@ -0,0 +1,306 @@
+/*
+Copyright 2022.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	nodefwloader "github.com/openshift/ingress-node-firewall/pkg/ebpf"
+)
+
+// The commands in this file inspect the live state of the firewall on the node, they run in the daemon container.
+
+// interfaceName returns the name of the interface with the provided index, or the index if the interface does not
+// exist.
+func interfaceName(ifIndex uint32) string {
+	iface, err := net.InterfaceByIndex(int(ifIndex))
+	if err != nil {
+		return fmt.Sprintf("index %d", ifIndex)
+	}
+	return iface.Name
+}
+
+// protocolName returns the name of the protocol of a rule.
+func protocolName(protocol uint8) string {
+	switch protocol {
+	case 0:
+		return "any"
+	case syscall.IPPROTO_TCP:
+		return "TCP"
+	case syscall.IPPROTO_UDP:
+		return "UDP"
+	case syscall.IPPROTO_SCTP:
+		return "SCTP"
+	case syscall.IPPROTO_ICMP:
+		return "ICMP"
+	case syscall.IPPROTO_ICMPV6:
+		return "ICMPv6"
+	default:
+		return fmt.Sprint(protocol)
+	}
+}
+
+// ruleMatch returns the ports or ICMP type and code that a rule matches.
+func ruleMatch(rule nodefwloader.BpfRuleTypeSt) string {
+	switch rule.Protocol {
+	case syscall.IPPROTO_TCP, syscall.IPPROTO_UDP, syscall.IPPROTO_SCTP:
+		if rule.DstPortEnd != 0 {
+			return fmt.Sprintf("ports %d-%d", rule.DstPortStart, rule.DstPortEnd)
+		}
+		return fmt.Sprintf("port %d", rule.DstPortStart)
+	case syscall.IPPROTO_ICMP, syscall.IPPROTO_ICMPV6:
+		types := fmt.Sprintf("type %d", rule.IcmpType)
+		if rule.IcmpTypeEnd > rule.IcmpType {
+			types = fmt.Sprintf("types %d-%d", rule.IcmpType, rule.IcmpTypeEnd)
+		}
+		if rule.IcmpAnyCode != 0 {
+			return types + " code any"
+		}
+		return fmt.Sprintf("%s code %d", types, rule.IcmpCode)
+	default:
+		return "-"
+	}
+}
+
+// actionName returns the name of the action of a rule, XDP_DROP for deny and XDP_PASS for allow.
+func actionName(action uint8) string {
+	switch action {
+	case 1:
+		return "Deny"
+	case 2:
+		return "Allow"
+	default:
+		return fmt.Sprintf("invalid action %d", action)
+	}
+}
+
+// ruleAction returns the action of a rule and the autoBan settings of the rule, if any.
+func ruleAction(rule nodefwloader.BpfRuleTypeSt) string {
+	if rule.AutoBan.Threshold == 0 {
+		return actionName(rule.Action)
+	}
+	return fmt.Sprintf("%s, ban after %d in %ds for %ds", actionName(rule.Action), rule.AutoBan.Threshold,
+		rule.AutoBan.Period, rule.AutoBan.Duration)
+}
+
+// runRules runs the rules command, which lists the source CIDRs and rules of every interface.
+func runRules(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("rules", flag.ContinueOnError)
+	pinPath := flags.String("pin-path", nodefwloader.DefaultPinPath, "directory of the pinned eBPF maps and links")
+	iface := flags.String("interface", "", "only list the rules of this interface")
+	withStats := flags.Bool("stats", false, "show the statistics of the rules")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	state, err := nodefwloader.OpenPinnedState(*pinPath)
+	if err != nil {
+		return err
+	}
+	defer state.Close()
+	targets, err := state.Targets()
+	if err != nil {
+		return err
+	}
+	var statistics map[uint32]nodefwloader.BpfRuleStatisticsSt
+	if *withStats {
+		if statistics, err = state.Statistics(); err != nil {
+			return err
+		}
+	}
+
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	for _, target := range targets {
+		name := interfaceName(target.Key.IngressIfindex)
+		if *iface != "" && name != *iface {
+			continue
+		}
+		cidrs := nodefwloader.KeyCIDRs(target.Key)
+		fmt.Fprintf(w, "Interface %s (index %d), source %s, rules ID %d\n", name, target.Key.IngressIfindex,
+			strings.Join(cidrs, " and "), target.Value.RulesId)
+		header := "\tORDER\tPROTOCOL\tMATCH\tACTION"
+		if *withStats {
+			header += "\tALLOWED PACKETS\tALLOWED BYTES\tDENIED PACKETS\tDENIED BYTES"
+		}
+		fmt.Fprintln(w, header)
+		for _, rule := range target.Rules {
+			line := fmt.Sprintf("\t%d\t%s\t%s\t%s", rule.RuleId, protocolName(rule.Protocol), ruleMatch(rule),
+				ruleAction(rule))
+			if *withStats {
+				stats := statistics[rule.RuleId]
+				line += fmt.Sprintf("\t%d\t%d\t%d\t%d", stats.AllowStats.Packets, stats.AllowStats.Bytes,
+					stats.DenyStats.Packets, stats.DenyStats.Bytes)
+			}
+			fmt.Fprintln(w, line)
+		}
+	}
+	if *withStats {
+		// Rule IDs are the orders of the rules, the statistics of rules with the same order on different
+		// interfaces and source CIDRs are shared.
+		fmt.Fprintln(w, "Statistics are per rule order, summed over all interfaces and source CIDRs.")
+	}
+	return w.Flush()
+}
+
+// runStats runs the stats command, which lists the statistics of the rules that matched packets.
+func runStats(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("stats", flag.ContinueOnError)
+	pinPath := flags.String("pin-path", nodefwloader.DefaultPinPath, "directory of the pinned eBPF maps and links")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	state, err := nodefwloader.OpenPinnedState(*pinPath)
+	if err != nil {
+		return err
+	}
+	defer state.Close()
+	statistics, err := state.Statistics()
+	if err != nil {
+		return err
+	}
+	ruleIDs := make([]uint32, 0, len(statistics))
+	for ruleID := range statistics {
+		ruleIDs = append(ruleIDs, ruleID)
+	}
+	sort.Slice(ruleIDs, func(i, j int) bool { return ruleIDs[i] < ruleIDs[j] })
+
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "ORDER\tALLOWED PACKETS\tALLOWED BYTES\tDENIED PACKETS\tDENIED BYTES\tSAMPLED OUT EVENTS\tRATE LIMITED EVENTS")
+	for _, ruleID := range ruleIDs {
+		stats := statistics[ruleID]
+		// Packets of blocklisted sources are counted under the invalid rule ID 0.
+		order := fmt.Sprint(ruleID)
+		if ruleID == 0 {
+			order = "blocklist"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%d\n", order, stats.AllowStats.Packets, stats.AllowStats.Bytes,
+			stats.DenyStats.Packets, stats.DenyStats.Bytes, stats.EventStats.SampledOut, stats.EventStats.RateLimited)
+	}
+	return w.Flush()
+}
+
+// runLinks runs the links command, which lists the pinned XDP links of the firewall.
+func runLinks(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("links", flag.ContinueOnError)
+	pinPath := flags.String("pin-path", nodefwloader.DefaultPinPath, "directory of the pinned eBPF maps and links")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	state, err := nodefwloader.OpenPinnedState(*pinPath)
+	if err != nil {
+		return err
+	}
+	defer state.Close()
+	links, err := state.Links()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "INTERFACE\tATTACHED TO\tLINK ID\tPROGRAM ID\tPIN")
+	for _, l := range links {
+		attachedTo := "-"
+		if l.IfIndex != 0 {
+			attachedTo = fmt.Sprintf("%s (index %d)", interfaceName(l.IfIndex), l.IfIndex)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\n", l.Interface, attachedTo, l.ID, l.ProgramID, l.Path)
+	}
+	return w.Flush()
+}
+
+// runBans runs the bans command, which lists the sources that rules with autoBan banned.
+func runBans(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("bans", flag.ContinueOnError)
+	pinPath := flags.String("pin-path", nodefwloader.DefaultPinPath, "directory of the pinned eBPF maps and links")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	state, err := nodefwloader.OpenPinnedState(*pinPath)
+	if err != nil {
+		return err
+	}
+	defer state.Close()
+	bans, err := state.Bans()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "SOURCE\tORDER\tREMAINING")
+	for _, ban := range bans {
+		fmt.Fprintf(w, "%s\t%d\t%s\n", ban.Source, ban.RuleID, ban.Remaining.Round(time.Second))
+	}
+	return w.Flush()
+}
+
+// runBlocklist runs the blocklist command, which lists the source addresses and CIDRs of the blocklist.
+func runBlocklist(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("blocklist", flag.ContinueOnError)
+	pinPath := flags.String("pin-path", nodefwloader.DefaultPinPath, "directory of the pinned eBPF maps and links")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	state, err := nodefwloader.OpenPinnedState(*pinPath)
+	if err != nil {
+		return err
+	}
+	defer state.Close()
+	cidrs, err := state.Blocklist()
+	if err != nil {
+		return err
+	}
+	for _, cidr := range cidrs {
+		if _, err := fmt.Fprintln(out, cidr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runEvents runs the events command, which prints the recent events of the XDP program that the daemon received.
+func runEvents(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("events", flag.ContinueOnError)
+	socketPath := flags.String("socket", nodefwloader.EventsSocketPath, "events socket of the daemon")
+	follow := flags.Bool("f", false, "keep printing new events")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	return nodefwloader.ReadEvents(*socketPath, *follow, func(event nodefwloader.Event) error {
+		var ban string
+		switch {
+		case event.Blocklisted:
+			ban = "  source in blocklist"
+		case event.BanStarted:
+			ban = "  source banned now"
+		case event.SourceBanned:
+			ban = "  source banned"
+		}
+		_, err := fmt.Fprintf(out, "%s  %-5s  rule %d  if %s  len %d  %s%s\n", event.Timestamp.Format(time.RFC3339Nano),
+			event.Action, event.RuleID, event.Interface, event.Length, event.Packet, ban)
+		return err
+	})
+}
@@ -18,20 +18,32 @@ package controllers
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"reflect"
+	"sort"
+	"time"
 
 	infv1alpha1 "github.com/openshift/ingress-node-firewall/api/v1alpha1"
+	"github.com/openshift/ingress-node-firewall/pkg/schedule"
 
 	"github.com/go-logr/logr"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
@@ -42,12 +54,21 @@ type IngressNodeFirewallReconciler struct {
 	Scheme    *runtime.Scheme
 	Log       logr.Logger
 	Namespace string
+	// PodCIDRs and ServiceCIDRs are the CIDRs of the cluster's pod and service networks. They are used to resolve
+	// fromClusterNetworks when the cluster does not provide an OpenShift cluster network configuration.
+	PodCIDRs     []string
+	ServiceCIDRs []string
+	// Recorder records the events of IngressNodeFirewalls whose ingress rules resolve to no source CIDRs. It can be
+	// left nil.
+	Recorder record.EventRecorder
 }
 
 //+kubebuilder:rbac:groups=ingressnodefirewall.openshift.io,resources=ingressnodefirewalls,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=ingressnodefirewall.openshift.io,resources=ingressnodefirewalls/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=ingressnodefirewall.openshift.io,resources=ingressnodefirewalls/finalizers,verbs=update
+//+kubebuilder:rbac:groups=ingressnodefirewall.openshift.io,resources=ingressnodefirewalladdresssets,verbs=get;list;watch
 //+kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -76,7 +97,7 @@ func (r *IngressNodeFirewallReconciler) Reconcile(ctx context.Context, req ctrl.
 		return ctrl.Result{}, err
 	}
 	r.Log.Info("Building the desired node state specs", "req.Name", req.Name)
-	desiredNodeStates, err := r.buildNodeStates(ctx, ingressNodeFirewallList.DeepCopy())
+	desiredNodeStates, nextTransition, err := r.buildNodeStates(ctx, ingressNodeFirewallList.DeepCopy())
 	if err != nil {
 		r.Log.Error(err, "Failed to build IngressNodeFirewallNodeState")
 		return ctrl.Result{}, err
@@ -195,13 +216,21 @@ func (r *IngressNodeFirewallReconciler) Reconcile(ctx context.Context, req ctrl.
 			"ingressNodeFirewallNodeState.Name", ingressNodeFirewallNodeState.Name)
 	}
 
+	// Reconcile again when the next ingress rules expire or the next schedule window of a rule opens or closes, so
+	// that the rules are removed from or applied to the nodes.
+	if nextTransition != nil {
+		r.Log.Info("Requeueing for the next expiry or schedule transition of rules", "req.Name", req.Name,
+			"nextTransition", nextTransition)
+		return ctrl.Result{RequeueAfter: time.Until(nextTransition.Time)}, nil
+	}
 	return ctrl.Result{}, nil
 }
 
-// triggerReconciliation triggers reconciliation for the first ingressnodefwv1alpha1.IngressNodeFirewall object that it
-// can find. Triggering reconciliation for a single object suffices because the IngressNodeFirewall reconciler will list
-// and reconcile all dependant resources with each reconciliation.
-func (r *IngressNodeFirewallReconciler) triggerReconciliation(ctx context.Context, object client.Object) []reconcile.Request {
+// triggerReconciliation triggers reconciliation for all ingressnodefwv1alpha1.IngressNodeFirewall objects whose
+// node selector matches the labels of any of the provided nodes, or whose source CIDRs depend on the cluster nodes.
+// For node updates, both the old and the new version of the node are provided so that nodes which stop being
+// matched by a node selector lead to reconciliation as well.
+func (r *IngressNodeFirewallReconciler) triggerReconciliation(ctx context.Context, nodes ...client.Object) []reconcile.Request {
 	ingressNodeFirewallList := infv1alpha1.IngressNodeFirewallList{}
 	reconcileReq := make([]reconcile.Request, 0)
 	listOpts := []client.ListOption{}
@@ -216,12 +245,23 @@ func (r *IngressNodeFirewallReconciler) triggerReconciliation(ctx context.Contex
 	}
 
 	for _, fwobj := range ingressNodeFirewallList.Items {
-		if reflect.DeepEqual(fwobj.Spec.NodeSelector.MatchLabels, object.GetLabels()) {
-			nodeState := fwobj
+		nodeSelector, err := metav1.LabelSelectorAsSelector(&fwobj.Spec.NodeSelector)
+		if err != nil {
+			r.Log.Error(err, "Invalid node selector", "IngressNodeFirewall", fwobj.Name)
+			continue
+		}
+		matches := usesNodeSources(fwobj.Spec.Ingress)
+		for _, node := range nodes {
+			if matches {
+				break
+			}
+			matches = nodeSelector.Matches(labels.Set(node.GetLabels()))
+		}
+		if matches {
 			req := reconcile.Request{
 				NamespacedName: types.NamespacedName{
-					Name:      nodeState.Name,
-					Namespace: nodeState.Namespace,
+					Name:      fwobj.Name,
+					Namespace: fwobj.Namespace,
 				},
 			}
 			reconcileReq = append(reconcileReq, req)
@@ -230,31 +270,114 @@ func (r *IngressNodeFirewallReconciler) triggerReconciliation(ctx context.Contex
 	return reconcileReq
 }
 
+// nodeEventHandler returns the event handler for objects of Kind Node. Node updates are only taken into account if
+// they change the node's labels or any of the node properties that are used to resolve rule sources.
+func (r *IngressNodeFirewallReconciler) nodeEventHandler() handler.EventHandler {
+	enqueue := func(q workqueue.RateLimitingInterface, reqs []reconcile.Request) {
+		for _, req := range reqs {
+			q.Add(req)
+		}
+	}
+	return handler.Funcs{
+		CreateFunc: func(ctx context.Context, e event.CreateEvent, q workqueue.RateLimitingInterface) {
+			enqueue(q, r.triggerReconciliation(ctx, e.Object))
+		},
+		UpdateFunc: func(ctx context.Context, e event.UpdateEvent, q workqueue.RateLimitingInterface) {
+			if !nodeChanged(e.ObjectOld, e.ObjectNew) {
+				return
+			}
+			enqueue(q, r.triggerReconciliation(ctx, e.ObjectOld, e.ObjectNew))
+		},
+		DeleteFunc: func(ctx context.Context, e event.DeleteEvent, q workqueue.RateLimitingInterface) {
+			enqueue(q, r.triggerReconciliation(ctx, e.Object))
+		},
+		GenericFunc: func(ctx context.Context, e event.GenericEvent, q workqueue.RateLimitingInterface) {
+			enqueue(q, r.triggerReconciliation(ctx, e.Object))
+		},
+	}
+}
+
+// nodeChanged returns true if the labels, addresses or pod CIDRs differ between the old and the new node.
+func nodeChanged(oldObj, newObj client.Object) bool {
+	if !reflect.DeepEqual(oldObj.GetLabels(), newObj.GetLabels()) {
+		return true
+	}
+	oldNode, ok := oldObj.(*v1.Node)
+	if !ok {
+		return true
+	}
+	newNode, ok := newObj.(*v1.Node)
+	if !ok {
+		return true
+	}
+	return !equality.Semantic.DeepEqual(oldNode.Status.Addresses, newNode.Status.Addresses) ||
+		!equality.Semantic.DeepEqual(oldNode.Spec.PodCIDRs, newNode.Spec.PodCIDRs)
+}
+
 // SetupWithManager sets up the controller with the Manager.
 // In addition to watching IngressNodeFirewall this also watches all objects of Kind Node and any change to a node
-// will trigger a reconciliation request.
+// that affects the set of nodes matched by an IngressNodeFirewall will trigger a reconciliation request.
+// Changes to objects of type IngressNodeFirewallAddressSet trigger reconciliation of the IngressNodeFirewall objects
+// that reference them. Changes to the IngressNodeFirewallConfig trigger reconciliation as it defines the capacity of
+// the nodes. On OpenShift, changes to the cluster network configuration trigger reconciliation of the
+// IngressNodeFirewall objects that use fromClusterNetworks.
 // Additionally, changes to objects of type IngressNodeFirewallNodeState with an owner references will lead to
 // reconciliation as well. Given that an IngressNodeFirewallNodeState can have multiple owners, reconciliation will
 // be triggered for any of them (thus, IsController: false).
 func (r *IngressNodeFirewallReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	builder := ctrl.NewControllerManagedBy(mgr).
 		For(&infv1alpha1.IngressNodeFirewall{}).
 		Watches(
 			&v1.Node{},
-			handler.EnqueueRequestsFromMapFunc(r.triggerReconciliation)).
+			r.nodeEventHandler()).
+		Watches(
+			&infv1alpha1.IngressNodeFirewallAddressSet{},
+			handler.EnqueueRequestsFromMapFunc(r.triggerAddressSetReconciliation)).
+		Watches(
+			&infv1alpha1.IngressNodeFirewallConfig{},
+			handler.EnqueueRequestsFromMapFunc(r.triggerConfigReconciliation)).
 		Watches(
 			&infv1alpha1.IngressNodeFirewallNodeState{},
-			handler.EnqueueRequestForOwner(mgr.GetScheme(), mgr.GetRESTMapper(), &infv1alpha1.IngressNodeFirewall{})).
-		Complete(r)
+			handler.EnqueueRequestForOwner(mgr.GetScheme(), mgr.GetRESTMapper(), &infv1alpha1.IngressNodeFirewall{}))
+	// The cluster network configuration only exists on OpenShift.
+	_, err := mgr.GetRESTMapper().RESTMapping(networkConfigGVK.GroupKind(), networkConfigGVK.Version)
+	if err == nil {
+		networkConfig := &unstructured.Unstructured{}
+		networkConfig.SetGroupVersionKind(networkConfigGVK)
+		builder = builder.Watches(networkConfig, handler.EnqueueRequestsFromMapFunc(r.triggerClusterNetworkReconciliation))
+	} else if !meta.IsNoMatchError(err) {
+		return err
+	}
+	return builder.Complete(r)
 }
 
 // buildNodeStates reads a list of *ingressnodefwv1alpha1.IngressNodeFirewallList and builds an appropriate mapping
-// of <nodeName> to IngressNodeFirewallNodeState.
-func (r *IngressNodeFirewallReconciler) buildNodeStates(
-	ctx context.Context, infList *infv1alpha1.IngressNodeFirewallList) (map[string]infv1alpha1.IngressNodeFirewallNodeState, error) {
+// of <nodeName> to IngressNodeFirewallNodeState. Expired ingress rules and rules outside of their schedule windows are
+// left out. It also returns the earliest time at which ingress rules expire or a schedule window opens or closes, or
+// nil if there is none.
+func (r *IngressNodeFirewallReconciler) buildNodeStates(ctx context.Context,
+	infList *infv1alpha1.IngressNodeFirewallList) (map[string]infv1alpha1.IngressNodeFirewallNodeState, *metav1.Time, error) {
 	var err error
+	var nextTransition *metav1.Time
+	now := time.Now()
 	nodeList := v1.NodeList{}
 	nodeStates := make(map[string]infv1alpha1.IngressNodeFirewallNodeState)
+	// nodeRuleSets holds the merged rules per node and interface, including the priority that each rule originates
+	// from, in a map [<nodeName>][<interface name>][]tieredRuleSet.
+	nodeRuleSets := make(map[string]map[string][]tieredRuleSet)
+	maxTargets, maxRulesPerTarget, err := r.getCapacity(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Process IngressNodeFirewall objects in order of their priority so that the result does not depend on the
+	// order in which the objects are listed.
+	sort.SliceStable(infList.Items, func(i, j int) bool {
+		if infList.Items[i].Spec.Priority != infList.Items[j].Spec.Priority {
+			return infList.Items[i].Spec.Priority < infList.Items[j].Spec.Priority
+		}
+		return infList.Items[i].Name < infList.Items[j].Name
+	})
 
 	// Build the NodeStates in a map [<nodeName>]IngressNodeFirewallNodeState.
 	// Iterate over all IngressNodeFirewall objects. Get all nodes that are matched by an IngressNodeFirewall object.
@@ -266,12 +389,44 @@ func (r *IngressNodeFirewallReconciler) buildNodeStates(
 	// in any further iteration.
 	for _, obj := range infList.Items {
 		firewallObj := obj.DeepCopy()
+		nodeSelector, selectorErr := metav1.LabelSelectorAsSelector(&firewallObj.Spec.NodeSelector)
+		if selectorErr != nil {
+			r.Log.Error(selectorErr, "Invalid node selector", "IngressNodeFirewall", firewallObj.Name)
+			firewallObj.Status.SyncStatus = infv1alpha1.FirewallRulesSyncError
+			if err := r.Status().Update(ctx, firewallObj); err != nil {
+				r.Log.Error(err, "failed to update ingress node firewall obj status", "firewall obj", firewallObj.Name)
+			}
+			continue
+		}
 		listOpts := []client.ListOption{
-			client.MatchingLabels(firewallObj.Spec.NodeSelector.MatchLabels),
+			client.MatchingLabelsSelector{Selector: nodeSelector},
 		}
 		err = r.List(ctx, &nodeList, listOpts...)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
+		}
+		// Leave out the rules outside of their schedule windows and the expired ingress rules, and record them in
+		// the status. An invalid schedule is reported in the status of each matched node further below.
+		scheduled, scheduledRules, transition, scheduleErr := scheduledIngress(firewallObj.Spec.Ingress, now)
+		// The ttl of ingress rules counts from their start, which is recorded before the rules are applied. Otherwise,
+		// a failed status update would restart the ttl on the next reconciliation and the rules would never expire.
+		if starts := ttlStarts(firewallObj.Spec.Ingress, firewallObj.Status.TTLStarts, now); !equality.Semantic.DeepEqual(
+			starts, firewallObj.Status.TTLStarts) {
+			firewallObj.Status.TTLStarts = starts
+			if err := r.Status().Update(ctx, firewallObj); err != nil {
+				return nil, nil, fmt.Errorf("failed to record the ttl starts of IngressNodeFirewall %s: %w",
+					firewallObj.Name, err)
+			}
+		}
+		active, expired, expiry := activeIngress(scheduled, firewallObj.Status.TTLStarts, now)
+		firewallObj.Status.ExpiredIngress, firewallObj.Status.NextExpiry = expired, expiry
+		firewallObj.Status.ScheduledRules = scheduledRules
+		nextTransition = earliest(nextTransition, expiry, transition)
+		// Expand address set references, node selectors and cluster networks of the ingress rules into their source
+		// CIDRs. A failure to do so is reported in the status of each matched node further below.
+		ingress, unresolved, resolveErr := r.resolveSourceCIDRs(ctx, active)
+		if resolveErr == nil {
+			r.recordUnresolvedIngress(firewallObj, unresolved, expired)
 		}
 
 	withNextNode:
@@ -316,6 +471,26 @@ func (r *IngressNodeFirewallReconciler) buildNodeStates(
 			// set it to SyncOK.
 			state.Status.SyncStatus = infv1alpha1.SyncOK
 
+			if resolveErr != nil {
+				state.Status = infv1alpha1.IngressNodeFirewallNodeStateStatus{
+					SyncStatus:       infv1alpha1.SyncError,
+					SyncErrorMessage: fmt.Sprintf("Cannot resolve source CIDRs, err: %q", resolveErr),
+				}
+				// Write back the state to the map and then continue with the next node.
+				nodeStates[node.Name] = state
+				continue withNextNode
+			}
+
+			if scheduleErr != nil {
+				state.Status = infv1alpha1.IngressNodeFirewallNodeStateStatus{
+					SyncStatus:       infv1alpha1.SyncError,
+					SyncErrorMessage: fmt.Sprintf("Invalid schedule, err: %q", scheduleErr),
+				}
+				// Write back the state to the map and then continue with the next node.
+				nodeStates[node.Name] = state
+				continue withNextNode
+			}
+
 			// Now, iterate over all interfaces in the InrgessNodeFirewallSpec.
 			if len(firewallObj.Spec.Interfaces) == 0 {
 				state.Status = infv1alpha1.IngressNodeFirewallNodeStateStatus{
@@ -326,24 +501,41 @@ func (r *IngressNodeFirewallReconciler) buildNodeStates(
 				nodeStates[node.Name] = state
 				continue withNextNode
 			}
+			if _, ok := nodeRuleSets[node.Name]; !ok {
+				nodeRuleSets[node.Name] = make(map[string][]tieredRuleSet)
+			}
 			for _, iface := range firewallObj.Spec.Interfaces {
-				// Create the rules for the node spec if they do not yet exist for this interface.
-				if _, ok := state.Spec.InterfaceIngressRules[iface]; !ok {
-					state.Spec.InterfaceIngressRules[iface] = []infv1alpha1.IngressNodeFirewallRules{}
-				}
 				// Merge in rules.
-				state.Spec.InterfaceIngressRules[iface], err = mergeRuleSet(
-					state.Spec.InterfaceIngressRules[iface], firewallObj.Spec.Ingress)
-				// On error, report the error in the status field and continue with the next node.
+				nodeRuleSets[node.Name][iface], err = mergeRuleSet(
+					nodeRuleSets[node.Name][iface], ingress, firewallObj.Spec.Priority, firewallObj.Name)
 				if err != nil {
-					state.Status = infv1alpha1.IngressNodeFirewallNodeStateStatus{
-						SyncStatus:       infv1alpha1.SyncError,
-						SyncErrorMessage: fmt.Sprintf("Illegal ruleset merge operation, err: %q", err),
-					}
-					// Write back the state to the map and then continue with the next node.
-					nodeStates[node.Name] = state
-					continue withNextNode
+					break
+				}
+			}
+			// Compile the merged rules of all interfaces into the rules of the node spec, since the rule IDs of a
+			// priority tier depend on the rules of the lower tiers on every interface.
+			if err == nil {
+				err = compileNodeRuleSets(nodeRuleSets[node.Name], &state.Spec)
+			}
+			// On error, report the error in the status field and continue with the next node.
+			if err != nil {
+				state.Status = infv1alpha1.IngressNodeFirewallNodeStateStatus{
+					SyncStatus:       infv1alpha1.SyncError,
+					SyncErrorMessage: fmt.Sprintf("Illegal ruleset merge operation, err: %q", err),
+				}
+				// Write back the state to the map and then continue with the next node.
+				nodeStates[node.Name] = state
+				continue withNextNode
+			}
+			// Verify that the merged rules fit into the eBPF maps of the node.
+			if err := checkCapacity(state.Spec.InterfaceIngressRules, maxTargets, maxRulesPerTarget); err != nil {
+				state.Status = infv1alpha1.IngressNodeFirewallNodeStateStatus{
+					SyncStatus:       infv1alpha1.SyncError,
+					SyncErrorMessage: fmt.Sprintf("Capacity exceeded, err: %q", err),
 				}
+				// Write back the state to the map and then continue with the next node.
+				nodeStates[node.Name] = state
+				continue withNextNode
 			}
 			// Write back the state to the map.
 			nodeStates[node.Name] = state
@@ -361,14 +553,235 @@ func (r *IngressNodeFirewallReconciler) buildNodeStates(
 		}
 	}
 
-	return nodeStates, nil
+	return nodeStates, nextTransition, nil
 }
 
-// mergeRuleSet merges 2 rulesets of type []infv1alpha1.IngressNodeFirewallRules.
-// Ruleset a and the returned ruleset will go into IngressNodeFirewallNodeState. Therefore, for ruleset a and for
-// the returned ruleset, SourceCIDRs must be of length 1.
-// Ruleset b comes from IngressNoeFirewall. Therefore, for ruleset b, SourceCIDRs can have any length >= 1.
-func mergeRuleSet(a, b []infv1alpha1.IngressNodeFirewallRules) ([]infv1alpha1.IngressNodeFirewallRules, error) {
+// earliest returns the earliest of times, ignoring nil times, or nil if all of them are nil.
+func earliest(times ...*metav1.Time) *metav1.Time {
+	var result *metav1.Time
+	for _, t := range times {
+		if t != nil && (result == nil || t.Before(result)) {
+			result = t
+		}
+	}
+	return result
+}
+
+// scheduledIngress returns the ingress rules without the rules whose schedule windows are all closed at now, the status
+// of each rule with a schedule, and the earliest time at which one of their windows opens or closes.
+func scheduledIngress(ingress []infv1alpha1.IngressNodeFirewallRules, now time.Time) (
+	[]infv1alpha1.IngressNodeFirewallRules, []infv1alpha1.IngressNodeFirewallScheduledRuleStatus, *metav1.Time, error) {
+	scheduled := make([]infv1alpha1.IngressNodeFirewallRules, 0, len(ingress))
+	var statuses []infv1alpha1.IngressNodeFirewallScheduledRuleStatus
+	var nextTransition *metav1.Time
+	for idx, entry := range ingress {
+		var rules []infv1alpha1.IngressNodeFirewallProtocolRule
+		for _, rule := range entry.FirewallProtocolRules {
+			if rule.Schedule == nil {
+				rules = append(rules, rule)
+				continue
+			}
+			window, err := schedule.NewWindow(rule.Schedule.Start, rule.Schedule.Duration.Duration,
+				rule.Schedule.TimeZone)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("rule with order %d of ingress rules %d: %w", rule.Order, idx, err)
+			}
+			active, transition := window.Active(now)
+			status := infv1alpha1.IngressNodeFirewallScheduledRuleStatus{
+				Ingress: int32(idx),
+				Order:   rule.Order,
+				Active:  active,
+			}
+			if !transition.IsZero() {
+				status.NextTransition = &metav1.Time{Time: transition}
+				nextTransition = earliest(nextTransition, status.NextTransition)
+			}
+			if active {
+				rules = append(rules, rule)
+			}
+			statuses = append(statuses, status)
+		}
+		entry.FirewallProtocolRules = rules
+		scheduled = append(scheduled, entry)
+	}
+	return scheduled, statuses, nextTransition, nil
+}
+
+// activeIngress returns the ingress rules of an IngressNodeFirewall that have not expired at now, the indices of the
+// expired ingress rules and the earliest expiry of the active ingress rules, or nil if none of them expires. starts
+// are the ttlStarts of the IngressNodeFirewall.
+func activeIngress(ingress []infv1alpha1.IngressNodeFirewallRules, starts []infv1alpha1.IngressNodeFirewallTTLStart,
+	now time.Time) ([]infv1alpha1.IngressNodeFirewallRules, []int32, *metav1.Time) {
+	var active []infv1alpha1.IngressNodeFirewallRules
+	var expired []int32
+	var nextExpiry *metav1.Time
+	for idx, entry := range ingress {
+		expiry := ingressExpiry(entry, starts)
+		if expiry != nil && !now.Before(expiry.Time) {
+			expired = append(expired, int32(idx))
+			continue
+		}
+		active = append(active, entry)
+		nextExpiry = earliest(nextExpiry, expiry)
+	}
+	return active, expired, nextExpiry
+}
+
+// ingressExpiry returns the time at which the ingress rules expire, or nil if they do not expire. The ttl of ingress
+// rules counts from their start in starts.
+func ingressExpiry(ingress infv1alpha1.IngressNodeFirewallRules, starts []infv1alpha1.IngressNodeFirewallTTLStart) *metav1.Time {
+	switch {
+	case ingress.ExpiresAt != nil:
+		return ingress.ExpiresAt
+	case ingress.TTL != nil:
+		hash := ingressHash(ingress)
+		for _, start := range starts {
+			if start.Ingress == hash {
+				expiry := metav1.NewTime(start.StartTime.Add(ingress.TTL.Duration))
+				return &expiry
+			}
+		}
+	}
+	return nil
+}
+
+// ttlStarts returns the ttlStarts of the ingress rules with a ttl of an IngressNodeFirewall. The ingress rules that
+// are in previous keep their start, the others start at now.
+func ttlStarts(ingress []infv1alpha1.IngressNodeFirewallRules, previous []infv1alpha1.IngressNodeFirewallTTLStart,
+	now time.Time) []infv1alpha1.IngressNodeFirewallTTLStart {
+	var starts []infv1alpha1.IngressNodeFirewallTTLStart
+	seen := make(map[string]bool)
+	for _, entry := range ingress {
+		if entry.TTL == nil {
+			continue
+		}
+		hash := ingressHash(entry)
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+		// The status stores times with a precision of seconds.
+		start := infv1alpha1.IngressNodeFirewallTTLStart{Ingress: hash, StartTime: metav1.NewTime(now.Truncate(time.Second))}
+		for _, p := range previous {
+			if p.Ingress == hash {
+				start = p
+				break
+			}
+		}
+		starts = append(starts, start)
+	}
+	return starts
+}
+
+// ingressHash identifies ingress rules by their sources and ttl, so that the ttl is not restarted when their
+// protocol rules change or are left out outside of their schedule windows.
+func ingressHash(ingress infv1alpha1.IngressNodeFirewallRules) string {
+	identity := infv1alpha1.IngressNodeFirewallRules{
+		SourceCIDRs:          ingress.SourceCIDRs,
+		SourceAddressSetRefs: ingress.SourceAddressSetRefs,
+		FromNodes:            ingress.FromNodes,
+		FromClusterNetworks:  ingress.FromClusterNetworks,
+		TTL:                  ingress.TTL,
+	}
+	// Marshaling the API type cannot fail.
+	data, _ := json.Marshal(identity)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// triggerConfigReconciliation triggers reconciliation for all ingressnodefwv1alpha1.IngressNodeFirewall objects when
+// the IngressNodeFirewallConfig changes.
+func (r *IngressNodeFirewallReconciler) triggerConfigReconciliation(ctx context.Context, object client.Object) []reconcile.Request {
+	if object.GetName() != defaultIngressNodeFirewallCrName || object.GetNamespace() != r.Namespace {
+		return []reconcile.Request{}
+	}
+	ingressNodeFirewallList := infv1alpha1.IngressNodeFirewallList{}
+	if err := r.List(ctx, &ingressNodeFirewallList); err != nil {
+		r.Log.Error(err, "Failed to list IngressNodeFirewall objects")
+		return []reconcile.Request{}
+	}
+
+	reconcileReq := make([]reconcile.Request, 0, len(ingressNodeFirewallList.Items))
+	for _, fwobj := range ingressNodeFirewallList.Items {
+		reconcileReq = append(reconcileReq, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      fwobj.Name,
+				Namespace: fwobj.Namespace,
+			},
+		})
+	}
+	return reconcileReq
+}
+
+// getCapacity returns the maximum number of source CIDR and interface combinations per node and the maximum number of
+// rules per source CIDR and interface from the IngressNodeFirewallConfig. The defaults are returned if the
+// IngressNodeFirewallConfig does not exist.
+func (r *IngressNodeFirewallReconciler) getCapacity(ctx context.Context) (int, int, error) {
+	config := &infv1alpha1.IngressNodeFirewallConfig{}
+	err := r.Get(ctx, types.NamespacedName{Name: defaultIngressNodeFirewallCrName, Namespace: r.Namespace}, config)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return infv1alpha1.DefaultMaxTargets, infv1alpha1.DefaultMaxRulesPerTarget, nil
+		}
+		return 0, 0, err
+	}
+	return config.Spec.GetMaxTargets(), config.Spec.GetMaxRulesPerTarget(), nil
+}
+
+// checkCapacity returns an error if the provided interface ingress rules of a node need more than maxTargets source
+// CIDR and interface combinations or if more than maxRulesPerTarget rules apply to any source CIDR and interface.
+// Bond interfaces are counted once here, the daemon reports an error if the slaves of a bond exceed the capacity.
+func checkCapacity(interfaceIngressRules map[string][]infv1alpha1.IngressNodeFirewallRules, maxTargets, maxRulesPerTarget int) error {
+	ifaces := make([]string, 0, len(interfaceIngressRules))
+	for iface := range interfaceIngressRules {
+		ifaces = append(ifaces, iface)
+	}
+	sort.Strings(ifaces)
+
+	targets := 0
+	for _, iface := range ifaces {
+		for _, rule := range interfaceIngressRules[iface] {
+			targets += len(rule.SourceCIDRs)
+			if len(rule.FirewallProtocolRules) > maxRulesPerTarget {
+				return fmt.Errorf("%d rules for sourceCIDRs %v on interface %s exceed the maximum of %d rules",
+					len(rule.FirewallProtocolRules), rule.SourceCIDRs, iface, maxRulesPerTarget)
+			}
+		}
+	}
+	if targets > maxTargets {
+		return fmt.Errorf("%d source CIDR and interface combinations exceed the maximum of %d", targets, maxTargets)
+	}
+	return nil
+}
+
+const (
+	// tierRuleIDAlignment aligns the first rule ID of every priority tier except the lowest.
+	tierRuleIDAlignment = 1024
+	// maxTieredRuleID is the highest rule ID of the rules of a priority tier other than the lowest, the daemon reports
+	// the rule IDs as 16 bit values and the highest rule IDs are used by the fail safe rules.
+	maxTieredRuleID = 65533
+)
+
+// tieredRule is an ingress node firewall protocol rule together with the priority of the IngressNodeFirewall that it
+// originates from.
+type tieredRule struct {
+	priority int32
+	firewall string
+	rule     infv1alpha1.IngressNodeFirewallProtocolRule
+}
+
+// tieredRuleSet holds all rules that apply to a single source CIDR.
+type tieredRuleSet struct {
+	sourceCIDR string
+	rules      []tieredRule
+}
+
+// mergeRuleSet merges ruleset b of type []infv1alpha1.IngressNodeFirewallRules into ruleset a.
+// Ruleset a holds a single entry per source CIDR.
+// Ruleset b comes from the IngressNodeFirewall firewall with the given priority. Therefore, for ruleset b, SourceCIDRs
+// can have any length >= 1.
+func mergeRuleSet(a []tieredRuleSet, b []infv1alpha1.IngressNodeFirewallRules, priority int32,
+	firewall string) ([]tieredRuleSet, error) {
 	var err error
 
 	// Go over each rule that shall be merged in.
@@ -379,47 +792,159 @@ func mergeRuleSet(a, b []infv1alpha1.IngressNodeFirewallRules) ([]infv1alpha1.In
 	withNextSourceCIDR:
 		for _, sourceCIDR := range ruleB.SourceCIDRs {
 			// Now, go over each existing rule in the already merged slice.
-			for i, ruleA := range a {
-				if len(ruleA.SourceCIDRs) != 1 {
-					return []infv1alpha1.IngressNodeFirewallRules{}, fmt.Errorf(
-						"cannot merge into ruleset A with invalid SourceCIDRs: '%v'", ruleA.SourceCIDRs)
-				}
+			for i, ruleSetA := range a {
 				// If the CIDR already exists in A, then merge it in and continue with the next CIDR.
-				if ruleA.SourceCIDRs[0] == sourceCIDR {
-					a[i].FirewallProtocolRules, err = mergeFirewallProtocolRules(
-						ruleA.FirewallProtocolRules, ruleB.FirewallProtocolRules)
+				if ruleSetA.sourceCIDR == sourceCIDR {
+					a[i].rules, err = mergeFirewallProtocolRules(ruleSetA.rules, ruleB.FirewallProtocolRules, priority, firewall)
 					if err != nil {
-						return []infv1alpha1.IngressNodeFirewallRules{}, err
+						return nil, err
 					}
 					continue withNextSourceCIDR
 				}
 			}
 			// If the CIDR was not found, append the rules to A.
-			a = append(a, infv1alpha1.IngressNodeFirewallRules{
-				SourceCIDRs:           []string{sourceCIDR},
-				FirewallProtocolRules: ruleB.FirewallProtocolRules,
-			})
+			ruleSet := tieredRuleSet{sourceCIDR: sourceCIDR}
+			ruleSet.rules, err = mergeFirewallProtocolRules(nil, ruleB.FirewallProtocolRules, priority, firewall)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, ruleSet)
 		}
 	}
 	return a, nil
 }
 
-// mergeFirewallProtocolRules merges slices b of type []infv1alpha1.IngressNodeFirewallProtocolRule int slice a
-// of type []infv1alpha1.IngressNodeFirewallProtocolRule. The function throws an error if duplicate orders are found.
-func mergeFirewallProtocolRules(a, b []infv1alpha1.IngressNodeFirewallProtocolRule) ([]infv1alpha1.IngressNodeFirewallProtocolRule, error) {
-	orderList := make(map[uint32]struct{})
+// mergeFirewallProtocolRules merges slice b of type []infv1alpha1.IngressNodeFirewallProtocolRule of the
+// IngressNodeFirewall firewall with the given priority into slice a. The function throws an error if duplicate orders
+// are found within the same priority.
+func mergeFirewallProtocolRules(a []tieredRule, b []infv1alpha1.IngressNodeFirewallProtocolRule, priority int32,
+	firewall string) ([]tieredRule, error) {
+	type tieredOrder struct {
+		priority int32
+		order    uint32
+	}
+	orderList := make(map[tieredOrder]struct{})
 	for _, itemA := range a {
-		if _, ok := orderList[itemA.Order]; ok {
-			return nil, fmt.Errorf("duplicate order %d detected for rules in A", itemA.Order)
+		key := tieredOrder{priority: itemA.priority, order: itemA.rule.Order}
+		if _, ok := orderList[key]; ok {
+			return nil, fmt.Errorf("duplicate order %d detected for rules in A", itemA.rule.Order)
 		}
-		orderList[itemA.Order] = struct{}{}
+		orderList[key] = struct{}{}
 	}
 	for _, itemB := range b {
-		if _, ok := orderList[itemB.Order]; ok {
-			return nil, fmt.Errorf("duplicate order %d detected for rules in B", itemB.Order)
+		key := tieredOrder{priority: priority, order: itemB.Order}
+		if _, ok := orderList[key]; ok {
+			return nil, fmt.Errorf("duplicate order %d detected for rules with priority %d", itemB.Order, priority)
 		}
-		orderList[itemB.Order] = struct{}{}
-		a = append(a, itemB)
+		orderList[key] = struct{}{}
+		a = append(a, tieredRule{priority: priority, firewall: firewall, rule: itemB})
 	}
 	return a, nil
 }
+
+// compileNodeRuleSets compiles the merged rulesets of the interfaces of a node into the interface ingress rules and
+// the rule owners of spec.
+func compileNodeRuleSets(ifaceRuleSets map[string][]tieredRuleSet, spec *infv1alpha1.IngressNodeFirewallNodeStateSpec) error {
+	offsets, err := tierOffsets(ifaceRuleSets)
+	if err != nil {
+		return err
+	}
+	spec.RuleOwners = nil
+	for iface, ruleSets := range ifaceRuleSets {
+		rules, owners := compileRuleSet(iface, ruleSets, offsets)
+		spec.InterfaceIngressRules[iface] = rules
+		spec.RuleOwners = append(spec.RuleOwners, owners...)
+	}
+	owners := spec.RuleOwners
+	sort.Slice(owners, func(i, j int) bool {
+		if owners[i].Interface != owners[j].Interface {
+			return owners[i].Interface < owners[j].Interface
+		}
+		if owners[i].SourceCIDR != owners[j].SourceCIDR {
+			return owners[i].SourceCIDR < owners[j].SourceCIDR
+		}
+		return owners[i].RuleID < owners[j].RuleID
+	})
+	return nil
+}
+
+// tierOffsets returns the offset of the rule IDs of each priority tier of the merged rulesets of a node's interfaces.
+// The rules of the lowest tier keep their order as rule ID. The rule IDs of every other tier start at the first
+// multiple of tierRuleIDAlignment above the rule IDs of the tier below, so that the rule ID of a rule only depends on
+// its tier and order as long as the rules of the lower tiers keep their blocks of rule IDs. It returns an error if
+// the rule IDs of a tier exceed maxTieredRuleID.
+func tierOffsets(ifaceRuleSets map[string][]tieredRuleSet) (map[int32]uint32, error) {
+	maxOrders := make(map[int32]uint32)
+	for _, ruleSets := range ifaceRuleSets {
+		for _, ruleSet := range ruleSets {
+			for _, item := range ruleSet.rules {
+				if item.rule.Order > maxOrders[item.priority] {
+					maxOrders[item.priority] = item.rule.Order
+				}
+			}
+		}
+	}
+	priorities := make([]int32, 0, len(maxOrders))
+	for priority := range maxOrders {
+		priorities = append(priorities, priority)
+	}
+	sort.Slice(priorities, func(i, j int) bool { return priorities[i] < priorities[j] })
+
+	offsets := make(map[int32]uint32, len(priorities))
+	var offset uint64
+	for i, priority := range priorities {
+		if i > 0 {
+			last := offset + uint64(maxOrders[priorities[i-1]])
+			offset = (last/tierRuleIDAlignment + 1) * tierRuleIDAlignment
+			if offset+uint64(maxOrders[priority]) > maxTieredRuleID {
+				return nil, fmt.Errorf("the rule IDs of the rules with priority %d exceed the maximum of %d, lower the "+
+					"orders of the rules with priority %d or lower", priority, maxTieredRuleID, priority)
+			}
+		}
+		offsets[priority] = uint32(offset)
+	}
+	return offsets, nil
+}
+
+// compileRuleSet converts the merged ruleset a of the interface into the rules of an IngressNodeFirewallNodeState and
+// returns the owners of the rules. The order of each rule is its rule ID, the order of the rule offset by the offset
+// of its priority tier. If all rules of a source CIDR originate from IngressNodeFirewalls with the same priority, the
+// rules keep their sequence, otherwise they are sorted by (priority, order).
+func compileRuleSet(iface string, a []tieredRuleSet,
+	offsets map[int32]uint32) ([]infv1alpha1.IngressNodeFirewallRules, []infv1alpha1.IngressNodeFirewallRuleOwner) {
+	rules := []infv1alpha1.IngressNodeFirewallRules{}
+	var owners []infv1alpha1.IngressNodeFirewallRuleOwner
+	for _, ruleSet := range a {
+		items := ruleSet.rules
+		for _, item := range ruleSet.rules {
+			if item.priority != ruleSet.rules[0].priority {
+				items = append([]tieredRule{}, ruleSet.rules...)
+				sort.SliceStable(items, func(i, j int) bool {
+					if items[i].priority != items[j].priority {
+						return items[i].priority < items[j].priority
+					}
+					return items[i].rule.Order < items[j].rule.Order
+				})
+				break
+			}
+		}
+		protocolRules := make([]infv1alpha1.IngressNodeFirewallProtocolRule, 0, len(items))
+		for _, item := range items {
+			rule := item.rule
+			rule.Order += offsets[item.priority]
+			protocolRules = append(protocolRules, rule)
+			owners = append(owners, infv1alpha1.IngressNodeFirewallRuleOwner{
+				Interface:  iface,
+				SourceCIDR: ruleSet.sourceCIDR,
+				RuleID:     rule.Order,
+				Firewall:   item.firewall,
+				Order:      item.rule.Order,
+			})
+		}
+		rules = append(rules, infv1alpha1.IngressNodeFirewallRules{
+			SourceCIDRs:           []string{ruleSet.sourceCIDR},
+			FirewallProtocolRules: protocolRules,
+		})
+	}
+	return rules, owners
+}
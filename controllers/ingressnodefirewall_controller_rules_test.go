@@ -36,6 +36,15 @@ var _ = Describe("IngressNodeFirewall controller rules", func() {
 						"node-role.kubernetes.io/worker": "",
 					},
 				},
+				Spec: v1.NodeSpec{
+					PodCIDRs: []string{"10.128.0.0/23"},
+				},
+				Status: v1.NodeStatus{
+					Addresses: []v1.NodeAddress{
+						{Type: v1.NodeHostName, Address: worker0Name},
+						{Type: v1.NodeInternalIP, Address: "192.168.0.10"},
+					},
+				},
 			},
 		}
 		for _, node := range nodes {
@@ -46,6 +55,7 @@ var _ = Describe("IngressNodeFirewall controller rules", func() {
 
 	AfterEach(func() {
 		Expect(k8sClient.DeleteAllOf(context.Background(), &infv1alpha1.IngressNodeFirewall{})).Should(Succeed())
+		Expect(k8sClient.DeleteAllOf(context.Background(), &infv1alpha1.IngressNodeFirewallAddressSet{})).Should(Succeed())
 		Expect(k8sClient.DeleteAllOf(context.Background(), &v1.Node{})).Should(Succeed())
 		Eventually(func() bool {
 			nodeStateList := &infv1alpha1.IngressNodeFirewallNodeStateList{}
@@ -59,10 +69,302 @@ var _ = Describe("IngressNodeFirewall controller rules", func() {
 	})
 
 	tcs := map[string]struct {
-		inSpecs     []infv1alpha1.IngressNodeFirewallSpec
-		outSpec     infv1alpha1.IngressNodeFirewallNodeStateSpec
-		statusError string
+		inAddressSets map[string][]string
+		inSpecs       []infv1alpha1.IngressNodeFirewallSpec
+		outSpec       infv1alpha1.IngressNodeFirewallNodeStateSpec
+		statusError   string
 	}{
+		"address set references are expanded into sourceCIDRs": {
+			inAddressSets: map[string][]string{
+				"trusted": {"10.0.0.0/24", "1000::/64"},
+			},
+			inSpecs: []infv1alpha1.IngressNodeFirewallSpec{
+				{
+					Ingress: []infv1alpha1.IngressNodeFirewallRules{
+						{
+							SourceCIDRs:          []string{"10.0.0.0/24", "172.16.0.0/12"},
+							SourceAddressSetRefs: []string{"trusted"},
+							FirewallProtocolRules: []infv1alpha1.IngressNodeFirewallProtocolRule{
+								{
+									Order: 10,
+									ProtocolConfig: infv1alpha1.IngressNodeProtocolConfig{
+										Protocol: infv1alpha1.ProtocolTypeTCP,
+										TCP: &infv1alpha1.IngressNodeFirewallProtoRule{
+											Ports: intstr.FromInt(80),
+										},
+									},
+									Action: infv1alpha1.IngressNodeFirewallAllow,
+								},
+							},
+						},
+					},
+					Interfaces: []string{"eth0"},
+				},
+			},
+			outSpec: infv1alpha1.IngressNodeFirewallNodeStateSpec{
+				InterfaceIngressRules: map[string][]infv1alpha1.IngressNodeFirewallRules{
+					"eth0": {
+						{
+							SourceCIDRs: []string{"10.0.0.0/24"},
+							FirewallProtocolRules: []infv1alpha1.IngressNodeFirewallProtocolRule{
+								{
+									Order: 10,
+									ProtocolConfig: infv1alpha1.IngressNodeProtocolConfig{
+										Protocol: infv1alpha1.ProtocolTypeTCP,
+										TCP: &infv1alpha1.IngressNodeFirewallProtoRule{
+											Ports: intstr.FromInt(80),
+										},
+									},
+									Action: infv1alpha1.IngressNodeFirewallAllow,
+								},
+							},
+						},
+						{
+							SourceCIDRs: []string{"172.16.0.0/12"},
+							FirewallProtocolRules: []infv1alpha1.IngressNodeFirewallProtocolRule{
+								{
+									Order: 10,
+									ProtocolConfig: infv1alpha1.IngressNodeProtocolConfig{
+										Protocol: infv1alpha1.ProtocolTypeTCP,
+										TCP: &infv1alpha1.IngressNodeFirewallProtoRule{
+											Ports: intstr.FromInt(80),
+										},
+									},
+									Action: infv1alpha1.IngressNodeFirewallAllow,
+								},
+							},
+						},
+						{
+							SourceCIDRs: []string{"1000::/64"},
+							FirewallProtocolRules: []infv1alpha1.IngressNodeFirewallProtocolRule{
+								{
+									Order: 10,
+									ProtocolConfig: infv1alpha1.IngressNodeProtocolConfig{
+										Protocol: infv1alpha1.ProtocolTypeTCP,
+										TCP: &infv1alpha1.IngressNodeFirewallProtoRule{
+											Ports: intstr.FromInt(80),
+										},
+									},
+									Action: infv1alpha1.IngressNodeFirewallAllow,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		"node and cluster network sources are expanded into sourceCIDRs": {
+			inSpecs: []infv1alpha1.IngressNodeFirewallSpec{
+				{
+					Ingress: []infv1alpha1.IngressNodeFirewallRules{
+						{
+							FromNodes: &metav1.LabelSelector{
+								MatchExpressions: []metav1.LabelSelectorRequirement{
+									{
+										Key:      "node-role.kubernetes.io/worker",
+										Operator: metav1.LabelSelectorOpExists,
+									},
+								},
+							},
+							FromClusterNetworks: []infv1alpha1.IngressNodeFirewallClusterNetworkType{
+								infv1alpha1.ClusterNetworkTypePod,
+								infv1alpha1.ClusterNetworkTypeService,
+							},
+							FirewallProtocolRules: []infv1alpha1.IngressNodeFirewallProtocolRule{
+								{
+									Order: 10,
+									ProtocolConfig: infv1alpha1.IngressNodeProtocolConfig{
+										Protocol: infv1alpha1.ProtocolTypeTCP,
+										TCP: &infv1alpha1.IngressNodeFirewallProtoRule{
+											Ports: intstr.FromInt(80),
+										},
+									},
+									Action: infv1alpha1.IngressNodeFirewallAllow,
+								},
+							},
+						},
+					},
+					Interfaces: []string{"eth0"},
+				},
+			},
+			outSpec: infv1alpha1.IngressNodeFirewallNodeStateSpec{
+				InterfaceIngressRules: map[string][]infv1alpha1.IngressNodeFirewallRules{
+					"eth0": {
+						{
+							SourceCIDRs: []string{"192.168.0.10/32"},
+							FirewallProtocolRules: []infv1alpha1.IngressNodeFirewallProtocolRule{
+								{
+									Order: 10,
+									ProtocolConfig: infv1alpha1.IngressNodeProtocolConfig{
+										Protocol: infv1alpha1.ProtocolTypeTCP,
+										TCP: &infv1alpha1.IngressNodeFirewallProtoRule{
+											Ports: intstr.FromInt(80),
+										},
+									},
+									Action: infv1alpha1.IngressNodeFirewallAllow,
+								},
+							},
+						},
+						{
+							SourceCIDRs: []string{"10.128.0.0/23"},
+							FirewallProtocolRules: []infv1alpha1.IngressNodeFirewallProtocolRule{
+								{
+									Order: 10,
+									ProtocolConfig: infv1alpha1.IngressNodeProtocolConfig{
+										Protocol: infv1alpha1.ProtocolTypeTCP,
+										TCP: &infv1alpha1.IngressNodeFirewallProtoRule{
+											Ports: intstr.FromInt(80),
+										},
+									},
+									Action: infv1alpha1.IngressNodeFirewallAllow,
+								},
+							},
+						},
+						{
+							SourceCIDRs: []string{"172.30.0.0/16"},
+							FirewallProtocolRules: []infv1alpha1.IngressNodeFirewallProtocolRule{
+								{
+									Order: 10,
+									ProtocolConfig: infv1alpha1.IngressNodeProtocolConfig{
+										Protocol: infv1alpha1.ProtocolTypeTCP,
+										TCP: &infv1alpha1.IngressNodeFirewallProtoRule{
+											Ports: intstr.FromInt(80),
+										},
+									},
+									Action: infv1alpha1.IngressNodeFirewallAllow,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		"merging rules for the same interface, CIDR and order - different priority": {
+			inSpecs: []infv1alpha1.IngressNodeFirewallSpec{
+				{
+					Priority: 10,
+					Ingress: []infv1alpha1.IngressNodeFirewallRules{
+						{
+							SourceCIDRs: []string{"10.0.0.0"},
+							FirewallProtocolRules: []infv1alpha1.IngressNodeFirewallProtocolRule{
+								{
+									Order: 10,
+									ProtocolConfig: infv1alpha1.IngressNodeProtocolConfig{
+										Protocol: infv1alpha1.ProtocolTypeTCP,
+										TCP: &infv1alpha1.IngressNodeFirewallProtoRule{
+											Ports: intstr.FromInt(80),
+										},
+									},
+									Action: infv1alpha1.IngressNodeFirewallAllow,
+								},
+								{
+									Order: 20,
+									ProtocolConfig: infv1alpha1.IngressNodeProtocolConfig{
+										Protocol: infv1alpha1.ProtocolTypeTCP,
+										TCP: &infv1alpha1.IngressNodeFirewallProtoRule{
+											Ports: intstr.FromInt(443),
+										},
+									},
+									Action: infv1alpha1.IngressNodeFirewallAllow,
+								},
+							},
+						},
+					},
+					Interfaces: []string{"eth0"},
+				},
+				{
+					Ingress: []infv1alpha1.IngressNodeFirewallRules{
+						{
+							SourceCIDRs: []string{"10.0.0.0"},
+							FirewallProtocolRules: []infv1alpha1.IngressNodeFirewallProtocolRule{
+								{
+									Order: 10,
+									ProtocolConfig: infv1alpha1.IngressNodeProtocolConfig{
+										Protocol: infv1alpha1.ProtocolTypeTCP,
+										TCP: &infv1alpha1.IngressNodeFirewallProtoRule{
+											Ports: intstr.FromInt(80),
+										},
+									},
+									Action: infv1alpha1.IngressNodeFirewallDeny,
+								},
+							},
+						},
+					},
+					Interfaces: []string{"eth0"},
+				},
+			},
+			outSpec: infv1alpha1.IngressNodeFirewallNodeStateSpec{
+				InterfaceIngressRules: map[string][]infv1alpha1.IngressNodeFirewallRules{
+					"eth0": {
+						{
+							SourceCIDRs: []string{"10.0.0.0"},
+							FirewallProtocolRules: []infv1alpha1.IngressNodeFirewallProtocolRule{
+								{
+									Order: 10,
+									ProtocolConfig: infv1alpha1.IngressNodeProtocolConfig{
+										Protocol: infv1alpha1.ProtocolTypeTCP,
+										TCP: &infv1alpha1.IngressNodeFirewallProtoRule{
+											Ports: intstr.FromInt(80),
+										},
+									},
+									Action: infv1alpha1.IngressNodeFirewallDeny,
+								},
+								{
+									Order: 1034,
+									ProtocolConfig: infv1alpha1.IngressNodeProtocolConfig{
+										Protocol: infv1alpha1.ProtocolTypeTCP,
+										TCP: &infv1alpha1.IngressNodeFirewallProtoRule{
+											Ports: intstr.FromInt(80),
+										},
+									},
+									Action: infv1alpha1.IngressNodeFirewallAllow,
+								},
+								{
+									Order: 1044,
+									ProtocolConfig: infv1alpha1.IngressNodeProtocolConfig{
+										Protocol: infv1alpha1.ProtocolTypeTCP,
+										TCP: &infv1alpha1.IngressNodeFirewallProtoRule{
+											Ports: intstr.FromInt(443),
+										},
+									},
+									Action: infv1alpha1.IngressNodeFirewallAllow,
+								},
+							},
+						},
+					},
+				},
+				RuleOwners: []infv1alpha1.IngressNodeFirewallRuleOwner{
+					{Interface: "eth0", SourceCIDR: "10.0.0.0", RuleID: 10, Firewall: "firewall-1", Order: 10},
+					{Interface: "eth0", SourceCIDR: "10.0.0.0", RuleID: 1034, Firewall: "firewall-0", Order: 10},
+					{Interface: "eth0", SourceCIDR: "10.0.0.0", RuleID: 1044, Firewall: "firewall-0", Order: 20},
+				},
+			},
+		},
+		"missing address set shall throw an error": {
+			inSpecs: []infv1alpha1.IngressNodeFirewallSpec{
+				{
+					Ingress: []infv1alpha1.IngressNodeFirewallRules{
+						{
+							SourceAddressSetRefs: []string{"missing"},
+							FirewallProtocolRules: []infv1alpha1.IngressNodeFirewallProtocolRule{
+								{
+									Order: 10,
+									ProtocolConfig: infv1alpha1.IngressNodeProtocolConfig{
+										Protocol: infv1alpha1.ProtocolTypeTCP,
+										TCP: &infv1alpha1.IngressNodeFirewallProtoRule{
+											Ports: intstr.FromInt(80),
+										},
+									},
+									Action: infv1alpha1.IngressNodeFirewallAllow,
+								},
+							},
+						},
+					},
+					Interfaces: []string{"eth0"},
+				},
+			},
+			statusError: "IngressNodeFirewallAddressSet \\\"missing\\\" not found",
+		},
 		"baseline test without merging": {
 			inSpecs: []infv1alpha1.IngressNodeFirewallSpec{
 				{
@@ -753,6 +1055,15 @@ var _ = Describe("IngressNodeFirewall controller rules", func() {
 		tc := tc
 		When(fmt.Sprintf("IngressNodeFirewall objects are created for test case: %q", s), func() {
 			It("The resulting IngressNodeFirewallNodeState object should look as expected", func() {
+				By("Creating new IngressNodeFirewallAddressSet objects")
+				for name, cidrs := range tc.inAddressSets {
+					addressSet := infv1alpha1.IngressNodeFirewallAddressSet{
+						ObjectMeta: metav1.ObjectMeta{Name: name},
+						Spec:       infv1alpha1.IngressNodeFirewallAddressSetSpec{CIDRs: cidrs},
+					}
+					Expect(k8sClient.Create(ctx, &addressSet)).Should(Succeed())
+				}
+
 				By("Creating new IngressNodeFirewall objects")
 				for k, spec := range tc.inSpecs {
 					objectName := fmt.Sprintf("firewall-%d", k)
@@ -799,6 +1110,12 @@ var _ = Describe("IngressNodeFirewall controller rules", func() {
 							fmt.Fprintf(GinkgoWriter, "Ingresses do not match. Got: '%v', Expected '%v'\n",
 								infns.Spec.InterfaceIngressRules, tc.outSpec.InterfaceIngressRules)
 						}
+						if tc.outSpec.RuleOwners != nil &&
+							!equality.Semantic.DeepEqual(infns.Spec.RuleOwners, tc.outSpec.RuleOwners) {
+							fmt.Fprintf(GinkgoWriter, "Rule owners do not match. Got: '%v', Expected '%v'\n",
+								infns.Spec.RuleOwners, tc.outSpec.RuleOwners)
+							return false
+						}
 						return ingressesEqual
 					}).Should(BeTrue())
 				} else {
@@ -830,3 +1147,166 @@ var _ = Describe("IngressNodeFirewall controller rules", func() {
 		})
 	}
 })
+
+var _ = Describe("IngressNodeFirewall controller capacity", func() {
+	rules := func(n int) []infv1alpha1.IngressNodeFirewallProtocolRule {
+		protocolRules := []infv1alpha1.IngressNodeFirewallProtocolRule{}
+		for i := 1; i <= n; i++ {
+			protocolRules = append(protocolRules, infv1alpha1.IngressNodeFirewallProtocolRule{
+				Order:  uint32(i),
+				Action: infv1alpha1.IngressNodeFirewallDeny,
+			})
+		}
+		return protocolRules
+	}
+
+	It("Should accept rules within the capacity", func() {
+		Expect(checkCapacity(map[string][]infv1alpha1.IngressNodeFirewallRules{
+			"eth0": {
+				{SourceCIDRs: []string{"10.0.0.0/8"}, FirewallProtocolRules: rules(2)},
+				{SourceCIDRs: []string{"2001:db8::/32"}, FirewallProtocolRules: rules(2)},
+			},
+		}, 2, 2)).To(Succeed())
+	})
+
+	It("Should reject too many rules for a sourceCIDR", func() {
+		err := checkCapacity(map[string][]infv1alpha1.IngressNodeFirewallRules{
+			"eth0": {{SourceCIDRs: []string{"10.0.0.0/8"}, FirewallProtocolRules: rules(3)}},
+		}, 2, 2)
+		Expect(err).To(MatchError("3 rules for sourceCIDRs [10.0.0.0/8] on interface eth0 exceed the maximum of 2 rules"))
+	})
+
+	It("Should reject too many sourceCIDR and interface combinations", func() {
+		err := checkCapacity(map[string][]infv1alpha1.IngressNodeFirewallRules{
+			"eth0": {{SourceCIDRs: []string{"10.0.0.0/8"}, FirewallProtocolRules: rules(1)}},
+			"eth1": {{SourceCIDRs: []string{"10.0.0.0/8"}, FirewallProtocolRules: rules(1)}},
+			"eth2": {{SourceCIDRs: []string{"10.0.0.0/8"}, FirewallProtocolRules: rules(1)}},
+		}, 2, 2)
+		Expect(err).To(MatchError("3 source CIDR and interface combinations exceed the maximum of 2"))
+	})
+})
+
+var _ = Describe("IngressNodeFirewall controller expiry", func() {
+	created := metav1.NewTime(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	at := func(d time.Duration) *metav1.Time {
+		t := metav1.NewTime(created.Add(d))
+		return &t
+	}
+	firewall := &infv1alpha1.IngressNodeFirewall{
+		ObjectMeta: metav1.ObjectMeta{Name: "incident", CreationTimestamp: created},
+		Spec: infv1alpha1.IngressNodeFirewallSpec{
+			Ingress: []infv1alpha1.IngressNodeFirewallRules{
+				{SourceCIDRs: []string{"10.0.0.0/8"}},
+				{SourceCIDRs: []string{"192.0.2.1/32"}, ExpiresAt: at(time.Hour)},
+				{SourceCIDRs: []string{"198.51.100.1/32"}, TTL: &metav1.Duration{Duration: 2 * time.Hour}},
+			},
+		},
+	}
+	starts := ttlStarts(firewall.Spec.Ingress, nil, created.Time)
+
+	It("Should start the ttl when the ingress rules are first seen", func() {
+		Expect(starts).To(HaveLen(1))
+		Expect(starts[0].StartTime).To(Equal(created))
+		Expect(ttlStarts(firewall.Spec.Ingress, starts, created.Add(time.Hour))).To(Equal(starts))
+
+		// Ingress rules that are added later start their ttl when they are added, not at the creation.
+		added := append([]infv1alpha1.IngressNodeFirewallRules{}, firewall.Spec.Ingress...)
+		added = append(added, infv1alpha1.IngressNodeFirewallRules{
+			SourceCIDRs: []string{"203.0.113.0/24"}, TTL: &metav1.Duration{Duration: time.Hour}})
+		addedStarts := ttlStarts(added, starts, created.Add(3*time.Hour))
+		Expect(addedStarts).To(HaveLen(2))
+		Expect(addedStarts[0]).To(Equal(starts[0]))
+		Expect(addedStarts[1].StartTime).To(Equal(*at(3 * time.Hour)))
+		active, expired, nextExpiry := activeIngress(added, addedStarts, created.Add(3*time.Hour))
+		Expect(active).To(Equal([]infv1alpha1.IngressNodeFirewallRules{added[0], added[3]}))
+		Expect(expired).To(Equal([]int32{1, 2}))
+		Expect(nextExpiry).To(Equal(at(4 * time.Hour)))
+	})
+
+	It("Should keep the ttl start when the protocol rules change", func() {
+		changed := append([]infv1alpha1.IngressNodeFirewallRules{}, firewall.Spec.Ingress...)
+		changed[2].FirewallProtocolRules = []infv1alpha1.IngressNodeFirewallProtocolRule{{Order: 10}}
+		Expect(ttlStarts(changed, starts, created.Add(time.Hour))).To(Equal(starts))
+		changed[2].TTL = &metav1.Duration{Duration: 3 * time.Hour}
+		Expect(ttlStarts(changed, starts, created.Add(time.Hour))[0].StartTime).To(Equal(*at(time.Hour)))
+	})
+
+	It("Should keep all ingress rules before the first expiry", func() {
+		active, expired, nextExpiry := activeIngress(firewall.Spec.Ingress, starts, created.Add(time.Minute))
+		Expect(active).To(Equal(firewall.Spec.Ingress))
+		Expect(expired).To(BeEmpty())
+		Expect(nextExpiry).To(Equal(at(time.Hour)))
+	})
+
+	It("Should drop ingress rules past their expiresAt", func() {
+		active, expired, nextExpiry := activeIngress(firewall.Spec.Ingress, starts, created.Add(time.Hour))
+		Expect(active).To(Equal([]infv1alpha1.IngressNodeFirewallRules{firewall.Spec.Ingress[0], firewall.Spec.Ingress[2]}))
+		Expect(expired).To(Equal([]int32{1}))
+		Expect(nextExpiry).To(Equal(at(2 * time.Hour)))
+	})
+
+	It("Should drop ingress rules past their ttl from their start", func() {
+		active, expired, nextExpiry := activeIngress(firewall.Spec.Ingress, starts, created.Add(3*time.Hour))
+		Expect(active).To(Equal([]infv1alpha1.IngressNodeFirewallRules{firewall.Spec.Ingress[0]}))
+		Expect(expired).To(Equal([]int32{1, 2}))
+		Expect(nextExpiry).To(BeNil())
+	})
+})
+
+var _ = Describe("IngressNodeFirewall controller schedules", func() {
+	// 2026-01-05 is a Monday.
+	at := func(day, hour int) time.Time {
+		return time.Date(2026, 1, day, hour, 0, 0, 0, time.UTC)
+	}
+	ingress := []infv1alpha1.IngressNodeFirewallRules{
+		{
+			SourceCIDRs: []string{"10.0.0.0/8"},
+			FirewallProtocolRules: []infv1alpha1.IngressNodeFirewallProtocolRule{
+				{
+					Order: 10,
+					ProtocolConfig: infv1alpha1.IngressNodeProtocolConfig{
+						Protocol: infv1alpha1.ProtocolTypeTCP,
+						TCP:      &infv1alpha1.IngressNodeFirewallProtoRule{Ports: intstr.FromInt(623)},
+					},
+					Action: infv1alpha1.IngressNodeFirewallAllow,
+					Schedule: &infv1alpha1.IngressNodeFirewallSchedule{
+						Start:    "0 22 * * 1-5",
+						Duration: metav1.Duration{Duration: 2 * time.Hour},
+					},
+				},
+				{
+					Order:  20,
+					Action: infv1alpha1.IngressNodeFirewallDeny,
+				},
+			},
+		},
+	}
+
+	It("Should leave out rules outside of their windows", func() {
+		scheduled, statuses, nextTransition, err := scheduledIngress(ingress, at(5, 12))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(scheduled).To(HaveLen(1))
+		Expect(scheduled[0].FirewallProtocolRules).To(Equal(ingress[0].FirewallProtocolRules[1:]))
+		Expect(statuses).To(Equal([]infv1alpha1.IngressNodeFirewallScheduledRuleStatus{
+			{Ingress: 0, Order: 10, Active: false, NextTransition: &metav1.Time{Time: at(5, 22)}},
+		}))
+		Expect(nextTransition).To(Equal(&metav1.Time{Time: at(5, 22)}))
+	})
+
+	It("Should include rules within their windows", func() {
+		scheduled, statuses, nextTransition, err := scheduledIngress(ingress, at(5, 23))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(scheduled).To(Equal(ingress))
+		Expect(statuses).To(Equal([]infv1alpha1.IngressNodeFirewallScheduledRuleStatus{
+			{Ingress: 0, Order: 10, Active: true, NextTransition: &metav1.Time{Time: at(6, 0)}},
+		}))
+		Expect(nextTransition).To(Equal(&metav1.Time{Time: at(6, 0)}))
+	})
+
+	It("Should reject invalid schedules", func() {
+		invalid := []infv1alpha1.IngressNodeFirewallRules{*ingress[0].DeepCopy()}
+		invalid[0].FirewallProtocolRules[0].Schedule.Start = "0 25 * * *"
+		_, _, _, err := scheduledIngress(invalid, at(5, 12))
+		Expect(err).To(MatchError(ContainSubstring("rule with order 10 of ingress rules 0")))
+	})
+})
@@ -45,6 +45,12 @@ var _ = Describe("IngressNodeFirewall controller", func() {
 		},
 	}
 	interfaces := []string{"eth0"}
+	workerWithoutFirewallLabelSelector := metav1.LabelSelector{
+		MatchExpressions: []metav1.LabelSelectorRequirement{
+			{Key: "node-role.kubernetes.io/worker", Operator: metav1.LabelSelectorOpExists},
+			{Key: "ingress-node-firewall", Operator: metav1.LabelSelectorOpNotIn, Values: []string{"enabled"}},
+		},
+	}
 
 	BeforeEach(func() {
 		nodes := []v1.Node{
@@ -237,10 +243,61 @@ var _ = Describe("IngressNodeFirewall controller", func() {
 				hasIngressNodeFirewallNodeStates(ctx, k8sClient, []string{})
 			})
 		})
+
+		// Test updates to IngressNodeFirewalls - match expressions.
+		When("the nodeSelector is updated to match workers without label \"ingress-node-firewall\"=\"enabled\"", func() {
+			It("The IngressNodeFirewallNodeState object for worker-0 should be deleted", func() {
+				By("Waiting for the expected list of IngressNodeFirewallNodeStates")
+				hasIngressNodeFirewallNodeStates(ctx, k8sClient, []string{"worker-0", "worker-1"})
+
+				By(fmt.Sprintf("Updating the nodeSelector on IngressNodeFirewall %s", ingressNodeFirewallName))
+				err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+					inf := &infv1alpha1.IngressNodeFirewall{}
+					key := types.NamespacedName{Name: ingressNodeFirewallName}
+					Expect(k8sClient.Get(ctx, key, inf)).Should(Succeed())
+					inf.Spec.NodeSelector = workerWithoutFirewallLabelSelector
+					return k8sClient.Update(ctx, inf)
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				By("Checking that we have only an IngressNodeFirewallNodeState for worker-1")
+				hasIngressNodeFirewallNodeStates(ctx, k8sClient, []string{"worker-1"})
+			})
+		})
 	})
 
 	// III) Test updates to node labels.
 	When("a node's label is updated", func() {
+		When("label \"ingress-node-firewall\"=\"enabled\" is added to worker-1 and the nodeSelector excludes it", func() {
+			It("The IngressNodeFirewallNodeState object for worker-1 should be deleted", func() {
+				By(fmt.Sprintf("Updating the nodeSelector on IngressNodeFirewall %s", ingressNodeFirewallName))
+				err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+					inf := &infv1alpha1.IngressNodeFirewall{}
+					key := types.NamespacedName{Name: ingressNodeFirewallName}
+					Expect(k8sClient.Get(ctx, key, inf)).Should(Succeed())
+					inf.Spec.NodeSelector = workerWithoutFirewallLabelSelector
+					return k8sClient.Update(ctx, inf)
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				By("Waiting for the expected list of IngressNodeFirewallNodeStates")
+				hasIngressNodeFirewallNodeStates(ctx, k8sClient, []string{"worker-1"})
+
+				By("Updating the label on node worker-1")
+				err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+					node := &v1.Node{}
+					key := types.NamespacedName{Name: "worker-1"}
+					Expect(k8sClient.Get(ctx, key, node)).Should(Succeed())
+					node.Labels["ingress-node-firewall"] = "enabled"
+					return k8sClient.Update(ctx, node)
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				By("Checking that we have no IngressNodeFirewallNodeState object")
+				hasIngressNodeFirewallNodeStates(ctx, k8sClient, []string{})
+			})
+		})
+
 		When("the label on worker-1 is removed", func() {
 			It("The IngressNodeFirewallNodeState object for worker-1 should be deleted", func() {
 				By("Waiting for the expected list of IngressNodeFirewallNodeStates")
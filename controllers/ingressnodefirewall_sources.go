@@ -0,0 +1,343 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+
+	infv1alpha1 "github.com/openshift/ingress-node-firewall/api/v1alpha1"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// networkConfigGVK is the GroupVersionKind of the OpenShift cluster network configuration. On OpenShift, the pod and
+// service networks are read from the object of this kind named "cluster".
+var networkConfigGVK = schema.GroupVersionKind{Group: "config.openshift.io", Version: "v1", Kind: "Network"}
+
+//+kubebuilder:rbac:groups=config.openshift.io,resources=networks,verbs=get;list;watch
+
+// triggerAddressSetReconciliation triggers reconciliation for all ingressnodefwv1alpha1.IngressNodeFirewall objects
+// that reference the given IngressNodeFirewallAddressSet from any of their ingress rules.
+func (r *IngressNodeFirewallReconciler) triggerAddressSetReconciliation(ctx context.Context, object client.Object) []reconcile.Request {
+	ingressNodeFirewallList := infv1alpha1.IngressNodeFirewallList{}
+	if err := r.List(ctx, &ingressNodeFirewallList); err != nil {
+		r.Log.Error(err, "Failed to list IngressNodeFirewall objects")
+		return []reconcile.Request{}
+	}
+
+	reconcileReq := make([]reconcile.Request, 0)
+	for _, fwobj := range ingressNodeFirewallList.Items {
+		if referencesAddressSet(fwobj.Spec.Ingress, object.GetName()) {
+			reconcileReq = append(reconcileReq, reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      fwobj.Name,
+					Namespace: fwobj.Namespace,
+				},
+			})
+		}
+	}
+	return reconcileReq
+}
+
+// triggerClusterNetworkReconciliation triggers reconciliation for all ingressnodefwv1alpha1.IngressNodeFirewall
+// objects that use fromClusterNetworks when the OpenShift cluster network configuration changes.
+func (r *IngressNodeFirewallReconciler) triggerClusterNetworkReconciliation(ctx context.Context, object client.Object) []reconcile.Request {
+	if object.GetName() != "cluster" {
+		return []reconcile.Request{}
+	}
+	ingressNodeFirewallList := infv1alpha1.IngressNodeFirewallList{}
+	if err := r.List(ctx, &ingressNodeFirewallList); err != nil {
+		r.Log.Error(err, "Failed to list IngressNodeFirewall objects")
+		return []reconcile.Request{}
+	}
+
+	reconcileReq := make([]reconcile.Request, 0)
+	for _, fwobj := range ingressNodeFirewallList.Items {
+		if usesClusterNetworks(fwobj.Spec.Ingress) {
+			reconcileReq = append(reconcileReq, reconcile.Request{
+				NamespacedName: types.NamespacedName{
+					Name:      fwobj.Name,
+					Namespace: fwobj.Namespace,
+				},
+			})
+		}
+	}
+	return reconcileReq
+}
+
+// recordUnresolvedIngress records a warning on the IngressNodeFirewall for each of its ingress rules that resolve to
+// no source CIDRs. unresolved are the indices returned by resolveSourceCIDRs for the active ingress rules, which
+// leave out the expired ingress rules.
+func (r *IngressNodeFirewallReconciler) recordUnresolvedIngress(firewallObj *infv1alpha1.IngressNodeFirewall,
+	unresolved []int, expired []int32) {
+	if r.Recorder == nil {
+		return
+	}
+	for _, idx := range unresolved {
+		// Map the index of the active ingress rules to the index of the ingress rules of the spec.
+		for _, expiredIdx := range expired {
+			if int(expiredIdx) <= idx {
+				idx++
+			}
+		}
+		r.Recorder.Eventf(firewallObj, v1.EventTypeWarning, "NoSourceCIDRs",
+			"ingress[%d] resolves to no source CIDRs and is not applied to the nodes", idx)
+	}
+}
+
+// resolveSourceCIDRs returns a copy of the provided ingress rules where all sources that are not plain CIDRs are
+// resolved and added to SourceCIDRs:
+// * the CIDRs of all IngressNodeFirewallAddressSets referenced by SourceAddressSetRefs,
+// * the addresses of all nodes selected by FromNodes,
+// * the CIDRs of the cluster networks listed in FromClusterNetworks.
+// CIDRs that are present more than once are only added a single time. Rules which do not resolve to any CIDR, for
+// example because FromNodes does not match any node, are dropped and their indices are returned in unresolved. An
+// error is returned if a source cannot be resolved.
+func (r *IngressNodeFirewallReconciler) resolveSourceCIDRs(ctx context.Context,
+	ingress []infv1alpha1.IngressNodeFirewallRules) (resolved []infv1alpha1.IngressNodeFirewallRules, unresolved []int, err error) {
+	resolved = make([]infv1alpha1.IngressNodeFirewallRules, 0, len(ingress))
+	for idx, rule := range ingress {
+		rule := *rule.DeepCopy()
+		seen := make(map[string]struct{})
+		sourceCIDRs := []string{}
+		addCIDRs := func(cidrs []string) {
+			for _, cidr := range cidrs {
+				if _, ok := seen[cidr]; ok {
+					continue
+				}
+				seen[cidr] = struct{}{}
+				sourceCIDRs = append(sourceCIDRs, cidr)
+			}
+		}
+		addCIDRs(rule.SourceCIDRs)
+		for _, ref := range rule.SourceAddressSetRefs {
+			addressSet := infv1alpha1.IngressNodeFirewallAddressSet{}
+			if err := r.Get(ctx, types.NamespacedName{Name: ref}, &addressSet); err != nil {
+				if errors.IsNotFound(err) {
+					return nil, nil, fmt.Errorf("IngressNodeFirewallAddressSet %q not found", ref)
+				}
+				return nil, nil, err
+			}
+			addCIDRs(addressSet.Spec.CIDRs)
+		}
+		if rule.FromNodes != nil {
+			cidrs, err := r.getNodeAddressCIDRs(ctx, rule.FromNodes)
+			if err != nil {
+				return nil, nil, err
+			}
+			addCIDRs(cidrs)
+		}
+		for _, network := range rule.FromClusterNetworks {
+			cidrs, err := r.getClusterNetworkCIDRs(ctx, network)
+			if err != nil {
+				return nil, nil, err
+			}
+			addCIDRs(cidrs)
+		}
+		if len(sourceCIDRs) == 0 {
+			unresolved = append(unresolved, idx)
+			continue
+		}
+		rule.SourceCIDRs = sourceCIDRs
+		rule.SourceAddressSetRefs = nil
+		rule.FromNodes = nil
+		rule.FromClusterNetworks = nil
+		resolved = append(resolved, rule)
+	}
+	return resolved, unresolved, nil
+}
+
+// getNodeAddressCIDRs returns the InternalIP and ExternalIP addresses of all nodes that are matched by the provided
+// label selector as host CIDRs (/32 for IPv4 and /128 for IPv6). Nodes are processed in order of their names so that
+// the result is stable between reconciliations.
+func (r *IngressNodeFirewallReconciler) getNodeAddressCIDRs(ctx context.Context, selector *metav1.LabelSelector) ([]string, error) {
+	nodeSelector, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fromNodes selector: %w", err)
+	}
+	nodeList := v1.NodeList{}
+	if err := r.List(ctx, &nodeList, client.MatchingLabelsSelector{Selector: nodeSelector}); err != nil {
+		return nil, err
+	}
+	sort.Slice(nodeList.Items, func(i, j int) bool {
+		return nodeList.Items[i].Name < nodeList.Items[j].Name
+	})
+
+	var cidrs []string
+	for _, node := range nodeList.Items {
+		for _, address := range node.Status.Addresses {
+			if address.Type != v1.NodeInternalIP && address.Type != v1.NodeExternalIP {
+				continue
+			}
+			ip := net.ParseIP(address.Address)
+			if ip == nil {
+				continue
+			}
+			if ip.To4() != nil {
+				cidrs = append(cidrs, fmt.Sprintf("%s/32", ip.String()))
+			} else {
+				cidrs = append(cidrs, fmt.Sprintf("%s/128", ip.String()))
+			}
+		}
+	}
+	return cidrs, nil
+}
+
+// getClusterNetworkCIDRs returns the CIDRs of the given cluster network.
+// The OpenShift cluster network configuration is used if it is available. Otherwise, the CIDRs are taken from the
+// reconciler's PodCIDRs and ServiceCIDRs. If PodCIDRs is not set, the pod network is built from the pod CIDRs that
+// are allocated to the nodes.
+func (r *IngressNodeFirewallReconciler) getClusterNetworkCIDRs(
+	ctx context.Context, network infv1alpha1.IngressNodeFirewallClusterNetworkType) ([]string, error) {
+	podCIDRs, serviceCIDRs, found, err := r.getOpenShiftClusterNetworks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		podCIDRs = r.PodCIDRs
+		serviceCIDRs = r.ServiceCIDRs
+	}
+
+	var cidrs []string
+	switch network {
+	case infv1alpha1.ClusterNetworkTypePod:
+		cidrs = podCIDRs
+		if len(cidrs) == 0 {
+			if cidrs, err = r.getNodePodCIDRs(ctx); err != nil {
+				return nil, err
+			}
+		}
+	case infv1alpha1.ClusterNetworkTypeService:
+		cidrs = serviceCIDRs
+	default:
+		return nil, fmt.Errorf("unknown cluster network %q", network)
+	}
+	if len(cidrs) == 0 {
+		return nil, fmt.Errorf("unable to determine the CIDRs of cluster network %q", network)
+	}
+	return cidrs, nil
+}
+
+// getOpenShiftClusterNetworks reads the pod and service network CIDRs from the OpenShift cluster network
+// configuration. found is false if the cluster does not provide this configuration.
+func (r *IngressNodeFirewallReconciler) getOpenShiftClusterNetworks(ctx context.Context) (podCIDRs, serviceCIDRs []string, found bool, err error) {
+	networkConfig := &unstructured.Unstructured{}
+	networkConfig.SetGroupVersionKind(networkConfigGVK)
+	if err := r.Get(ctx, types.NamespacedName{Name: "cluster"}, networkConfig); err != nil {
+		if errors.IsNotFound(err) || meta.IsNoMatchError(err) {
+			return nil, nil, false, nil
+		}
+		return nil, nil, false, err
+	}
+
+	clusterNetworks, _, err := unstructured.NestedSlice(networkConfig.Object, "status", "clusterNetwork")
+	if err != nil {
+		return nil, nil, false, err
+	}
+	for _, clusterNetwork := range clusterNetworks {
+		entry, ok := clusterNetwork.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if cidr, ok := entry["cidr"].(string); ok {
+			podCIDRs = append(podCIDRs, cidr)
+		}
+	}
+	serviceCIDRs, _, err = unstructured.NestedStringSlice(networkConfig.Object, "status", "serviceNetwork")
+	if err != nil {
+		return nil, nil, false, err
+	}
+	return podCIDRs, serviceCIDRs, true, nil
+}
+
+// getNodePodCIDRs returns the union of the pod CIDRs that are allocated to the nodes of the cluster.
+func (r *IngressNodeFirewallReconciler) getNodePodCIDRs(ctx context.Context) ([]string, error) {
+	nodeList := v1.NodeList{}
+	if err := r.List(ctx, &nodeList); err != nil {
+		return nil, err
+	}
+	sort.Slice(nodeList.Items, func(i, j int) bool {
+		return nodeList.Items[i].Name < nodeList.Items[j].Name
+	})
+
+	seen := make(map[string]struct{})
+	var cidrs []string
+	for _, node := range nodeList.Items {
+		nodePodCIDRs := node.Spec.PodCIDRs
+		if len(nodePodCIDRs) == 0 && node.Spec.PodCIDR != "" {
+			nodePodCIDRs = []string{node.Spec.PodCIDR}
+		}
+		for _, cidr := range nodePodCIDRs {
+			if _, ok := seen[cidr]; ok {
+				continue
+			}
+			seen[cidr] = struct{}{}
+			cidrs = append(cidrs, cidr)
+		}
+	}
+	return cidrs, nil
+}
+
+// referencesAddressSet returns true if any of the provided ingress rules references the IngressNodeFirewallAddressSet
+// with the given name.
+func referencesAddressSet(ingress []infv1alpha1.IngressNodeFirewallRules, name string) bool {
+	for _, rule := range ingress {
+		for _, ref := range rule.SourceAddressSetRefs {
+			if ref == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// usesClusterNetworks returns true if any of the provided ingress rules uses fromClusterNetworks.
+func usesClusterNetworks(ingress []infv1alpha1.IngressNodeFirewallRules) bool {
+	for _, rule := range ingress {
+		if len(rule.FromClusterNetworks) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// usesNodeSources returns true if the source CIDRs of any of the provided ingress rules depend on the cluster nodes,
+// either through fromNodes or through the pod network.
+func usesNodeSources(ingress []infv1alpha1.IngressNodeFirewallRules) bool {
+	for _, rule := range ingress {
+		if rule.FromNodes != nil {
+			return true
+		}
+		for _, network := range rule.FromClusterNetworks {
+			if network == infv1alpha1.ClusterNetworkTypePod {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -19,6 +19,7 @@ package controllers
 import (
 	"context"
 	"os"
+	"path"
 	"time"
 
 	ingressnodefwv1alpha1 "github.com/openshift/ingress-node-firewall/api/v1alpha1"
@@ -40,6 +41,12 @@ import (
 const (
 	defaultIngressNodeFirewallCrName = "ingressnodefirewallconfig"
 	IngressNodeFirewallManifestPath  = "./bindata/manifests/daemon"
+	// blocklistMountPath is the directory of the daemon container into which the ConfigMap of the blocklist, or the
+	// directory of its file on the host, is mounted.
+	blocklistMountPath = "/etc/ingress-node-firewall/blocklist"
+	// captureMountPath is the directory of the daemon container into which the capture directory of the host is
+	// mounted.
+	captureMountPath = "/var/log/ingress-node-firewall/capture"
 )
 
 var ManifestPath = IngressNodeFirewallManifestPath
@@ -142,6 +149,60 @@ func (r *IngressNodeFirewallConfigReconciler) syncIngressNodeFwConfigResources(c
 			data.Data["Debug"] = "1"
 		}
 	}
+	data.Data["RuleInheritance"] = "false"
+	if config.Spec.RuleInheritance != nil && *config.Spec.RuleInheritance {
+		data.Data["RuleInheritance"] = "true"
+	}
+	data.Data["AllowEssentialICMPv6"] = "false"
+	if config.Spec.AllowEssentialICMPv6 != nil && *config.Spec.AllowEssentialICMPv6 {
+		data.Data["AllowEssentialICMPv6"] = "true"
+	}
+	data.Data["MaxTargets"] = config.Spec.GetMaxTargets()
+	data.Data["MaxRulesPerTarget"] = config.Spec.GetMaxRulesPerTarget()
+	data.Data["BlocklistConfigMap"] = ""
+	data.Data["BlocklistHostDir"] = ""
+	data.Data["BlocklistFile"] = ""
+	if blocklist := config.Spec.Blocklist; blocklist != nil {
+		if blocklist.ConfigMapName != "" {
+			data.Data["BlocklistConfigMap"] = blocklist.ConfigMapName
+			data.Data["BlocklistFile"] = path.Join(blocklistMountPath, blocklist.GetKey())
+		} else if blocklist.HostPath != "" {
+			data.Data["BlocklistHostDir"] = path.Dir(blocklist.HostPath)
+			data.Data["BlocklistFile"] = path.Join(blocklistMountPath, path.Base(blocklist.HostPath))
+		}
+	}
+	data.Data["CaptureMode"] = ""
+	data.Data["CaptureHostDir"] = ""
+	data.Data["CaptureDir"] = ""
+	data.Data["CaptureMaxFileSizeMiB"] = 0
+	data.Data["CaptureMaxFiles"] = 0
+	if capture := config.Spec.Capture; capture != nil {
+		data.Data["CaptureMode"] = string(capture.Mode)
+		if capture.Mode == ingressnodefwv1alpha1.CaptureModeFile {
+			data.Data["CaptureHostDir"] = capture.GetHostPath()
+			data.Data["CaptureDir"] = captureMountPath
+		}
+		data.Data["CaptureMaxFileSizeMiB"] = capture.GetMaxFileSizeMiB()
+		data.Data["CaptureMaxFiles"] = capture.GetMaxFiles()
+	}
+	data.Data["EventSampleRate"] = 1
+	data.Data["MaxEventsPerSecond"] = ""
+	data.Data["EventAggregationWindowSeconds"] = ingressnodefwv1alpha1.DefaultEventAggregationWindowSeconds
+	if events := config.Spec.Events; events != nil {
+		data.Data["EventSampleRate"] = events.GetSampleRate()
+		data.Data["EventAggregationWindowSeconds"] = events.GetAggregationWindowSeconds()
+		if events.MaxEventsPerSecond != 0 {
+			data.Data["MaxEventsPerSecond"] = events.MaxEventsPerSecond
+		}
+	}
+	data.Data["DropReportIntervalSeconds"] = ""
+	data.Data["DropReportMaxEvents"] = ingressnodefwv1alpha1.DefaultDropReportMaxEvents
+	data.Data["DropReportPolicyReport"] = false
+	if dropReports := config.Spec.DropReports; dropReports != nil {
+		data.Data["DropReportIntervalSeconds"] = dropReports.GetIntervalSeconds()
+		data.Data["DropReportMaxEvents"] = dropReports.GetMaxEvents()
+		data.Data["DropReportPolicyReport"] = dropReports.PolicyReport
+	}
 
 	objs, err := render.RenderDir(ManifestPath, &data)
 	if err != nil {
@@ -25,7 +25,8 @@ var _ = Describe("Ingress nodefirewall config Controller", func() {
 					Namespace: IngressNodeFwConfigTestNameSpace,
 				},
 				Spec: ingressnodefwv1alpha1.IngressNodeFirewallConfigSpec{
-					Debug: pointer.Bool(true),
+					Debug:             pointer.Bool(true),
+					MaxRulesPerTarget: pointer.Int32(200),
 				},
 			}
 			daemonContainers := map[string]string{
@@ -56,6 +57,12 @@ var _ = Describe("Ingress nodefirewall config Controller", func() {
 						if env.Name == "ENABLE_EBPF_LPM_LOOKUP_DBG" {
 							Expect(env.Value).To(Equal("1"))
 						}
+						if env.Name == "MAX_TARGETS" {
+							Expect(env.Value).To(Equal("1024"))
+						}
+						if env.Name == "MAX_RULES_PER_TARGET" {
+							Expect(env.Value).To(Equal("200"))
+						}
 					}
 				}
 			}
@@ -85,6 +92,135 @@ var _ = Describe("Ingress nodefirewall config Controller", func() {
 			err = k8sClient.Update(context.TODO(), config)
 			Expect(err).NotTo(HaveOccurred())
 
+			By("Referencing a blocklist ConfigMap")
+			config = &ingressnodefwv1alpha1.IngressNodeFirewallConfig{}
+			err = k8sClient.Get(context.Background(), types.NamespacedName{Name: IngressNodeFirewallResourceName, Namespace: IngressNodeFwConfigTestNameSpace}, config)
+			Expect(err).NotTo(HaveOccurred())
+			config.Spec.Blocklist = &ingressnodefwv1alpha1.IngressNodeFirewallBlocklist{ConfigMapName: "threat-intel"}
+			err = k8sClient.Update(context.TODO(), config)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(func() string {
+				daemonSet = &appsv1.DaemonSet{}
+				err := k8sClient.Get(context.TODO(), types.NamespacedName{Name: DeamonSetName, Namespace: IngressNodeFwConfigTestNameSpace}, daemonSet)
+				if err != nil {
+					return ""
+				}
+				for _, volume := range daemonSet.Spec.Template.Spec.Volumes {
+					if volume.Name == "blocklist" && volume.ConfigMap != nil {
+						return volume.ConfigMap.Name
+					}
+				}
+				return ""
+			}, 2*time.Second, 200*time.Millisecond).Should(Equal("threat-intel"))
+			for _, c := range daemonSet.Spec.Template.Spec.Containers {
+				if c.Name != "daemon" {
+					continue
+				}
+				for _, env := range c.Env {
+					if env.Name == "BLOCKLIST_FILE" {
+						Expect(env.Value).To(Equal("/etc/ingress-node-firewall/blocklist/blocklist"))
+					}
+				}
+			}
+
+			By("Rejecting a blocklist with both a ConfigMap and a host path")
+			config.Spec.Blocklist.HostPath = "/var/lib/blocklist.txt"
+			err = k8sClient.Update(context.TODO(), config)
+			Expect(err).To(HaveOccurred())
+
+			By("Capturing dropped packets to files on the host")
+			config = &ingressnodefwv1alpha1.IngressNodeFirewallConfig{}
+			err = k8sClient.Get(context.Background(), types.NamespacedName{Name: IngressNodeFirewallResourceName, Namespace: IngressNodeFwConfigTestNameSpace}, config)
+			Expect(err).NotTo(HaveOccurred())
+			config.Spec.Capture = &ingressnodefwv1alpha1.IngressNodeFirewallCapture{Mode: ingressnodefwv1alpha1.CaptureModeFile}
+			err = k8sClient.Update(context.TODO(), config)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(func() string {
+				daemonSet = &appsv1.DaemonSet{}
+				err := k8sClient.Get(context.TODO(), types.NamespacedName{Name: DeamonSetName, Namespace: IngressNodeFwConfigTestNameSpace}, daemonSet)
+				if err != nil {
+					return ""
+				}
+				for _, volume := range daemonSet.Spec.Template.Spec.Volumes {
+					if volume.Name == "capture" && volume.HostPath != nil {
+						return volume.HostPath.Path
+					}
+				}
+				return ""
+			}, 2*time.Second, 200*time.Millisecond).Should(Equal("/var/log/ingress-node-firewall"))
+			for _, c := range daemonSet.Spec.Template.Spec.Containers {
+				if c.Name != "daemon" {
+					continue
+				}
+				for _, env := range c.Env {
+					if env.Name == "CAPTURE_MODE" {
+						Expect(env.Value).To(Equal("File"))
+					}
+					if env.Name == "CAPTURE_MAX_FILES" {
+						Expect(env.Value).To(Equal("5"))
+					}
+				}
+			}
+
+			By("Sampling, rate limiting and aggregating events")
+			config = &ingressnodefwv1alpha1.IngressNodeFirewallConfig{}
+			err = k8sClient.Get(context.Background(), types.NamespacedName{Name: IngressNodeFirewallResourceName, Namespace: IngressNodeFwConfigTestNameSpace}, config)
+			Expect(err).NotTo(HaveOccurred())
+			config.Spec.Events = &ingressnodefwv1alpha1.IngressNodeFirewallEvents{SampleRate: 10, MaxEventsPerSecond: 500,
+				AggregationWindowSeconds: pointer.Int32(0)}
+			err = k8sClient.Update(context.TODO(), config)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(func() map[string]string {
+				daemonSet = &appsv1.DaemonSet{}
+				err := k8sClient.Get(context.TODO(), types.NamespacedName{Name: DeamonSetName, Namespace: IngressNodeFwConfigTestNameSpace}, daemonSet)
+				if err != nil {
+					return nil
+				}
+				envs := map[string]string{}
+				for _, c := range daemonSet.Spec.Template.Spec.Containers {
+					if c.Name != "daemon" {
+						continue
+					}
+					for _, env := range c.Env {
+						if env.Name == "EVENT_SAMPLE_RATE" || env.Name == "MAX_EVENTS_PER_SECOND" ||
+							env.Name == "EVENT_AGGREGATION_WINDOW_SECONDS" {
+							envs[env.Name] = env.Value
+						}
+					}
+				}
+				return envs
+			}, 2*time.Second, 200*time.Millisecond).Should(Equal(map[string]string{"EVENT_SAMPLE_RATE": "10", "MAX_EVENTS_PER_SECOND": "500",
+				"EVENT_AGGREGATION_WINDOW_SECONDS": "0"}))
+
+			By("Publishing drop reports")
+			config = &ingressnodefwv1alpha1.IngressNodeFirewallConfig{}
+			err = k8sClient.Get(context.Background(), types.NamespacedName{Name: IngressNodeFirewallResourceName, Namespace: IngressNodeFwConfigTestNameSpace}, config)
+			Expect(err).NotTo(HaveOccurred())
+			config.Spec.DropReports = &ingressnodefwv1alpha1.IngressNodeFirewallDropReports{PolicyReport: true}
+			err = k8sClient.Update(context.TODO(), config)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(func() map[string]string {
+				daemonSet = &appsv1.DaemonSet{}
+				err := k8sClient.Get(context.TODO(), types.NamespacedName{Name: DeamonSetName, Namespace: IngressNodeFwConfigTestNameSpace}, daemonSet)
+				if err != nil {
+					return nil
+				}
+				envs := map[string]string{}
+				for _, c := range daemonSet.Spec.Template.Spec.Containers {
+					if c.Name != "daemon" {
+						continue
+					}
+					for _, env := range c.Env {
+						if env.Name == "DROP_REPORT_INTERVAL_SECONDS" || env.Name == "DROP_REPORT_MAX_EVENTS" ||
+							env.Name == "DROP_REPORT_POLICY_REPORT" {
+							envs[env.Name] = env.Value
+						}
+					}
+				}
+				return envs
+			}, 2*time.Second, 200*time.Millisecond).Should(Equal(map[string]string{"DROP_REPORT_INTERVAL_SECONDS": "60",
+				"DROP_REPORT_MAX_EVENTS": "10", "DROP_REPORT_POLICY_REPORT": "true"}))
+
 			config = &ingressnodefwv1alpha1.IngressNodeFirewallConfig{}
 			err = k8sClient.Get(context.Background(), types.NamespacedName{Name: IngressNodeFirewallResourceName, Namespace: IngressNodeFwConfigTestNameSpace}, config)
 			Expect(err).NotTo(HaveOccurred())
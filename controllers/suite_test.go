@@ -114,10 +114,11 @@ var _ = BeforeSuite(func() {
 	Expect(err).ToNot(HaveOccurred())
 
 	err = (&IngressNodeFirewallReconciler{
-		Client:    k8sClient,
-		Scheme:    scheme.Scheme,
-		Log:       ctrl.Log.WithName("controllers").WithName("IngressNodeFirewall"),
-		Namespace: IngressNodeFwConfigTestNameSpace,
+		Client:       k8sClient,
+		Scheme:       scheme.Scheme,
+		Log:          ctrl.Log.WithName("controllers").WithName("IngressNodeFirewall"),
+		Namespace:    IngressNodeFwConfigTestNameSpace,
+		ServiceCIDRs: []string{"172.30.0.0/16"},
 	}).SetupWithManager(k8sManager)
 	Expect(err).ToNot(HaveOccurred())
 
@@ -20,6 +20,7 @@ import (
 	"crypto/tls"
 	"flag"
 	"os"
+	"strings"
 
 	ingressnodefwv1alpha1 "github.com/openshift/ingress-node-firewall/api/v1alpha1"
 	"github.com/openshift/ingress-node-firewall/controllers"
@@ -60,7 +61,7 @@ func main() {
 	var secureMetrics bool
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":39201", "The address the metric endpoint binds to.")
-	flag.BoolVar(&enableWebhook, "enable-webhook", false, "Enable deployment of webhook to validate CR IngressNodeFirewall")
+	flag.BoolVar(&enableWebhook, "enable-webhook", false, "Enable deployment of webhook to validate CR IngressNodeFirewall and IngressNodeFirewallAddressSet")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
@@ -134,6 +135,11 @@ func main() {
 		Scheme:    mgr.GetScheme(),
 		Log:       ctrl.Log.WithName("controllers").WithName("IngressNodeFirewall"),
 		Namespace: nameSpace,
+		// POD_CIDRS and SERVICE_CIDRS are only needed when the cluster does not provide an OpenShift cluster
+		// network configuration.
+		PodCIDRs:     cidrsFromEnv("POD_CIDRS"),
+		ServiceCIDRs: cidrsFromEnv("SERVICE_CIDRS"),
+		Recorder:     mgr.GetEventRecorderFor("ingressnodefirewall-controller"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "IngressNodeFirewall")
 		os.Exit(1)
@@ -144,6 +150,10 @@ func main() {
 			setupLog.Error(err, "unable to create webhook", "webhook", "IngressNodeFirewall")
 			os.Exit(1)
 		}
+		if err = (&webhook.IngressNodeFirewallAddressSetWebhook{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "IngressNodeFirewallAddressSet")
+			os.Exit(1)
+		}
 	}
 
 	cfg := ctrl.GetConfigOrDie()
@@ -179,3 +189,14 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// cidrsFromEnv returns the comma separated list of CIDRs from the given environment variable.
+func cidrsFromEnv(name string) []string {
+	var cidrs []string
+	for _, cidr := range strings.Split(os.Getenv(name), ",") {
+		if cidr = strings.TrimSpace(cidr); cidr != "" {
+			cidrs = append(cidrs, cidr)
+		}
+	}
+	return cidrs
+}
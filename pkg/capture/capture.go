@@ -0,0 +1,280 @@
+package capture
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openshift/ingress-node-firewall/api/v1alpha1"
+	nodefwloader "github.com/openshift/ingress-node-firewall/pkg/ebpf"
+)
+
+const (
+	// Path is the path of the endpoint of the metrics server that streams the captured packets in Stream mode.
+	Path = "/debug/capture"
+
+	modeEnvVar        = "CAPTURE_MODE"
+	dirEnvVar         = "CAPTURE_DIR"
+	maxFileSizeEnvVar = "CAPTURE_MAX_FILE_SIZE_MIB"
+	maxFilesEnvVar    = "CAPTURE_MAX_FILES"
+
+	// snapLen is the maximum number of bytes of a packet that events carry, MAX_EVENT_DATA in the kernel hook.
+	snapLen = 256
+	// fileNamePrefix and fileNameSuffix surround the UTC time at which a pcapng file was started in its name, so
+	// that the files sort by age.
+	fileNamePrefix = "drops-"
+	fileNameSuffix = ".pcapng"
+	fileTimeFormat = "20060102T150405.000000000Z"
+	// subscriberBufferSize is the number of packets that are buffered for a client of the stream, packets are
+	// dropped for clients that do not keep up.
+	subscriberBufferSize = 1024
+)
+
+// Packet is a captured packet.
+type Packet struct {
+	Timestamp time.Time
+	IfIndex   uint32
+	Interface string
+	// Length is the length of the packet, Data holds up to its first snapLen bytes.
+	Length  int
+	Data    []byte
+	Comment string
+}
+
+// Capturer writes captured packets in pcapng format to rotating files or streams them to HTTP clients.
+type Capturer struct {
+	mode        v1alpha1.CaptureMode
+	dir         string
+	maxFileSize int64
+	maxFiles    int
+
+	mu sync.Mutex
+	// file is the current pcapng file, fileWriter writes to it and fileSize is its size.
+	file        *os.File
+	fileWriter  *pcapngWriter
+	fileSize    int64
+	subscribers map[chan *Packet]struct{}
+}
+
+// New returns a capturer for the provided mode. In File mode, the packets are written to files in dir that are
+// rotated when they reach maxFileSize bytes, keeping maxFiles files.
+func New(mode v1alpha1.CaptureMode, dir string, maxFileSize int64, maxFiles int) *Capturer {
+	return &Capturer{
+		mode:        mode,
+		dir:         dir,
+		maxFileSize: maxFileSize,
+		maxFiles:    maxFiles,
+		subscribers: make(map[chan *Packet]struct{}),
+	}
+}
+
+// NewFromEnv returns a capturer configured by the environment of the daemon, or nil if capture is disabled.
+func NewFromEnv() (*Capturer, error) {
+	mode := v1alpha1.CaptureMode(os.Getenv(modeEnvVar))
+	switch mode {
+	case "":
+		return nil, nil
+	case v1alpha1.CaptureModeStream:
+		return New(mode, "", 0, 0), nil
+	case v1alpha1.CaptureModeFile:
+	default:
+		return nil, fmt.Errorf("invalid %s %q", modeEnvVar, mode)
+	}
+	dir := os.Getenv(dirEnvVar)
+	if dir == "" {
+		return nil, fmt.Errorf("%s must be set in %s mode", dirEnvVar, mode)
+	}
+	maxFileSizeMiB, err := intFromEnv(maxFileSizeEnvVar, v1alpha1.DefaultCaptureMaxFileSizeMiB)
+	if err != nil {
+		return nil, err
+	}
+	maxFiles, err := intFromEnv(maxFilesEnvVar, v1alpha1.DefaultCaptureMaxFiles)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create capture directory %s: %w", dir, err)
+	}
+	return New(mode, dir, int64(maxFileSizeMiB)<<20, maxFiles), nil
+}
+
+// intFromEnv returns the positive integer value of the environment variable name, or def if it is not set.
+func intFromEnv(name string, def int) (int, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return def, nil
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil || i < 1 {
+		return 0, fmt.Errorf("invalid %s %q", name, value)
+	}
+	return i, nil
+}
+
+// HandleEvent captures the packet of an event of the XDP program, with the rule ID, action and flags of the event in
+// the comment of the packet.
+func (c *Capturer) HandleEvent(event *nodefwloader.RawEvent) {
+	decoded := event.Decode()
+	comment := fmt.Sprintf("ruleId %d action %s", decoded.RuleID, decoded.Action)
+	if decoded.Blocklisted {
+		comment += ", source is in the blocklist"
+	}
+	if decoded.SourceBanned {
+		comment += ", source is banned"
+	}
+	if decoded.BanStarted {
+		comment += ", rule banned the source"
+	}
+	c.Capture(&Packet{
+		Timestamp: event.Timestamp,
+		IfIndex:   uint32(event.Header.IfId),
+		Interface: event.Interface,
+		Length:    int(event.Header.PktLength),
+		Data:      event.Packet,
+		Comment:   comment,
+	})
+}
+
+// Capture writes packet to the current pcapng file in File mode, or sends it to the clients of the stream in Stream
+// mode. Errors are logged, a new file is started for the next packet if writing to the current file failed.
+func (c *Capturer) Capture(packet *Packet) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.mode == v1alpha1.CaptureModeStream {
+		for subscriber := range c.subscribers {
+			select {
+			case subscriber <- packet:
+			default:
+			}
+		}
+		return
+	}
+
+	if c.file == nil || c.fileSize >= c.maxFileSize {
+		if err := c.rotate(packet.Timestamp); err != nil {
+			log.Printf("Failed to start a new capture file in %s: %v", c.dir, err)
+			return
+		}
+	}
+	if err := c.fileWriter.writePacket(packet); err != nil {
+		log.Printf("Failed to write to capture file %s: %v", c.file.Name(), err)
+		c.closeFile()
+	}
+}
+
+// rotate closes the current pcapng file, starts a new one and removes the oldest files beyond maxFiles.
+func (c *Capturer) rotate(now time.Time) error {
+	c.closeFile()
+	name := path.Join(c.dir, fileNamePrefix+now.UTC().Format(fileTimeFormat)+fileNameSuffix)
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	c.file, c.fileSize = file, 0
+	if c.fileWriter, err = newPcapngWriter(&countingWriter{w: file, n: &c.fileSize}); err != nil {
+		c.closeFile()
+		return err
+	}
+	return c.removeOldFiles()
+}
+
+func (c *Capturer) closeFile() {
+	if c.file == nil {
+		return
+	}
+	if err := c.file.Close(); err != nil {
+		log.Printf("Failed to close capture file %s: %v", c.file.Name(), err)
+	}
+	c.file, c.fileWriter = nil, nil
+}
+
+// removeOldFiles removes the oldest pcapng files of the directory so that maxFiles files are kept.
+func (c *Capturer) removeOldFiles() error {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, entry := range entries {
+		if name := entry.Name(); strings.HasPrefix(name, fileNamePrefix) && strings.HasSuffix(name, fileNameSuffix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for len(names) > c.maxFiles {
+		if err := os.Remove(path.Join(c.dir, names[0])); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		names = names[1:]
+	}
+	return nil
+}
+
+// Close closes the current pcapng file.
+func (c *Capturer) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closeFile()
+}
+
+// ServeHTTP streams the captured packets in pcapng format until the client disconnects, for example to
+// wireshark -k -i -.
+func (c *Capturer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if c.mode != v1alpha1.CaptureModeStream {
+		http.Error(w, "the capture is not in Stream mode", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-pcapng")
+	flusher, _ := w.(http.Flusher)
+	writer, err := newPcapngWriter(w)
+	if err != nil {
+		return
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	subscriber := make(chan *Packet, subscriberBufferSize)
+	c.mu.Lock()
+	c.subscribers[subscriber] = struct{}{}
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.subscribers, subscriber)
+		c.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case packet := <-subscriber:
+			if err := writer.writePacket(packet); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// countingWriter counts the bytes that are written to w in n.
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	*c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,204 @@
+package capture
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/openshift/ingress-node-firewall/api/v1alpha1"
+)
+
+// pcapngBlock is a block of a pcapng file.
+type pcapngBlock struct {
+	blockType uint32
+	body      []byte
+}
+
+// readBlocks parses the blocks of a little endian pcapng file.
+func readBlocks(t *testing.T, data []byte) []pcapngBlock {
+	var blocks []pcapngBlock
+	for len(data) > 0 {
+		if len(data) < 12 {
+			t.Fatalf("truncated block of %d bytes", len(data))
+		}
+		blockType := binary.LittleEndian.Uint32(data[0:4])
+		length := binary.LittleEndian.Uint32(data[4:8])
+		if length%4 != 0 || int(length) > len(data) {
+			t.Fatalf("invalid block length %d", length)
+		}
+		if trailer := binary.LittleEndian.Uint32(data[length-4 : length]); trailer != length {
+			t.Fatalf("block length %d does not match the trailing length %d", length, trailer)
+		}
+		blocks = append(blocks, pcapngBlock{blockType: blockType, body: data[8 : length-4]})
+		data = data[length:]
+	}
+	return blocks
+}
+
+// packetOf returns the captured data and the comment of an enhanced packet block.
+func packetOf(t *testing.T, block pcapngBlock) ([]byte, string) {
+	if block.blockType != blockTypeEnhancedPacket {
+		t.Fatalf("expected an enhanced packet block, got block type %#x", block.blockType)
+	}
+	capturedLen := int(binary.LittleEndian.Uint32(block.body[12:16]))
+	data := block.body[20 : 20+capturedLen]
+	options := block.body[20+capturedLen+padding(capturedLen):]
+	var comment string
+	for len(options) >= 4 {
+		code := binary.LittleEndian.Uint16(options[0:2])
+		length := int(binary.LittleEndian.Uint16(options[2:4]))
+		if code == optionComment {
+			comment = string(options[4 : 4+length])
+		}
+		options = options[4+length+padding(length):]
+	}
+	return data, comment
+}
+
+func testPacket(ifIndex uint32, data string, comment string) *Packet {
+	return &Packet{Timestamp: time.Now(), IfIndex: ifIndex, Interface: "eth0", Length: 1500, Data: []byte(data),
+		Comment: comment}
+}
+
+func TestPcapngWriter(t *testing.T) {
+	var buf bytes.Buffer
+	writer, err := newPcapngWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, packet := range []*Packet{
+		testPacket(2, "first", "ruleId 1 action Drop"),
+		testPacket(3, "second packet", ""),
+		testPacket(2, "third!", "ruleId 3 action Drop"),
+	} {
+		if err := writer.writePacket(packet); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	blocks := readBlocks(t, buf.Bytes())
+	expectedTypes := []uint32{blockTypeSectionHeader, blockTypeInterfaceDesc, blockTypeEnhancedPacket,
+		blockTypeInterfaceDesc, blockTypeEnhancedPacket, blockTypeEnhancedPacket}
+	if len(blocks) != len(expectedTypes) {
+		t.Fatalf("got %d blocks, expected %d", len(blocks), len(expectedTypes))
+	}
+	for i, block := range blocks {
+		if block.blockType != expectedTypes[i] {
+			t.Fatalf("block %d has type %#x, expected %#x", i, block.blockType, expectedTypes[i])
+		}
+	}
+	if magic := binary.LittleEndian.Uint32(blocks[0].body[0:4]); magic != byteOrderMagic {
+		t.Fatalf("unexpected byte order magic %#x", magic)
+	}
+	if data, comment := packetOf(t, blocks[2]); string(data) != "first" || comment != "ruleId 1 action Drop" {
+		t.Fatalf("unexpected first packet %q with comment %q", data, comment)
+	}
+	if data, comment := packetOf(t, blocks[4]); string(data) != "second packet" || comment != "" {
+		t.Fatalf("unexpected second packet %q with comment %q", data, comment)
+	}
+	// The third packet is on the first interface, whose description block has ID 0.
+	if interfaceID := binary.LittleEndian.Uint32(blocks[5].body[0:4]); interfaceID != 0 {
+		t.Fatalf("third packet has interface ID %d, expected 0", interfaceID)
+	}
+	if originalLen := binary.LittleEndian.Uint32(blocks[5].body[16:20]); originalLen != 1500 {
+		t.Fatalf("third packet has original length %d, expected 1500", originalLen)
+	}
+}
+
+func TestCaptureFileRotation(t *testing.T) {
+	dir := t.TempDir()
+	capturer := New(v1alpha1.CaptureModeFile, dir, 200, 2)
+	defer capturer.Close()
+	for i := 0; i < 10; i++ {
+		packet := testPacket(2, "0123456789012345678901234567890123456789", "ruleId 1 action Drop")
+		packet.Timestamp = time.Date(2026, 1, 1, 0, 0, i, 0, time.UTC)
+		capturer.Capture(packet)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 capture files, got %d", len(entries))
+	}
+	for _, entry := range entries {
+		data, err := os.ReadFile(path.Join(dir, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		blocks := readBlocks(t, data)
+		if len(blocks) < 3 || blocks[0].blockType != blockTypeSectionHeader || blocks[1].blockType != blockTypeInterfaceDesc {
+			t.Fatalf("%s does not start with a section header and an interface description", entry.Name())
+		}
+	}
+	// The newest file is kept.
+	if newest := entries[1].Name(); newest < fileNamePrefix+"20260101T000008" {
+		t.Fatalf("unexpected newest capture file %s", newest)
+	}
+}
+
+func TestCaptureStream(t *testing.T) {
+	capturer := New(v1alpha1.CaptureModeStream, "", 0, 0)
+	server := httptest.NewServer(capturer)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	// The section header block is flushed before the client is subscribed.
+	header := make([]byte, 28)
+	if _, err := io.ReadFull(response.Body, header); err != nil {
+		t.Fatal(err)
+	}
+	if blocks := readBlocks(t, header); blocks[0].blockType != blockTypeSectionHeader {
+		t.Fatalf("the stream does not start with a section header")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		capturer.mu.Lock()
+		subscribed := len(capturer.subscribers) == 1
+		capturer.mu.Unlock()
+		if subscribed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the client was not subscribed to the stream")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	capturer.Capture(testPacket(2, "streamed", "ruleId 7 action Drop"))
+	var length [8]byte
+	var blocks []pcapngBlock
+	for len(blocks) < 2 {
+		if _, err := io.ReadFull(response.Body, length[:]); err != nil {
+			t.Fatal(err)
+		}
+		block := make([]byte, binary.LittleEndian.Uint32(length[4:8]))
+		copy(block, length[:])
+		if _, err := io.ReadFull(response.Body, block[8:]); err != nil {
+			t.Fatal(err)
+		}
+		blocks = append(blocks, readBlocks(t, block)...)
+	}
+	if data, comment := packetOf(t, blocks[1]); string(data) != "streamed" || comment != "ruleId 7 action Drop" {
+		t.Fatalf("unexpected streamed packet %q with comment %q", data, comment)
+	}
+}
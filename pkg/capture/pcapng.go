@@ -0,0 +1,101 @@
+package capture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// Block types and options of the pcapng format, see https://www.ietf.org/archive/id/draft-ietf-opsawg-pcapng-01.html.
+const (
+	blockTypeSectionHeader     = 0x0A0D0D0A
+	blockTypeInterfaceDesc     = 0x00000001
+	blockTypeEnhancedPacket    = 0x00000006
+	byteOrderMagic             = 0x1A2B3C4D
+	optionEndOfOptions         = 0
+	optionComment              = 1
+	optionInterfaceName        = 2
+	optionInterfaceTSResol     = 9
+	linkTypeEthernet           = 1
+	timestampResolutionNanosec = 9
+)
+
+// pcapngWriter writes packets in pcapng format. An interface description block is written before the first packet
+// of each interface.
+type pcapngWriter struct {
+	w io.Writer
+	// interfaces maps interface indexes to the IDs of their interface description blocks.
+	interfaces map[uint32]uint32
+	buf        bytes.Buffer
+}
+
+// newPcapngWriter writes the section header block to w and returns a writer for the packets of the section.
+func newPcapngWriter(w io.Writer) (*pcapngWriter, error) {
+	p := &pcapngWriter{w: w, interfaces: make(map[uint32]uint32)}
+	var body bytes.Buffer
+	_ = binary.Write(&body, binary.LittleEndian, uint32(byteOrderMagic))
+	_ = binary.Write(&body, binary.LittleEndian, uint16(1)) // major version
+	_ = binary.Write(&body, binary.LittleEndian, uint16(0)) // minor version
+	_ = binary.Write(&body, binary.LittleEndian, int64(-1)) // unknown section length
+	return p, p.writeBlock(blockTypeSectionHeader, body.Bytes())
+}
+
+// writePacket writes an enhanced packet block for packet, preceded by the interface description block of its
+// interface if it is the first packet of the interface.
+func (p *pcapngWriter) writePacket(packet *Packet) error {
+	interfaceID, ok := p.interfaces[packet.IfIndex]
+	if !ok {
+		interfaceID = uint32(len(p.interfaces))
+		var body bytes.Buffer
+		_ = binary.Write(&body, binary.LittleEndian, uint16(linkTypeEthernet))
+		_ = binary.Write(&body, binary.LittleEndian, uint16(0)) // reserved
+		_ = binary.Write(&body, binary.LittleEndian, uint32(snapLen))
+		writeOption(&body, optionInterfaceName, []byte(packet.Interface))
+		writeOption(&body, optionInterfaceTSResol, []byte{timestampResolutionNanosec})
+		writeOption(&body, optionEndOfOptions, nil)
+		if err := p.writeBlock(blockTypeInterfaceDesc, body.Bytes()); err != nil {
+			return err
+		}
+		p.interfaces[packet.IfIndex] = interfaceID
+	}
+
+	timestamp := uint64(packet.Timestamp.UnixNano())
+	var body bytes.Buffer
+	_ = binary.Write(&body, binary.LittleEndian, interfaceID)
+	_ = binary.Write(&body, binary.LittleEndian, uint32(timestamp>>32))
+	_ = binary.Write(&body, binary.LittleEndian, uint32(timestamp))
+	_ = binary.Write(&body, binary.LittleEndian, uint32(len(packet.Data)))
+	_ = binary.Write(&body, binary.LittleEndian, uint32(packet.Length))
+	body.Write(packet.Data)
+	body.Write(make([]byte, padding(len(packet.Data))))
+	if packet.Comment != "" {
+		writeOption(&body, optionComment, []byte(packet.Comment))
+		writeOption(&body, optionEndOfOptions, nil)
+	}
+	return p.writeBlock(blockTypeEnhancedPacket, body.Bytes())
+}
+
+// writeBlock writes a block of the provided type with body, which must be padded to 32 bits, in a single write.
+func (p *pcapngWriter) writeBlock(blockType uint32, body []byte) error {
+	length := uint32(12 + len(body))
+	p.buf.Reset()
+	_ = binary.Write(&p.buf, binary.LittleEndian, blockType)
+	_ = binary.Write(&p.buf, binary.LittleEndian, length)
+	p.buf.Write(body)
+	_ = binary.Write(&p.buf, binary.LittleEndian, length)
+	_, err := p.w.Write(p.buf.Bytes())
+	return err
+}
+
+// writeOption appends an option with the provided code and value, padded to 32 bits, to buf.
+func writeOption(buf *bytes.Buffer, code uint16, value []byte) {
+	_ = binary.Write(buf, binary.LittleEndian, code)
+	_ = binary.Write(buf, binary.LittleEndian, uint16(len(value)))
+	buf.Write(value)
+	buf.Write(make([]byte, padding(len(value))))
+}
+
+// padding returns the number of bytes that pad length bytes to 32 bits.
+func padding(length int) int {
+	return (4 - length%4) % 4
+}
@@ -0,0 +1,250 @@
+package dropreport
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	infv1alpha1 "github.com/openshift/ingress-node-firewall/api/v1alpha1"
+	nodefwloader "github.com/openshift/ingress-node-firewall/pkg/ebpf"
+	"github.com/openshift/ingress-node-firewall/pkg/explain"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	intervalEnvVar             = "DROP_REPORT_INTERVAL_SECONDS"
+	maxEventsEnvVar            = "DROP_REPORT_MAX_EVENTS"
+	policyReportEnvVar         = "DROP_REPORT_POLICY_REPORT"
+	ruleInheritanceEnvVar      = "ENABLE_RULE_INHERITANCE"
+	allowEssentialICMPv6EnvVar = "ALLOW_ESSENTIAL_ICMPV6"
+
+	// EventReason is the reason of the Kubernetes Events of denied packets.
+	EventReason = "PacketsDenied"
+	// maxDrops bounds the memory of the reporter, the events of new keys are not reported while it holds that many
+	// keys in an interval.
+	maxDrops = 10000
+)
+
+// Drop summarizes the events of denied packets of the same interface, rule, source address, protocol and destination
+// port over an interval.
+type Drop struct {
+	nodefwloader.EventKey
+	Events    uint64
+	Bytes     uint64
+	FirstSeen time.Time
+	LastSeen  time.Time
+	// Blocklisted is set if the packets were dropped because their source is in the blocklist.
+	Blocklisted bool
+}
+
+// Reporter publishes periodic summaries of the denied packets of a node as Kubernetes Events on the
+// IngressNodeFirewalls that own the rules, and optionally as a PolicyReport.
+type Reporter struct {
+	client       client.Client
+	reader       client.Reader
+	recorder     record.EventRecorder
+	log          logr.Logger
+	nodeName     string
+	namespace    string
+	interval     time.Duration
+	maxEvents    int
+	policyReport bool
+	options      explain.Options
+
+	mu    sync.Mutex
+	drops map[nodefwloader.EventKey]*Drop
+}
+
+// NewFromEnv returns a reporter configured by the environment of the daemon, or nil if drop reports are disabled.
+// The reporter writes with c and reads the IngressNodeFirewalls and the IngressNodeFirewallNodeState of the node
+// with reader, so that they do not need to be cached.
+func NewFromEnv(c client.Client, reader client.Reader, recorder record.EventRecorder, log logr.Logger,
+	nodeName, namespace string) (*Reporter, error) {
+	intervalVal := os.Getenv(intervalEnvVar)
+	if intervalVal == "" {
+		return nil, nil
+	}
+	interval, err := strconv.Atoi(intervalVal)
+	if err != nil || interval < 1 {
+		return nil, fmt.Errorf("invalid %s %q", intervalEnvVar, intervalVal)
+	}
+	maxEvents := infv1alpha1.DefaultDropReportMaxEvents
+	if maxEventsVal := os.Getenv(maxEventsEnvVar); maxEventsVal != "" {
+		if maxEvents, err = strconv.Atoi(maxEventsVal); err != nil || maxEvents < 1 {
+			return nil, fmt.Errorf("invalid %s %q", maxEventsEnvVar, maxEventsVal)
+		}
+	}
+	r := &Reporter{
+		client:    c,
+		reader:    reader,
+		recorder:  recorder,
+		log:       log,
+		nodeName:  nodeName,
+		namespace: namespace,
+		interval:  time.Duration(interval) * time.Second,
+		maxEvents: maxEvents,
+		drops:     make(map[nodefwloader.EventKey]*Drop),
+	}
+	for envVar, value := range map[string]*bool{
+		policyReportEnvVar:         &r.policyReport,
+		ruleInheritanceEnvVar:      &r.options.RuleInheritance,
+		allowEssentialICMPv6EnvVar: &r.options.AllowEssentialICMPv6,
+	} {
+		if strVal := os.Getenv(envVar); strVal != "" {
+			if *value, err = strconv.ParseBool(strVal); err != nil {
+				return nil, fmt.Errorf("failed to convert %s %q to boolean: %v", envVar, strVal, err)
+			}
+		}
+	}
+	return r, nil
+}
+
+// HandleEvent adds an event of the XDP program to the drops of the current interval.
+func (r *Reporter) HandleEvent(event *nodefwloader.RawEvent) {
+	key := event.Key()
+	decoded := event.Decode()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	drop, ok := r.drops[key]
+	if !ok {
+		if len(r.drops) >= maxDrops {
+			return
+		}
+		drop = &Drop{EventKey: key, FirstSeen: event.Timestamp, Blocklisted: decoded.Blocklisted}
+		r.drops[key] = drop
+	}
+	drop.Events++
+	drop.Bytes += uint64(event.Header.PktLength)
+	drop.LastSeen = event.Timestamp
+}
+
+// take returns the drops of the current interval, with the most events first, and starts a new interval.
+func (r *Reporter) take() []Drop {
+	r.mu.Lock()
+	drops := make([]Drop, 0, len(r.drops))
+	for _, drop := range r.drops {
+		drops = append(drops, *drop)
+	}
+	r.drops = make(map[nodefwloader.EventKey]*Drop)
+	r.mu.Unlock()
+	sort.Slice(drops, func(i, j int) bool {
+		if drops[i].Events != drops[j].Events {
+			return drops[i].Events > drops[j].Events
+		}
+		return drops[i].FirstSeen.Before(drops[j].FirstSeen)
+	})
+	return drops
+}
+
+// Start publishes the reports of each interval until ctx is done. It implements manager.Runnable.
+func (r *Reporter) Start(ctx context.Context) error {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.report(ctx, r.take()); err != nil {
+				r.log.Error(err, "failed to publish the drop reports")
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// report records Kubernetes Events for drops on the IngressNodeFirewalls that own the rules, and publishes the
+// PolicyReport of the node if enabled.
+func (r *Reporter) report(ctx context.Context, drops []Drop) error {
+	if len(drops) == 0 && !r.policyReport {
+		return nil
+	}
+	evaluator, firewalls, err := r.evaluator(ctx)
+	if err != nil {
+		return err
+	}
+	r.recordEvents(drops, evaluator, firewalls)
+	if !r.policyReport {
+		return nil
+	}
+	return r.publishPolicyReport(ctx, newPolicyReport(r.nodeName, r.namespace, drops, evaluator))
+}
+
+// evaluator returns an evaluator of the rules of the node and the IngressNodeFirewalls by name.
+func (r *Reporter) evaluator(ctx context.Context) (*explain.Evaluator, map[string]*infv1alpha1.IngressNodeFirewall, error) {
+	nodeState := &infv1alpha1.IngressNodeFirewallNodeState{}
+	if err := r.reader.Get(ctx, types.NamespacedName{Name: r.nodeName, Namespace: r.namespace}, nodeState); err != nil &&
+		!apierrors.IsNotFound(err) {
+		return nil, nil, fmt.Errorf("failed to get the IngressNodeFirewallNodeState of node %s: %w", r.nodeName, err)
+	}
+	firewallList := &infv1alpha1.IngressNodeFirewallList{}
+	if err := r.reader.List(ctx, firewallList); err != nil {
+		return nil, nil, fmt.Errorf("failed to list the IngressNodeFirewalls: %w", err)
+	}
+	evaluator, err := explain.NewEvaluator(nodeState.Spec, r.options)
+	if err != nil {
+		return nil, nil, err
+	}
+	firewalls := make(map[string]*infv1alpha1.IngressNodeFirewall, len(firewallList.Items))
+	for i := range firewallList.Items {
+		firewalls[firewallList.Items[i].Name] = &firewallList.Items[i]
+	}
+	return evaluator, firewalls, nil
+}
+
+// recordEvents records a warning on the IngressNodeFirewalls that own the rule of each drop, for up to maxEvents
+// drops with the most events. Drops of blocklisted sources and of rules that were removed have no owner.
+func (r *Reporter) recordEvents(drops []Drop, evaluator *explain.Evaluator, firewalls map[string]*infv1alpha1.IngressNodeFirewall) {
+	recorded := 0
+	for _, drop := range drops {
+		if recorded >= r.maxEvents {
+			return
+		}
+		for _, owner := range owners(drop, evaluator) {
+			firewall, ok := firewalls[owner]
+			if !ok {
+				continue
+			}
+			r.recorder.Event(firewall, corev1.EventTypeWarning, EventReason, message(r.nodeName, drop))
+			recorded++
+		}
+	}
+}
+
+// owners returns the names of the IngressNodeFirewalls that own the rule of drop.
+func owners(drop Drop, evaluator *explain.Evaluator) []string {
+	if drop.Blocklisted || drop.Source == "" {
+		return nil
+	}
+	return evaluator.RuleOwners(drop.Interface, net.ParseIP(drop.Source), uint32(drop.RuleID))
+}
+
+// message describes drop on the node.
+func message(nodeName string, drop Drop) string {
+	by := fmt.Sprintf("Rule %d", drop.RuleID)
+	if drop.Blocklisted {
+		by = "The blocklist"
+	}
+	var packets string
+	switch {
+	case drop.Source == "":
+		packets = fmt.Sprintf("%d non IP packets (%d bytes)", drop.Events, drop.Bytes)
+	case drop.DstPort != 0:
+		packets = fmt.Sprintf("%d packets (%d bytes) from %s to %s port %d", drop.Events, drop.Bytes, drop.Source,
+			drop.Protocol, drop.DstPort)
+	default:
+		packets = fmt.Sprintf("%d %s packets (%d bytes) from %s", drop.Events, drop.Protocol, drop.Bytes, drop.Source)
+	}
+	return fmt.Sprintf("%s denied %s on interface %s of node %s between %s and %s", by, packets, drop.Interface,
+		nodeName, drop.FirstSeen.UTC().Format(time.RFC3339), drop.LastSeen.UTC().Format(time.RFC3339))
+}
@@ -0,0 +1,166 @@
+package dropreport
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	infv1alpha1 "github.com/openshift/ingress-node-firewall/api/v1alpha1"
+	nodefwloader "github.com/openshift/ingress-node-firewall/pkg/ebpf"
+	"github.com/openshift/ingress-node-firewall/pkg/explain"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
+)
+
+const eventFlagBlocklisted = 4
+
+var start = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// tcpEvent returns a deny event of ruleID for a TCP packet from src to dstPort on eth0.
+func tcpEvent(t *testing.T, offset time.Duration, ruleID uint16, src string, dstPort uint16, flags uint8) *nodefwloader.RawEvent {
+	eth := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0x02, 0, 0, 0, 0, 1},
+		DstMAC:       net.HardwareAddr{0x02, 0, 0, 0, 0, 2},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: net.ParseIP(src).To4(),
+		DstIP: net.ParseIP("192.0.2.1").To4()}
+	tcp := &layers.TCP{SrcPort: 40000, DstPort: layers.TCPPort(dstPort), SYN: true}
+	if err := tcp.SetNetworkLayerForChecksum(ip); err != nil {
+		t.Fatal(err)
+	}
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true},
+		eth, ip, tcp); err != nil {
+		t.Fatal(err)
+	}
+	return nodefwloader.NewRawEvent(start.Add(offset),
+		nodefwloader.BpfEventHdrSt{IfId: 2, RuleId: ruleID, Action: 1, Flags: flags, PktLength: 60}, "eth0", buf.Bytes())
+}
+
+func newTestReporter(maxEvents int) *Reporter {
+	return &Reporter{nodeName: "worker-0", namespace: "ingress-node-firewall-system", maxEvents: maxEvents,
+		drops: make(map[nodefwloader.EventKey]*Drop)}
+}
+
+// newTestEvaluator returns an evaluator of a node with rule 10 denying SSH from 10.0.0.0/8 on eth0, owned by
+// IngressNodeFirewall deny-ssh.
+func newTestEvaluator(t *testing.T) (*explain.Evaluator, map[string]*infv1alpha1.IngressNodeFirewall) {
+	denySSH := infv1alpha1.IngressNodeFirewallProtocolRule{
+		Order: 10,
+		ProtocolConfig: infv1alpha1.IngressNodeProtocolConfig{
+			Protocol: infv1alpha1.ProtocolTypeTCP,
+			TCP:      &infv1alpha1.IngressNodeFirewallProtoRule{Ports: intstr.FromInt(22)},
+		},
+		Action: infv1alpha1.IngressNodeFirewallDeny,
+	}
+	ingress := []infv1alpha1.IngressNodeFirewallRules{
+		{SourceCIDRs: []string{"10.0.0.0/8"}, FirewallProtocolRules: []infv1alpha1.IngressNodeFirewallProtocolRule{denySSH}},
+	}
+	firewall := infv1alpha1.IngressNodeFirewall{Spec: infv1alpha1.IngressNodeFirewallSpec{
+		Interfaces: []string{"eth0"},
+		Ingress:    ingress,
+	}}
+	firewall.Name = "deny-ssh"
+	spec := infv1alpha1.IngressNodeFirewallNodeStateSpec{
+		InterfaceIngressRules: map[string][]infv1alpha1.IngressNodeFirewallRules{"eth0": ingress},
+		RuleOwners: []infv1alpha1.IngressNodeFirewallRuleOwner{
+			{Interface: "eth0", SourceCIDR: "10.0.0.0/8", RuleID: 10, Firewall: firewall.Name, Order: 10},
+		},
+	}
+	evaluator, err := explain.NewEvaluator(spec, explain.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return evaluator, map[string]*infv1alpha1.IngressNodeFirewall{firewall.Name: &firewall}
+}
+
+func TestTake(t *testing.T) {
+	r := newTestReporter(10)
+	for i := 0; i < 5; i++ {
+		r.HandleEvent(tcpEvent(t, time.Duration(i)*time.Second, 10, "10.0.0.1", 22, 0))
+	}
+	r.HandleEvent(tcpEvent(t, time.Second, 10, "10.0.0.2", 22, 0))
+	r.HandleEvent(tcpEvent(t, 2*time.Second, 0, "10.0.0.3", 80, eventFlagBlocklisted))
+	r.HandleEvent(tcpEvent(t, 3*time.Second, 0, "10.0.0.3", 80, eventFlagBlocklisted))
+
+	drops := r.take()
+	if len(drops) != 3 {
+		t.Fatalf("expected 3 drops, got %d", len(drops))
+	}
+	scan := drops[0]
+	if scan.Source != "10.0.0.1" || scan.Protocol != "tcp" || scan.DstPort != 22 || scan.Events != 5 ||
+		scan.Bytes != 300 || !scan.FirstSeen.Equal(start) || !scan.LastSeen.Equal(start.Add(4*time.Second)) {
+		t.Fatalf("unexpected first drop %+v", scan)
+	}
+	if drops[1].Source != "10.0.0.3" || !drops[1].Blocklisted || drops[1].Events != 2 {
+		t.Fatalf("unexpected second drop %+v", drops[1])
+	}
+	if drops := r.take(); len(drops) != 0 {
+		t.Fatalf("expected a new interval to start without drops, got %v", drops)
+	}
+}
+
+func TestRecordEvents(t *testing.T) {
+	evaluator, firewalls := newTestEvaluator(t)
+	r := newTestReporter(1)
+	recorder := record.NewFakeRecorder(10)
+	r.recorder = recorder
+	r.HandleEvent(tcpEvent(t, 0, 0, "10.0.0.3", 80, eventFlagBlocklisted))
+	r.HandleEvent(tcpEvent(t, 0, 0, "10.0.0.3", 80, eventFlagBlocklisted))
+	r.HandleEvent(tcpEvent(t, 0, 10, "10.0.0.1", 22, 0))
+	r.HandleEvent(tcpEvent(t, time.Second, 10, "10.0.0.2", 22, 0))
+
+	r.recordEvents(r.take(), evaluator, firewalls)
+	if len(recorder.Events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(recorder.Events))
+	}
+	event := <-recorder.Events
+	expected := "Warning PacketsDenied Rule 10 denied 1 packets (60 bytes) from 10.0.0.1 to tcp port 22 on interface " +
+		"eth0 of node worker-0 between 2026-01-01T00:00:00Z and 2026-01-01T00:00:00Z"
+	if event != expected {
+		t.Fatalf("unexpected event %q", event)
+	}
+}
+
+func TestNewPolicyReport(t *testing.T) {
+	evaluator, _ := newTestEvaluator(t)
+	r := newTestReporter(10)
+	r.HandleEvent(tcpEvent(t, 0, 10, "10.0.0.1", 22, 0))
+	r.HandleEvent(tcpEvent(t, time.Second, 10, "10.0.0.1", 22, 0))
+	r.HandleEvent(tcpEvent(t, 0, 0, "10.0.0.3", 80, eventFlagBlocklisted))
+
+	report := newPolicyReport(r.nodeName, r.namespace, r.take(), evaluator)
+	if report.GetName() != "ingress-node-firewall-worker-0" || report.GetNamespace() != r.namespace ||
+		report.GetKind() != "PolicyReport" || report.GetAPIVersion() != "wgpolicyk8s.io/v1alpha2" {
+		t.Fatalf("unexpected PolicyReport %s %s/%s", report.GetAPIVersion(), report.GetNamespace(), report.GetName())
+	}
+	// The object must hold JSON compatible values only to be sent to the API server.
+	report = report.DeepCopy()
+	if fail, _, _ := unstructured.NestedInt64(report.Object, "summary", "fail"); fail != 2 {
+		t.Fatalf("expected 2 failures in the summary, got %d", fail)
+	}
+	results, _, _ := unstructured.NestedSlice(report.Object, "results")
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	for i, expected := range []struct{ policy, rule, packets string }{
+		{"deny-ssh", "10", "2"},
+		{blocklistPolicy, "0", "1"},
+	} {
+		result := results[i].(map[string]interface{})
+		packets, _, _ := unstructured.NestedString(result, "properties", "packets")
+		if result["policy"] != expected.policy || result["rule"] != expected.rule || packets != expected.packets ||
+			result["result"] != "fail" {
+			t.Fatalf("unexpected result %d %v", i, result)
+		}
+	}
+	if message := results[1].(map[string]interface{})["message"].(string); !strings.HasPrefix(message, "The blocklist denied") {
+		t.Fatalf("unexpected message %q", message)
+	}
+}
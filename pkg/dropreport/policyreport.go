@@ -0,0 +1,116 @@
+package dropreport
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openshift/ingress-node-firewall/pkg/explain"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// policyReportNamePrefix is followed by the name of the node in the name of its PolicyReport.
+	policyReportNamePrefix = "ingress-node-firewall-"
+	policyReportSource     = "ingress-node-firewall"
+	policyReportCategory   = "Ingress Node Firewall"
+	// blocklistPolicy is the policy of the results of blocklisted sources, unknownPolicy the one of rules without
+	// an owner.
+	blocklistPolicy = "blocklist"
+	unknownPolicy   = "unknown"
+	// maxPolicyReportResults bounds the size of the PolicyReport, the drops with the most events are kept.
+	maxPolicyReportResults = 100
+)
+
+// policyReportGVK is the PolicyReport kind of the wg-policy-prototypes API.
+var policyReportGVK = schema.GroupVersionKind{Group: "wgpolicyk8s.io", Version: "v1alpha2", Kind: "PolicyReport"}
+
+// newPolicyReport returns the PolicyReport of the node with a fail result for each drop of the interval. The policy
+// of a result is the IngressNodeFirewall that owns the rule and its rule is the rule ID.
+func newPolicyReport(nodeName, namespace string, drops []Drop, evaluator *explain.Evaluator) *unstructured.Unstructured {
+	if len(drops) > maxPolicyReportResults {
+		drops = drops[:maxPolicyReportResults]
+	}
+	results := make([]interface{}, 0, len(drops))
+	for _, drop := range drops {
+		policy := strings.Join(owners(drop, evaluator), ",")
+		if drop.Blocklisted {
+			policy = blocklistPolicy
+		} else if policy == "" {
+			policy = unknownPolicy
+		}
+		results = append(results, map[string]interface{}{
+			"source":   policyReportSource,
+			"category": policyReportCategory,
+			"policy":   policy,
+			"rule":     strconv.Itoa(int(drop.RuleID)),
+			"result":   "fail",
+			"message":  message(nodeName, drop),
+			"timestamp": map[string]interface{}{
+				"seconds": drop.LastSeen.Unix(),
+				"nanos":   int64(drop.LastSeen.Nanosecond()),
+			},
+			"properties": map[string]interface{}{
+				"interface": drop.Interface,
+				"sourceIP":  drop.Source,
+				"protocol":  drop.Protocol,
+				"dstPort":   strconv.Itoa(int(drop.DstPort)),
+				"packets":   strconv.FormatUint(drop.Events, 10),
+				"bytes":     strconv.FormatUint(drop.Bytes, 10),
+				"firstSeen": drop.FirstSeen.UTC().Format(time.RFC3339Nano),
+				"lastSeen":  drop.LastSeen.UTC().Format(time.RFC3339Nano),
+			},
+		})
+	}
+
+	report := &unstructured.Unstructured{Object: map[string]interface{}{
+		"scope": map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Node",
+			"name":       nodeName,
+		},
+		"summary": map[string]interface{}{
+			"pass":  int64(0),
+			"fail":  int64(len(results)),
+			"warn":  int64(0),
+			"error": int64(0),
+			"skip":  int64(0),
+		},
+		"results": results,
+	}}
+	report.SetGroupVersionKind(policyReportGVK)
+	report.SetName(policyReportNamePrefix + nodeName)
+	report.SetNamespace(namespace)
+	report.SetLabels(map[string]string{"app.kubernetes.io/managed-by": policyReportSource})
+	return report
+}
+
+// publishPolicyReport creates or replaces the PolicyReport of the node. Publishing is disabled if the PolicyReport
+// CRD is not installed.
+func (r *Reporter) publishPolicyReport(ctx context.Context, report *unstructured.Unstructured) error {
+	existing := &unstructured.Unstructured{}
+	existing.SetGroupVersionKind(policyReportGVK)
+	err := r.reader.Get(ctx, types.NamespacedName{Name: report.GetName(), Namespace: report.GetNamespace()}, existing)
+	switch {
+	case meta.IsNoMatchError(err):
+		r.log.Info("The PolicyReport CRD is not installed, not publishing PolicyReports")
+		r.policyReport = false
+		return nil
+	case apierrors.IsNotFound(err):
+		err = r.client.Create(ctx, report)
+	case err == nil:
+		report.SetResourceVersion(existing.GetResourceVersion())
+		err = r.client.Update(ctx, report)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to publish PolicyReport %s/%s: %w", report.GetNamespace(), report.GetName(), err)
+	}
+	return nil
+}
@@ -1,6 +1,5 @@
 // Code generated by bpf2go; DO NOT EDIT.
 //go:build arm64be || armbe || mips || mips64 || mips64p32 || ppc64 || s390 || s390x || sparc || sparc64
-// +build arm64be armbe mips mips64 mips64p32 ppc64 s390 s390x sparc sparc64
 
 package nodefwloader
 
@@ -13,20 +12,74 @@ import (
 	"github.com/cilium/ebpf"
 )
 
+type BpfAutoBanSt struct {
+	Threshold uint32
+	Period    uint32
+	Duration  uint32
+}
+
+type BpfBanCounterKeySt struct {
+	IpData [16]uint8
+	RuleId uint32
+}
+
+type BpfBanCounterValSt struct {
+	PeriodStart uint64
+	Packets     uint32
+	_           [4]byte
+}
+
+type BpfBanKeySt struct{ IpData [16]uint8 }
+
+type BpfBanValSt struct {
+	Expires uint64
+	RuleId  uint32
+}
+
+type BpfBlocklistKeySt struct {
+	PrefixLen uint32
+	IpData    [16]uint8
+}
+
+type BpfClassKeySt struct {
+	PrefixLen uint32
+	RulesId   uint32
+	Protocol  uint8
+	Data      [2]uint8
+}
+
+type BpfClassValSt struct {
+	RuleId  uint32
+	Action  uint8
+	AutoBan BpfAutoBanSt
+}
+
 type BpfEventHdrSt struct {
 	IfId      uint16
 	RuleId    uint16
 	Action    uint8
-	Pad       uint8
+	Flags     uint8
 	PktLength uint16
 }
 
+type BpfEventRateLimitSt struct {
+	Lock       struct{ Val uint32 }
+	_          [4]byte
+	Tokens     uint64
+	LastRefill uint64
+}
+
 type BpfLpmIpKeySt struct {
 	PrefixLen      uint32
 	IngressIfindex uint32
 	IpData         [16]uint8
 }
 
+type BpfRuleKeySt struct {
+	RulesId uint32
+	Index   uint32
+}
+
 type BpfRuleStatisticsSt struct {
 	AllowStats struct {
 		Packets uint64
@@ -36,6 +89,10 @@ type BpfRuleStatisticsSt struct {
 		Packets uint64
 		Bytes   uint64
 	}
+	EventStats struct {
+		SampledOut  uint64
+		RateLimited uint64
+	}
 }
 
 type BpfRuleTypeSt struct {
@@ -44,11 +101,27 @@ type BpfRuleTypeSt struct {
 	DstPortStart uint16
 	DstPortEnd   uint16
 	IcmpType     uint8
+	IcmpTypeEnd  uint8
 	IcmpCode     uint8
+	IcmpAnyCode  uint8
 	Action       uint8
+	AutoBan      BpfAutoBanSt
 }
 
-type BpfRulesValSt struct{ Rules [100]BpfRuleTypeSt }
+type BpfRulesValSt struct {
+	RulesId  uint32
+	NumRules uint32
+}
+
+type BpfSourceStatisticsKeySt struct {
+	IfId   uint32
+	IpData [16]uint8
+}
+
+type BpfSourceStatisticsValSt struct {
+	Packets uint64
+	Bytes   uint64
+}
 
 // LoadBpf returns the embedded CollectionSpec for Bpf.
 func LoadBpf() (*ebpf.CollectionSpec, error) {
@@ -65,9 +138,9 @@ func LoadBpf() (*ebpf.CollectionSpec, error) {
 //
 // The following types are suitable as obj argument:
 //
-//     *BpfObjects
-//     *BpfPrograms
-//     *BpfMaps
+//	*BpfObjects
+//	*BpfPrograms
+//	*BpfMaps
 //
 // See ebpf.CollectionSpec.LoadAndAssign documentation for details.
 func LoadBpfObjects(obj interface{}, opts *ebpf.CollectionOptions) error {
@@ -98,10 +171,17 @@ type BpfProgramSpecs struct {
 //
 // It can be passed ebpf.CollectionSpec.Assign.
 type BpfMapSpecs struct {
-	IngressNodeFirewallDbgMap        *ebpf.MapSpec `ebpf:"ingress_node_firewall_dbg_map"`
-	IngressNodeFirewallEventsMap     *ebpf.MapSpec `ebpf:"ingress_node_firewall_events_map"`
-	IngressNodeFirewallStatisticsMap *ebpf.MapSpec `ebpf:"ingress_node_firewall_statistics_map"`
-	IngressNodeFirewallTableMap      *ebpf.MapSpec `ebpf:"ingress_node_firewall_table_map"`
+	IngressNodeFirewallBanCounterMap       *ebpf.MapSpec `ebpf:"ingress_node_firewall_ban_counter_map"`
+	IngressNodeFirewallBanMap              *ebpf.MapSpec `ebpf:"ingress_node_firewall_ban_map"`
+	IngressNodeFirewallBlocklistMap        *ebpf.MapSpec `ebpf:"ingress_node_firewall_blocklist_map"`
+	IngressNodeFirewallClassifierMap       *ebpf.MapSpec `ebpf:"ingress_node_firewall_classifier_map"`
+	IngressNodeFirewallDbgMap              *ebpf.MapSpec `ebpf:"ingress_node_firewall_dbg_map"`
+	IngressNodeFirewallEventRateLimitMap   *ebpf.MapSpec `ebpf:"ingress_node_firewall_event_rate_limit_map"`
+	IngressNodeFirewallEventsMap           *ebpf.MapSpec `ebpf:"ingress_node_firewall_events_map"`
+	IngressNodeFirewallRulesMap            *ebpf.MapSpec `ebpf:"ingress_node_firewall_rules_map"`
+	IngressNodeFirewallSourceStatisticsMap *ebpf.MapSpec `ebpf:"ingress_node_firewall_source_statistics_map"`
+	IngressNodeFirewallStatisticsMap       *ebpf.MapSpec `ebpf:"ingress_node_firewall_statistics_map"`
+	IngressNodeFirewallTableMap            *ebpf.MapSpec `ebpf:"ingress_node_firewall_table_map"`
 }
 
 // BpfObjects contains all objects after they have been loaded into the kernel.
@@ -123,16 +203,30 @@ func (o *BpfObjects) Close() error {
 //
 // It can be passed to LoadBpfObjects or ebpf.CollectionSpec.LoadAndAssign.
 type BpfMaps struct {
-	IngressNodeFirewallDbgMap        *ebpf.Map `ebpf:"ingress_node_firewall_dbg_map"`
-	IngressNodeFirewallEventsMap     *ebpf.Map `ebpf:"ingress_node_firewall_events_map"`
-	IngressNodeFirewallStatisticsMap *ebpf.Map `ebpf:"ingress_node_firewall_statistics_map"`
-	IngressNodeFirewallTableMap      *ebpf.Map `ebpf:"ingress_node_firewall_table_map"`
+	IngressNodeFirewallBanCounterMap       *ebpf.Map `ebpf:"ingress_node_firewall_ban_counter_map"`
+	IngressNodeFirewallBanMap              *ebpf.Map `ebpf:"ingress_node_firewall_ban_map"`
+	IngressNodeFirewallBlocklistMap        *ebpf.Map `ebpf:"ingress_node_firewall_blocklist_map"`
+	IngressNodeFirewallClassifierMap       *ebpf.Map `ebpf:"ingress_node_firewall_classifier_map"`
+	IngressNodeFirewallDbgMap              *ebpf.Map `ebpf:"ingress_node_firewall_dbg_map"`
+	IngressNodeFirewallEventRateLimitMap   *ebpf.Map `ebpf:"ingress_node_firewall_event_rate_limit_map"`
+	IngressNodeFirewallEventsMap           *ebpf.Map `ebpf:"ingress_node_firewall_events_map"`
+	IngressNodeFirewallRulesMap            *ebpf.Map `ebpf:"ingress_node_firewall_rules_map"`
+	IngressNodeFirewallSourceStatisticsMap *ebpf.Map `ebpf:"ingress_node_firewall_source_statistics_map"`
+	IngressNodeFirewallStatisticsMap       *ebpf.Map `ebpf:"ingress_node_firewall_statistics_map"`
+	IngressNodeFirewallTableMap            *ebpf.Map `ebpf:"ingress_node_firewall_table_map"`
 }
 
 func (m *BpfMaps) Close() error {
 	return _BpfClose(
+		m.IngressNodeFirewallBanCounterMap,
+		m.IngressNodeFirewallBanMap,
+		m.IngressNodeFirewallBlocklistMap,
+		m.IngressNodeFirewallClassifierMap,
 		m.IngressNodeFirewallDbgMap,
+		m.IngressNodeFirewallEventRateLimitMap,
 		m.IngressNodeFirewallEventsMap,
+		m.IngressNodeFirewallRulesMap,
+		m.IngressNodeFirewallSourceStatisticsMap,
 		m.IngressNodeFirewallStatisticsMap,
 		m.IngressNodeFirewallTableMap,
 	)
@@ -161,5 +255,6 @@ func _BpfClose(closers ...io.Closer) error {
 }
 
 // Do not access this directly.
+//
 //go:embed bpf_bpfeb.o
 var _BpfBytes []byte
@@ -0,0 +1,209 @@
+package nodefwloader
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/cilium/ebpf"
+	"k8s.io/klog"
+)
+
+// ipv4MappedPrefixLen is the length of the ::ffff:0:0/96 prefix of the IPv4-mapped IPv6 addresses under which the
+// blocklist map stores IPv4 addresses.
+const ipv4MappedPrefixLen = 96
+
+// parseBlocklist parses a plaintext blocklist with one IP address or CIDR per line. Empty lines and everything after
+// a # are ignored. Addresses are treated as /32 or /128 CIDRs and duplicate entries are removed.
+func parseBlocklist(r io.Reader) ([]BpfBlocklistKeySt, error) {
+	seen := make(map[BpfBlocklistKeySt]struct{})
+	var keys []BpfBlocklistKeySt
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := scanner.Text()
+		if idx := strings.Index(line, "#"); idx >= 0 {
+			line = line[:idx]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		key, err := blocklistKey(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		keys = append(keys, key)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// blocklistKey returns the key of the blocklist map for an IP address or CIDR. Only IPv4 addresses and CIDRs are
+// moved under the IPv4-mapped prefix; IPv4-mapped IPv6 addresses and CIDRs such as ::ffff:192.0.2.0/120 already are.
+func blocklistKey(entry string) (BpfBlocklistKeySt, error) {
+	var key BpfBlocklistKeySt
+	if !strings.Contains(entry, "/") {
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			return key, fmt.Errorf("invalid IP address or CIDR %q", entry)
+		}
+		if strings.Contains(entry, ":") {
+			entry += "/128"
+		} else {
+			entry += "/32"
+		}
+	}
+	_, ipNet, err := net.ParseCIDR(entry)
+	if err != nil {
+		return key, fmt.Errorf("invalid IP address or CIDR %q", entry)
+	}
+	ones, _ := ipNet.Mask.Size()
+	key.PrefixLen = uint32(ones)
+	if len(ipNet.IP) == net.IPv4len {
+		key.PrefixLen += ipv4MappedPrefixLen
+	}
+	copy(key.IpData[:], ipNet.IP.To16())
+	return key, nil
+}
+
+// checkBlocklistKey returns an error if a key cannot be added to the blocklist map, that is if its prefix length
+// exceeds 128 bits or if it has address bits set beyond its prefix length.
+func checkBlocklistKey(key BpfBlocklistKeySt) error {
+	if key.PrefixLen > 8*net.IPv6len {
+		return fmt.Errorf("invalid prefix length %d of blocklist entry %s", key.PrefixLen, net.IP(key.IpData[:]))
+	}
+	ip := net.IP(key.IpData[:])
+	if !ip.Mask(net.CIDRMask(int(key.PrefixLen), 8*net.IPv6len)).Equal(ip) {
+		return fmt.Errorf("blocklist entry %s/%d has address bits set beyond its prefix length", ip, key.PrefixLen)
+	}
+	return nil
+}
+
+// blocklistCIDR returns the IP address or CIDR of a key of the blocklist map.
+func blocklistCIDR(key BpfBlocklistKeySt) *net.IPNet {
+	ip := net.IP(append([]byte(nil), key.IpData[:]...))
+	if ipv4 := ip.To4(); ipv4 != nil && key.PrefixLen >= ipv4MappedPrefixLen {
+		return &net.IPNet{IP: ipv4, Mask: net.CIDRMask(int(key.PrefixLen)-ipv4MappedPrefixLen, 32)}
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(int(key.PrefixLen), 128)}
+}
+
+// blocklistEntries returns the keys of the blocklist map, ordered by address and prefix length.
+func blocklistEntries(blocklistMap *ebpf.Map) ([]BpfBlocklistKeySt, error) {
+	var keys []BpfBlocklistKeySt
+	var key BpfBlocklistKeySt
+	var verdict uint8
+	iterator := blocklistMap.Iterate()
+	for iterator.Next(&key, &verdict) {
+		keys = append(keys, key)
+	}
+	if err := iterator.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if c := bytes.Compare(keys[i].IpData[:], keys[j].IpData[:]); c != 0 {
+			return c < 0
+		}
+		return keys[i].PrefixLen < keys[j].PrefixLen
+	})
+	return keys, nil
+}
+
+// diffBlocklist returns the keys of desired that are not in current, and the keys of current that are not in desired.
+func diffBlocklist(current, desired []BpfBlocklistKeySt) (added, removed []BpfBlocklistKeySt) {
+	currentKeys := make(map[BpfBlocklistKeySt]struct{}, len(current))
+	for _, key := range current {
+		currentKeys[key] = struct{}{}
+	}
+	desiredKeys := make(map[BpfBlocklistKeySt]struct{}, len(desired))
+	for _, key := range desired {
+		desiredKeys[key] = struct{}{}
+		if _, ok := currentKeys[key]; !ok {
+			added = append(added, key)
+		}
+	}
+	for _, key := range current {
+		if _, ok := desiredKeys[key]; !ok {
+			removed = append(removed, key)
+		}
+	}
+	return added, removed
+}
+
+// LoadBlocklist applies the blocklist file to the blocklist map if the file changed since it was last applied. Only
+// the entries that were added to or removed from the file are updated in the map. The map is emptied if no blocklist
+// file is configured or if the file does not exist. The map is left unchanged if the file cannot be parsed, if it
+// does not fit into the map or if one of its added entries cannot be added to the map.
+func (infc *IngNodeFwController) LoadBlocklist() error {
+	var desired []BpfBlocklistKeySt
+	var modTime int64
+	var size int64 = -1
+	if infc.blocklistFile != "" {
+		info, err := os.Stat(infc.blocklistFile)
+		switch {
+		case os.IsNotExist(err):
+			// The ConfigMap of the blocklist may not have been created yet.
+		case err != nil:
+			return err
+		default:
+			modTime, size = info.ModTime().UnixNano(), info.Size()
+			if infc.blocklistApplied && modTime == infc.blocklistModTime && size == infc.blocklistSize {
+				return nil
+			}
+			file, err := os.Open(infc.blocklistFile)
+			if err != nil {
+				return err
+			}
+			desired, err = parseBlocklist(file)
+			file.Close()
+			if err != nil {
+				return fmt.Errorf("failed to parse blocklist %s: %w", infc.blocklistFile, err)
+			}
+		}
+	}
+	if infc.blocklistApplied && size == -1 && infc.blocklistSize == -1 {
+		return nil
+	}
+
+	blocklistMap := infc.objs.IngressNodeFirewallBlocklistMap
+	if len(desired) > int(blocklistMap.MaxEntries()) {
+		return fmt.Errorf("%w: the blocklist has %d entries, the map holds %d", ErrCapacityExceeded, len(desired),
+			blocklistMap.MaxEntries())
+	}
+	current, err := blocklistEntries(blocklistMap)
+	if err != nil {
+		return fmt.Errorf("failed to list blocklist entries: %w", err)
+	}
+	added, removed := diffBlocklist(current, desired)
+	// Check all added entries before anything is deleted so that the map is not left partially updated.
+	for _, key := range added {
+		if err := checkBlocklistKey(key); err != nil {
+			return err
+		}
+	}
+	for _, key := range removed {
+		if err := blocklistMap.Delete(key); err != nil {
+			return fmt.Errorf("failed to delete blocklist entry %s: %w", blocklistCIDR(key), err)
+		}
+	}
+	for _, key := range added {
+		if err := blocklistMap.Put(key, uint8(xdpDeny)); err != nil {
+			return fmt.Errorf("failed to add blocklist entry %s: %w", blocklistCIDR(key), err)
+		}
+	}
+	infc.blocklistApplied, infc.blocklistModTime, infc.blocklistSize = true, modTime, size
+	klog.Infof("Applied blocklist %q with %d entries, %d added and %d removed", infc.blocklistFile, len(desired),
+		len(added), len(removed))
+	return nil
+}
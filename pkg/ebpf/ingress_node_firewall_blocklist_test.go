@@ -0,0 +1,91 @@
+package nodefwloader
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseBlocklist(t *testing.T) {
+	list := `# threat intel feed
+10.1.2.3
+192.0.2.0/24   # scanners
+192.0.2.77/24
+2001:db8::/32
+
+2001:db8::1
+10.1.2.3
+`
+	keys, err := parseBlocklist(strings.NewReader(list))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cidrs []string
+	for _, key := range keys {
+		cidrs = append(cidrs, blocklistCIDR(key).String())
+	}
+	expected := []string{"10.1.2.3/32", "192.0.2.0/24", "2001:db8::/32", "2001:db8::1/128"}
+	if !reflect.DeepEqual(cidrs, expected) {
+		t.Fatalf("got %v, expected %v", cidrs, expected)
+	}
+	if keys[0].PrefixLen != 128 || keys[1].PrefixLen != 120 || keys[2].PrefixLen != 32 {
+		t.Fatalf("unexpected prefix lengths of keys %v", keys)
+	}
+
+	// IPv4-mapped IPv6 addresses and CIDRs are already under the IPv4-mapped prefix.
+	keys, err = parseBlocklist(strings.NewReader("::ffff:192.0.2.0/120\n::ffff:198.51.100.7\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0].PrefixLen != 120 || keys[1].PrefixLen != 128 {
+		t.Fatalf("unexpected keys %v of IPv4-mapped IPv6 entries", keys)
+	}
+	if cidr := blocklistCIDR(keys[0]).String(); cidr != "192.0.2.0/24" {
+		t.Fatalf("got %s for ::ffff:192.0.2.0/120, expected 192.0.2.0/24", cidr)
+	}
+
+	for _, list := range []string{"10.1.2.3\nnot-an-address\n", "10.0.0.0/33", "2001:db8::/129"} {
+		if _, err := parseBlocklist(strings.NewReader(list)); err == nil {
+			t.Errorf("parseBlocklist(%q) succeeded, expected an error", list)
+		}
+	}
+}
+
+func TestCheckBlocklistKey(t *testing.T) {
+	key, err := blocklistKey("2001:db8::/32")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkBlocklistKey(key); err != nil {
+		t.Fatalf("valid key: %v", err)
+	}
+	tooLong := key
+	tooLong.PrefixLen = 129
+	if err := checkBlocklistKey(tooLong); err == nil {
+		t.Fatal("expected an error for a prefix length of 129")
+	}
+	hostBits := key
+	hostBits.IpData[15] = 1
+	if err := checkBlocklistKey(hostBits); err == nil {
+		t.Fatal("expected an error for address bits beyond the prefix length")
+	}
+}
+
+func TestDiffBlocklist(t *testing.T) {
+	parse := func(list string) []BpfBlocklistKeySt {
+		keys, err := parseBlocklist(strings.NewReader(list))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return keys
+	}
+	current := parse("10.0.0.1\n10.0.0.2\n2001:db8::/32\n")
+	desired := parse("10.0.0.2\n2001:db8::/32\n10.0.0.3\n")
+	added, removed := diffBlocklist(current, desired)
+	if !reflect.DeepEqual(added, parse("10.0.0.3")) || !reflect.DeepEqual(removed, parse("10.0.0.1")) {
+		t.Fatalf("got added %v and removed %v", added, removed)
+	}
+	if added, removed := diffBlocklist(desired, desired); len(added) != 0 || len(removed) != 0 {
+		t.Fatalf("unchanged blocklist: got added %v and removed %v", added, removed)
+	}
+}
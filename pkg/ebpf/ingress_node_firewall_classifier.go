@@ -0,0 +1,150 @@
+package nodefwloader
+
+import (
+	"math/bits"
+	"sort"
+	"syscall"
+
+	"github.com/openshift/ingress-node-firewall/pkg/utils"
+)
+
+const (
+	invalidRuleID = 0 // INVALID_RULE_ID in the kernel hook
+	// Prefix lengths of the classifier key, the rules ID is followed by the protocol and two bytes of data.
+	classKeyRulesIDPrefixLen  = 32
+	classKeyProtocolPrefixLen = classKeyRulesIDPrefixLen + 8
+	classKeyMaxPrefixLen      = classKeyProtocolPrefixLen + 16
+	maxPort                   = 1<<16 - 1
+	// maxClassifierEntries bounds the size of the classifier map, entries are only allocated when they are used.
+	maxClassifierEntries = 1 << 24
+)
+
+// classifierEntriesPerTarget returns the maximum number of classifier entries that maxRulesPerTarget rules can be
+// compiled into. A port rule or an ICMP rule that matches every code of its types is one interval, an ICMP rule with
+// a code is one interval per type, at most 256. n intervals split the data of the five protocols into at most 2n+5
+// intervals and every interval is covered by at most 30 prefixes. A rule of another protocol takes one entry and a
+// rule without protocol takes one more entry.
+func classifierEntriesPerTarget(maxRulesPerTarget int) int {
+	return 30*(2*256*maxRulesPerTarget+5) + 1
+}
+
+// compileClassifier compiles the rules of a target, ordered by rule ID, into the entries of the LPM classifier map.
+// For every protocol, destination port, ICMP type and code, the longest matching entry holds the first rule that the
+// kernel hook would match when it evaluates the rules one by one, so that a single lookup replaces the scan of the
+// rules.
+func compileClassifier(rulesID uint32, rules []BpfRuleTypeSt) map[BpfClassKeySt]BpfClassValSt {
+	entries := make(map[BpfClassKeySt]BpfClassValSt)
+	intervalRules := make(map[uint8][]BpfRuleTypeSt)
+	for _, rule := range rules {
+		if rule.RuleId == invalidRuleID {
+			continue
+		}
+		switch rule.Protocol {
+		case 0:
+			// A rule without protocol matches all packets, the rules after it are never evaluated.
+			entries[BpfClassKeySt{PrefixLen: classKeyRulesIDPrefixLen, RulesId: rulesID}] = classVal(rule)
+			return compileIntervalRules(rulesID, intervalRules, entries)
+		case syscall.IPPROTO_TCP, syscall.IPPROTO_UDP, syscall.IPPROTO_SCTP, syscall.IPPROTO_ICMP,
+			syscall.IPPROTO_ICMPV6:
+			intervalRules[rule.Protocol] = append(intervalRules[rule.Protocol], rule)
+		default:
+			// Rules of other protocols match on the protocol alone.
+			key := BpfClassKeySt{PrefixLen: classKeyProtocolPrefixLen, RulesId: rulesID, Protocol: rule.Protocol}
+			if _, ok := entries[key]; !ok {
+				entries[key] = classVal(rule)
+			}
+		}
+	}
+	return compileIntervalRules(rulesID, intervalRules, entries)
+}
+
+// compileIntervalRules adds the entries for the TCP, UDP, SCTP, ICMP and ICMPv6 rules to entries. The data of the
+// key is split into intervals that are matched by the same first rule and each interval is covered by prefixes.
+func compileIntervalRules(rulesID uint32, intervalRules map[uint8][]BpfRuleTypeSt,
+	entries map[BpfClassKeySt]BpfClassValSt) map[BpfClassKeySt]BpfClassValSt {
+	for protocol, rules := range intervalRules {
+		boundaries := []uint32{0}
+		for _, rule := range rules {
+			for _, interval := range ruleIntervals(rule) {
+				boundaries = append(boundaries, interval.Start, interval.End+1)
+			}
+		}
+		sort.Slice(boundaries, func(i, j int) bool { return boundaries[i] < boundaries[j] })
+
+		var current *BpfRuleTypeSt
+		var currentStart uint32
+		flush := func(end uint32) {
+			if current == nil {
+				return
+			}
+			for _, prefix := range rangeToPrefixes(currentStart, end) {
+				entries[BpfClassKeySt{
+					PrefixLen: classKeyProtocolPrefixLen + prefix.len,
+					RulesId:   rulesID,
+					Protocol:  protocol,
+					Data:      [2]uint8{uint8(prefix.port >> 8), uint8(prefix.port)},
+				}] = classVal(*current)
+			}
+		}
+		for idx, start := range boundaries {
+			if start > maxPort || (idx > 0 && start == boundaries[idx-1]) {
+				continue
+			}
+			winner := firstMatch(rules, start)
+			if current != nil && winner != nil && current.RuleId == winner.RuleId {
+				continue
+			}
+			flush(start - 1)
+			current, currentStart = winner, start
+		}
+		flush(maxPort)
+	}
+	return entries
+}
+
+// ruleIntervals returns the intervals of the key data that rule matches.
+func ruleIntervals(rule BpfRuleTypeSt) []utils.Interval {
+	switch rule.Protocol {
+	case syscall.IPPROTO_ICMP, syscall.IPPROTO_ICMPV6:
+		return utils.ICMPIntervals(rule.IcmpType, rule.IcmpTypeEnd, rule.IcmpCode, rule.IcmpAnyCode != 0)
+	}
+	return utils.PortIntervals(rule.DstPortStart, rule.DstPortEnd)
+}
+
+// firstMatch returns the first rule that matches the key data, or nil.
+func firstMatch(rules []BpfRuleTypeSt, data uint32) *BpfRuleTypeSt {
+	for idx := range rules {
+		if utils.IntervalsContain(ruleIntervals(rules[idx]), data) {
+			return &rules[idx]
+		}
+	}
+	return nil
+}
+
+// portPrefix is a prefix of len bits of a 16 bit port.
+type portPrefix struct {
+	port uint32
+	len  uint32
+}
+
+// rangeToPrefixes returns the smallest set of prefixes that covers the ports from start to end, both included.
+func rangeToPrefixes(start, end uint32) []portPrefix {
+	var prefixes []portPrefix
+	for start <= end {
+		// The largest aligned block that starts at start and does not go past end.
+		size := uint32(1) << 16
+		if start != 0 {
+			size = uint32(1) << bits.TrailingZeros32(start)
+		}
+		for size > end-start+1 {
+			size >>= 1
+		}
+		prefixes = append(prefixes, portPrefix{port: start, len: 16 - uint32(bits.TrailingZeros32(size))})
+		start += size
+	}
+	return prefixes
+}
+
+func classVal(rule BpfRuleTypeSt) BpfClassValSt {
+	return BpfClassValSt{RuleId: rule.RuleId, Action: rule.Action, AutoBan: rule.AutoBan}
+}
@@ -0,0 +1,221 @@
+package nodefwloader
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+func TestRangeToPrefixes(t *testing.T) {
+	tcs := []struct {
+		start, end uint32
+		expected   []portPrefix
+	}{
+		{start: 22, end: 22, expected: []portPrefix{{port: 22, len: 16}}},
+		{start: 0, end: maxPort, expected: []portPrefix{{port: 0, len: 0}}},
+		{start: 1024, end: 2047, expected: []portPrefix{{port: 1024, len: 6}}},
+		{start: 80, end: 83, expected: []portPrefix{{port: 80, len: 14}}},
+		{start: 79, end: 84, expected: []portPrefix{{port: 79, len: 16}, {port: 80, len: 14}, {port: 84, len: 16}}},
+		{start: 65534, end: maxPort, expected: []portPrefix{{port: 65534, len: 15}}},
+	}
+	for i, tc := range tcs {
+		prefixes := rangeToPrefixes(tc.start, tc.end)
+		if !reflect.DeepEqual(prefixes, tc.expected) {
+			t.Fatalf("TestRangeToPrefixes(%d): got %v, expected %v", i, prefixes, tc.expected)
+		}
+	}
+}
+
+// TestCompileClassifier compares a lookup in the compiled classifier with the evaluation of the rules one by one
+// for random rules and packets.
+func TestCompileClassifier(t *testing.T) {
+	protocols := []uint8{0, syscall.IPPROTO_TCP, syscall.IPPROTO_UDP, syscall.IPPROTO_SCTP, syscall.IPPROTO_ICMP,
+		syscall.IPPROTO_ICMPV6, syscall.IPPROTO_IGMP, syscall.IPPROTO_GRE}
+	// Keep the ports, types and codes in a small space so that rules overlap.
+	randomPort := func(r *rand.Rand) uint16 {
+		if r.Intn(10) == 0 {
+			return uint16(maxPort - r.Intn(4))
+		}
+		return uint16(r.Intn(64))
+	}
+	r := rand.New(rand.NewSource(1))
+	for iteration := 0; iteration < 200; iteration++ {
+		var rules []BpfRuleTypeSt
+		numRules := 1 + r.Intn(20)
+		for idx := 0; idx < numRules; idx++ {
+			rule := BpfRuleTypeSt{RuleId: uint32(idx + 1), Action: uint8(xdpDeny + r.Intn(2))}
+			// Rules without protocol are rare so that the rules behind them are evaluated.
+			rule.Protocol = protocols[1+r.Intn(len(protocols)-1)]
+			if r.Intn(numRules*2) == 0 {
+				rule.Protocol = 0
+			}
+			switch rule.Protocol {
+			case syscall.IPPROTO_TCP, syscall.IPPROTO_UDP, syscall.IPPROTO_SCTP:
+				rule.DstPortStart = randomPort(r)
+				if r.Intn(2) == 0 {
+					rule.DstPortEnd = randomPort(r)
+				}
+			case syscall.IPPROTO_ICMP, syscall.IPPROTO_ICMPV6:
+				rule.IcmpType = uint8(r.Intn(3))
+				rule.IcmpCode = uint8(r.Intn(3))
+				if r.Intn(3) == 0 {
+					rule.IcmpTypeEnd = uint8(r.Intn(4))
+				}
+				if r.Intn(3) == 0 {
+					rule.IcmpAnyCode = 1
+				}
+			}
+			if rule.Action == xdpDeny && r.Intn(4) == 0 {
+				rule.AutoBan = BpfAutoBanSt{Threshold: uint32(1 + r.Intn(10)), Period: 60, Duration: 600}
+			}
+			rules = append(rules, rule)
+		}
+		entries := compileClassifier(7, rules)
+		if len(entries) > classifierEntriesPerTarget(numRules) {
+			t.Fatalf("%d rules were compiled into %d entries, more than %d: %v", numRules, len(entries),
+				classifierEntriesPerTarget(numRules), rules)
+		}
+
+		for _, icmpProto := range []uint8{syscall.IPPROTO_ICMP, syscall.IPPROTO_ICMPV6} {
+			for _, proto := range protocols[1:] {
+				for packet := 0; packet < 200; packet++ {
+					port, icmpType, icmpCode := randomPort(r), uint8(r.Intn(5)), uint8(r.Intn(4))
+					expected := linearLookup(rules, proto, port, icmpType, icmpCode, icmpProto)
+					result := classifierLookup(entries, 7, proto, port, icmpType, icmpCode, icmpProto)
+					if result != expected {
+						t.Fatalf("packet (protocol %d, port %d, type %d, code %d) matched %v instead of %v, rules: %v",
+							proto, port, icmpType, icmpCode, result, expected, rules)
+					}
+				}
+			}
+		}
+	}
+}
+
+// linearLookup mirrors rules_lookup in the kernel hook.
+func linearLookup(rules []BpfRuleTypeSt, proto uint8, port uint16, icmpType, icmpCode, icmpProto uint8) BpfClassValSt {
+	for _, rule := range rules {
+		if rule.RuleId == invalidRuleID {
+			continue
+		}
+		if rule.Protocol != 0 && rule.Protocol == proto {
+			if rule.Protocol == syscall.IPPROTO_TCP || rule.Protocol == syscall.IPPROTO_UDP ||
+				rule.Protocol == syscall.IPPROTO_SCTP {
+				if rule.DstPortEnd == 0 {
+					if rule.DstPortStart == port {
+						return classVal(rule)
+					}
+				} else if port >= rule.DstPortStart && port < rule.DstPortEnd {
+					return classVal(rule)
+				}
+			}
+			if rule.Protocol == icmpProto {
+				icmpTypeEnd := rule.IcmpType
+				if rule.IcmpTypeEnd != 0 {
+					icmpTypeEnd = rule.IcmpTypeEnd
+				}
+				if icmpType >= rule.IcmpType && icmpType <= icmpTypeEnd &&
+					(rule.IcmpAnyCode != 0 || rule.IcmpCode == icmpCode) {
+					return classVal(rule)
+				}
+			}
+			switch rule.Protocol {
+			case syscall.IPPROTO_TCP, syscall.IPPROTO_UDP, syscall.IPPROTO_SCTP, syscall.IPPROTO_ICMP,
+				syscall.IPPROTO_ICMPV6:
+			default:
+				return classVal(rule)
+			}
+		}
+		if rule.Protocol == 0 {
+			return classVal(rule)
+		}
+	}
+	return BpfClassValSt{}
+}
+
+// classifierLookup mirrors rules_classify in the kernel hook with a longest prefix match over the entries.
+func classifierLookup(entries map[BpfClassKeySt]BpfClassValSt, rulesID uint32, proto uint8, port uint16,
+	icmpType, icmpCode, icmpProto uint8) BpfClassValSt {
+	key := BpfClassKeySt{PrefixLen: classKeyMaxPrefixLen, RulesId: rulesID, Protocol: proto}
+	switch proto {
+	case syscall.IPPROTO_TCP, syscall.IPPROTO_UDP, syscall.IPPROTO_SCTP:
+		key.Data = [2]uint8{uint8(port >> 8), uint8(port)}
+	case syscall.IPPROTO_ICMP, syscall.IPPROTO_ICMPV6:
+		if proto != icmpProto {
+			key.PrefixLen = classKeyRulesIDPrefixLen
+			break
+		}
+		key.Data = [2]uint8{icmpType, icmpCode}
+	}
+	var result BpfClassValSt
+	longest := -1
+	for entry, value := range entries {
+		if entry.PrefixLen <= key.PrefixLen && int(entry.PrefixLen) > longest &&
+			classKeyBits(entry)>>(classKeyMaxPrefixLen-entry.PrefixLen) == classKeyBits(key)>>(classKeyMaxPrefixLen-entry.PrefixLen) {
+			result, longest = value, int(entry.PrefixLen)
+		}
+	}
+	return result
+}
+
+func classKeyBits(key BpfClassKeySt) uint64 {
+	return uint64(key.RulesId)<<24 | uint64(key.Protocol)<<16 | uint64(key.Data[0])<<8 | uint64(key.Data[1])
+}
+
+// BenchmarkRuleLookup compares the evaluation of the rules one by one with the classifier lookup by running the XDP
+// program on a TCP packet that matches the last rule of its target. The verifier explores every iteration of the
+// evaluation of the rules one by one, which only loads for up to maxLinearRules rules.
+func BenchmarkRuleLookup(b *testing.B) {
+	const maxLinearRules = 100
+	for _, numRules := range []int{1, 10, 100, 1000} {
+		for _, linear := range []bool{true, false} {
+			if linear && numRules > maxLinearRules {
+				continue
+			}
+			name := fmt.Sprintf("rules=%d/classifier", numRules)
+			if linear {
+				name = fmt.Sprintf("rules=%d/linear", numRules)
+			}
+			b.Run(name, func(b *testing.B) {
+				benchmarkRuleLookup(b, numRules, linear)
+			})
+		}
+	}
+}
+
+func benchmarkRuleLookup(b *testing.B, numRules int, linear bool) {
+	objs := loadTestObjects(b, numRules, linear)
+	defer objs.Close()
+
+	// Without a context, BPF_PROG_TEST_RUN runs XDP programs on the loopback interface.
+	key, err := BuildEBPFKey(loopbackIfIndex, "10.0.0.0/8")
+	if err != nil {
+		b.Fatal(err)
+	}
+	rules := make([]BpfRuleTypeSt, 0, numRules)
+	for idx := 0; idx < numRules; idx++ {
+		rules = append(rules, BpfRuleTypeSt{
+			RuleId:       uint32(idx + 1),
+			Protocol:     syscall.IPPROTO_TCP,
+			DstPortStart: uint16(1000 + 2*idx),
+			Action:       xdpAllow,
+		})
+	}
+	infc := &IngNodeFwController{objs: *objs, maxTargets: 1, maxRulesPerTarget: numRules}
+	if err := infc.addOrUpdateRules(map[BpfLpmIpKeySt][]BpfRuleTypeSt{key: rules}); err != nil {
+		b.Fatal(err)
+	}
+
+	frame := buildFrame(b, net.ParseIP("10.0.0.1"), syscall.IPPROTO_TCP, rules[numRules-1].DstPortStart, 0, 0)
+	ret, duration, err := objs.IngressNodeFirewallProcess.Benchmark(frame, b.N, b.ResetTimer)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if ret != xdpAllow {
+		b.Fatalf("XDP program returned %d instead of %d", ret, xdpAllow)
+	}
+	b.ReportMetric(float64(duration.Nanoseconds()), "ns/packet")
+}
@@ -0,0 +1,161 @@
+package nodefwloader
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/openshift/ingress-node-firewall/api/v1alpha1"
+)
+
+const (
+	eventAggregationWindowEnvVar = "EVENT_AGGREGATION_WINDOW_SECONDS"
+	maxEventAggregationWindow    = 3600
+	// maxAggregatedEventKeys bounds the memory of the aggregator, the events of new keys are not aggregated while
+	// it holds that many keys.
+	maxAggregatedEventKeys = 10000
+)
+
+// EventKey identifies the events of the same interface, rule, source address, protocol and destination port, which
+// are aggregated into one summary.
+type EventKey struct {
+	Interface string
+	RuleID    uint16
+	Source    string
+	Protocol  string
+	DstPort   uint16
+}
+
+// eventSummary aggregates the events of a key over a window, starting with the event that opened the window.
+type eventSummary struct {
+	EventKey
+	Action    uint8
+	Count     uint64
+	Bytes     uint64
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+// String returns a one line description of the summary for syslog.
+func (s *eventSummary) String() string {
+	return fmt.Sprintf("ruleId %d action %s if %s src %s proto %s dstPort %d: %d events, %d bytes, first seen %s, last seen %s",
+		s.RuleID, convertXdpActionToString(s.Action), s.Interface, s.Source, s.Protocol, s.DstPort, s.Count, s.Bytes,
+		s.FirstSeen.UTC().Format(time.RFC3339Nano), s.LastSeen.UTC().Format(time.RFC3339Nano))
+}
+
+// eventAggregator aggregates the events of the same interface, rule, source address, protocol and destination port
+// over a window, so that floods of similar events are logged as one summary.
+type eventAggregator struct {
+	window time.Duration
+
+	mu        sync.Mutex
+	summaries map[EventKey]*eventSummary
+	// ended holds the summaries of the windows that ended when a new event of their key was added.
+	ended []eventSummary
+}
+
+// eventAggregationWindowFromEnv returns the aggregation window configured by the environment of the daemon, 0 if
+// events are not aggregated.
+func eventAggregationWindowFromEnv() (time.Duration, error) {
+	strVal, ok := os.LookupEnv(eventAggregationWindowEnvVar)
+	if !ok || strVal == "" {
+		return v1alpha1.DefaultEventAggregationWindowSeconds * time.Second, nil
+	}
+	val, err := strconv.Atoi(strVal)
+	if err != nil {
+		return 0, fmt.Errorf("failed to convert %s %q to integer: %v", eventAggregationWindowEnvVar, strVal, err)
+	}
+	if val < 0 || val > maxEventAggregationWindow {
+		return 0, fmt.Errorf("%s %d must be between 0 and %d", eventAggregationWindowEnvVar, val, maxEventAggregationWindow)
+	}
+	return time.Duration(val) * time.Second, nil
+}
+
+func newEventAggregator(window time.Duration) *eventAggregator {
+	return &eventAggregator{window: window, summaries: make(map[EventKey]*eventSummary)}
+}
+
+// add records event and returns true if it is the first event of its key in the current window, in which case it must
+// be forwarded immediately.
+func (a *eventAggregator) add(event *RawEvent) bool {
+	key := event.Key()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	summary, ok := a.summaries[key]
+	if ok && event.Timestamp.Sub(summary.FirstSeen) < a.window {
+		summary.Count++
+		summary.Bytes += uint64(event.Header.PktLength)
+		summary.LastSeen = event.Timestamp
+		return false
+	}
+	if ok {
+		// The window of the key ended, it is reported by the next call to expired.
+		if summary.Count > 1 {
+			a.ended = append(a.ended, *summary)
+		}
+	} else if len(a.summaries) >= maxAggregatedEventKeys {
+		return true
+	}
+	a.summaries[key] = &eventSummary{
+		EventKey:  key,
+		Action:    event.Header.Action,
+		Count:     1,
+		Bytes:     uint64(event.Header.PktLength),
+		FirstSeen: event.Timestamp,
+		LastSeen:  event.Timestamp,
+	}
+	return true
+}
+
+// expired removes the keys whose window ended before now and returns the summaries of those that aggregated
+// repeated events, sorted by the time of their first event.
+func (a *eventAggregator) expired(now time.Time) []eventSummary {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	summaries := a.ended
+	a.ended = nil
+	for key, summary := range a.summaries {
+		if now.Sub(summary.FirstSeen) < a.window {
+			continue
+		}
+		delete(a.summaries, key)
+		if summary.Count > 1 {
+			summaries = append(summaries, *summary)
+		}
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].FirstSeen.Before(summaries[j].FirstSeen)
+	})
+	return summaries
+}
+
+// newEventKey returns the key of the event with the provided header and decoded packet.
+func newEventKey(hdr BpfEventHdrSt, ifName string, decodePacket gopacket.Packet) EventKey {
+	key := EventKey{Interface: ifName, RuleID: hdr.RuleId}
+	if ip4Layer := decodePacket.Layer(layers.LayerTypeIPv4); ip4Layer != nil {
+		ip, _ := ip4Layer.(*layers.IPv4)
+		key.Source, key.Protocol = ip.SrcIP.String(), strings.ToLower(ip.Protocol.String())
+	} else if ip6Layer := decodePacket.Layer(layers.LayerTypeIPv6); ip6Layer != nil {
+		ip, _ := ip6Layer.(*layers.IPv6)
+		key.Source, key.Protocol = ip.SrcIP.String(), strings.ToLower(ip.NextHeader.String())
+	} else {
+		return key
+	}
+	if tcpLayer := decodePacket.Layer(layers.LayerTypeTCP); tcpLayer != nil {
+		tcp, _ := tcpLayer.(*layers.TCP)
+		key.DstPort = uint16(tcp.DstPort)
+	} else if udpLayer := decodePacket.Layer(layers.LayerTypeUDP); udpLayer != nil {
+		udp, _ := udpLayer.(*layers.UDP)
+		key.DstPort = uint16(udp.DstPort)
+	} else if sctpLayer := decodePacket.Layer(layers.LayerTypeSCTP); sctpLayer != nil {
+		sctp, _ := sctpLayer.(*layers.SCTP)
+		key.DstPort = uint16(sctp.DstPort)
+	}
+	return key
+}
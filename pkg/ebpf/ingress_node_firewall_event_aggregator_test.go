@@ -0,0 +1,64 @@
+package nodefwloader
+
+import (
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestEventAggregator(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	event := func(offset time.Duration, src string, dstPort uint16) *RawEvent {
+		return NewRawEvent(start.Add(offset), BpfEventHdrSt{IfId: 2, RuleId: 1, Action: xdpDeny, PktLength: 60},
+			"eth0", buildFrame(t, net.ParseIP(src), syscall.IPPROTO_TCP, dstPort, 0, 0))
+	}
+
+	aggregator := newEventAggregator(10 * time.Second)
+	// A scan of one port from one source, and a single packet from another source.
+	for i := 0; i < 100; i++ {
+		first := aggregator.add(event(time.Duration(i)*50*time.Millisecond, "10.0.0.1", 22))
+		if first != (i == 0) {
+			t.Fatalf("event %d of the scan forwarded: %t", i, first)
+		}
+	}
+	if !aggregator.add(event(time.Second, "10.0.0.1", 23)) {
+		t.Fatal("the first event to another port was not forwarded")
+	}
+	if !aggregator.add(event(time.Second, "2001:db8::2", 22)) {
+		t.Fatal("the first event of another source was not forwarded")
+	}
+
+	if summaries := aggregator.expired(start.Add(9 * time.Second)); len(summaries) != 0 {
+		t.Fatalf("expected no summary before the end of the window, got %v", summaries)
+	}
+	summaries := aggregator.expired(start.Add(11 * time.Second))
+	if len(summaries) != 1 {
+		t.Fatalf("expected 1 summary, got %v", summaries)
+	}
+	summary := summaries[0]
+	expectedKey := EventKey{Interface: "eth0", RuleID: 1, Source: "10.0.0.1", Protocol: "tcp", DstPort: 22}
+	if summary.EventKey != expectedKey {
+		t.Fatalf("unexpected summary key %+v", summary.EventKey)
+	}
+	if summary.Count != 100 || summary.Bytes != 6000 || !summary.FirstSeen.Equal(start) ||
+		!summary.LastSeen.Equal(start.Add(99*50*time.Millisecond)) {
+		t.Fatalf("unexpected summary %s", summary.String())
+	}
+	if len(aggregator.summaries) != 0 {
+		t.Fatalf("expected the expired windows to be removed, %d remain", len(aggregator.summaries))
+	}
+
+	// A new window starts with the next event of the key, an event after the end of the window that was not
+	// reported yet ends it.
+	if !aggregator.add(event(20*time.Second, "10.0.0.1", 22)) || aggregator.add(event(21*time.Second, "10.0.0.1", 22)) {
+		t.Fatal("the events of the new window were not aggregated")
+	}
+	if !aggregator.add(event(31*time.Second, "10.0.0.1", 22)) {
+		t.Fatal("the first event after the end of the window was not forwarded")
+	}
+	summaries = aggregator.expired(start.Add(31 * time.Second))
+	if len(summaries) != 1 || summaries[0].Count != 2 || !summaries[0].FirstSeen.Equal(start.Add(20*time.Second)) {
+		t.Fatalf("unexpected summaries %v", summaries)
+	}
+}
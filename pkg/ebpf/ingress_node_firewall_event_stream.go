@@ -0,0 +1,233 @@
+package nodefwloader
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	// EventsSocketPath is the unix socket on which the daemon streams the events of the XDP program.
+	EventsSocketPath = "/var/run/ingress-node-firewall/events.sock"
+	// recentEventsSize is the number of recent events that are sent to new clients of the events socket.
+	recentEventsSize = 256
+	// subscriberBufferSize is the number of events that are buffered for a client, events are dropped for clients
+	// that do not keep up.
+	subscriberBufferSize = 1024
+	// Flags of the event header, EVENT_FLAG_SOURCE_BANNED, EVENT_FLAG_BAN_STARTED and EVENT_FLAG_BLOCKLISTED in the
+	// kernel hook.
+	eventFlagSourceBanned = 1
+	eventFlagBanStarted   = 2
+	eventFlagBlocklisted  = 4
+)
+
+// Event is an event of the XDP program, decoded for display.
+type Event struct {
+	Timestamp time.Time `json:"timestamp"`
+	Interface string    `json:"interface"`
+	RuleID    uint16    `json:"ruleId"`
+	Action    string    `json:"action"`
+	Length    uint16    `json:"length"`
+	// Packet summarizes the addresses, protocol, ports or ICMP type and code of the packet.
+	Packet string `json:"packet"`
+	// SourceBanned is set when the packet was dropped because the rule had banned its source.
+	SourceBanned bool `json:"sourceBanned,omitempty"`
+	// BanStarted is set when the packet made the rule ban its source.
+	BanStarted bool `json:"banStarted,omitempty"`
+	// Blocklisted is set when the packet was dropped because its source is in the blocklist.
+	Blocklisted bool `json:"blocklisted,omitempty"`
+}
+
+// EventsRequest is the request of a client of the events socket.
+type EventsRequest struct {
+	// Follow keeps the connection open and streams new events after the recent ones.
+	Follow bool `json:"follow"`
+}
+
+// newEvent returns the event for the provided header and decoded packet of an event of the XDP program.
+func newEvent(timestamp time.Time, hdr BpfEventHdrSt, ifName string, packet gopacket.Packet) Event {
+	return Event{
+		Timestamp:    timestamp,
+		Interface:    ifName,
+		RuleID:       hdr.RuleId,
+		Action:       convertXdpActionToString(hdr.Action),
+		Length:       hdr.PktLength,
+		Packet:       summarizePacket(packet),
+		SourceBanned: hdr.Flags&eventFlagSourceBanned != 0,
+		BanStarted:   hdr.Flags&eventFlagBanStarted != 0,
+		Blocklisted:  hdr.Flags&eventFlagBlocklisted != 0,
+	}
+}
+
+// summarizePacket returns a one line summary of the provided decoded ethernet frame.
+func summarizePacket(decodePacket gopacket.Packet) string {
+	var src, dst string
+	var protocol layers.IPProtocol
+	if ip4Layer := decodePacket.Layer(layers.LayerTypeIPv4); ip4Layer != nil {
+		ip, _ := ip4Layer.(*layers.IPv4)
+		src, dst, protocol = ip.SrcIP.String(), ip.DstIP.String(), ip.Protocol
+	} else if ip6Layer := decodePacket.Layer(layers.LayerTypeIPv6); ip6Layer != nil {
+		ip, _ := ip6Layer.(*layers.IPv6)
+		src, dst, protocol = ip.SrcIP.String(), ip.DstIP.String(), ip.NextHeader
+	} else {
+		return "non IP packet"
+	}
+	if tcpLayer := decodePacket.Layer(layers.LayerTypeTCP); tcpLayer != nil {
+		tcp, _ := tcpLayer.(*layers.TCP)
+		return fmt.Sprintf("tcp %s -> %s", net.JoinHostPort(src, fmt.Sprint(uint16(tcp.SrcPort))),
+			net.JoinHostPort(dst, fmt.Sprint(uint16(tcp.DstPort))))
+	}
+	if udpLayer := decodePacket.Layer(layers.LayerTypeUDP); udpLayer != nil {
+		udp, _ := udpLayer.(*layers.UDP)
+		return fmt.Sprintf("udp %s -> %s", net.JoinHostPort(src, fmt.Sprint(uint16(udp.SrcPort))),
+			net.JoinHostPort(dst, fmt.Sprint(uint16(udp.DstPort))))
+	}
+	if sctpLayer := decodePacket.Layer(layers.LayerTypeSCTP); sctpLayer != nil {
+		sctp, _ := sctpLayer.(*layers.SCTP)
+		return fmt.Sprintf("sctp %s -> %s", net.JoinHostPort(src, fmt.Sprint(uint16(sctp.SrcPort))),
+			net.JoinHostPort(dst, fmt.Sprint(uint16(sctp.DstPort))))
+	}
+	if icmpv4Layer := decodePacket.Layer(layers.LayerTypeICMPv4); icmpv4Layer != nil {
+		icmp, _ := icmpv4Layer.(*layers.ICMPv4)
+		return fmt.Sprintf("icmpv4 %s -> %s type %d code %d", src, dst, icmp.TypeCode.Type(), icmp.TypeCode.Code())
+	}
+	if icmpv6Layer := decodePacket.Layer(layers.LayerTypeICMPv6); icmpv6Layer != nil {
+		icmp, _ := icmpv6Layer.(*layers.ICMPv6)
+		return fmt.Sprintf("icmpv6 %s -> %s type %d code %d", src, dst, icmp.TypeCode.Type(), icmp.TypeCode.Code())
+	}
+	return fmt.Sprintf("ip protocol %d %s -> %s", uint8(protocol), src, dst)
+}
+
+// eventStream keeps the recent events of the XDP program and streams them to the clients of the events socket.
+type eventStream struct {
+	mu          sync.Mutex
+	recent      []Event
+	next        int
+	subscribers map[chan Event]struct{}
+}
+
+func newEventStream() *eventStream {
+	return &eventStream{subscribers: make(map[chan Event]struct{})}
+}
+
+// publish records the event and sends it to the subscribers.
+func (s *eventStream) publish(event Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.recent) < recentEventsSize {
+		s.recent = append(s.recent, event)
+	} else {
+		s.recent[s.next] = event
+		s.next = (s.next + 1) % recentEventsSize
+	}
+	for subscriber := range s.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+		}
+	}
+}
+
+// subscribe returns the recent events, oldest first, and a channel that receives new events if follow is set.
+func (s *eventStream) subscribe(follow bool) ([]Event, chan Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	recent := append(append([]Event(nil), s.recent[s.next:]...), s.recent[:s.next]...)
+	if !follow {
+		return recent, nil
+	}
+	subscriber := make(chan Event, subscriberBufferSize)
+	s.subscribers[subscriber] = struct{}{}
+	return recent, subscriber
+}
+
+func (s *eventStream) unsubscribe(subscriber chan Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.subscribers, subscriber)
+}
+
+// listen serves the events on a unix socket at socketPath, replacing a stale socket.
+func (s *eventStream) listen(socketPath string) (net.Listener, error) {
+	if err := os.MkdirAll(path.Dir(socketPath), 0o755); err != nil {
+		return nil, err
+	}
+	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return listener, nil
+}
+
+// serve reads the request of a client and writes the events as JSON lines.
+func (s *eventStream) serve(conn net.Conn) {
+	defer conn.Close()
+	var request EventsRequest
+	if err := json.NewDecoder(conn).Decode(&request); err != nil {
+		log.Printf("Reading events request: %v", err)
+		return
+	}
+	recent, subscriber := s.subscribe(request.Follow)
+	if subscriber != nil {
+		defer s.unsubscribe(subscriber)
+	}
+	encoder := json.NewEncoder(conn)
+	for _, event := range recent {
+		if err := encoder.Encode(event); err != nil {
+			return
+		}
+	}
+	if subscriber == nil {
+		return
+	}
+	for event := range subscriber {
+		if err := encoder.Encode(event); err != nil {
+			return
+		}
+	}
+}
+
+// ReadEvents connects to the events socket of the daemon at socketPath and calls fn for the recent events, and for
+// new events until fn returns an error if follow is set.
+func ReadEvents(socketPath string, follow bool, fn func(Event) error) error {
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("failed to connect to the daemon events socket: %w", err)
+	}
+	defer conn.Close()
+	if err := json.NewEncoder(conn).Encode(EventsRequest{Follow: follow}); err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return fmt.Errorf("failed to parse event: %w", err)
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
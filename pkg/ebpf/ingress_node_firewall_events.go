@@ -11,6 +11,8 @@ import (
 	"net"
 	"os"
 	"os/signal"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 	"unsafe"
@@ -21,6 +23,100 @@ import (
 	"k8s.io/apimachinery/pkg/util/wait"
 )
 
+// eventHandlerBufferSize is the number of events that are buffered for each event handler, events are dropped for
+// handlers that do not keep up.
+const eventHandlerBufferSize = 1024
+
+// RawEvent is an event of the XDP program with the packet data that it carries. RawEvents are created with
+// NewRawEvent, which decodes the packet once for all the consumers of the event.
+type RawEvent struct {
+	Timestamp time.Time
+	Header    BpfEventHdrSt
+	Interface string
+	// Packet holds up to the first MAX_EVENT_DATA bytes of the packet, Header.PktLength is the length of the packet.
+	Packet []byte
+
+	decoded gopacket.Packet
+	event   Event
+	key     EventKey
+}
+
+// NewRawEvent returns the event for the provided header and packet of an event of the XDP program.
+func NewRawEvent(timestamp time.Time, hdr BpfEventHdrSt, ifName string, packet []byte) *RawEvent {
+	decoded := gopacket.NewPacket(packet, layers.LayerTypeEthernet, gopacket.Default)
+	return &RawEvent{
+		Timestamp: timestamp,
+		Header:    hdr,
+		Interface: ifName,
+		Packet:    packet,
+		decoded:   decoded,
+		event:     newEvent(timestamp, hdr, ifName, decoded),
+		key:       newEventKey(hdr, ifName, decoded),
+	}
+}
+
+// Decode returns the event decoded for display.
+func (e *RawEvent) Decode() Event {
+	return e.event
+}
+
+// Key returns the key of the event. The source, protocol and destination port are empty for non IP packets, and the
+// destination port is 0 for protocols without ports.
+func (e *RawEvent) Key() EventKey {
+	return e.key
+}
+
+// EventHandler is called for each event of the XDP program. Each handler is called sequentially on a goroutine of
+// its own, so that slow handlers do not hold up the events reader, and must not modify the event.
+type EventHandler func(event *RawEvent)
+
+// eventHandlerQueue buffers the events of a handler.
+type eventHandlerQueue struct {
+	events chan *RawEvent
+	// dropped is the number of events that were dropped because the buffer was full, it is only accessed by the
+	// events reader.
+	dropped uint64
+}
+
+var (
+	eventHandlersMu sync.Mutex
+	eventHandlers   []*eventHandlerQueue
+)
+
+// RegisterEventHandler registers a handler that is called for each event of the XDP program, in addition to the
+// syslog and the events socket.
+func RegisterEventHandler(handler EventHandler) {
+	queue := &eventHandlerQueue{events: make(chan *RawEvent, eventHandlerBufferSize)}
+	go func() {
+		for event := range queue.events {
+			handler(event)
+		}
+	}()
+	eventHandlersMu.Lock()
+	defer eventHandlersMu.Unlock()
+	eventHandlers = append(eventHandlers, queue)
+}
+
+func registeredEventHandlers() []*eventHandlerQueue {
+	eventHandlersMu.Lock()
+	defer eventHandlersMu.Unlock()
+	return eventHandlers
+}
+
+// dispatchEvent queues the event for each registered handler, dropping it for the handlers whose buffer is full.
+func dispatchEvent(event *RawEvent) {
+	for idx, queue := range registeredEventHandlers() {
+		select {
+		case queue.events <- event:
+		default:
+			queue.dropped++
+			if queue.dropped == 1 || queue.dropped%eventHandlerBufferSize == 0 {
+				log.Printf("Event handler %d does not keep up, dropped %d events", idx, queue.dropped)
+			}
+		}
+	}
+}
+
 // ingressNodeFwEvents watch for eBPF events generated during XDP packet processing
 func (infc *IngNodeFwController) ingressNodeFwEvents() error {
 	objs := infc.objs
@@ -46,11 +142,44 @@ func (infc *IngNodeFwController) ingressNodeFwEvents() error {
 		return fmt.Errorf("failed to connect to syslog: %v", err)
 	}
 
+	// Serve the recent events to infwctl on the node.
+	stream := newEventStream()
+	listener, err := stream.listen(EventsSocketPath)
+	if err != nil {
+		log.Printf("Failed to listen on events socket %s: %v", EventsSocketPath, err)
+	}
+
+	// Similar events are logged once per aggregation window, followed by a summary at the end of the window.
+	var aggregator *eventAggregator
+	done := make(chan struct{})
+	if infc.eventAggregationWindow > 0 {
+		aggregator = newEventAggregator(infc.eventAggregationWindow)
+		go func() {
+			ticker := time.NewTicker(time.Second)
+			defer ticker.Stop()
+			for {
+				select {
+				case now := <-ticker.C:
+					logEventSummaries(eventsLogger, aggregator, now)
+				case <-done:
+					// Log the summaries of the open windows before exiting.
+					logEventSummaries(eventsLogger, aggregator, time.Now().Add(infc.eventAggregationWindow))
+					return
+				}
+			}
+		}()
+	}
+
 	go func() {
 		// Wait for a signal and close the perf reader,
 		// which will interrupt rd.Read() and make the program exit.
 		<-stopper
 		log.Println("Received signal, exiting program..")
+		close(done)
+
+		if listener != nil {
+			listener.Close()
+		}
 
 		if err := rd.Close(); err != nil {
 			log.Printf("Closing perf event reader: %q", err)
@@ -61,7 +190,9 @@ func (infc *IngNodeFwController) ingressNodeFwEvents() error {
 	log.Printf("Listening for events..")
 
 	// bpfEventHdrSt is generated by bpf2go.
+	atomic.StoreInt32(&infc.eventsReaderAlive, 1)
 	go func() {
+		defer atomic.StoreInt32(&infc.eventsReaderAlive, 0)
 		var eventHdr BpfEventHdrSt
 		const eventHdrSize = unsafe.Sizeof(eventHdr)
 		buf := make([]byte, eventHdrSize)
@@ -90,12 +221,12 @@ func (infc *IngNodeFwController) ingressNodeFwEvents() error {
 			eventHdr.IfId = binary.LittleEndian.Uint16(buf[0:2])
 			eventHdr.RuleId = binary.LittleEndian.Uint16(buf[2:4])
 			eventHdr.Action = buf[4]
+			eventHdr.Flags = buf[5]
 			eventHdr.PktLength = binary.LittleEndian.Uint16(buf[6:8])
-			packet := make([]byte, eventHdr.PktLength)
-			// Parse the perf event entry into a bpfEvent structure.
-			if err := binary.Read(bytes.NewBuffer(record.RawSample[eventHdrSize:]), binary.LittleEndian, &packet); err != nil {
-				log.Printf("Parsing perf event packet header : %v", err)
-				continue
+			// The sample holds up to MAX_EVENT_DATA bytes of the packet and is padded by the kernel.
+			packet := record.RawSample[eventHdrSize:]
+			if len(packet) > int(eventHdr.PktLength) {
+				packet = packet[:eventHdr.PktLength]
 			}
 			// Look up the network interface by index.
 			iface, err := net.InterfaceByIndex(int(eventHdr.IfId))
@@ -103,66 +234,11 @@ func (infc *IngNodeFwController) ingressNodeFwEvents() error {
 				log.Printf("lookup network iface %d: %s", eventHdr.IfId, err)
 				continue
 			}
-			if err := eventsLogger.Info(fmt.Sprintf("ruleId %d action %s len %d if %s\n",
-				eventHdr.RuleId, convertXdpActionToString(eventHdr.Action), eventHdr.PktLength, iface.Name)); err != nil {
-				log.Printf("syslog event logging failed %q", err)
-			}
-			decodePacket := gopacket.NewPacket(packet, layers.LayerTypeEthernet, gopacket.Default)
-			// check for IPv4
-			if ip4Layer := decodePacket.Layer(layers.LayerTypeIPv4); ip4Layer != nil {
-				ip, _ := ip4Layer.(*layers.IPv4)
-				if err := eventsLogger.Info(fmt.Sprintf("\tipv4 src addr %s dst addr %s\n", ip.SrcIP.String(), ip.DstIP.String())); err != nil {
-					log.Printf("syslog event logging for ruleId %d on intrerface %s failed err: %q",
-						eventHdr.RuleId, iface.Name, err)
-				}
-			}
-			// check for IPv6
-			if ip6Layer := decodePacket.Layer(layers.LayerTypeIPv6); ip6Layer != nil {
-				ip, _ := ip6Layer.(*layers.IPv6)
-				if err := eventsLogger.Info(fmt.Sprintf("\tipv6 src addr %s dst addr %s\n", ip.SrcIP.String(), ip.DstIP.String())); err != nil {
-					log.Printf("syslog event logging for ruleId %d on intrerface %s failed err: %q",
-						eventHdr.RuleId, iface.Name, err)
-				}
-			}
-			// check for TCP
-			if tcpLayer := decodePacket.Layer(layers.LayerTypeTCP); tcpLayer != nil {
-				tcp, _ := tcpLayer.(*layers.TCP)
-				if err := eventsLogger.Info(fmt.Sprintf("\ttcp srcPort %d dstPort %d\n", tcp.SrcPort, tcp.DstPort)); err != nil {
-					log.Printf("syslog event logging for ruleId %d on intrerface %s failed err: %q",
-						eventHdr.RuleId, iface.Name, err)
-				}
-			}
-			// check for UDP
-			if udpLayer := decodePacket.Layer(layers.LayerTypeUDP); udpLayer != nil {
-				udp, _ := udpLayer.(*layers.UDP)
-				if err := eventsLogger.Info(fmt.Sprintf("\tudp srcPort %d dstPort %d\n", udp.SrcPort, udp.DstPort)); err != nil {
-					log.Printf("syslog event logging for ruleId %d on intrerface %s failed err: %q",
-						eventHdr.RuleId, iface.Name, err)
-				}
-			}
-			// check fo SCTP
-			if sctpLayer := decodePacket.Layer(layers.LayerTypeSCTP); sctpLayer != nil {
-				sctp, _ := sctpLayer.(*layers.SCTP)
-				if err := eventsLogger.Info(fmt.Sprintf("\tsctp srcPort %d dstPort %d\n", sctp.SrcPort, sctp.DstPort)); err != nil {
-					log.Printf("syslog event logging for ruleId %d on intrerface %s failed err: %q",
-						eventHdr.RuleId, iface.Name, err)
-				}
-			}
-			// check for ICMPv4
-			if icmpv4Layer := decodePacket.Layer(layers.LayerTypeICMPv4); icmpv4Layer != nil {
-				icmp, _ := icmpv4Layer.(*layers.ICMPv4)
-				if err := eventsLogger.Info(fmt.Sprintf("\ticmpv4 type %d code %d\n", icmp.TypeCode.Type(), icmp.TypeCode.Code())); err != nil {
-					log.Printf("syslog event logging for ruleId %d on intrerface %s failed err: %q",
-						eventHdr.RuleId, iface.Name, err)
-				}
-			}
-			// check for ICMPV6
-			if icmpv6Layer := decodePacket.Layer(layers.LayerTypeICMPv6); icmpv6Layer != nil {
-				icmp, _ := icmpv6Layer.(*layers.ICMPv6)
-				if err := eventsLogger.Info(fmt.Sprintf("\ticmpv6 type %d code %d\n", icmp.TypeCode.Type(), icmp.TypeCode.Code())); err != nil {
-					log.Printf("syslog event logging for ruleId %d on intrerface %s failed err: %q",
-						eventHdr.RuleId, iface.Name, err)
-				}
+			rawEvent := NewRawEvent(time.Now(), eventHdr, iface.Name, packet)
+			stream.publish(rawEvent.Decode())
+			dispatchEvent(rawEvent)
+			if aggregator == nil || aggregator.add(rawEvent) {
+				logEvent(eventsLogger, rawEvent)
 			}
 		}
 	}()
@@ -170,6 +246,97 @@ func (infc *IngNodeFwController) ingressNodeFwEvents() error {
 	return nil
 }
 
+// EventsReaderAlive returns true while the reader of the perf events of the XDP program runs.
+func (infc *IngNodeFwController) EventsReaderAlive() bool {
+	return atomic.LoadInt32(&infc.eventsReaderAlive) == 1
+}
+
+// logEvent logs event to syslog.
+func logEvent(eventsLogger *syslog.Writer, event *RawEvent) {
+	if err := eventsLogger.Info(fmt.Sprintf("ruleId %d action %s len %d if %s\n",
+		event.Header.RuleId, convertXdpActionToString(event.Header.Action), event.Header.PktLength, event.Interface)); err != nil {
+		log.Printf("syslog event logging failed %q", err)
+	}
+	if event.Header.Flags&eventFlagBlocklisted != 0 {
+		if err := eventsLogger.Info("\tsource is in the blocklist\n"); err != nil {
+			log.Printf("syslog event logging for ruleId %d on intrerface %s failed err: %q",
+				event.Header.RuleId, event.Interface, err)
+		}
+	}
+	if event.Header.Flags&eventFlagBanStarted != 0 {
+		if err := eventsLogger.Info(fmt.Sprintf("\truleId %d banned the source\n", event.Header.RuleId)); err != nil {
+			log.Printf("syslog event logging for ruleId %d on intrerface %s failed err: %q",
+				event.Header.RuleId, event.Interface, err)
+		}
+	}
+	decodePacket := event.decoded
+	// check for IPv4
+	if ip4Layer := decodePacket.Layer(layers.LayerTypeIPv4); ip4Layer != nil {
+		ip, _ := ip4Layer.(*layers.IPv4)
+		if err := eventsLogger.Info(fmt.Sprintf("\tipv4 src addr %s dst addr %s\n", ip.SrcIP.String(), ip.DstIP.String())); err != nil {
+			log.Printf("syslog event logging for ruleId %d on intrerface %s failed err: %q",
+				event.Header.RuleId, event.Interface, err)
+		}
+	}
+	// check for IPv6
+	if ip6Layer := decodePacket.Layer(layers.LayerTypeIPv6); ip6Layer != nil {
+		ip, _ := ip6Layer.(*layers.IPv6)
+		if err := eventsLogger.Info(fmt.Sprintf("\tipv6 src addr %s dst addr %s\n", ip.SrcIP.String(), ip.DstIP.String())); err != nil {
+			log.Printf("syslog event logging for ruleId %d on intrerface %s failed err: %q",
+				event.Header.RuleId, event.Interface, err)
+		}
+	}
+	// check for TCP
+	if tcpLayer := decodePacket.Layer(layers.LayerTypeTCP); tcpLayer != nil {
+		tcp, _ := tcpLayer.(*layers.TCP)
+		if err := eventsLogger.Info(fmt.Sprintf("\ttcp srcPort %d dstPort %d\n", tcp.SrcPort, tcp.DstPort)); err != nil {
+			log.Printf("syslog event logging for ruleId %d on intrerface %s failed err: %q",
+				event.Header.RuleId, event.Interface, err)
+		}
+	}
+	// check for UDP
+	if udpLayer := decodePacket.Layer(layers.LayerTypeUDP); udpLayer != nil {
+		udp, _ := udpLayer.(*layers.UDP)
+		if err := eventsLogger.Info(fmt.Sprintf("\tudp srcPort %d dstPort %d\n", udp.SrcPort, udp.DstPort)); err != nil {
+			log.Printf("syslog event logging for ruleId %d on intrerface %s failed err: %q",
+				event.Header.RuleId, event.Interface, err)
+		}
+	}
+	// check fo SCTP
+	if sctpLayer := decodePacket.Layer(layers.LayerTypeSCTP); sctpLayer != nil {
+		sctp, _ := sctpLayer.(*layers.SCTP)
+		if err := eventsLogger.Info(fmt.Sprintf("\tsctp srcPort %d dstPort %d\n", sctp.SrcPort, sctp.DstPort)); err != nil {
+			log.Printf("syslog event logging for ruleId %d on intrerface %s failed err: %q",
+				event.Header.RuleId, event.Interface, err)
+		}
+	}
+	// check for ICMPv4
+	if icmpv4Layer := decodePacket.Layer(layers.LayerTypeICMPv4); icmpv4Layer != nil {
+		icmp, _ := icmpv4Layer.(*layers.ICMPv4)
+		if err := eventsLogger.Info(fmt.Sprintf("\ticmpv4 type %d code %d\n", icmp.TypeCode.Type(), icmp.TypeCode.Code())); err != nil {
+			log.Printf("syslog event logging for ruleId %d on intrerface %s failed err: %q",
+				event.Header.RuleId, event.Interface, err)
+		}
+	}
+	// check for ICMPV6
+	if icmpv6Layer := decodePacket.Layer(layers.LayerTypeICMPv6); icmpv6Layer != nil {
+		icmp, _ := icmpv6Layer.(*layers.ICMPv6)
+		if err := eventsLogger.Info(fmt.Sprintf("\ticmpv6 type %d code %d\n", icmp.TypeCode.Type(), icmp.TypeCode.Code())); err != nil {
+			log.Printf("syslog event logging for ruleId %d on intrerface %s failed err: %q",
+				event.Header.RuleId, event.Interface, err)
+		}
+	}
+}
+
+// logEventSummaries logs the summaries of the aggregation windows that ended at now to syslog.
+func logEventSummaries(eventsLogger *syslog.Writer, aggregator *eventAggregator, now time.Time) {
+	for _, summary := range aggregator.expired(now) {
+		if err := eventsLogger.Info(fmt.Sprintf("summary %s\n", summary.String())); err != nil {
+			log.Printf("syslog event summary logging failed %q", err)
+		}
+	}
+}
+
 func convertXdpActionToString(action uint8) string {
 	switch action {
 	case xdpDeny:
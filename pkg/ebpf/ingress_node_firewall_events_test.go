@@ -0,0 +1,62 @@
+package nodefwloader
+
+import (
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestDispatchEvent checks that the events are decoded once for all handlers and that a handler that does not keep
+// up does not block the events reader or the other handlers.
+func TestDispatchEvent(t *testing.T) {
+	eventHandlersMu.Lock()
+	registered := eventHandlers
+	eventHandlers = nil
+	eventHandlersMu.Unlock()
+	defer func() {
+		eventHandlersMu.Lock()
+		eventHandlers = registered
+		eventHandlersMu.Unlock()
+	}()
+
+	block := make(chan struct{})
+	defer close(block)
+	RegisterEventHandler(func(event *RawEvent) { <-block })
+	received := make(chan *RawEvent, 2*eventHandlerBufferSize)
+	RegisterEventHandler(func(event *RawEvent) { received <- event })
+
+	event := NewRawEvent(time.Unix(0, 0), BpfEventHdrSt{IfId: 2, RuleId: 1, Action: xdpDeny, PktLength: 60}, "eth0",
+		buildFrame(t, net.ParseIP("10.0.0.1"), syscall.IPPROTO_TCP, 22, 0, 0))
+	if key := event.Key(); key.Source != "10.0.0.1" || key.Protocol != "tcp" || key.DstPort != 22 {
+		t.Fatalf("unexpected key %+v", key)
+	}
+	if packet := event.Decode().Packet; !strings.HasPrefix(packet, "tcp 10.0.0.1:") {
+		t.Fatalf("unexpected packet summary %q", packet)
+	}
+
+	dispatched := make(chan struct{})
+	go func() {
+		for i := 0; i < 2*eventHandlerBufferSize; i++ {
+			dispatchEvent(event)
+		}
+		close(dispatched)
+	}()
+	select {
+	case <-dispatched:
+	case <-time.After(10 * time.Second):
+		t.Fatal("dispatching events blocked on a handler that does not keep up")
+	}
+	if dropped := registeredEventHandlers()[0].dropped; dropped == 0 {
+		t.Fatal("no events were dropped for the handler that does not keep up")
+	}
+	select {
+	case got := <-received:
+		if got != event {
+			t.Fatalf("the handler received %+v instead of the dispatched event", got)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the handler that keeps up did not receive the event")
+	}
+}
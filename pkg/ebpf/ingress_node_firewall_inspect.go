@@ -0,0 +1,295 @@
+package nodefwloader
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+	"golang.org/x/sys/unix"
+	apierrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// DefaultPinPath is the directory in which the daemon pins the eBPF maps and links.
+var DefaultPinPath = path.Join(bpfFSPath, xdpIngressNodeFirewallProcess)
+
+// PinnedState gives read-only access to the eBPF maps and links that the daemon pinned, to inspect the firewall
+// state on a node without loading the eBPF objects.
+type PinnedState struct {
+	pinPath  string
+	tableMap *ebpf.Map
+	rulesMap *ebpf.Map
+}
+
+// Target holds the rules that apply to the packets of a source CIDR that are received on an interface.
+type Target struct {
+	Key   BpfLpmIpKeySt
+	Value BpfRulesValSt
+	Rules []BpfRuleTypeSt
+}
+
+// PinnedLink is an XDP link of the ingress node firewall program that is pinned in the pin directory.
+type PinnedLink struct {
+	// Interface is the name of the interface from the name of the pin.
+	Interface string
+	Path      string
+	ID        link.ID
+	ProgramID ebpf.ProgramID
+	// IfIndex is the index of the interface the link is attached to, 0 if the kernel does not report it.
+	IfIndex uint32
+}
+
+// Ban is a source that a rule with autoBan banned.
+type Ban struct {
+	Source net.IP
+	RuleID uint32
+	// Remaining is the time until the ban ends.
+	Remaining time.Duration
+}
+
+// OpenPinnedState opens the pinned table and rules maps in pinPath.
+func OpenPinnedState(pinPath string) (*PinnedState, error) {
+	opts := &ebpf.LoadPinOptions{ReadOnly: true}
+	tableMap, err := ebpf.LoadPinnedMap(path.Join(pinPath, tableMapName), opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pinned map %s: %w", tableMapName, err)
+	}
+	rulesMap, err := ebpf.LoadPinnedMap(path.Join(pinPath, rulesMapName), opts)
+	if err != nil {
+		tableMap.Close()
+		return nil, fmt.Errorf("failed to open pinned map %s: %w", rulesMapName, err)
+	}
+	return &PinnedState{pinPath: pinPath, tableMap: tableMap, rulesMap: rulesMap}, nil
+}
+
+// Close closes the pinned maps, they stay pinned.
+func (s *PinnedState) Close() error {
+	var errs []error
+	for _, m := range []*ebpf.Map{s.tableMap, s.rulesMap} {
+		if err := m.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return apierrors.NewAggregate(errs)
+}
+
+// Targets returns the keys of the table map and their rules, ordered by interface index and source CIDR.
+func (s *PinnedState) Targets() ([]Target, error) {
+	var targets []Target
+	var key BpfLpmIpKeySt
+	var value BpfRulesValSt
+	iterator := s.tableMap.Iterate()
+	for iterator.Next(&key, &value) {
+		rules, err := lookupRules(s.rulesMap, value)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, Target{Key: key, Value: value, Rules: rules})
+	}
+	if err := iterator.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		a, b := targets[i].Key, targets[j].Key
+		if a.IngressIfindex != b.IngressIfindex {
+			return a.IngressIfindex < b.IngressIfindex
+		}
+		if c := bytes.Compare(a.IpData[:], b.IpData[:]); c != 0 {
+			return c < 0
+		}
+		return a.PrefixLen < b.PrefixLen
+	})
+	return targets, nil
+}
+
+// Links returns the pinned XDP links of the program.
+func (s *PinnedState) Links() ([]PinnedLink, error) {
+	files, err := ioutil.ReadDir(s.pinPath)
+	if err != nil {
+		return nil, err
+	}
+	var links []PinnedLink
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), linkSuffix) {
+			continue
+		}
+		pinnedLink := PinnedLink{
+			Interface: strings.TrimSuffix(file.Name(), linkSuffix),
+			Path:      path.Join(s.pinPath, file.Name()),
+		}
+		l, err := link.LoadPinnedLink(pinnedLink.Path, &ebpf.LoadPinOptions{ReadOnly: true})
+		if err != nil {
+			return nil, fmt.Errorf("failed to open pinned link %s: %w", pinnedLink.Path, err)
+		}
+		info, err := l.Info()
+		l.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get info of pinned link %s: %w", pinnedLink.Path, err)
+		}
+		pinnedLink.ID, pinnedLink.ProgramID = info.ID, info.Program
+		if xdp := info.XDP(); xdp != nil {
+			pinnedLink.IfIndex = xdp.Ifindex
+		}
+		links = append(links, pinnedLink)
+	}
+	return links, nil
+}
+
+// Statistics returns the statistics of the rules with packets, summed over all CPUs and keyed by rule ID. The
+// statistics map is not pinned, it is found through the program of the pinned links.
+func (s *PinnedState) Statistics() (map[uint32]BpfRuleStatisticsSt, error) {
+	links, err := s.Links()
+	if err != nil {
+		return nil, err
+	}
+	if len(links) == 0 {
+		return nil, errors.New("no pinned links, the program is not attached to any interface")
+	}
+	statsMap, err := statisticsMapOfProgram(links[0].ProgramID)
+	if err != nil {
+		return nil, err
+	}
+	defer statsMap.Close()
+
+	statistics := make(map[uint32]BpfRuleStatisticsSt)
+	var perCPUStats []BpfRuleStatisticsSt
+	for ruleID := uint32(0); ruleID < statsMap.MaxEntries(); ruleID++ {
+		if err := statsMap.Lookup(ruleID, &perCPUStats); err != nil {
+			return nil, fmt.Errorf("failed to look up statistics of rule %d: %w", ruleID, err)
+		}
+		var sum BpfRuleStatisticsSt
+		for _, stats := range perCPUStats {
+			sum.AllowStats.Packets += stats.AllowStats.Packets
+			sum.AllowStats.Bytes += stats.AllowStats.Bytes
+			sum.DenyStats.Packets += stats.DenyStats.Packets
+			sum.DenyStats.Bytes += stats.DenyStats.Bytes
+			sum.EventStats.SampledOut += stats.EventStats.SampledOut
+			sum.EventStats.RateLimited += stats.EventStats.RateLimited
+		}
+		if sum.AllowStats.Packets != 0 || sum.DenyStats.Packets != 0 {
+			statistics[ruleID] = sum
+		}
+	}
+	return statistics, nil
+}
+
+// Bans returns the sources that are currently banned. The pinned ban map is opened for each call since it is only
+// needed by this method.
+func (s *PinnedState) Bans() ([]Ban, error) {
+	banMap, err := ebpf.LoadPinnedMap(path.Join(s.pinPath, banMapName), &ebpf.LoadPinOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pinned map %s: %w", banMapName, err)
+	}
+	defer banMap.Close()
+	return ActiveBans(banMap)
+}
+
+// Blocklist returns the source addresses and CIDRs of the blocklist, ordered by address and prefix length.
+func (s *PinnedState) Blocklist() ([]*net.IPNet, error) {
+	blocklistMap, err := ebpf.LoadPinnedMap(path.Join(s.pinPath, blocklistMapName), &ebpf.LoadPinOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pinned map %s: %w", blocklistMapName, err)
+	}
+	defer blocklistMap.Close()
+	keys, err := blocklistEntries(blocklistMap)
+	if err != nil {
+		return nil, err
+	}
+	cidrs := make([]*net.IPNet, 0, len(keys))
+	for _, key := range keys {
+		cidrs = append(cidrs, blocklistCIDR(key))
+	}
+	return cidrs, nil
+}
+
+// ActiveBans returns the bans of the ban map that have not ended yet, ordered by source address. The kernel hook
+// removes ended bans lazily, when the next packet of the source is received.
+func ActiveBans(banMap *ebpf.Map) ([]Ban, error) {
+	var ts unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_MONOTONIC, &ts); err != nil {
+		return nil, fmt.Errorf("failed to read the monotonic clock: %w", err)
+	}
+	now := uint64(ts.Nano())
+
+	var bans []Ban
+	var key BpfBanKeySt
+	var value BpfBanValSt
+	iterator := banMap.Iterate()
+	for iterator.Next(&key, &value) {
+		if value.Expires <= now {
+			continue
+		}
+		source := net.IP(append([]byte(nil), key.IpData[:]...))
+		if ipv4 := source.To4(); ipv4 != nil {
+			source = ipv4
+		}
+		bans = append(bans, Ban{Source: source, RuleID: value.RuleId, Remaining: time.Duration(value.Expires - now)})
+	}
+	if err := iterator.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(bans, func(i, j int) bool { return bytes.Compare(bans[i].Source.To16(), bans[j].Source.To16()) < 0 })
+	return bans, nil
+}
+
+// statisticsMapOfProgram returns the statistics map that the program with the provided ID uses. Map names are
+// truncated by the kernel, the statistics map is the only per CPU array of the program.
+func statisticsMapOfProgram(programID ebpf.ProgramID) (*ebpf.Map, error) {
+	prog, err := ebpf.NewProgramFromID(programID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open program %d: %w", programID, err)
+	}
+	defer prog.Close()
+	info, err := prog.Info()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get info of program %d: %w", programID, err)
+	}
+	mapIDs, ok := info.MapIDs()
+	if !ok {
+		return nil, fmt.Errorf("the kernel does not report the maps of program %d", programID)
+	}
+	for _, mapID := range mapIDs {
+		m, err := ebpf.NewMapFromID(mapID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open map %d: %w", mapID, err)
+		}
+		if m.Type() == ebpf.PerCPUArray {
+			return m, nil
+		}
+		m.Close()
+	}
+	return nil, fmt.Errorf("program %d has no statistics map", programID)
+}
+
+// KeyCIDRs returns the source CIDRs that the provided key of the table map matches. Keys do not record the
+// address family: IPv4 addresses are stored in the first bytes of the key, so a key with a prefix of at most 32
+// bits and zero trailing bytes matches both an IPv4 and an IPv6 CIDR, and both are returned, IPv4 first.
+func KeyCIDRs(key BpfLpmIpKeySt) []string {
+	prefixLen := int(key.PrefixLen) - ifIndexKeyLength
+	if prefixLen < 0 {
+		prefixLen = 0
+	}
+	ipv6 := &net.IPNet{IP: net.IP(append([]byte(nil), key.IpData[:]...)), Mask: net.CIDRMask(prefixLen, 128)}
+	if prefixLen > 32 || !allZero(key.IpData[4:]) {
+		return []string{ipv6.String()}
+	}
+	ipv4 := &net.IPNet{IP: net.IPv4(key.IpData[0], key.IpData[1], key.IpData[2], key.IpData[3]).To4(),
+		Mask: net.CIDRMask(prefixLen, 32)}
+	return []string{ipv4.String(), ipv6.String()}
+}
+
+func allZero(data []uint8) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
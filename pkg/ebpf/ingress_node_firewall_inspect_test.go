@@ -0,0 +1,102 @@
+package nodefwloader
+
+import (
+	"errors"
+	"net"
+	"path"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestKeyCIDRs(t *testing.T) {
+	tcs := []struct {
+		cidr     string
+		expected []string
+	}{
+		{cidr: "10.0.0.0/8", expected: []string{"10.0.0.0/8", "a00::/8"}},
+		{cidr: "192.0.2.7/32", expected: []string{"192.0.2.7/32", "c000:207::/32"}},
+		{cidr: "0.0.0.0/0", expected: []string{"0.0.0.0/0", "::/0"}},
+		{cidr: "2001:db8::/32", expected: []string{"32.1.13.184/32", "2001:db8::/32"}},
+		{cidr: "2001:db8:1::/48", expected: []string{"2001:db8:1::/48"}},
+		{cidr: "fd00::1/128", expected: []string{"fd00::1/128"}},
+	}
+	for _, tc := range tcs {
+		key, err := BuildEBPFKey(3, tc.cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cidrs := KeyCIDRs(key); !reflect.DeepEqual(cidrs, tc.expected) {
+			t.Fatalf("KeyCIDRs(%s): got %v, expected %v", tc.cidr, cidrs, tc.expected)
+		}
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	stream := newEventStream()
+	socketPath := path.Join(t.TempDir(), "events.sock")
+	listener, err := stream.listen(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	frame := buildFrame(t, net.ParseIP("10.1.2.3"), syscall.IPPROTO_TCP, 22, 0, 0)
+	hdr := BpfEventHdrSt{IfId: 2, RuleId: 1, Action: xdpDeny, PktLength: uint16(len(frame))}
+	for idx := 0; idx < recentEventsSize+10; idx++ {
+		stream.publish(NewRawEvent(time.Unix(int64(idx), 0), hdr, "eth0", frame).Decode())
+	}
+
+	var events []Event
+	if err := ReadEvents(socketPath, false, func(event Event) error {
+		events = append(events, event)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != recentEventsSize {
+		t.Fatalf("got %d recent events instead of %d", len(events), recentEventsSize)
+	}
+	if !events[0].Timestamp.Equal(time.Unix(10, 0)) || !events[len(events)-1].Timestamp.Equal(time.Unix(recentEventsSize+9, 0)) {
+		t.Fatalf("recent events are not the last events in order: first %s, last %s", events[0].Timestamp,
+			events[len(events)-1].Timestamp)
+	}
+	expected := Event{Timestamp: events[0].Timestamp, Interface: "eth0", RuleID: 1, Action: "Drop",
+		Length: uint16(len(frame)), Packet: "tcp 10.1.2.3:40000 -> 192.0.2.1:22"}
+	if events[0] != expected {
+		t.Fatalf("got event %+v instead of %+v", events[0], expected)
+	}
+
+	// A client that follows the events receives the new events after the recent ones.
+	errStop := errors.New("stop")
+	received := make(chan Event, 1)
+	done := make(chan error, 1)
+	go func() {
+		count := 0
+		done <- ReadEvents(socketPath, true, func(event Event) error {
+			if count++; count <= recentEventsSize {
+				return nil
+			}
+			received <- event
+			return errStop
+		})
+	}()
+	deadline := time.After(5 * time.Second)
+	for {
+		stream.publish(NewRawEvent(time.Unix(1000, 0), hdr, "eth1", frame).Decode())
+		select {
+		case event := <-received:
+			if event.Interface != "eth1" {
+				t.Fatalf("got event %+v instead of a new event", event)
+			}
+			if err := <-done; !errors.Is(err, errStop) {
+				t.Fatalf("ReadEvents returned %v", err)
+			}
+			return
+		case <-deadline:
+			t.Fatal("no new event received")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
@@ -10,12 +10,15 @@ import (
 	"path"
 	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/openshift/ingress-node-firewall/api/v1alpha1"
 	ingressnodefwiov1alpha1 "github.com/openshift/ingress-node-firewall/api/v1alpha1"
+	"github.com/openshift/ingress-node-firewall/pkg/failsaferules"
 	"github.com/openshift/ingress-node-firewall/pkg/interfaces"
 	"github.com/openshift/ingress-node-firewall/pkg/utils"
 
@@ -36,8 +39,38 @@ const (
 	xdpEBUSYErr                   = "device or resource busy"
 	debugLookup                   = "debug_lookup" // constant defined in kernel hook to enable lPM lookup
 	debugLookupEnvVar             = "ENABLE_EBPF_LPM_LOOKUP_DBG"
+	ruleInheritanceEnvVar         = "ENABLE_RULE_INHERITANCE"
+	allowEssentialICMPv6EnvVar    = "ALLOW_ESSENTIAL_ICMPV6"
+	maxTargetsEnvVar              = "MAX_TARGETS"
+	maxRulesPerTargetEnvVar       = "MAX_RULES_PER_TARGET"
+	maxRulesPerTargetConst        = "max_rules_per_target" // constant defined in kernel hook to bound the rules loop
+	blocklistFileEnvVar           = "BLOCKLIST_FILE"
+	eventSampleRate               = "event_sample_rate" // constant defined in kernel hook to sample events
+	eventSampleRateEnvVar         = "EVENT_SAMPLE_RATE"
+	eventRateLimit                = "event_rate_limit" // constant defined in kernel hook to limit events per second
+	maxEventsPerSecondEnvVar      = "MAX_EVENTS_PER_SECOND"
+	maxEventSampleRate            = 1 << 16
+	maxEventsPerSecondLimit       = 1000000
+	maxRulesPerTargetLimit        = 1024 // MAX_RULES_PER_TARGET_LIMIT in the kernel hook
+	tableMapName                  = "ingress_node_firewall_table_map"
+	rulesMapName                  = "ingress_node_firewall_rules_map"
+	classifierMapName             = "ingress_node_firewall_classifier_map"
+	statisticsMapName             = "ingress_node_firewall_statistics_map"
+	banMapName                    = "ingress_node_firewall_ban_map"
+	blocklistMapName              = "ingress_node_firewall_blocklist_map"
+	// statisticsMapEntries covers all rule IDs, which are 16-bit. The rule IDs of the priority tiers and of the fail
+	// safe rules go beyond the rules of a single target.
+	statisticsMapEntries = 1 << 16
+	// failSafeTCPPortsConst and failSafeUDPPortsConst are the constants defined in kernel hook that hold the fail safe
+	// ports, which banned sources can still reach. maxFailSafePorts is MAX_FAILSAFE_PORTS in the kernel hook.
+	failSafeTCPPortsConst = "failsafe_tcp_ports"
+	failSafeUDPPortsConst = "failsafe_udp_ports"
+	maxFailSafePorts      = 8
 )
 
+// ErrCapacityExceeded is returned when the rules do not fit into the eBPF maps.
+var ErrCapacityExceeded = errors.New("ingress node firewall capacity exceeded")
+
 // IngNodeFwController structure is the object hold controls for starting
 // ingress node firewall resource
 type IngNodeFwController struct {
@@ -47,10 +80,29 @@ type IngNodeFwController struct {
 	links map[string]link.Link
 	// eBPF pingPath
 	pinPath string
+	// ruleInheritance appends the rules of less specific CIDRs to the rules of more specific CIDRs.
+	ruleInheritance bool
+	// allowEssentialICMPv6 places the ICMPv6 fail safe rules ahead of the rules of IPv6 CIDRs.
+	allowEssentialICMPv6 bool
+	// maxTargets is the maximum number of keys in the eBPF table map.
+	maxTargets int
+	// maxRulesPerTarget is the maximum number of rules per key in the eBPF table map.
+	maxRulesPerTarget int
+	// blocklistFile is the plaintext list of the sources whose packets are dropped before the rules are evaluated.
+	blocklistFile string
+	// blocklistApplied is set once the blocklist file was applied to the blocklist map, blocklistModTime and
+	// blocklistSize are the modification time and size of the file at that time, or 0 and -1 if it did not exist.
+	blocklistApplied bool
+	blocklistModTime int64
+	blocklistSize    int64
+	// eventAggregationWindow is the window over which similar events are aggregated in syslog, 0 to log every event.
+	eventAggregationWindow time.Duration
+	// eventsReaderAlive is 1 while the reader of the perf events of the XDP program runs. It is accessed atomically.
+	eventsReaderAlive int32
 }
 
 // $BPF_CLANG and $BPF_CFLAGS are set by the Makefile.
-//go:generate bpf2go -cc $BPF_CLANG -cflags $BPF_CFLAGS -type ruleType_st -type event_hdr_st -type ruleStatistics_st Bpf ../../bpf/ingress_node_firewall_kernel.c -- -I ../../bpf/headers -I/usr/include/x86_64-linux-gnu/
+//go:generate bpf2go -cc $BPF_CLANG -cflags $BPF_CFLAGS -type ruleType_st -type event_hdr_st -type ruleStatistics_st -type autoBan_st Bpf ../../bpf/ingress_node_firewall_kernel.c -- -I ../../bpf/headers -I/usr/include/x86_64-linux-gnu/
 
 // NewIngNodeFwController creates new IngressNodeFirewall controller object.
 func NewIngNodeFwController() (*IngNodeFwController, error) {
@@ -59,16 +111,52 @@ func NewIngNodeFwController() (*IngNodeFwController, error) {
 		return nil, err
 	}
 
-	pinDir := path.Join(bpfFSPath, xdpIngressNodeFirewallProcess)
+	pinDir := DefaultPinPath
 	if err := os.MkdirAll(pinDir, os.ModePerm); err != nil {
 		return nil, fmt.Errorf("failed to create pinDir %s: %s", pinDir, err)
 	}
+	maxTargets, err := intFromEnv(maxTargetsEnvVar, v1alpha1.DefaultMaxTargets, 1<<16)
+	if err != nil {
+		return nil, err
+	}
+	maxRulesPerTarget, err := intFromEnv(maxRulesPerTargetEnvVar, v1alpha1.DefaultMaxRulesPerTarget, maxRulesPerTargetLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	eventAggregationWindow, err := eventAggregationWindowFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
 	// Load pre-compiled programs into the kernel.
 	objs := BpfObjects{}
 	spec, err := LoadBpf()
 	if err != nil {
 		return nil, fmt.Errorf("failed loading BPF data: %w", err)
 	}
+	if err := sizeMaps(spec, maxTargets, maxRulesPerTarget); err != nil {
+		return nil, err
+	}
+	sampleRate, err := intFromEnv(eventSampleRateEnvVar, 1, maxEventSampleRate)
+	if err != nil {
+		return nil, err
+	}
+	// Events are not rate limited unless the limit is set.
+	maxEventsPerSecond, err := intFromEnv(maxEventsPerSecondEnvVar, 0, maxEventsPerSecondLimit)
+	if err != nil {
+		return nil, err
+	}
+	if err := spec.RewriteConstants(map[string]interface{}{
+		maxRulesPerTargetConst: uint32(maxRulesPerTarget),
+		eventSampleRate:        uint32(sampleRate),
+		eventRateLimit:         uint32(maxEventsPerSecond),
+	}); err != nil {
+		return nil, fmt.Errorf("failed to rewrite BPF constants definition: %w", err)
+	}
+	if err := spec.RewriteConstants(failSafePortConstants()); err != nil {
+		return nil, fmt.Errorf("failed to rewrite BPF constants definition: %w", err)
+	}
 	debugLookupVal, ok := os.LookupEnv(debugLookupEnvVar)
 	if ok {
 		val, err := strconv.Atoi(debugLookupVal)
@@ -82,7 +170,17 @@ func NewIngNodeFwController() (*IngNodeFwController, error) {
 		}
 	}
 
-	if err := spec.LoadAndAssign(&objs, &ebpf.CollectionOptions{Maps: ebpf.MapOptions{PinPath: pinDir}}); err != nil {
+	err = spec.LoadAndAssign(&objs, &ebpf.CollectionOptions{Maps: ebpf.MapOptions{PinPath: pinDir}})
+	if errors.Is(err, ebpf.ErrMapIncompatible) {
+		// The pinned maps were created with a different capacity or layout. Replace them, the rules are
+		// programmed again on the next synchronization.
+		klog.Infof("Pinned maps are incompatible, recreating them: %v", err)
+		if err := removePinnedMaps(pinDir); err != nil {
+			return nil, err
+		}
+		err = spec.LoadAndAssign(&objs, &ebpf.CollectionOptions{Maps: ebpf.MapOptions{PinPath: pinDir}})
+	}
+	if err != nil {
 		var ve *ebpf.VerifierError
 		if errors.As(err, &ve) {
 			// Using %+v will print the whole verifier error, not just the last
@@ -92,9 +190,23 @@ func NewIngNodeFwController() (*IngNodeFwController, error) {
 		return nil, fmt.Errorf("loading objects: pinDir:%s, err:%s", pinDir, err)
 	}
 	infc := &IngNodeFwController{
-		objs:    objs,
-		pinPath: pinDir,
-		links:   make(map[string]link.Link, 0),
+		objs:                   objs,
+		pinPath:                pinDir,
+		links:                  make(map[string]link.Link, 0),
+		maxTargets:             maxTargets,
+		maxRulesPerTarget:      maxRulesPerTarget,
+		blocklistFile:          os.Getenv(blocklistFileEnvVar),
+		eventAggregationWindow: eventAggregationWindow,
+	}
+	if ruleInheritanceVal, ok := os.LookupEnv(ruleInheritanceEnvVar); ok && ruleInheritanceVal != "" {
+		if infc.ruleInheritance, err = strconv.ParseBool(ruleInheritanceVal); err != nil {
+			return nil, fmt.Errorf("failed to convert %q to boolean: %v", ruleInheritanceVal, err)
+		}
+	}
+	if allowEssentialICMPv6Val, ok := os.LookupEnv(allowEssentialICMPv6EnvVar); ok && allowEssentialICMPv6Val != "" {
+		if infc.allowEssentialICMPv6, err = strconv.ParseBool(allowEssentialICMPv6Val); err != nil {
+			return nil, fmt.Errorf("failed to convert %q to boolean: %v", allowEssentialICMPv6Val, err)
+		}
 	}
 	// Load pinned links from /sys/fs/bpf/xdp_ingress_node_firewall_process on initialization.
 	// That way, the state in /sys/fs/bpf/xdp_ingress_node_firewall_process and the tracked list of links
@@ -111,6 +223,39 @@ func NewIngNodeFwController() (*IngNodeFwController, error) {
 	return infc, nil
 }
 
+// failSafePortConstants returns the constants of the kernel hook that hold the fail safe TCP and UDP ports. Sources
+// that an autoBan rule banned can still reach these ports, which the rules cannot deny either.
+func failSafePortConstants() map[string]interface{} {
+	var tcpPorts, udpPorts [maxFailSafePorts]uint16
+	for i, rule := range failsaferules.GetTCP() {
+		tcpPorts[i] = rule.GetPort()
+	}
+	for i, rule := range failsaferules.GetUDP() {
+		udpPorts[i] = rule.GetPort()
+	}
+	return map[string]interface{}{failSafeTCPPortsConst: tcpPorts, failSafeUDPPortsConst: udpPorts}
+}
+
+// sizeMaps sizes the maps of spec for the configured capacity. The rules map holds the rules of all targets plus the
+// rules of one target that is being replaced, and so does the classifier map. Rule IDs are used as keys of the
+// statistics map, which holds all of them. It returns an error if the BPF objects do not contain one of the maps.
+func sizeMaps(spec *ebpf.CollectionSpec, maxTargets, maxRulesPerTarget int) error {
+	for _, name := range []string{tableMapName, rulesMapName, classifierMapName, statisticsMapName} {
+		if spec.Maps[name] == nil {
+			return fmt.Errorf("the BPF objects do not contain the %s map", name)
+		}
+	}
+	spec.Maps[tableMapName].MaxEntries = uint32(maxTargets)
+	spec.Maps[rulesMapName].MaxEntries = uint32((maxTargets + 1) * maxRulesPerTarget)
+	classifierEntries := (maxTargets + 1) * classifierEntriesPerTarget(maxRulesPerTarget)
+	if classifierEntries > maxClassifierEntries {
+		classifierEntries = maxClassifierEntries
+	}
+	spec.Maps[classifierMapName].MaxEntries = uint32(classifierEntries)
+	spec.Maps[statisticsMapName].MaxEntries = statisticsMapEntries
+	return nil
+}
+
 // IngressNodeFwRulesLoader adds/updates/deletes ingress node firewall rules to the eBPF LPM MAP in an idempotent way.
 // IngressNodeFwRulesLoader executes the following actions in order:
 // i)   Get eBPF objs to create/update eBPF maps and get map info.
@@ -118,6 +263,11 @@ func NewIngNodeFwController() (*IngNodeFwController, error) {
 //
 //	ifaceIngressRules).
 //
+//	If rule inheritance is enabled, the rules of less specific CIDRs are appended to the rules of more specific
+//	CIDRs on the same interface. If essential ICMPv6 is allowed, the ICMPv6 fail safe rules are placed ahead of
+//	the rules of IPv6 CIDRs. An error wrapping ErrCapacityExceeded is returned if the keys or rules do not
+//	fit into the eBPF maps.
+//
 // iii) Get stale keys (= keys inside the eBPF map but not inside the currently desired ruleset).
 // iv)  Purge all stale keys from the eBPF map.
 // v)   Add/update all keys. This is an idempotent action and non-existing keys are added whereas existing keys
@@ -137,34 +287,32 @@ func (infc *IngNodeFwController) IngressNodeFwRulesLoader(
 	klog.Infof("Ingress node firewall map Info: %+v with FD %s", info, infc.objs.BpfMaps.IngressNodeFirewallTableMap.String())
 
 	// Convert IngressNodeFirewallRules into data that can be written to the BPF map.
-	// Build a map of valid ebpfKeys pointing to the ebpfRules that should be associated to them.
-	ebpfKeyToRules := make(map[BpfLpmIpKeySt]BpfRulesValSt)
-	for interfaceName, ingressRules := range ifaceIngressRules {
+	ebpfKeyToRules, ebpfKeyToCIDR, err := infc.buildRules(ifaceIngressRules, func(interfaceName string) ([]uint32, error) {
 		if !interfaces.IsValidInterfaceNameAndState(interfaceName) {
 			klog.Infof("Fail to load ingress firewall rules invalid interface %s", interfaceName)
-			continue
+			return nil, nil
 		}
 		// Look up the network interface by name.
 		// Note: for bond interface we use the slaves interfaces indices instead of the bond interface index
-		ifIDs, err := interfaces.GetInterfaceIndices(interfaceName)
-		if err != nil {
-			return err
-		}
+		return interfaces.GetInterfaceIndices(interfaceName)
+	})
+	if err != nil {
+		return err
+	}
 
-		// Convert each provided ingressRule into a mapping of potentially multiple keys (one for each CIDR)
-		// pointing to a flattened rule that can be written to the BPF map.
-		for _, rule := range ingressRules {
-			for _, ifID := range ifIDs {
-				if ebpfKeys, ebpfRules, err := infc.makeIngressFwRulesMap(rule, ifID); err == nil {
-					for _, ebpfKey := range ebpfKeys {
-						ebpfKeyToRules[ebpfKey] = ebpfRules
-					}
-				} else {
-					return fmt.Errorf("failed to create map firewall rules: %v on if %d", err, ifID)
-				}
-			}
+	// The LPM lookup only returns the rules of the longest matching prefix. With rule inheritance, fold the rules of
+	// all less specific prefixes into each key so that broader rules still apply under more specific ones.
+	if infc.ruleInheritance {
+		ebpfKeyToRules = inheritRules(ebpfKeyToRules)
+	}
+	if infc.allowEssentialICMPv6 {
+		if ebpfKeyToRules, ebpfKeyToCIDR, err = addICMPv6FailSafeRules(ebpfKeyToRules, ebpfKeyToCIDR); err != nil {
+			return err
 		}
 	}
+	if err := infc.checkCapacity(ebpfKeyToRules, ebpfKeyToCIDR); err != nil {
+		return err
+	}
 
 	// Build a slice of desired keys - it's easier to iterate over this slice later.
 	var desiredKeys []BpfLpmIpKeySt
@@ -195,18 +343,194 @@ func (infc *IngNodeFwController) IngressNodeFwRulesLoader(
 
 // addOrUpdateRules is a small method containing this limited set of functionality to facilitate unit testing of
 // this part of code.
+// The rules of a key and their classifier entries are written under a rules ID that is not in use, then the key is
+// pointed to the new rules ID and the previous rules of the key are deleted. That way, the XDP program never sees a partially
+// written set of rules. Keys whose rules did not change are skipped.
 // FIXME: addOrUpdateRules seems to ignore interface indexes during the UpdateAny operation. Cf. the corresponding
 // unit test.
-func (infc *IngNodeFwController) addOrUpdateRules(ebpfKeyToRules map[BpfLpmIpKeySt]BpfRulesValSt) error {
+func (infc *IngNodeFwController) addOrUpdateRules(ebpfKeyToRules map[BpfLpmIpKeySt][]BpfRuleTypeSt) error {
+	tableEntries, err := infc.getTableEntries()
+	if err != nil {
+		return err
+	}
+	usedRulesIDs := make(map[uint32]struct{}, len(tableEntries))
+	for _, value := range tableEntries {
+		usedRulesIDs[value.RulesId] = struct{}{}
+	}
 	for ebpfKey, ebpfRules := range ebpfKeyToRules {
+		// A lookup in the LPM table map returns the longest prefix match, the entries of the table are used to find
+		// the exact key.
+		oldValue, exists := tableEntries[ebpfKey]
+		if exists {
+			if oldRules, err := infc.lookupRules(oldValue); err == nil && reflect.DeepEqual(oldRules, ebpfRules) {
+				continue
+			}
+		}
+
 		log.Printf("Adding or updating ingress firewall rules for key %v", ebpfKey)
-		if err := infc.objs.BpfMaps.IngressNodeFirewallTableMap.Update(ebpfKey, ebpfRules, ebpf.UpdateAny); err != nil {
+		value := BpfRulesValSt{RulesId: nextRulesID(usedRulesIDs), NumRules: uint32(len(ebpfRules))}
+		for idx, rule := range ebpfRules {
+			ruleKey := BpfRuleKeySt{RulesId: value.RulesId, Index: uint32(idx)}
+			if err := infc.objs.BpfMaps.IngressNodeFirewallRulesMap.Update(ruleKey, rule, ebpf.UpdateAny); err != nil {
+				_ = infc.deleteRules(value)
+				return fmt.Errorf("Failed Adding/Updating ingress firewall rules: %v", err)
+			}
+		}
+		for classKey, classValue := range compileClassifier(value.RulesId, ebpfRules) {
+			if err := infc.objs.BpfMaps.IngressNodeFirewallClassifierMap.Update(classKey, classValue, ebpf.UpdateAny); err != nil {
+				_ = infc.deleteRules(value)
+				return fmt.Errorf("Failed Adding/Updating ingress firewall rules classifier: %v", err)
+			}
+		}
+		if err := infc.objs.BpfMaps.IngressNodeFirewallTableMap.Update(ebpfKey, value, ebpf.UpdateAny); err != nil {
+			_ = infc.deleteRules(value)
 			return fmt.Errorf("Failed Adding/Updating ingress firewall rules: %v", err)
 		}
+		usedRulesIDs[value.RulesId] = struct{}{}
+		if exists {
+			if err := infc.deleteRules(oldValue); err != nil {
+				klog.Infof("Failed to delete replaced rules of key %v, err: %q", ebpfKey, err)
+			}
+			delete(usedRulesIDs, oldValue.RulesId)
+		}
 	}
 	return nil
 }
 
+// checkCapacity returns an error wrapping ErrCapacityExceeded if the provided keys or the rules of any key do not
+// fit into the eBPF maps. ebpfKeyToCIDR provides the CIDRs of the keys for the error message.
+func (infc *IngNodeFwController) checkCapacity(
+	ebpfKeyToRules map[BpfLpmIpKeySt][]BpfRuleTypeSt, ebpfKeyToCIDR map[BpfLpmIpKeySt]string) error {
+	if len(ebpfKeyToRules) > infc.maxTargets {
+		return fmt.Errorf("%w: %d source CIDR and interface combinations exceed the maximum of %d, "+
+			"note that every slave of a bond interface counts separately", ErrCapacityExceeded, len(ebpfKeyToRules), infc.maxTargets)
+	}
+	for key, rules := range ebpfKeyToRules {
+		if len(rules) > infc.maxRulesPerTarget {
+			return fmt.Errorf("%w: %d rules for sourceCIDR %s on interface index %d exceed the maximum of %d rules",
+				ErrCapacityExceeded, len(rules), ebpfKeyToCIDR[key], key.IngressIfindex, infc.maxRulesPerTarget)
+		}
+	}
+	return nil
+}
+
+// getTableEntries returns the entries of the eBPF table map.
+func (infc *IngNodeFwController) getTableEntries() (map[BpfLpmIpKeySt]BpfRulesValSt, error) {
+	entries := make(map[BpfLpmIpKeySt]BpfRulesValSt)
+	var key BpfLpmIpKeySt
+	var value BpfRulesValSt
+	iterator := infc.objs.BpfMaps.IngressNodeFirewallTableMap.Iterate()
+	for iterator.Next(&key, &value) {
+		entries[key] = value
+	}
+	if err := iterator.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// nextRulesID returns the lowest rules ID that is not in use.
+func nextRulesID(used map[uint32]struct{}) uint32 {
+	id := uint32(1)
+	for {
+		if _, ok := used[id]; !ok {
+			return id
+		}
+		id++
+	}
+}
+
+// lookupRules returns the rules that are referenced by the provided value of the eBPF table map.
+func (infc *IngNodeFwController) lookupRules(value BpfRulesValSt) ([]BpfRuleTypeSt, error) {
+	return lookupRules(infc.objs.BpfMaps.IngressNodeFirewallRulesMap, value)
+}
+
+// lookupRules returns the rules in rulesMap that are referenced by the provided value of the eBPF table map.
+func lookupRules(rulesMap *ebpf.Map, value BpfRulesValSt) ([]BpfRuleTypeSt, error) {
+	rules := make([]BpfRuleTypeSt, 0, value.NumRules)
+	for idx := uint32(0); idx < value.NumRules; idx++ {
+		var rule BpfRuleTypeSt
+		if err := rulesMap.Lookup(BpfRuleKeySt{RulesId: value.RulesId, Index: idx}, &rule); err != nil {
+			return nil, fmt.Errorf("failed to look up rule %d of rules ID %d: %w", idx, value.RulesId, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// deleteRules deletes the rules that are referenced by the provided value of the eBPF table map from the classifier
+// and rules maps.
+func (infc *IngNodeFwController) deleteRules(value BpfRulesValSt) error {
+	var errs []error
+	var classKeys []BpfClassKeySt
+	if rules, err := infc.lookupRules(value); err == nil {
+		for classKey := range compileClassifier(value.RulesId, rules) {
+			classKeys = append(classKeys, classKey)
+		}
+	} else {
+		// The rules were only written partially, find the classifier entries of the rules ID instead.
+		var classKey BpfClassKeySt
+		var classValue BpfClassValSt
+		iterator := infc.objs.BpfMaps.IngressNodeFirewallClassifierMap.Iterate()
+		for iterator.Next(&classKey, &classValue) {
+			if classKey.RulesId == value.RulesId {
+				classKeys = append(classKeys, classKey)
+			}
+		}
+		if err := iterator.Err(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, classKey := range classKeys {
+		err := infc.objs.BpfMaps.IngressNodeFirewallClassifierMap.Delete(classKey)
+		if err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	for idx := uint32(0); idx < value.NumRules; idx++ {
+		err := infc.objs.BpfMaps.IngressNodeFirewallRulesMap.Delete(BpfRuleKeySt{RulesId: value.RulesId, Index: idx})
+		if err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return apierrors.NewAggregate(errs)
+	}
+	return nil
+}
+
+// intFromEnv returns the value of the environment variable with the given name as an integer between 1 and max, or
+// defaultValue if the environment variable is not set.
+func intFromEnv(name string, defaultValue, max int) (int, error) {
+	strVal, ok := os.LookupEnv(name)
+	if !ok || strVal == "" {
+		return defaultValue, nil
+	}
+	val, err := strconv.Atoi(strVal)
+	if err != nil {
+		return 0, fmt.Errorf("failed to convert %s %q to integer: %v", name, strVal, err)
+	}
+	if val < 1 || val > max {
+		return 0, fmt.Errorf("%s %d must be between 1 and %d", name, val, max)
+	}
+	return val, nil
+}
+
+// GetBanMap returns the map of the sources that rules with autoBan banned.
+func (infc *IngNodeFwController) GetBanMap() *ebpf.Map {
+	return infc.objs.IngressNodeFirewallBanMap
+}
+
+// GetBlocklistMap returns the map of the blocklisted sources.
+func (infc *IngNodeFwController) GetBlocklistMap() *ebpf.Map {
+	return infc.objs.IngressNodeFirewallBlocklistMap
+}
+
+// GetSourceStatisticsMap returns the map of the packets that were denied from each source per interface.
+func (infc *IngNodeFwController) GetSourceStatisticsMap() *ebpf.Map {
+	return infc.objs.IngressNodeFirewallSourceStatisticsMap
+}
+
 // GetStatisticsMap returns the statistics map of the object.
 func (infc *IngNodeFwController) GetStatisticsMap() *ebpf.Map {
 	return infc.objs.IngressNodeFirewallStatisticsMap
@@ -263,6 +587,19 @@ func (infc *IngNodeFwController) IngressNodeFwAttach(ifacesName ...string) error
 	return nil
 }
 
+// XDPProgramID returns the ID of the XDP program of the firewall, which is attached to the managed interfaces.
+func (infc *IngNodeFwController) XDPProgramID() (uint32, error) {
+	info, err := infc.objs.IngressNodeFirewallProcess.Info()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get the info of the XDP program: %w", err)
+	}
+	id, ok := info.ID()
+	if !ok {
+		return 0, fmt.Errorf("the kernel does not report the ID of the XDP program")
+	}
+	return uint32(id), nil
+}
+
 // IngressNodeFwDetach detaches the eBPF program from the list of interfaces and cleans up the interfaces.
 // Additionally, it unloads all firewall rules that are associated to the interfaces.
 func (infc *IngNodeFwController) IngressNodeFwDetach(interfaceNames ...string) error {
@@ -283,16 +620,20 @@ func (infc *IngNodeFwController) IngressNodeFwDetach(interfaceNames ...string) e
 }
 
 // GetBPFMapContentForTest lists all existing keys and rules inside the map. Used for unit testing.
-func (infc *IngNodeFwController) GetBPFMapContentForTest() (map[BpfLpmIpKeySt]BpfRulesValSt, error) {
+func (infc *IngNodeFwController) GetBPFMapContentForTest() (map[BpfLpmIpKeySt][]BpfRuleTypeSt, error) {
 	objs := infc.objs
 
-	// Lookup all keys inside the map and find keys that are stale.
-	keysToRules := make(map[BpfLpmIpKeySt]BpfRulesValSt)
+	// Lookup all keys inside the map and their rules.
+	keysToRules := make(map[BpfLpmIpKeySt][]BpfRuleTypeSt)
 	var key BpfLpmIpKeySt
 	var value BpfRulesValSt
 	iterator := objs.BpfMaps.IngressNodeFirewallTableMap.Iterate()
 	for iterator.Next(&key, &value) {
-		keysToRules[key] = value
+		rules, err := infc.lookupRules(value)
+		if err != nil {
+			return nil, err
+		}
+		keysToRules[key] = rules
 	}
 	err := iterator.Err()
 	if err != nil {
@@ -367,17 +708,24 @@ func (infc *IngNodeFwController) removeAllPins() error {
 	return nil
 }
 
-// removeTableMap removes the ebpf table map.
+// removeTableMap removes the ebpf table map and the rules and classifier maps that it references.
 func (infc *IngNodeFwController) removeTableMap() error {
-	err := os.Remove(path.Join(infc.pinPath, "ingress_node_firewall_table_map"))
-	if err == nil || os.IsNotExist(err) {
-		return nil
+	return removePinnedMaps(infc.pinPath)
+}
+
+// removePinnedMaps removes the pinned ebpf table, rules, classifier, ban and blocklist maps from pinPath.
+func removePinnedMaps(pinPath string) error {
+	for _, mapName := range []string{tableMapName, rulesMapName, classifierMapName, banMapName, blocklistMapName} {
+		if err := os.Remove(path.Join(pinPath, mapName)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
 	}
-	return err
+	return nil
 }
 
 // loadPinnedLinks loads any pinned links that reside inside the /sys mount into memory if no such memory representation
-// exists yet.
+// exists yet. The links are updated to the XDP program that was just loaded, as they still hold the program of the
+// previous daemon.
 func (infc *IngNodeFwController) loadPinnedLinks() error {
 	klog.Info("Loading interfaces from pinned dir into memory")
 	files, err := ioutil.ReadDir(infc.pinPath)
@@ -398,6 +746,10 @@ func (infc *IngNodeFwController) loadPinnedLinks() error {
 				if err != nil {
 					return err
 				}
+				if err := l.Update(infc.objs.IngressNodeFirewallProcess); err != nil {
+					l.Close()
+					return fmt.Errorf("failed to update the XDP program of interface %s: %w", interfaceName, err)
+				}
 				infc.links[interfaceName] = l
 			}
 		}
@@ -423,19 +775,49 @@ func (infc *IngNodeFwController) cleanup(ifName string) error {
 	return nil
 }
 
+// buildRules builds a map of valid ebpfKeys pointing to the ebpfRules that should be associated to them from the
+// provided interface ingress rules. ifIndices returns the interface indices that the rules of an interface apply to,
+// interfaces without indices are skipped. The second map maps the ebpfKeys back to their CIDRs for error reporting.
+func (infc *IngNodeFwController) buildRules(ifaceIngressRules map[string][]v1alpha1.IngressNodeFirewallRules,
+	ifIndices func(interfaceName string) ([]uint32, error)) (map[BpfLpmIpKeySt][]BpfRuleTypeSt, map[BpfLpmIpKeySt]string, error) {
+	ebpfKeyToRules := make(map[BpfLpmIpKeySt][]BpfRuleTypeSt)
+	ebpfKeyToCIDR := make(map[BpfLpmIpKeySt]string)
+	for interfaceName, ingressRules := range ifaceIngressRules {
+		ifIDs, err := ifIndices(interfaceName)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// Convert each provided ingressRule into a mapping of potentially multiple keys (one for each CIDR)
+		// pointing to a flattened rule that can be written to the BPF map.
+		for _, rule := range ingressRules {
+			for _, ifID := range ifIDs {
+				if ebpfKeys, ebpfRules, err := infc.makeIngressFwRulesMap(rule, ifID); err == nil {
+					for idx, ebpfKey := range ebpfKeys {
+						ebpfKeyToRules[ebpfKey] = ebpfRules
+						ebpfKeyToCIDR[ebpfKey] = rule.SourceCIDRs[idx]
+					}
+				} else {
+					return nil, nil, fmt.Errorf("failed to create map firewall rules: %v on if %d", err, ifID)
+				}
+			}
+		}
+	}
+	return ebpfKeyToRules, ebpfKeyToCIDR, nil
+}
+
 // makeIngressFwRulesMap converts IngressNodeFirewallRules into eBPF format which matches what the
 // kernel hook will be using. It returns the valid keys and the rules associated to those keys, or an error in case
 // of issues. If multiple keys are returned then the rules must be attached to each of these keys.
 func (infc *IngNodeFwController) makeIngressFwRulesMap(
-	ingFirewallConfig ingressnodefwiov1alpha1.IngressNodeFirewallRules, ifID uint32) ([]BpfLpmIpKeySt, BpfRulesValSt, error) {
-	rules := BpfRulesValSt{}
+	ingFirewallConfig ingressnodefwiov1alpha1.IngressNodeFirewallRules, ifID uint32) ([]BpfLpmIpKeySt, []BpfRuleTypeSt, error) {
+	var rules []BpfRuleTypeSt
 	var keys []BpfLpmIpKeySt
 
 	// Parse firewall rules
 	for _, rule := range ingFirewallConfig.FirewallProtocolRules {
 		rule := rule
-		idx := rule.Order
-		rules.Rules[idx].RuleId = rule.Order
+		ebpfRule := BpfRuleTypeSt{RuleId: rule.Order}
 		switch rule.ProtocolConfig.Protocol {
 		case ingressnodefwiov1alpha1.ProtocolTypeTCP:
 			if utils.IsRange(rule.ProtocolConfig.TCP) {
@@ -444,18 +826,18 @@ func (infc *IngNodeFwController) makeIngressFwRulesMap(
 					return keys, rules, fmt.Errorf("invalid Port range %s for protocol %v",
 						rule.ProtocolConfig.TCP.Ports.String(), rule.ProtocolConfig.Protocol)
 				}
-				rules.Rules[idx].DstPortStart = start
-				rules.Rules[idx].DstPortEnd = end
+				ebpfRule.DstPortStart = start
+				ebpfRule.DstPortEnd = end
 			} else {
 				port, err := utils.GetPort(rule.ProtocolConfig.TCP)
 				if err != nil {
 					return keys, rules, fmt.Errorf("invalid Port %s for protocol %v",
 						rule.ProtocolConfig.TCP.Ports.String(), rule.ProtocolConfig.Protocol)
 				}
-				rules.Rules[idx].DstPortStart = port
-				rules.Rules[idx].DstPortEnd = 0
+				ebpfRule.DstPortStart = port
+				ebpfRule.DstPortEnd = 0
 			}
-			rules.Rules[idx].Protocol = syscall.IPPROTO_TCP
+			ebpfRule.Protocol = syscall.IPPROTO_TCP
 		case ingressnodefwiov1alpha1.ProtocolTypeUDP:
 			if utils.IsRange(rule.ProtocolConfig.UDP) {
 				start, end, err := utils.GetRange(rule.ProtocolConfig.UDP)
@@ -463,18 +845,18 @@ func (infc *IngNodeFwController) makeIngressFwRulesMap(
 					return keys, rules, fmt.Errorf("invalid Port range %s for protocol %v",
 						rule.ProtocolConfig.UDP.Ports.String(), rule.ProtocolConfig.Protocol)
 				}
-				rules.Rules[idx].DstPortStart = start
-				rules.Rules[idx].DstPortEnd = end
+				ebpfRule.DstPortStart = start
+				ebpfRule.DstPortEnd = end
 			} else {
 				port, err := utils.GetPort(rule.ProtocolConfig.UDP)
 				if err != nil {
 					return keys, rules, fmt.Errorf("invalid Port %s for protocol %v",
 						rule.ProtocolConfig.UDP.Ports.String(), rule.ProtocolConfig.Protocol)
 				}
-				rules.Rules[idx].DstPortStart = port
-				rules.Rules[idx].DstPortEnd = 0
+				ebpfRule.DstPortStart = port
+				ebpfRule.DstPortEnd = 0
 			}
-			rules.Rules[idx].Protocol = syscall.IPPROTO_UDP
+			ebpfRule.Protocol = syscall.IPPROTO_UDP
 		case ingressnodefwiov1alpha1.ProtocolTypeSCTP:
 			if utils.IsRange(rule.ProtocolConfig.SCTP) {
 				start, end, err := utils.GetRange(rule.ProtocolConfig.SCTP)
@@ -482,37 +864,51 @@ func (infc *IngNodeFwController) makeIngressFwRulesMap(
 					return keys, rules, fmt.Errorf("invalid Port range %s for protocol %v",
 						rule.ProtocolConfig.SCTP.Ports.String(), rule.ProtocolConfig.Protocol)
 				}
-				rules.Rules[idx].DstPortStart = start
-				rules.Rules[idx].DstPortEnd = end
+				ebpfRule.DstPortStart = start
+				ebpfRule.DstPortEnd = end
 			} else {
 				port, err := utils.GetPort(rule.ProtocolConfig.SCTP)
 				if err != nil {
 					return keys, rules, fmt.Errorf("invalid Port %s for protocol %v",
 						rule.ProtocolConfig.SCTP.Ports.String(), rule.ProtocolConfig.Protocol)
 				}
-				rules.Rules[idx].DstPortStart = port
-				rules.Rules[idx].DstPortEnd = 0
+				ebpfRule.DstPortStart = port
+				ebpfRule.DstPortEnd = 0
 			}
-			rules.Rules[idx].Protocol = syscall.IPPROTO_SCTP
+			ebpfRule.Protocol = syscall.IPPROTO_SCTP
 		case ingressnodefwiov1alpha1.ProtocolTypeICMP:
-			rules.Rules[idx].IcmpType = rule.ProtocolConfig.ICMP.ICMPType
-			rules.Rules[idx].IcmpCode = rule.ProtocolConfig.ICMP.ICMPCode
-			rules.Rules[idx].Protocol = syscall.IPPROTO_ICMP
+			setICMPRule(&ebpfRule, rule.ProtocolConfig.ICMP)
+			ebpfRule.Protocol = syscall.IPPROTO_ICMP
 		case ingressnodefwiov1alpha1.ProtocolTypeICMP6:
-			rules.Rules[idx].IcmpType = rule.ProtocolConfig.ICMPv6.ICMPType
-			rules.Rules[idx].IcmpCode = rule.ProtocolConfig.ICMPv6.ICMPCode
-			rules.Rules[idx].Protocol = syscall.IPPROTO_ICMPV6
-
+			setICMPRule(&ebpfRule, rule.ProtocolConfig.ICMPv6)
+			ebpfRule.Protocol = syscall.IPPROTO_ICMPV6
+		case ingressnodefwiov1alpha1.ProtocolTypeIPProtocol:
+			if rule.ProtocolConfig.IPProtocol == nil {
+				return keys, rules, fmt.Errorf("missing ipProtocol for protocol %v", rule.ProtocolConfig.Protocol)
+			}
+			ebpfRule.Protocol = *rule.ProtocolConfig.IPProtocol
 		}
 		switch rule.Action {
 		case ingressnodefwiov1alpha1.IngressNodeFirewallAllow:
-			rules.Rules[idx].Action = xdpAllow
+			ebpfRule.Action = xdpAllow
 		case ingressnodefwiov1alpha1.IngressNodeFirewallDeny:
-			rules.Rules[idx].Action = xdpDeny
+			ebpfRule.Action = xdpDeny
 		default:
 			return keys, rules, fmt.Errorf("Failed invalid action %v", rule.Action)
 		}
+		if rule.AutoBan != nil {
+			ebpfRule.AutoBan = BpfAutoBanSt{
+				Threshold: rule.AutoBan.Threshold,
+				Period:    uint32(rule.AutoBan.Period.Seconds()),
+				Duration:  uint32(rule.AutoBan.BanDuration.Seconds()),
+			}
+		}
+		rules = append(rules, ebpfRule)
 	}
+	// The rules are evaluated in the order in which they are stored.
+	sort.SliceStable(rules, func(i, j int) bool {
+		return rules[i].RuleId < rules[j].RuleId
+	})
 
 	// Parse CIDRs to construct map keys with shared rules.
 	for _, cidr := range ingFirewallConfig.SourceCIDRs {
@@ -526,6 +922,138 @@ func (infc *IngNodeFwController) makeIngressFwRulesMap(
 	return keys, rules, nil
 }
 
+// setICMPRule sets the ICMP types and code of the eBPF rule.
+func setICMPRule(ebpfRule *BpfRuleTypeSt, icmpRule *ingressnodefwiov1alpha1.IngressNodeFirewallICMPRule) {
+	ebpfRule.IcmpType = icmpRule.ICMPType
+	ebpfRule.IcmpTypeEnd = icmpRule.ICMPTypeEnd
+	ebpfRule.IcmpCode = icmpRule.ICMPCode
+	if icmpRule.ICMPAnyCode {
+		ebpfRule.IcmpAnyCode = 1
+	}
+}
+
+// inheritRules returns a copy of ebpfKeyToRules where the rules of each key are followed by the rules of all keys
+// with a less specific prefix that contains it on the same interface, from the most to the least specific prefix.
+// Inherited rules keep their rule ID so that statistics and events are accounted to the original rule.
+func inheritRules(ebpfKeyToRules map[BpfLpmIpKeySt][]BpfRuleTypeSt) map[BpfLpmIpKeySt][]BpfRuleTypeSt {
+	inherited := make(map[BpfLpmIpKeySt][]BpfRuleTypeSt, len(ebpfKeyToRules))
+	for key, rules := range ebpfKeyToRules {
+		var parents []BpfLpmIpKeySt
+		for candidate := range ebpfKeyToRules {
+			if candidate != key && keyContains(candidate, key) {
+				parents = append(parents, candidate)
+			}
+		}
+		sort.Slice(parents, func(i, j int) bool {
+			return parents[i].PrefixLen > parents[j].PrefixLen
+		})
+
+		// Inherited rules are placed behind the rules of the key itself.
+		rules = append([]BpfRuleTypeSt{}, rules...)
+		for _, parent := range parents {
+			rules = append(rules, ebpfKeyToRules[parent]...)
+		}
+		inherited[key] = rules
+	}
+	return inherited
+}
+
+// addICMPv6FailSafeRules returns copies of ebpfKeyToRules and ebpfKeyToCIDR where the ICMPv6 fail safe rules are
+// placed ahead of the rules of each IPv6 key that their source CIDR contains. If an IPv6 key contains the source CIDR
+// of a fail safe rule, a key for the source CIDR is added with the rules of the most specific of these keys, so that
+// the other packets from the source CIDR still match the rules that they matched before.
+func addICMPv6FailSafeRules(ebpfKeyToRules map[BpfLpmIpKeySt][]BpfRuleTypeSt,
+	ebpfKeyToCIDR map[BpfLpmIpKeySt]string) (map[BpfLpmIpKeySt][]BpfRuleTypeSt, map[BpfLpmIpKeySt]string, error) {
+	keyToRules := make(map[BpfLpmIpKeySt][]BpfRuleTypeSt, len(ebpfKeyToRules))
+	keyToCIDR := make(map[BpfLpmIpKeySt]string, len(ebpfKeyToCIDR))
+	var ipv6Keys []BpfLpmIpKeySt
+	ifIDs := make(map[uint32]struct{})
+	for key, rules := range ebpfKeyToRules {
+		keyToRules[key] = rules
+		keyToCIDR[key] = ebpfKeyToCIDR[key]
+		if isIPv6CIDR(ebpfKeyToCIDR[key]) {
+			ipv6Keys = append(ipv6Keys, key)
+			ifIDs[key.IngressIfindex] = struct{}{}
+		}
+	}
+
+	type failSafeKeyRule struct {
+		key  BpfLpmIpKeySt
+		cidr string
+		rule BpfRuleTypeSt
+	}
+	var failSafeKeyRules []failSafeKeyRule
+	for _, failSafeRule := range failsaferules.GetICMPv6() {
+		for ifID := range ifIDs {
+			key, err := BuildEBPFKey(ifID, failSafeRule.GetSourceCIDR())
+			if err != nil {
+				return nil, nil, err
+			}
+			failSafeKeyRules = append(failSafeKeyRules, failSafeKeyRule{key: key, cidr: failSafeRule.GetSourceCIDR(),
+				rule: BpfRuleTypeSt{
+					RuleId:      failSafeRule.GetRuleID(),
+					Protocol:    syscall.IPPROTO_ICMPV6,
+					IcmpType:    failSafeRule.GetICMPType(),
+					IcmpTypeEnd: failSafeRule.GetICMPTypeEnd(),
+					IcmpAnyCode: 1,
+					Action:      xdpAllow,
+				}})
+		}
+	}
+
+	// Add keys for the source CIDRs of the fail safe rules that are contained in IPv6 keys.
+	for _, failSafe := range failSafeKeyRules {
+		if _, ok := keyToRules[failSafe.key]; ok {
+			continue
+		}
+		var parent *BpfLpmIpKeySt
+		for idx, key := range ipv6Keys {
+			if keyContains(key, failSafe.key) && (parent == nil || key.PrefixLen > parent.PrefixLen) {
+				parent = &ipv6Keys[idx]
+			}
+		}
+		if parent != nil {
+			keyToRules[failSafe.key] = keyToRules[*parent]
+			keyToCIDR[failSafe.key] = failSafe.cidr
+			ipv6Keys = append(ipv6Keys, failSafe.key)
+		}
+	}
+
+	// Place the fail safe rules ahead of the rules of the IPv6 keys that their source CIDR contains.
+	for _, key := range ipv6Keys {
+		var rules []BpfRuleTypeSt
+		for _, failSafe := range failSafeKeyRules {
+			if failSafe.key == key || keyContains(failSafe.key, key) {
+				rules = append(rules, failSafe.rule)
+			}
+		}
+		keyToRules[key] = append(rules, keyToRules[key]...)
+	}
+	return keyToRules, keyToCIDR, nil
+}
+
+// isIPv6CIDR returns true if cidr is an IPv6 CIDR.
+func isIPv6CIDR(cidr string) bool {
+	ip, _, err := net.ParseCIDR(cidr)
+	return err == nil && ip.To4() == nil
+}
+
+// keyContains returns true if the prefix of key parent is less specific than the prefix of key child and contains
+// it, i.e. if the LPM lookup for an address of child would also match parent without child.
+func keyContains(parent, child BpfLpmIpKeySt) bool {
+	if parent.IngressIfindex != child.IngressIfindex || parent.PrefixLen >= child.PrefixLen {
+		return false
+	}
+	bits := int(parent.PrefixLen) - ifIndexKeyLength
+	for i := 0; i < bits; i++ {
+		mask := byte(0x80 >> (i % 8))
+		if parent.IpData[i/8]&mask != child.IpData[i/8]&mask {
+			return false
+		}
+	}
+	return true
+}
+
 // BuildEBPFKey builds a key object from an ifID and a cidr.
 func BuildEBPFKey(ifID uint32, cidr string) (BpfLpmIpKeySt, error) {
 	var key BpfLpmIpKeySt
@@ -628,8 +1156,8 @@ func (infc *IngNodeFwController) getStaleInterfaceKeys() ([]BpfLpmIpKeySt, error
 	return keysToDelete, nil
 }
 
-// purgeKeys purges the provided keys from the eBPF map. If a key deletion fails, the error is added to a list
-// of errors which will be returned at the end.
+// purgeKeys purges the provided keys and their rules from the eBPF maps. If a key deletion fails, the error is added
+// to a list of errors which will be returned at the end.
 func (infc *IngNodeFwController) purgeKeys(keys []BpfLpmIpKeySt) error {
 	var errors []error
 	objs := infc.objs
@@ -637,8 +1165,16 @@ func (infc *IngNodeFwController) purgeKeys(keys []BpfLpmIpKeySt) error {
 	// Delete all keys that should be deleted.
 	for _, keyToDelete := range keys {
 		klog.Infof("Purging key %v", keyToDelete)
-		err := objs.BpfMaps.IngressNodeFirewallTableMap.Delete(keyToDelete)
-		if err != nil {
+		var value BpfRulesValSt
+		if err := objs.BpfMaps.IngressNodeFirewallTableMap.Lookup(keyToDelete, &value); err != nil {
+			errors = append(errors, err)
+			continue
+		}
+		if err := objs.BpfMaps.IngressNodeFirewallTableMap.Delete(keyToDelete); err != nil {
+			errors = append(errors, err)
+			continue
+		}
+		if err := infc.deleteRules(value); err != nil {
 			errors = append(errors, err)
 		}
 	}
@@ -1,8 +1,12 @@
 package nodefwloader
 
 import (
+	"errors"
 	"os"
 	"os/user"
+	"reflect"
+	"strings"
+	"syscall"
 	"testing"
 )
 
@@ -18,55 +22,49 @@ func TestAddOrUpdateRules(t *testing.T) {
 	// Get eBPF keys for and rules for tc0.
 	key0a, _ := BuildEBPFKey(100, "10.0.0.0/8")
 	key0b, _ := BuildEBPFKey(100, "192.0.2.0/24")
-	rule0 := BpfRulesValSt{
-		Rules: [100]BpfRuleTypeSt{
-			{
-				RuleId: 10,
-				Action: 1,
-			},
+	rule0 := []BpfRuleTypeSt{
+		{
+			RuleId: 10,
+			Action: 1,
 		},
 	}
 	// Get eBPF keys for and rules for tc1.
 	key1a, _ := BuildEBPFKey(100, "10.0.0.0/8")
 	key1b, _ := BuildEBPFKey(100, "10.0.0.0/16")
-	rule1 := BpfRulesValSt{
-		Rules: [100]BpfRuleTypeSt{
-			{
-				RuleId: 10,
-				Action: 1,
-			},
+	rule1 := []BpfRuleTypeSt{
+		{
+			RuleId: 10,
+			Action: 1,
 		},
 	}
 	// Get eBPF keys for and rules for tc2.
 
 	key2a, _ := BuildEBPFKey(100, "10.0.0.0/8")
 	key2b, _ := BuildEBPFKey(101, "10.0.0.0/8")
-	rule2 := BpfRulesValSt{
-		Rules: [100]BpfRuleTypeSt{
-			{
-				RuleId: 10,
-				Action: 1,
-			},
+	rule2 := []BpfRuleTypeSt{
+		{
+			RuleId: 10,
+			Action: 1,
 		},
 	}
 
 	tcs := []struct {
-		inputRules map[BpfLpmIpKeySt]BpfRulesValSt
+		inputRules map[BpfLpmIpKeySt][]BpfRuleTypeSt
 	}{
 		{
-			inputRules: map[BpfLpmIpKeySt]BpfRulesValSt{
+			inputRules: map[BpfLpmIpKeySt][]BpfRuleTypeSt{
 				key0a: rule0,
 				key0b: rule0,
 			},
 		},
 		{
-			inputRules: map[BpfLpmIpKeySt]BpfRulesValSt{
+			inputRules: map[BpfLpmIpKeySt][]BpfRuleTypeSt{
 				key1a: rule1,
 				key1b: rule1,
 			},
 		},
 		{
-			inputRules: map[BpfLpmIpKeySt]BpfRulesValSt{
+			inputRules: map[BpfLpmIpKeySt][]BpfRuleTypeSt{
 				key2a: rule2,
 				key2b: rule2,
 			},
@@ -128,3 +126,139 @@ func cleanup(t *testing.T) {
 		t.Log(err)
 	}
 }
+
+func TestInheritRules(t *testing.T) {
+	parentKey, _ := BuildEBPFKey(100, "10.0.0.0/8")
+	childKey, _ := BuildEBPFKey(100, "10.1.0.0/16")
+	grandChildKey, _ := BuildEBPFKey(100, "10.1.1.0/24")
+	siblingKey, _ := BuildEBPFKey(100, "192.0.2.0/24")
+	otherIfaceKey, _ := BuildEBPFKey(200, "10.1.0.0/16")
+
+	denySSH := BpfRuleTypeSt{RuleId: 10, Protocol: syscall.IPPROTO_TCP, DstPortStart: 22, Action: xdpDeny}
+	allowHTTPS := BpfRuleTypeSt{RuleId: 10, Protocol: syscall.IPPROTO_TCP, DstPortStart: 443, Action: xdpAllow}
+	allowHTTP := BpfRuleTypeSt{RuleId: 5, Protocol: syscall.IPPROTO_TCP, DstPortStart: 80, Action: xdpAllow}
+
+	inherited := inheritRules(map[BpfLpmIpKeySt][]BpfRuleTypeSt{
+		parentKey:     {denySSH},
+		childKey:      {allowHTTPS},
+		grandChildKey: {allowHTTP},
+		siblingKey:    {allowHTTPS},
+		otherIfaceKey: {allowHTTPS},
+	})
+
+	expected := map[BpfLpmIpKeySt][]BpfRuleTypeSt{
+		parentKey:     {denySSH},
+		childKey:      {allowHTTPS, denySSH},
+		grandChildKey: {allowHTTP, allowHTTPS, denySSH},
+		siblingKey:    {allowHTTPS},
+		otherIfaceKey: {allowHTTPS},
+	}
+	if !reflect.DeepEqual(inherited, expected) {
+		t.Fatalf("inherited rules do not match, got: %v, expected: %v", inherited, expected)
+	}
+}
+
+func TestAddICMPv6FailSafeRules(t *testing.T) {
+	ipv4Key, _ := BuildEBPFKey(100, "10.0.0.0/8")
+	defaultKey, _ := BuildEBPFKey(100, "::/0")
+	globalKey, _ := BuildEBPFKey(100, "2001:db8::/32")
+	linkLocalHostKey, _ := BuildEBPFKey(100, "fe80::1/128")
+	linkLocalKey, _ := BuildEBPFKey(100, "fe80::/10")
+	otherIfaceKey, _ := BuildEBPFKey(200, "2001:db8::/32")
+	otherIfaceLinkLocalKey, _ := BuildEBPFKey(200, "fe80::/10")
+
+	denyAll := BpfRuleTypeSt{RuleId: 1, Action: xdpDeny}
+	allowHTTPS := BpfRuleTypeSt{RuleId: 10, Protocol: syscall.IPPROTO_TCP, DstPortStart: 443, Action: xdpAllow}
+	ndp := BpfRuleTypeSt{RuleId: 65534, Protocol: syscall.IPPROTO_ICMPV6, IcmpType: 133, IcmpTypeEnd: 137, IcmpAnyCode: 1,
+		Action: xdpAllow}
+	pmtud := BpfRuleTypeSt{RuleId: 65535, Protocol: syscall.IPPROTO_ICMPV6, IcmpType: 2, IcmpTypeEnd: 2, IcmpAnyCode: 1,
+		Action: xdpAllow}
+
+	keyToRules, keyToCIDR, err := addICMPv6FailSafeRules(map[BpfLpmIpKeySt][]BpfRuleTypeSt{
+		ipv4Key:          {denyAll},
+		defaultKey:       {denyAll},
+		globalKey:        {allowHTTPS},
+		linkLocalHostKey: {allowHTTPS},
+		otherIfaceKey:    {allowHTTPS},
+	}, map[BpfLpmIpKeySt]string{
+		ipv4Key:          "10.0.0.0/8",
+		defaultKey:       "::/0",
+		globalKey:        "2001:db8::/32",
+		linkLocalHostKey: "fe80::1/128",
+		otherIfaceKey:    "2001:db8::/32",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A link-local key is only added if a less specific key contains it.
+	expected := map[BpfLpmIpKeySt][]BpfRuleTypeSt{
+		ipv4Key:          {denyAll},
+		defaultKey:       {pmtud, denyAll},
+		globalKey:        {pmtud, allowHTTPS},
+		linkLocalHostKey: {ndp, pmtud, allowHTTPS},
+		linkLocalKey:     {ndp, pmtud, denyAll},
+		otherIfaceKey:    {pmtud, allowHTTPS},
+	}
+	if !reflect.DeepEqual(keyToRules, expected) {
+		t.Fatalf("rules do not match, got: %v, expected: %v", keyToRules, expected)
+	}
+	if keyToCIDR[linkLocalKey] != "fe80::/10" {
+		t.Fatalf("unexpected CIDR %q for the added link-local key", keyToCIDR[linkLocalKey])
+	}
+	if _, ok := keyToRules[otherIfaceLinkLocalKey]; ok {
+		t.Fatal("unexpected link-local key on the other interface")
+	}
+}
+
+func TestCheckCapacity(t *testing.T) {
+	key0, _ := BuildEBPFKey(100, "10.0.0.0/8")
+	key1, _ := BuildEBPFKey(100, "10.1.0.0/16")
+	key2, _ := BuildEBPFKey(101, "2001:db8::/32")
+	rules := []BpfRuleTypeSt{{RuleId: 1, Action: xdpDeny}, {RuleId: 2, Action: xdpAllow}}
+
+	tcs := []struct {
+		maxTargets        int
+		maxRulesPerTarget int
+		keysToRules       map[BpfLpmIpKeySt][]BpfRuleTypeSt
+		expectedErr       string
+	}{
+		{
+			maxTargets:        2,
+			maxRulesPerTarget: 2,
+			keysToRules:       map[BpfLpmIpKeySt][]BpfRuleTypeSt{key0: rules, key1: rules},
+		},
+		{
+			maxTargets:        2,
+			maxRulesPerTarget: 2,
+			keysToRules:       map[BpfLpmIpKeySt][]BpfRuleTypeSt{key0: rules, key1: rules, key2: rules},
+			expectedErr:       "3 source CIDR and interface combinations exceed the maximum of 2",
+		},
+		{
+			maxTargets:        2,
+			maxRulesPerTarget: 1,
+			keysToRules:       map[BpfLpmIpKeySt][]BpfRuleTypeSt{key0: rules},
+			expectedErr:       "2 rules for sourceCIDR 10.0.0.0/8 on interface index 100 exceed the maximum of 1 rules",
+		},
+		{
+			maxTargets:        2,
+			maxRulesPerTarget: 1,
+			keysToRules:       map[BpfLpmIpKeySt][]BpfRuleTypeSt{key2: rules},
+			expectedErr:       "2 rules for sourceCIDR 2001:db8::/32 on interface index 101 exceed the maximum of 1 rules",
+		},
+	}
+	for i, tc := range tcs {
+		infc := &IngNodeFwController{maxTargets: tc.maxTargets, maxRulesPerTarget: tc.maxRulesPerTarget}
+		keyToCIDR := map[BpfLpmIpKeySt]string{key0: "10.0.0.0/8", key1: "10.1.0.0/16", key2: "2001:db8::/32"}
+		err := infc.checkCapacity(tc.keysToRules, keyToCIDR)
+		if tc.expectedErr == "" {
+			if err != nil {
+				t.Fatalf("TestCheckCapacity(%d): unexpected error: %v", i, err)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrCapacityExceeded) || !strings.Contains(err.Error(), tc.expectedErr) {
+			t.Fatalf("TestCheckCapacity(%d): expected error containing %q, got: %v", i, tc.expectedErr, err)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package nodefwloader
+
+import (
+	"bytes"
+	"net"
+	"sort"
+
+	"github.com/cilium/ebpf"
+)
+
+// SourceStatistics is the number of packets and bytes that were denied from a source on an interface since the
+// XDP program was loaded.
+type SourceStatistics struct {
+	IfIndex uint32
+	Source  net.IP
+	Packets uint64
+	Bytes   uint64
+}
+
+// TopSources returns for each interface index the n sources with the most denied packets, ordered by the number of
+// denied packets. The source statistics map is a LRU map, sources from which no packets were denied for a long time
+// may have been evicted.
+func TopSources(sourceStatisticsMap *ebpf.Map, n int) (map[uint32][]SourceStatistics, error) {
+	var stats []SourceStatistics
+	var key BpfSourceStatisticsKeySt
+	var value BpfSourceStatisticsValSt
+	iterator := sourceStatisticsMap.Iterate()
+	for iterator.Next(&key, &value) {
+		source := net.IP(append([]byte(nil), key.IpData[:]...))
+		if ipv4 := source.To4(); ipv4 != nil {
+			source = ipv4
+		}
+		stats = append(stats, SourceStatistics{IfIndex: key.IfId, Source: source, Packets: value.Packets,
+			Bytes: value.Bytes})
+	}
+	if err := iterator.Err(); err != nil {
+		return nil, err
+	}
+	return topSources(stats, n), nil
+}
+
+// topSources groups stats by interface index and keeps the n sources with the most denied packets of each
+// interface. Ties are ordered by bytes and then by source address so that the result is stable.
+func topSources(stats []SourceStatistics, n int) map[uint32][]SourceStatistics {
+	top := make(map[uint32][]SourceStatistics)
+	for _, stat := range stats {
+		top[stat.IfIndex] = append(top[stat.IfIndex], stat)
+	}
+	for ifIndex, sources := range top {
+		sort.Slice(sources, func(i, j int) bool {
+			if sources[i].Packets != sources[j].Packets {
+				return sources[i].Packets > sources[j].Packets
+			}
+			if sources[i].Bytes != sources[j].Bytes {
+				return sources[i].Bytes > sources[j].Bytes
+			}
+			return bytes.Compare(sources[i].Source.To16(), sources[j].Source.To16()) < 0
+		})
+		if len(sources) > n {
+			top[ifIndex] = sources[:n]
+		}
+	}
+	return top
+}
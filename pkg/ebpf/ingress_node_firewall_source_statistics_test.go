@@ -0,0 +1,39 @@
+package nodefwloader
+
+import (
+	"net"
+	"testing"
+)
+
+func TestTopSources(t *testing.T) {
+	stat := func(ifIndex uint32, source string, packets, bytes uint64) SourceStatistics {
+		return SourceStatistics{IfIndex: ifIndex, Source: net.ParseIP(source), Packets: packets, Bytes: bytes}
+	}
+	stats := []SourceStatistics{
+		stat(2, "10.0.0.1", 5, 500),
+		stat(2, "10.0.0.2", 50, 5000),
+		stat(2, "10.0.0.3", 5, 700),
+		stat(2, "2001:db8::1", 20, 2000),
+		stat(3, "10.0.0.1", 1, 100),
+	}
+	top := topSources(stats, 3)
+	if len(top) != 2 {
+		t.Fatalf("expected the sources of 2 interfaces, got %+v", top)
+	}
+	var sources []string
+	for _, source := range top[2] {
+		sources = append(sources, source.Source.String())
+	}
+	expected := []string{"10.0.0.2", "2001:db8::1", "10.0.0.3"}
+	if len(sources) != len(expected) {
+		t.Fatalf("got top sources %v, expected %v", sources, expected)
+	}
+	for i := range expected {
+		if sources[i] != expected[i] {
+			t.Fatalf("got top sources %v, expected %v", sources, expected)
+		}
+	}
+	if len(top[3]) != 1 || top[3][0].Packets != 1 {
+		t.Fatalf("unexpected top sources of interface 3 %+v", top[3])
+	}
+}
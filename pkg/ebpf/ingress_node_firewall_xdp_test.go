@@ -0,0 +1,970 @@
+package nodefwloader
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"os/user"
+	"path"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/openshift/ingress-node-firewall/api/v1alpha1"
+	"github.com/openshift/ingress-node-firewall/pkg/explain"
+	"github.com/openshift/ingress-node-firewall/pkg/failsaferules"
+	"github.com/openshift/ingress-node-firewall/pkg/icmppresets"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/perf"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/vishvananda/netlink"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	// loopbackIfIndex is the interface index of packets that BPF_PROG_TEST_RUN runs XDP programs on without a
+	// context.
+	loopbackIfIndex = 1
+	// testMaxTargets is the number of targets that the maps of the tests are sized for.
+	testMaxTargets = 8
+)
+
+// loadTestObjects loads the eBPF objects without pinning them, with maps for maxRulesPerTarget rules per target.
+// linear selects the evaluation of the rules one by one instead of the classifier lookup. The test is skipped if it
+// does not run as root and fails if the eBPF objects are outdated.
+func loadTestObjects(tb testing.TB, maxRulesPerTarget int, linear bool) *BpfObjects {
+	linearLookupVal := uint32(0)
+	if linear {
+		linearLookupVal = 1
+	}
+	return loadTestObjectsWithConstants(tb, maxRulesPerTarget, map[string]interface{}{"linear_lookup": linearLookupVal})
+}
+
+// loadTestObjectsWithConstants is loadTestObjects with the provided constants of the kernel hook.
+func loadTestObjectsWithConstants(tb testing.TB, maxRulesPerTarget int, constants map[string]interface{}) *BpfObjects {
+	currentUser, err := user.Current()
+	if err != nil {
+		tb.Fatalf("Unable to get current user: %s", err)
+	}
+	if currentUser.Uid != "0" {
+		tb.Skipf("Skipping this test due to insufficient privileges")
+	}
+
+	spec, err := LoadBpf()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	for _, mapSpec := range spec.Maps {
+		mapSpec.Pinning = ebpf.PinNone
+	}
+	if err := sizeMaps(spec, testMaxTargets, maxRulesPerTarget); err != nil {
+		tb.Fatalf("%s, regenerate the BPF objects with make ebpf-generate", err)
+	}
+	if err := spec.RewriteConstants(map[string]interface{}{maxRulesPerTargetConst: uint32(maxRulesPerTarget)}); err != nil {
+		tb.Fatal(err)
+	}
+	if err := spec.RewriteConstants(failSafePortConstants()); err != nil {
+		tb.Fatal(err)
+	}
+	if err := spec.RewriteConstants(constants); err != nil {
+		tb.Fatal(err)
+	}
+	objs := &BpfObjects{}
+	if err := spec.LoadAndAssign(objs, nil); err != nil {
+		tb.Fatal(err)
+	}
+	return objs
+}
+
+// buildFrame returns an ethernet frame with an IPv4 or IPv6 packet from srcIP with the provided protocol. TCP, UDP
+// and SCTP packets are sent to dstPort, ICMP and ICMPv6 packets have the provided type and code.
+func buildFrame(tb testing.TB, srcIP net.IP, protocol uint8, dstPort uint16, icmpType, icmpCode uint8) []byte {
+	eth := &layers.Ethernet{
+		SrcMAC: net.HardwareAddr{0x02, 0, 0, 0, 0, 1},
+		DstMAC: net.HardwareAddr{0x02, 0, 0, 0, 0, 2},
+	}
+	var ip gopacket.NetworkLayer
+	var serializableIP gopacket.SerializableLayer
+	if srcIP.To4() != nil {
+		eth.EthernetType = layers.EthernetTypeIPv4
+		ipv4 := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocol(protocol), SrcIP: srcIP.To4(),
+			DstIP: net.ParseIP("192.0.2.1").To4()}
+		ip, serializableIP = ipv4, ipv4
+	} else {
+		eth.EthernetType = layers.EthernetTypeIPv6
+		ipv6 := &layers.IPv6{Version: 6, HopLimit: 64, NextHeader: layers.IPProtocol(protocol), SrcIP: srcIP,
+			DstIP: net.ParseIP("2001:db8::1")}
+		ip, serializableIP = ipv6, ipv6
+	}
+
+	var l4 gopacket.SerializableLayer
+	switch protocol {
+	case syscall.IPPROTO_TCP:
+		tcp := &layers.TCP{SrcPort: 40000, DstPort: layers.TCPPort(dstPort), SYN: true, Window: 1024}
+		if err := tcp.SetNetworkLayerForChecksum(ip); err != nil {
+			tb.Fatal(err)
+		}
+		l4 = tcp
+	case syscall.IPPROTO_UDP:
+		udp := &layers.UDP{SrcPort: 40000, DstPort: layers.UDPPort(dstPort)}
+		if err := udp.SetNetworkLayerForChecksum(ip); err != nil {
+			tb.Fatal(err)
+		}
+		l4 = udp
+	case syscall.IPPROTO_SCTP:
+		l4 = &layers.SCTP{SrcPort: 40000, DstPort: layers.SCTPPort(dstPort)}
+	case syscall.IPPROTO_ICMP:
+		l4 = &layers.ICMPv4{TypeCode: layers.CreateICMPv4TypeCode(icmpType, icmpCode)}
+	case syscall.IPPROTO_ICMPV6:
+		icmp6 := &layers.ICMPv6{TypeCode: layers.CreateICMPv6TypeCode(icmpType, icmpCode)}
+		if err := icmp6.SetNetworkLayerForChecksum(ip); err != nil {
+			tb.Fatal(err)
+		}
+		l4 = icmp6
+	default:
+		tb.Fatalf("unsupported protocol %d", protocol)
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	// The XDP program reads the fixed size ICMP header, which is longer than the ICMP layer.
+	payload := gopacket.Payload(make([]byte, 8))
+	if err := gopacket.SerializeLayers(buf, opts, eth, serializableIP, l4, payload); err != nil {
+		tb.Fatal(err)
+	}
+	// Pad the frame to the minimum ethernet frame size.
+	frame := buf.Bytes()
+	for len(frame) < 60 {
+		frame = append(frame, 0)
+	}
+	return frame
+}
+
+// ruleStatistics returns the statistics of a rule, summed over all CPUs.
+func ruleStatistics(tb testing.TB, objs *BpfObjects, ruleID uint32) BpfRuleStatisticsSt {
+	var perCPUStats []BpfRuleStatisticsSt
+	if err := objs.IngressNodeFirewallStatisticsMap.Lookup(ruleID, &perCPUStats); err != nil {
+		tb.Fatal(err)
+	}
+	var sum BpfRuleStatisticsSt
+	for _, stats := range perCPUStats {
+		sum.AllowStats.Packets += stats.AllowStats.Packets
+		sum.AllowStats.Bytes += stats.AllowStats.Bytes
+		sum.DenyStats.Packets += stats.DenyStats.Packets
+		sum.DenyStats.Bytes += stats.DenyStats.Bytes
+		sum.EventStats.SampledOut += stats.EventStats.SampledOut
+		sum.EventStats.RateLimited += stats.EventStats.RateLimited
+	}
+	return sum
+}
+
+// packets returns the number of packets that were accounted to a rule.
+func (s BpfRuleStatisticsSt) packets() uint64 {
+	return s.AllowStats.Packets + s.DenyStats.Packets
+}
+
+// TestExplainAgreesWithXDP checks that the offline evaluator returns the same verdict and rule as the XDP program for
+// random rules and packets.
+func TestExplainAgreesWithXDP(t *testing.T) {
+	cidrs := []string{"0.0.0.0/0", "10.0.0.0/8", "10.1.0.0/16", "10.1.2.0/24", "192.0.2.0/24", "::/0",
+		"2001:db8::/32", "2001:db8:1::/48", "fe80::/64"}
+	sourceIPs := []string{"10.1.2.3", "10.1.3.3", "10.2.0.1", "192.0.2.7", "172.16.0.1", "2001:db8:1::5",
+		"2001:db8:2::5", "fd00::1", "fe80::5", "fe80:1::5"}
+	icmpTypes := []uint8{0, 1, 2, 3, 135}
+	protocols := []v1alpha1.IngressNodeFirewallRuleProtocolType{v1alpha1.ProtocolTypeTCP, v1alpha1.ProtocolTypeUDP,
+		v1alpha1.ProtocolTypeSCTP, v1alpha1.ProtocolTypeICMP, v1alpha1.ProtocolTypeICMP6}
+	const maxRulesPerTarget = 64
+
+	r := rand.New(rand.NewSource(1))
+	randomRule := func(order uint32) v1alpha1.IngressNodeFirewallProtocolRule {
+		rule := v1alpha1.IngressNodeFirewallProtocolRule{Order: order, Action: v1alpha1.IngressNodeFirewallAllow}
+		if r.Intn(2) == 0 {
+			rule.Action = v1alpha1.IngressNodeFirewallDeny
+		}
+		rule.ProtocolConfig.Protocol = protocols[r.Intn(len(protocols))]
+		ports := &v1alpha1.IngressNodeFirewallProtoRule{Ports: intstr.FromString(fmt.Sprint(1 + r.Intn(8)))}
+		if r.Intn(2) == 0 {
+			start := 1 + r.Intn(8)
+			ports.Ports = intstr.FromString(fmt.Sprintf("%d-%d", start, start+1+r.Intn(4)))
+		}
+		icmp := &v1alpha1.IngressNodeFirewallICMPRule{ICMPType: uint8(r.Intn(2))}
+		if r.Intn(3) == 0 {
+			icmp.ICMPTypeEnd = icmp.ICMPType + uint8(r.Intn(3))
+		}
+		if r.Intn(3) != 0 {
+			icmp.ICMPCode = uint8(r.Intn(2))
+		} else {
+			icmp.ICMPAnyCode = true
+		}
+		switch rule.ProtocolConfig.Protocol {
+		case v1alpha1.ProtocolTypeTCP:
+			rule.ProtocolConfig.TCP = ports
+		case v1alpha1.ProtocolTypeUDP:
+			rule.ProtocolConfig.UDP = ports
+		case v1alpha1.ProtocolTypeSCTP:
+			rule.ProtocolConfig.SCTP = ports
+		case v1alpha1.ProtocolTypeICMP:
+			rule.ProtocolConfig.ICMP = icmp
+		case v1alpha1.ProtocolTypeICMP6:
+			rule.ProtocolConfig.ICMPv6 = icmp
+		}
+		return rule
+	}
+
+	for iteration := 0; iteration < 20; iteration++ {
+		var ingress []v1alpha1.IngressNodeFirewallRules
+		// The source CIDRs of the node state are distinct, note that 0.0.0.0/0 and ::/0 share the same key.
+		usedKeys := make(map[BpfLpmIpKeySt]struct{})
+		for idx := 0; idx < 1+r.Intn(4); idx++ {
+			rules := v1alpha1.IngressNodeFirewallRules{}
+			for cidrIdx := 0; cidrIdx < 1+r.Intn(2); cidrIdx++ {
+				cidr := cidrs[r.Intn(len(cidrs))]
+				key, err := BuildEBPFKey(loopbackIfIndex, cidr)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, ok := usedKeys[key]; ok {
+					continue
+				}
+				usedKeys[key] = struct{}{}
+				rules.SourceCIDRs = append(rules.SourceCIDRs, cidr)
+			}
+			if len(rules.SourceCIDRs) == 0 {
+				continue
+			}
+			for order := uint32(1); order <= uint32(1+r.Intn(6)); order++ {
+				rules.FirewallProtocolRules = append(rules.FirewallProtocolRules, randomRule(order*10))
+			}
+			ingress = append(ingress, rules)
+		}
+		spec := v1alpha1.IngressNodeFirewallNodeStateSpec{
+			InterfaceIngressRules: map[string][]v1alpha1.IngressNodeFirewallRules{"eth0": ingress},
+		}
+		ruleInheritance := r.Intn(2) == 0
+		allowEssentialICMPv6 := r.Intn(2) == 0
+		evaluator, err := explain.NewEvaluator(spec, explain.Options{RuleInheritance: ruleInheritance,
+			AllowEssentialICMPv6: allowEssentialICMPv6})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, linear := range []bool{true, false} {
+			func() {
+				objs := loadTestObjects(t, maxRulesPerTarget, linear)
+				defer objs.Close()
+				infc := &IngNodeFwController{objs: *objs, ruleInheritance: ruleInheritance, maxTargets: len(cidrs),
+					maxRulesPerTarget: maxRulesPerTarget}
+				ebpfKeyToRules, ebpfKeyToCIDR, err := infc.buildRules(spec.InterfaceIngressRules, func(string) ([]uint32, error) {
+					return []uint32{loopbackIfIndex}, nil
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if ruleInheritance {
+					ebpfKeyToRules = inheritRules(ebpfKeyToRules)
+				}
+				if allowEssentialICMPv6 {
+					if ebpfKeyToRules, _, err = addICMPv6FailSafeRules(ebpfKeyToRules, ebpfKeyToCIDR); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if err := infc.addOrUpdateRules(ebpfKeyToRules); err != nil {
+					t.Fatal(err)
+				}
+
+				for packetIdx := 0; packetIdx < 50; packetIdx++ {
+					packet := explain.Packet{
+						Interface: "eth0",
+						SourceIP:  net.ParseIP(sourceIPs[r.Intn(len(sourceIPs))]),
+						DstPort:   uint16(1 + r.Intn(12)),
+						ICMPType:  icmpTypes[r.Intn(len(icmpTypes))],
+						ICMPCode:  uint8(r.Intn(3)),
+					}
+					packet.Protocol, _ = explain.ParseProtocol(string(protocols[r.Intn(len(protocols))]))
+					result, err := evaluator.Explain(packet)
+					if err != nil {
+						t.Fatal(err)
+					}
+					// The fail safe rules are not accounted in the statistics.
+					_, failSafe := failsaferules.GetICMPv6ByRuleID(ruleOrder(result))
+					var before uint64
+					if result.Rule != nil && !failSafe {
+						before = ruleStatistics(t, objs, result.Rule.Order).packets()
+					}
+
+					frame := buildFrame(t, packet.SourceIP, packet.Protocol, packet.DstPort, packet.ICMPType, packet.ICMPCode)
+					ret, _, err := objs.IngressNodeFirewallProcess.Test(frame)
+					if err != nil {
+						t.Fatal(err)
+					}
+					expected := uint32(xdpAllow)
+					if result.Verdict == v1alpha1.IngressNodeFirewallDeny {
+						expected = xdpDeny
+					}
+					if ret != expected {
+						t.Fatalf("XDP program returned %d instead of %d for packet %+v (linear: %t), result: %+v, rules: %+v",
+							ret, expected, packet, linear, result, ingress)
+					}
+					if result.Rule != nil && !failSafe && ruleStatistics(t, objs, result.Rule.Order).packets() != before+1 {
+						t.Fatalf("XDP program did not match rule %d for packet %+v (linear: %t), rules: %+v",
+							result.Rule.Order, packet, linear, ingress)
+					}
+				}
+			}()
+		}
+	}
+}
+
+// ruleOrder returns the order of the rule that matches in result, or 0 if no rule matches.
+func ruleOrder(result explain.Result) uint32 {
+	if result.Rule == nil {
+		return 0
+	}
+	return result.Rule.Order
+}
+
+// xdpMd is the context of XDP programs, struct xdp_md in the kernel.
+type xdpMd struct {
+	Data           uint32
+	DataEnd        uint32
+	DataMeta       uint32
+	IngressIfindex uint32
+	RxQueueIndex   uint32
+	EgressIfindex  uint32
+}
+
+// xdpEvent is an event of the XDP program read from the events map.
+type xdpEvent struct {
+	header BpfEventHdrSt
+	packet []byte
+}
+
+// xdpHarness runs frames through the XDP program as if they were received on a test interface.
+type xdpHarness struct {
+	t      *testing.T
+	objs   *BpfObjects
+	link   netlink.Link
+	reader *perf.Reader
+}
+
+// newXDPHarness loads the eBPF objects, creates a veth interface named ifName and programs the rules of the
+// interface through the rules loader. The test is skipped if it does not run as root and fails if the eBPF objects
+// are outdated.
+func newXDPHarness(t *testing.T, ifName string, rules []v1alpha1.IngressNodeFirewallRules, linear bool) *xdpHarness {
+	linearLookupVal := uint32(0)
+	if linear {
+		linearLookupVal = 1
+	}
+	return newXDPHarnessWithConstants(t, ifName, rules, map[string]interface{}{"linear_lookup": linearLookupVal})
+}
+
+// newXDPHarnessWithConstants is newXDPHarness with the provided constants of the kernel hook.
+func newXDPHarnessWithConstants(t *testing.T, ifName string, rules []v1alpha1.IngressNodeFirewallRules,
+	constants map[string]interface{}) *xdpHarness {
+	const maxRulesPerTarget = 16
+	objs := loadTestObjectsWithConstants(t, maxRulesPerTarget, constants)
+	t.Cleanup(func() { objs.Close() })
+
+	if err := netlink.LinkAdd(&netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: ifName}, PeerName: ifName + "p"}); err != nil {
+		t.Fatalf("Unable to create interface %s: %s", ifName, err)
+	}
+	link, err := netlink.LinkByName(ifName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = netlink.LinkDel(link) })
+	if err := netlink.LinkSetUp(link); err != nil {
+		t.Fatal(err)
+	}
+
+	infc := &IngNodeFwController{objs: *objs, maxTargets: testMaxTargets, maxRulesPerTarget: maxRulesPerTarget}
+	if err := infc.IngressNodeFwRulesLoader(map[string][]v1alpha1.IngressNodeFirewallRules{ifName: rules}); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := perf.NewReader(objs.IngressNodeFirewallEventsMap, os.Getpagesize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { reader.Close() })
+	return &xdpHarness{t: t, objs: objs, link: link, reader: reader}
+}
+
+// run runs frame through the XDP program and returns the verdict.
+func (h *xdpHarness) run(frame []byte) uint32 {
+	ret, err := h.objs.IngressNodeFirewallProcess.Run(&ebpf.RunOptions{
+		Data:    frame,
+		Context: xdpMd{DataEnd: uint32(len(frame)), IngressIfindex: uint32(h.link.Attrs().Index)},
+	})
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	return ret
+}
+
+// readEvent returns the next event of the XDP program, or nil if there is none.
+func (h *xdpHarness) readEvent() *xdpEvent {
+	h.reader.SetDeadline(time.Now().Add(100 * time.Millisecond))
+	record, err := h.reader.Read()
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return nil
+	}
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	if record.LostSamples != 0 {
+		h.t.Fatalf("Lost %d events", record.LostSamples)
+	}
+	// Note position of the bytes in the sample depends on the layout of bpfEventHdrSt struct
+	sample := record.RawSample
+	eventHdrSize := int(unsafe.Sizeof(BpfEventHdrSt{}))
+	if len(sample) < eventHdrSize {
+		h.t.Fatalf("Event of %d bytes is shorter than the event header", len(sample))
+	}
+	event := &xdpEvent{header: BpfEventHdrSt{
+		IfId:      binary.LittleEndian.Uint16(sample[0:2]),
+		RuleId:    binary.LittleEndian.Uint16(sample[2:4]),
+		Action:    sample[4],
+		Flags:     sample[5],
+		PktLength: binary.LittleEndian.Uint16(sample[6:8]),
+	}}
+	event.packet = sample[eventHdrSize:]
+	return event
+}
+
+// TestXDPProgram programs rules through the rules loader, runs frames through the XDP program and checks the
+// verdicts, the statistics of the matching rules and the events.
+func TestXDPProgram(t *testing.T) {
+	protoRule := func(order uint32, action v1alpha1.IngressNodeFirewallActionType,
+		config v1alpha1.IngressNodeProtocolConfig) v1alpha1.IngressNodeFirewallProtocolRule {
+		return v1alpha1.IngressNodeFirewallProtocolRule{Order: order, Action: action, ProtocolConfig: config}
+	}
+	ports := func(ports string) *v1alpha1.IngressNodeFirewallProtoRule {
+		return &v1alpha1.IngressNodeFirewallProtoRule{Ports: intstr.FromString(ports)}
+	}
+	vrrp := uint8(112)
+	ndpRules, err := icmppresets.Rules(icmppresets.NDP, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pmtudRules, err := icmppresets.Rules(icmppresets.PMTUD, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	presetRules := append(ndpRules, pmtudRules...)
+	rules := []v1alpha1.IngressNodeFirewallRules{
+		{
+			SourceCIDRs: []string{"10.0.0.0/8", "2001:db8::/32"},
+			FirewallProtocolRules: []v1alpha1.IngressNodeFirewallProtocolRule{
+				protoRule(1, v1alpha1.IngressNodeFirewallDeny, v1alpha1.IngressNodeProtocolConfig{
+					Protocol: v1alpha1.ProtocolTypeTCP, TCP: ports("22")}),
+				protoRule(2, v1alpha1.IngressNodeFirewallDeny, v1alpha1.IngressNodeProtocolConfig{
+					Protocol: v1alpha1.ProtocolTypeUDP, UDP: ports("8000-9000")}),
+				protoRule(3, v1alpha1.IngressNodeFirewallDeny, v1alpha1.IngressNodeProtocolConfig{
+					Protocol: v1alpha1.ProtocolTypeICMP, ICMP: &v1alpha1.IngressNodeFirewallICMPRule{ICMPType: 8}}),
+				protoRule(4, v1alpha1.IngressNodeFirewallDeny, v1alpha1.IngressNodeProtocolConfig{
+					Protocol: v1alpha1.ProtocolTypeICMP6, ICMPv6: &v1alpha1.IngressNodeFirewallICMPRule{ICMPType: 128}}),
+				protoRule(5, v1alpha1.IngressNodeFirewallAllow, v1alpha1.IngressNodeProtocolConfig{
+					Protocol: v1alpha1.ProtocolTypeSCTP, SCTP: ports("5000")}),
+				protoRule(6, v1alpha1.IngressNodeFirewallAllow, v1alpha1.IngressNodeProtocolConfig{
+					Protocol: v1alpha1.ProtocolTypeTCP, TCP: ports("80")}),
+				protoRule(7, v1alpha1.IngressNodeFirewallDeny, v1alpha1.IngressNodeProtocolConfig{
+					Protocol: v1alpha1.ProtocolTypeIPProtocol, IPProtocol: &vrrp}),
+				protoRule(8, v1alpha1.IngressNodeFirewallDeny, v1alpha1.IngressNodeProtocolConfig{
+					Protocol: v1alpha1.ProtocolTypeICMP, ICMP: &v1alpha1.IngressNodeFirewallICMPRule{ICMPType: 11,
+						ICMPTypeEnd: 13, ICMPAnyCode: true}}),
+			},
+		},
+		{
+			SourceCIDRs:           []string{"fe80::/10"},
+			FirewallProtocolRules: append(presetRules, protoRule(100, v1alpha1.IngressNodeFirewallDeny, v1alpha1.IngressNodeProtocolConfig{})),
+		},
+		{
+			SourceCIDRs: []string{"192.0.2.0/24"},
+			FirewallProtocolRules: []v1alpha1.IngressNodeFirewallProtocolRule{
+				protoRule(1, v1alpha1.IngressNodeFirewallDeny, v1alpha1.IngressNodeProtocolConfig{}),
+			},
+		},
+	}
+
+	// truncate returns the first n bytes of frame.
+	truncate := func(frame []byte, n int) []byte {
+		return append([]byte(nil), frame[:n]...)
+	}
+	// withProtocol returns frame with the IPv4 protocol field replaced.
+	withProtocol := func(frame []byte, protocol uint8) []byte {
+		frame = append([]byte(nil), frame...)
+		frame[14+9] = protocol
+		return frame
+	}
+	// withNextHeader returns frame with the IPv6 next header field replaced.
+	withNextHeader := func(frame []byte, protocol uint8) []byte {
+		frame = append([]byte(nil), frame...)
+		frame[14+6] = protocol
+		return frame
+	}
+	arp := func() []byte {
+		buf := gopacket.NewSerializeBuffer()
+		eth := &layers.Ethernet{
+			SrcMAC:       net.HardwareAddr{0x02, 0, 0, 0, 0, 1},
+			DstMAC:       layers.EthernetBroadcast,
+			EthernetType: layers.EthernetTypeARP,
+		}
+		arp := &layers.ARP{AddrType: layers.LinkTypeEthernet, Protocol: layers.EthernetTypeIPv4, HwAddressSize: 6,
+			ProtAddressSize: 4, Operation: layers.ARPRequest, SourceHwAddress: eth.SrcMAC,
+			SourceProtAddress: net.ParseIP("10.0.0.1").To4(), DstHwAddress: make([]byte, 6),
+			DstProtAddress: net.ParseIP("10.0.0.2").To4()}
+		if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{}, eth, arp); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	v4 := net.ParseIP("10.1.2.3")
+	v6 := net.ParseIP("2001:db8::5")
+	linkLocal := net.ParseIP("fe80::5")
+	tcp4 := buildFrame(t, v4, syscall.IPPROTO_TCP, 22, 0, 0)
+	tcs := []struct {
+		name   string
+		frame  []byte
+		ret    uint32
+		ruleID uint32
+	}{
+		{name: "IPv4 TCP denied", frame: tcp4, ret: xdpDeny, ruleID: 1},
+		{name: "IPv6 TCP denied", frame: buildFrame(t, v6, syscall.IPPROTO_TCP, 22, 0, 0), ret: xdpDeny, ruleID: 1},
+		{name: "IPv4 TCP allowed", frame: buildFrame(t, v4, syscall.IPPROTO_TCP, 80, 0, 0), ret: xdpAllow, ruleID: 6},
+		{name: "IPv6 TCP allowed", frame: buildFrame(t, v6, syscall.IPPROTO_TCP, 80, 0, 0), ret: xdpAllow, ruleID: 6},
+		{name: "IPv4 TCP unmatched port", frame: buildFrame(t, v4, syscall.IPPROTO_TCP, 23, 0, 0), ret: xdpAllow},
+		{name: "IPv4 UDP range start", frame: buildFrame(t, v4, syscall.IPPROTO_UDP, 8000, 0, 0), ret: xdpDeny, ruleID: 2},
+		{name: "IPv6 UDP range end", frame: buildFrame(t, v6, syscall.IPPROTO_UDP, 8999, 0, 0), ret: xdpDeny, ruleID: 2},
+		{name: "IPv4 UDP past range", frame: buildFrame(t, v4, syscall.IPPROTO_UDP, 9000, 0, 0), ret: xdpAllow},
+		{name: "IPv4 UDP before range", frame: buildFrame(t, v4, syscall.IPPROTO_UDP, 7999, 0, 0), ret: xdpAllow},
+		{name: "ICMP echo request", frame: buildFrame(t, v4, syscall.IPPROTO_ICMP, 0, 8, 0), ret: xdpDeny, ruleID: 3},
+		{name: "ICMP echo reply", frame: buildFrame(t, v4, syscall.IPPROTO_ICMP, 0, 0, 0), ret: xdpAllow},
+		{name: "ICMPv6 echo request", frame: buildFrame(t, v6, syscall.IPPROTO_ICMPV6, 0, 128, 0), ret: xdpDeny, ruleID: 4},
+		{name: "ICMPv6 echo reply", frame: buildFrame(t, v6, syscall.IPPROTO_ICMPV6, 0, 129, 0), ret: xdpAllow},
+		{name: "SCTP allowed", frame: buildFrame(t, v4, syscall.IPPROTO_SCTP, 5000, 0, 0), ret: xdpAllow, ruleID: 5},
+		{name: "unmatched source", frame: buildFrame(t, net.ParseIP("172.16.0.1"), syscall.IPPROTO_TCP, 22, 0, 0),
+			ret: xdpAllow},
+		{name: "catch-all rule", frame: buildFrame(t, net.ParseIP("192.0.2.5"), syscall.IPPROTO_UDP, 53, 0, 0),
+			ret: xdpDeny, ruleID: 1},
+		{name: "truncated IPv4 header", frame: truncate(tcp4, 14+10), ret: xdpAllow},
+		{name: "truncated TCP header", frame: truncate(tcp4, 14+20+10), ret: xdpAllow},
+		{name: "ethernet header only", frame: truncate(tcp4, 14), ret: xdpAllow},
+		{name: "ARP", frame: arp(), ret: xdpAllow},
+		{name: "ICMP type range start with any code", frame: buildFrame(t, v4, syscall.IPPROTO_ICMP, 0, 11, 1), ret: xdpDeny,
+			ruleID: 8},
+		{name: "ICMP type range end", frame: buildFrame(t, v4, syscall.IPPROTO_ICMP, 0, 13, 0), ret: xdpDeny, ruleID: 8},
+		{name: "ICMP past type range", frame: buildFrame(t, v4, syscall.IPPROTO_ICMP, 0, 14, 0), ret: xdpAllow},
+		{name: "NDP neighbor solicitation", frame: buildFrame(t, linkLocal, syscall.IPPROTO_ICMPV6, 0, 135, 0),
+			ret: xdpAllow, ruleID: 10},
+		{name: "NDP redirect", frame: buildFrame(t, linkLocal, syscall.IPPROTO_ICMPV6, 0, 137, 0), ret: xdpDeny,
+			ruleID: 100},
+		{name: "PMTUD packet too big", frame: buildFrame(t, linkLocal, syscall.IPPROTO_ICMPV6, 0, 2, 0), ret: xdpAllow,
+			ruleID: 20},
+		{name: "PMTUD destination unreachable", frame: buildFrame(t, linkLocal, syscall.IPPROTO_ICMPV6, 0, 1, 4),
+			ret: xdpDeny, ruleID: 100},
+		{name: "IPv4 IP protocol denied", frame: withProtocol(tcp4, vrrp), ret: xdpDeny, ruleID: 7},
+		{name: "IPv6 IP protocol denied", frame: withNextHeader(buildFrame(t, v6, syscall.IPPROTO_TCP, 22, 0, 0), vrrp),
+			ret: xdpDeny, ruleID: 7},
+		{name: "IPv4 unmatched IP protocol", frame: withProtocol(tcp4, syscall.IPPROTO_GRE), ret: xdpAllow},
+		{name: "other protocol matches catch-all rule", frame: withProtocol(buildFrame(t, net.ParseIP("192.0.2.5"),
+			syscall.IPPROTO_UDP, 53, 0, 0), syscall.IPPROTO_GRE), ret: xdpDeny, ruleID: 1},
+	}
+
+	for _, linear := range []bool{true, false} {
+		name := "classifier"
+		if linear {
+			name = "linear"
+		}
+		t.Run(name, func(t *testing.T) {
+			h := newXDPHarness(t, "infwtest0", rules, linear)
+			for _, tc := range tcs {
+				var before BpfRuleStatisticsSt
+				if tc.ruleID != invalidRuleID {
+					before = ruleStatistics(t, h.objs, tc.ruleID)
+				}
+
+				if ret := h.run(tc.frame); ret != tc.ret {
+					t.Fatalf("%s: XDP program returned %d instead of %d", tc.name, ret, tc.ret)
+				}
+
+				if tc.ruleID != invalidRuleID {
+					after := ruleStatistics(t, h.objs, tc.ruleID)
+					allow, deny := after.AllowStats.Packets-before.AllowStats.Packets,
+						after.DenyStats.Packets-before.DenyStats.Packets
+					if (tc.ret == xdpAllow && (allow != 1 || deny != 0)) || (tc.ret == xdpDeny && (allow != 0 || deny != 1)) {
+						t.Fatalf("%s: rule %d counted %d allowed and %d denied packets", tc.name, tc.ruleID, allow, deny)
+					}
+				}
+
+				event := h.readEvent()
+				if tc.ret == xdpAllow || tc.ruleID == invalidRuleID {
+					if event != nil {
+						t.Fatalf("%s: unexpected event %+v", tc.name, event.header)
+					}
+					continue
+				}
+				if event == nil {
+					t.Fatalf("%s: no event", tc.name)
+				}
+				expected := BpfEventHdrSt{IfId: uint16(h.link.Attrs().Index), RuleId: uint16(tc.ruleID),
+					Action: xdpDeny, PktLength: uint16(len(tc.frame))}
+				if event.header != expected {
+					t.Fatalf("%s: got event %+v instead of %+v", tc.name, event.header, expected)
+				}
+				if len(event.packet) < len(tc.frame) || !bytes.Equal(event.packet[:len(tc.frame)], tc.frame) {
+					t.Fatalf("%s: event does not hold the packet", tc.name)
+				}
+			}
+		})
+	}
+}
+
+// TestXDPAutoBan checks that a source is banned once a rule with autoBan denied threshold packets from it, and that
+// all packets of a banned source are then dropped on behalf of that rule, except those to the fail safe ports.
+func TestXDPAutoBan(t *testing.T) {
+	rules := []v1alpha1.IngressNodeFirewallRules{
+		{
+			SourceCIDRs: []string{"10.0.0.0/8", "2001:db8::/32"},
+			FirewallProtocolRules: []v1alpha1.IngressNodeFirewallProtocolRule{
+				{
+					Order:  1,
+					Action: v1alpha1.IngressNodeFirewallDeny,
+					ProtocolConfig: v1alpha1.IngressNodeProtocolConfig{Protocol: v1alpha1.ProtocolTypeTCP,
+						TCP: &v1alpha1.IngressNodeFirewallProtoRule{Ports: intstr.FromInt(23)}},
+					AutoBan: &v1alpha1.IngressNodeFirewallAutoBan{
+						Threshold:   3,
+						Period:      metav1.Duration{Duration: time.Minute},
+						BanDuration: metav1.Duration{Duration: time.Hour},
+					},
+				},
+				{
+					Order:  2,
+					Action: v1alpha1.IngressNodeFirewallAllow,
+					ProtocolConfig: v1alpha1.IngressNodeProtocolConfig{Protocol: v1alpha1.ProtocolTypeTCP,
+						TCP: &v1alpha1.IngressNodeFirewallProtoRule{Ports: intstr.FromInt(80)}},
+				},
+			},
+		},
+	}
+
+	for _, linear := range []bool{true, false} {
+		name := "classifier"
+		if linear {
+			name = "linear"
+		}
+		t.Run(name, func(t *testing.T) {
+			h := newXDPHarness(t, "infwtest0", rules, linear)
+			for _, src := range []net.IP{net.ParseIP("10.1.2.3"), net.ParseIP("2001:db8::5")} {
+				expectEvent := func(flags uint8) {
+					event := h.readEvent()
+					if event == nil {
+						t.Fatalf("%s: no event", src)
+					}
+					if event.header.RuleId != 1 || event.header.Flags != flags {
+						t.Fatalf("%s: got event %+v, expected rule 1 with flags %d", src, event.header, flags)
+					}
+				}
+				allowed := buildFrame(t, src, syscall.IPPROTO_TCP, 80, 0, 0)
+				if ret := h.run(allowed); ret != xdpAllow {
+					t.Fatalf("%s: XDP program returned %d before the ban", src, ret)
+				}
+
+				denied := buildFrame(t, src, syscall.IPPROTO_TCP, 23, 0, 0)
+				for i := 1; i <= 3; i++ {
+					if ret := h.run(denied); ret != xdpDeny {
+						t.Fatalf("%s: XDP program returned %d for denied packet %d", src, ret, i)
+					}
+					if i < 3 {
+						expectEvent(0)
+					} else {
+						expectEvent(eventFlagBanStarted)
+					}
+				}
+
+				before := ruleStatistics(t, h.objs, 1)
+				if ret := h.run(allowed); ret != xdpDeny {
+					t.Fatalf("%s: XDP program returned %d for a banned source", src, ret)
+				}
+				expectEvent(eventFlagSourceBanned)
+				if after := ruleStatistics(t, h.objs, 1); after.DenyStats.Packets != before.DenyStats.Packets+1 {
+					t.Fatalf("%s: rule 1 did not count the packet of the banned source", src)
+				}
+				// The banned source can still reach the fail safe ports, such as the Kubernetes API, SSH and DHCP.
+				for _, failSafe := range []struct {
+					protocol uint8
+					port     uint16
+				}{{syscall.IPPROTO_TCP, 6443}, {syscall.IPPROTO_TCP, 22}, {syscall.IPPROTO_UDP, 68}} {
+					if ret := h.run(buildFrame(t, src, failSafe.protocol, failSafe.port, 0, 0)); ret != xdpAllow {
+						t.Fatalf("%s: XDP program returned %d for fail safe port %d of a banned source", src, ret,
+							failSafe.port)
+					}
+				}
+
+				bans, err := ActiveBans(h.objs.IngressNodeFirewallBanMap)
+				if err != nil {
+					t.Fatal(err)
+				}
+				found := false
+				for _, ban := range bans {
+					if ban.Source.Equal(src) && ban.RuleID == 1 && ban.Remaining > 59*time.Minute {
+						found = true
+					}
+				}
+				if !found {
+					t.Fatalf("%s: not in the active bans %+v", src, bans)
+				}
+			}
+
+			// Other sources are not affected.
+			if ret := h.run(buildFrame(t, net.ParseIP("10.9.9.9"), syscall.IPPROTO_TCP, 80, 0, 0)); ret != xdpAllow {
+				t.Fatalf("XDP program returned %d for a source that is not banned", ret)
+			}
+		})
+	}
+}
+
+// TestXDPBlocklist checks that packets of blocklisted sources are dropped before the rules are evaluated, and that
+// changes of the blocklist file are applied to the blocklist map.
+func TestXDPBlocklist(t *testing.T) {
+	rules := []v1alpha1.IngressNodeFirewallRules{
+		{
+			SourceCIDRs: []string{"10.0.0.0/8", "2001:db8::/32"},
+			FirewallProtocolRules: []v1alpha1.IngressNodeFirewallProtocolRule{
+				{
+					Order:  1,
+					Action: v1alpha1.IngressNodeFirewallAllow,
+					ProtocolConfig: v1alpha1.IngressNodeProtocolConfig{Protocol: v1alpha1.ProtocolTypeTCP,
+						TCP: &v1alpha1.IngressNodeFirewallProtoRule{Ports: intstr.FromInt(80)}},
+				},
+			},
+		},
+	}
+	h := newXDPHarness(t, "infwtest0", rules, false)
+	blocklistFile := path.Join(t.TempDir(), "blocklist")
+	infc := &IngNodeFwController{objs: *h.objs, blocklistFile: blocklistFile}
+	writeBlocklist := func(list string) {
+		if err := os.WriteFile(blocklistFile, []byte(list), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := infc.LoadBlocklist(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeBlocklist("10.66.0.0/16\n2001:db8:bad::/48\n")
+	tcs := []struct {
+		src         string
+		blocklisted bool
+	}{
+		{src: "10.66.1.2", blocklisted: true},
+		{src: "10.67.1.2"},
+		{src: "2001:db8:bad::5", blocklisted: true},
+		{src: "2001:db8::5"},
+	}
+	for _, tc := range tcs {
+		frame := buildFrame(t, net.ParseIP(tc.src), syscall.IPPROTO_TCP, 80, 0, 0)
+		before := ruleStatistics(t, h.objs, invalidRuleID)
+		ret := h.run(frame)
+		if !tc.blocklisted {
+			if ret != xdpAllow {
+				t.Fatalf("%s: XDP program returned %d instead of allowing the packet", tc.src, ret)
+			}
+			continue
+		}
+		if ret != xdpDeny {
+			t.Fatalf("%s: XDP program returned %d for a blocklisted source", tc.src, ret)
+		}
+		if after := ruleStatistics(t, h.objs, invalidRuleID); after.DenyStats.Packets != before.DenyStats.Packets+1 {
+			t.Fatalf("%s: the packet was not counted in the blocklist statistics", tc.src)
+		}
+		event := h.readEvent()
+		if event == nil || event.header.RuleId != invalidRuleID || event.header.Flags != eventFlagBlocklisted {
+			t.Fatalf("%s: expected a blocklist event, got %+v", tc.src, event)
+		}
+	}
+
+	// Only the removed entry is deleted from the map.
+	writeBlocklist("# 10.66.0.0/16 is no longer listed\n2001:db8:bad::/48\n")
+	if ret := h.run(buildFrame(t, net.ParseIP("10.66.1.2"), syscall.IPPROTO_TCP, 80, 0, 0)); ret != xdpAllow {
+		t.Fatalf("XDP program returned %d for a source that was removed from the blocklist", ret)
+	}
+	entries, err := blocklistEntries(h.objs.IngressNodeFirewallBlocklistMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || blocklistCIDR(entries[0]).String() != "2001:db8:bad::/48" {
+		t.Fatalf("unexpected blocklist entries %v", entries)
+	}
+
+	// The blocklist is emptied when its file is removed.
+	if err := os.Remove(blocklistFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := infc.LoadBlocklist(); err != nil {
+		t.Fatal(err)
+	}
+	if entries, err := blocklistEntries(h.objs.IngressNodeFirewallBlocklistMap); err != nil || len(entries) != 0 {
+		t.Fatalf("got blocklist entries %v, err %v after removing the file", entries, err)
+	}
+}
+
+// TestXDPTopSources checks that denied packets are counted per source and interface, and that allowed packets are not.
+func TestXDPTopSources(t *testing.T) {
+	rules := []v1alpha1.IngressNodeFirewallRules{
+		{
+			SourceCIDRs: []string{"10.0.0.0/8", "2001:db8::/32"},
+			FirewallProtocolRules: []v1alpha1.IngressNodeFirewallProtocolRule{
+				{
+					Order:  1,
+					Action: v1alpha1.IngressNodeFirewallAllow,
+					ProtocolConfig: v1alpha1.IngressNodeProtocolConfig{Protocol: v1alpha1.ProtocolTypeTCP,
+						TCP: &v1alpha1.IngressNodeFirewallProtoRule{Ports: intstr.FromInt(80)}},
+				},
+				{
+					Order:  2,
+					Action: v1alpha1.IngressNodeFirewallDeny,
+					ProtocolConfig: v1alpha1.IngressNodeProtocolConfig{Protocol: v1alpha1.ProtocolTypeTCP,
+						TCP: &v1alpha1.IngressNodeFirewallProtoRule{Ports: intstr.FromInt(2222)}},
+				},
+			},
+		},
+	}
+	h := newXDPHarness(t, "infwtest0", rules, false)
+
+	send := func(src string, dstPort uint16, count int) {
+		for i := 0; i < count; i++ {
+			h.run(buildFrame(t, net.ParseIP(src), syscall.IPPROTO_TCP, dstPort, 0, 0))
+		}
+	}
+	send("10.1.1.1", 2222, 3)
+	send("10.2.2.2", 2222, 1)
+	send("2001:db8::7", 2222, 2)
+	send("10.3.3.3", 80, 5)
+
+	top, err := TopSources(h.objs.IngressNodeFirewallSourceStatisticsMap, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources := top[uint32(h.link.Attrs().Index)]
+	if len(top) != 1 || len(sources) != 2 {
+		t.Fatalf("expected the top 2 sources of one interface, got %+v", top)
+	}
+	if !sources[0].Source.Equal(net.ParseIP("10.1.1.1")) || sources[0].Packets != 3 ||
+		!sources[1].Source.Equal(net.ParseIP("2001:db8::7")) || sources[1].Packets != 2 {
+		t.Fatalf("unexpected top sources %+v", sources)
+	}
+	if sources[0].Bytes == 0 || sources[0].Bytes%3 != 0 {
+		t.Fatalf("unexpected number of denied bytes %d for 3 packets of the same size", sources[0].Bytes)
+	}
+}
+
+// TestXDPTieredRuleStatistics checks that the packets of rules of a priority tier above the lowest, whose rule IDs
+// start at a multiple of 1024, and of the fail safe rules are counted in the statistics of their rule.
+func TestXDPTieredRuleStatistics(t *testing.T) {
+	const tieredRuleID = 3*1024 + 5
+	rules := []v1alpha1.IngressNodeFirewallRules{
+		{
+			SourceCIDRs: []string{"10.0.0.0/8"},
+			FirewallProtocolRules: []v1alpha1.IngressNodeFirewallProtocolRule{
+				{
+					Order:  1,
+					Action: v1alpha1.IngressNodeFirewallAllow,
+					ProtocolConfig: v1alpha1.IngressNodeProtocolConfig{Protocol: v1alpha1.ProtocolTypeTCP,
+						TCP: &v1alpha1.IngressNodeFirewallProtoRule{Ports: intstr.FromInt(80)}},
+				},
+				{
+					Order:  tieredRuleID,
+					Action: v1alpha1.IngressNodeFirewallDeny,
+					ProtocolConfig: v1alpha1.IngressNodeProtocolConfig{Protocol: v1alpha1.ProtocolTypeTCP,
+						TCP: &v1alpha1.IngressNodeFirewallProtoRule{Ports: intstr.FromInt(2222)}},
+				},
+			},
+		},
+	}
+	h := newXDPHarness(t, "infwtest0", rules, false)
+	if maxEntries := h.objs.IngressNodeFirewallStatisticsMap.MaxEntries(); maxEntries != statisticsMapEntries {
+		t.Fatalf("the statistics map holds %d rule IDs instead of %d", maxEntries, statisticsMapEntries)
+	}
+
+	for i := 0; i < 3; i++ {
+		if ret := h.run(buildFrame(t, net.ParseIP("10.1.1.1"), syscall.IPPROTO_TCP, 2222, 0, 0)); ret != xdpDeny {
+			t.Fatalf("XDP program returned %d instead of denying the packet", ret)
+		}
+		if event := h.readEvent(); event == nil || event.header.RuleId != tieredRuleID {
+			t.Fatalf("expected an event of rule %d, got %+v", tieredRuleID, event)
+		}
+	}
+	if stats := ruleStatistics(t, h.objs, tieredRuleID); stats.DenyStats.Packets != 3 || stats.DenyStats.Bytes == 0 {
+		t.Fatalf("unexpected statistics %+v of rule %d", stats, tieredRuleID)
+	}
+	if stats := ruleStatistics(t, h.objs, 65535); stats.packets() != 0 {
+		t.Fatalf("unexpected statistics %+v of the highest rule ID", stats)
+	}
+}
+
+// TestXDPEventSuppression checks that events beyond the event rate limit and events that are sampled out are not
+// generated but counted in the statistics of the rule.
+func TestXDPEventSuppression(t *testing.T) {
+	rules := []v1alpha1.IngressNodeFirewallRules{
+		{
+			SourceCIDRs: []string{"10.0.0.0/8"},
+			FirewallProtocolRules: []v1alpha1.IngressNodeFirewallProtocolRule{
+				{
+					Order:  1,
+					Action: v1alpha1.IngressNodeFirewallDeny,
+					ProtocolConfig: v1alpha1.IngressNodeProtocolConfig{Protocol: v1alpha1.ProtocolTypeTCP,
+						TCP: &v1alpha1.IngressNodeFirewallProtoRule{Ports: intstr.FromInt(2222)}},
+				},
+			},
+		},
+	}
+	const packets = 10
+	countEvents := func(h *xdpHarness) int {
+		events := 0
+		for h.readEvent() != nil {
+			events++
+		}
+		return events
+	}
+
+	t.Run("rate limit", func(t *testing.T) {
+		// The bucket starts full with one second worth of events, the packets are sent well within a second.
+		h := newXDPHarnessWithConstants(t, "infwtest0", rules, map[string]interface{}{"event_rate_limit": uint32(3)})
+		for i := 0; i < packets; i++ {
+			if ret := h.run(buildFrame(t, net.ParseIP("10.1.1.1"), syscall.IPPROTO_TCP, 2222, 0, 0)); ret != xdpDeny {
+				t.Fatalf("XDP program returned %d instead of denying the packet", ret)
+			}
+		}
+		if events := countEvents(h); events != 3 {
+			t.Fatalf("got %d events, expected 3", events)
+		}
+		stats := ruleStatistics(t, h.objs, 1)
+		if stats.DenyStats.Packets != packets || stats.EventStats.RateLimited != packets-3 ||
+			stats.EventStats.SampledOut != 0 {
+			t.Fatalf("unexpected statistics %+v", stats)
+		}
+	})
+
+	t.Run("sampling", func(t *testing.T) {
+		h := newXDPHarnessWithConstants(t, "infwtest0", rules, map[string]interface{}{"event_sample_rate": uint32(4)})
+		for i := 0; i < packets; i++ {
+			h.run(buildFrame(t, net.ParseIP("10.1.1.1"), syscall.IPPROTO_TCP, 2222, 0, 0))
+		}
+		events := countEvents(h)
+		stats := ruleStatistics(t, h.objs, 1)
+		if stats.DenyStats.Packets != packets || uint64(events)+stats.EventStats.SampledOut != packets ||
+			stats.EventStats.RateLimited != 0 {
+			t.Fatalf("got %d events and statistics %+v for %d packets", events, stats, packets)
+		}
+	})
+}
@@ -8,6 +8,7 @@ import (
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/openshift/ingress-node-firewall/api/v1alpha1"
 	infv1alpha1 "github.com/openshift/ingress-node-firewall/api/v1alpha1"
@@ -24,6 +25,9 @@ var (
 	instance                     EbpfSyncer
 	isValidInterfaceNameAndState = intfs.IsValidInterfaceNameAndState
 	xdpEBUSYErr                  = "device or resource busy"
+	// blocklistPollPeriod is the period at which the blocklist file is checked for changes. Kubelet updates the
+	// files of mounted ConfigMaps within about a minute.
+	blocklistPollPeriod = 10 * time.Second
 )
 
 // ebpfDaemon is a single point of contact that all reconciliation requests will send their desired state of
@@ -59,7 +63,9 @@ type ebpfSingleton struct {
 	stats             *metrics.Statistics
 	c                 *nodefwloader.IngNodeFwController
 	managedInterfaces map[string]struct{}
-	mu                sync.Mutex
+	// blocklistStopCh stops the poller of the blocklist file of the manager.
+	blocklistStopCh chan struct{}
+	mu              sync.Mutex
 }
 
 // syncInterfaceIngressRules takes a map of <interfaceName>:<interfaceRules> and a boolean parameter that indicates
@@ -67,10 +73,12 @@ type ebpfSingleton struct {
 // If isDelete is true then all rules will be attached from all provided interfaces. In such a case, the given
 // interfaceRules (if any) will be ignored.
 // If isDelete is false then rules will be synchronized for each of the given interfaces.
+// The result of the sync is recorded for the health checks.
 func (e *ebpfSingleton) SyncInterfaceIngressRules(
-	ifaceIngressRules map[string][]infv1alpha1.IngressNodeFirewallRules, isDelete bool) error {
+	ifaceIngressRules map[string][]infv1alpha1.IngressNodeFirewallRules, isDelete bool) (err error) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
+	defer func() { e.recordSync(err) }()
 
 	logger := e.log.WithName("syncIngressNodeFirewallResources")
 	logger.Info("Running sync operation", "ifaceIngressRules", ifaceIngressRules, "isDelete", isDelete)
@@ -82,7 +90,7 @@ func (e *ebpfSingleton) SyncInterfaceIngressRules(
 		e.stats.StopPoll()
 		defer func() {
 			if e.c != nil {
-				e.stats.StartPoll(e.c.GetStatisticsMap())
+				e.stats.StartPoll(e.c.GetStatisticsMap(), e.c.GetBanMap(), e.c.GetSourceStatisticsMap())
 			}
 		}()
 	}
@@ -121,11 +129,14 @@ func (e *ebpfSingleton) SyncInterfaceIngressRules(
 	if err := e.loadIngressNodeFirewallRules(ifaceIngressRules); err != nil {
 		return err
 	}
+
+	// Apply changes of the blocklist that the poller did not pick up yet.
+	e.loadBlocklist()
 	return nil
 }
 
 // getBPFMapContentForTest lists the content of the current BPF map. Used for unit testing only.
-func (e *ebpfSingleton) getBPFMapContentForTest() (map[nodefwloader.BpfLpmIpKeySt]nodefwloader.BpfRulesValSt, error) {
+func (e *ebpfSingleton) getBPFMapContentForTest() (map[nodefwloader.BpfLpmIpKeySt][]nodefwloader.BpfRuleTypeSt, error) {
 	if e.c == nil {
 		return nil, fmt.Errorf("Nil pointer to node firewall loader")
 	}
@@ -140,10 +151,38 @@ func (e *ebpfSingleton) createNewManager() error {
 		if e.c, err = nodefwloader.NewIngNodeFwController(); err != nil {
 			return fmt.Errorf("Failed to create nodefw controller instance, err: %q", err)
 		}
+		e.blocklistStopCh = make(chan struct{})
+		go e.pollBlocklist(e.blocklistStopCh)
 	}
 	return nil
 }
 
+// pollBlocklist applies the changes of the blocklist file periodically until stopCh is closed.
+func (e *ebpfSingleton) pollBlocklist(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(blocklistPollPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			e.mu.Lock()
+			if e.c != nil {
+				e.loadBlocklist()
+			}
+			e.mu.Unlock()
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// loadBlocklist applies the changes of the blocklist file to the blocklist map. Errors are logged and the current
+// blocklist stays in place, so that an invalid list does not prevent rules from being programmed.
+func (e *ebpfSingleton) loadBlocklist() {
+	if err := e.c.LoadBlocklist(); err != nil {
+		e.log.Error(err, "Failed loading blocklist")
+	}
+}
+
 // loadIngressNodeFirewallRules adds, updates and deletes rules from the ruleset.
 func (e *ebpfSingleton) loadIngressNodeFirewallRules(
 	ifaceIngressRules map[string][]v1alpha1.IngressNodeFirewallRules) error {
@@ -171,6 +210,10 @@ func (e *ebpfSingleton) resetAll() error {
 		e.log.Info("Could not clean up all objects that belong to the firewall manager", "err", err)
 	}
 
+	if e.blocklistStopCh != nil {
+		close(e.blocklistStopCh)
+		e.blocklistStopCh = nil
+	}
 	e.managedInterfaces = make(map[string]struct{})
 	e.c = nil
 
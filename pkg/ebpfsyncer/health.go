@@ -0,0 +1,140 @@
+package ebpfsyncer
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	intfs "github.com/openshift/ingress-node-firewall/pkg/interfaces"
+	"github.com/openshift/ingress-node-firewall/pkg/metrics"
+
+	apierrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+const (
+	// XDPAttachedCheck verifies that the XDP program of the firewall is attached to every managed interface.
+	XDPAttachedCheck = "xdp_attached"
+	// SyncCheck verifies that the last sync of the rules succeeded.
+	SyncCheck = "sync"
+	// EventsReaderCheck verifies that the reader of the events of the XDP program runs.
+	EventsReaderCheck = "events_reader"
+)
+
+var (
+	getXDPProgramIDs = intfs.GetXDPProgramIDs
+
+	// healthMu controls access to lastSync, so that health checks do not wait for a sync in progress.
+	healthMu sync.Mutex
+	lastSync *syncResult
+)
+
+// syncResult is the state of the syncer after a sync.
+type syncResult struct {
+	err               error
+	managedInterfaces []string
+	// eventsReaderAlive reports whether the events reader of the firewall manager runs, nil if there is no manager.
+	eventsReaderAlive func() bool
+	// xdpProgramID returns the ID of the XDP program of the firewall manager, nil if there is no manager.
+	xdpProgramID func() (uint32, error)
+}
+
+// recordSync records the result of a sync for the health checks. It must be called with e.mu held.
+func (e *ebpfSingleton) recordSync(err error) {
+	result := &syncResult{err: err}
+	for intf := range e.managedInterfaces {
+		result.managedInterfaces = append(result.managedInterfaces, intf)
+	}
+	sort.Strings(result.managedInterfaces)
+	if e.c != nil {
+		result.eventsReaderAlive = e.c.EventsReaderAlive
+		result.xdpProgramID = e.c.XDPProgramID
+	}
+	healthMu.Lock()
+	lastSync = result
+	healthMu.Unlock()
+}
+
+// HealthCheck verifies that the last sync succeeded, that the XDP program is attached to every managed interface and
+// that the events reader runs, and records the result of each check in a metric. It passes until the first sync,
+// since nothing is enforced on the node before. It implements healthz.Checker.
+func HealthCheck(_ *http.Request) error {
+	healthMu.Lock()
+	result := lastSync
+	healthMu.Unlock()
+	if result == nil {
+		for _, check := range []string{XDPAttachedCheck, SyncCheck, EventsReaderCheck} {
+			metrics.SetHealthCheck(check, true)
+		}
+		return nil
+	}
+
+	var errs []error
+	for _, check := range []struct {
+		name string
+		run  func(*syncResult) error
+	}{
+		{XDPAttachedCheck, checkXDPAttached},
+		{SyncCheck, checkSync},
+		{EventsReaderCheck, checkEventsReader},
+	} {
+		err := check.run(result)
+		metrics.SetHealthCheck(check.name, err == nil)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s check failed: %v", check.name, err))
+		}
+	}
+	return apierrors.NewAggregate(errs)
+}
+
+// checkXDPAttached returns an error if one of the managed interfaces has no XDP program attached, or another XDP
+// program than the one of the firewall manager.
+func checkXDPAttached(result *syncResult) error {
+	if len(result.managedInterfaces) == 0 {
+		return nil
+	}
+	attached, err := getXDPProgramIDs()
+	if err != nil {
+		return fmt.Errorf("failed to list the interfaces with XDP attached: %v", err)
+	}
+	var programID uint32
+	if result.xdpProgramID != nil {
+		if programID, err = result.xdpProgramID(); err != nil {
+			return err
+		}
+	}
+	var detached, replaced []string
+	for _, intf := range result.managedInterfaces {
+		id, ok := attached[intf]
+		switch {
+		case !ok:
+			detached = append(detached, intf)
+		case result.xdpProgramID != nil && id != programID:
+			replaced = append(replaced, intf)
+		}
+	}
+	if len(detached) > 0 {
+		return fmt.Errorf("the XDP program is not attached to managed interfaces %v", detached)
+	}
+	if len(replaced) > 0 {
+		return fmt.Errorf("another XDP program than program %d of the firewall is attached to managed interfaces %v",
+			programID, replaced)
+	}
+	return nil
+}
+
+// checkSync returns the error of the last sync.
+func checkSync(result *syncResult) error {
+	if result.err != nil {
+		return fmt.Errorf("the last sync failed: %v", result.err)
+	}
+	return nil
+}
+
+// checkEventsReader returns an error if the firewall manager exists and its events reader stopped.
+func checkEventsReader(result *syncResult) error {
+	if result.eventsReaderAlive != nil && !result.eventsReaderAlive() {
+		return fmt.Errorf("the events reader stopped")
+	}
+	return nil
+}
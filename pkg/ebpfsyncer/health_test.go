@@ -0,0 +1,85 @@
+package ebpfsyncer
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestHealthCheck(t *testing.T) {
+	defer func(f func() (map[string]uint32, error)) {
+		getXDPProgramIDs = f
+		lastSync = nil
+	}(getXDPProgramIDs)
+	getXDPProgramIDs = func() (map[string]uint32, error) {
+		return map[string]uint32{"eth0": 42, "eth2": 42, "eth3": 7}, nil
+	}
+	alive := func() bool { return true }
+	stopped := func() bool { return false }
+	programID := func() (uint32, error) { return 42, nil }
+
+	tcs := []struct {
+		name     string
+		result   *syncResult
+		expected []string // the checks that must fail
+	}{
+		{name: "before the first sync"},
+		{
+			name:   "healthy",
+			result: &syncResult{managedInterfaces: []string{"eth0", "eth2"}, eventsReaderAlive: alive},
+		},
+		{
+			name: "healthy with the program of the firewall",
+			result: &syncResult{managedInterfaces: []string{"eth0", "eth2"}, eventsReaderAlive: alive,
+				xdpProgramID: programID},
+		},
+		{
+			name: "replaced program",
+			result: &syncResult{managedInterfaces: []string{"eth0", "eth3"}, eventsReaderAlive: alive,
+				xdpProgramID: programID},
+			expected: []string{XDPAttachedCheck},
+		},
+		{
+			name:   "after a delete",
+			result: &syncResult{},
+		},
+		{
+			name:     "detached interface",
+			result:   &syncResult{managedInterfaces: []string{"eth0", "eth1"}, eventsReaderAlive: alive},
+			expected: []string{XDPAttachedCheck},
+		},
+		{
+			name:     "failed sync and stopped events reader",
+			result:   &syncResult{err: fmt.Errorf("failed"), eventsReaderAlive: stopped},
+			expected: []string{SyncCheck, EventsReaderCheck},
+		},
+	}
+	for _, tc := range tcs {
+		lastSync = tc.result
+		err := HealthCheck(nil)
+		if len(tc.expected) == 0 {
+			if err != nil {
+				t.Fatalf("%s: unexpected error %v", tc.name, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Fatalf("%s: expected checks %v to fail", tc.name, tc.expected)
+		}
+		for _, check := range []string{XDPAttachedCheck, SyncCheck, EventsReaderCheck} {
+			failed := strings.Contains(err.Error(), check+" check failed")
+			if failed != contains(tc.expected, check) {
+				t.Fatalf("%s: unexpected result of check %s: %v", tc.name, check, err)
+			}
+		}
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
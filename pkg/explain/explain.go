@@ -0,0 +1,506 @@
+// Package explain evaluates the ingress node firewall rules of a node offline. It reproduces the matching of the
+// XDP program: the rules of the most specific source CIDR on the receiving interface are evaluated in order and the
+// first rule that matches the protocol and the destination port, or the ICMP type and code, decides the verdict.
+package explain
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	infv1alpha1 "github.com/openshift/ingress-node-firewall/api/v1alpha1"
+	"github.com/openshift/ingress-node-firewall/pkg/failsaferules"
+	"github.com/openshift/ingress-node-firewall/pkg/utils"
+)
+
+// Packet describes a packet that is received on an interface of a node.
+type Packet struct {
+	// Interface is the name of the interface that receives the packet. Use the name of the bond for packets that are
+	// received on the slave of a bond.
+	Interface string
+	// SourceIP is the source address of the packet.
+	SourceIP net.IP
+	// Protocol is the IP protocol number of the packet.
+	Protocol uint8
+	// DstPort is the destination port of TCP, UDP and SCTP packets.
+	DstPort uint16
+	// ICMPType is the type of ICMP and ICMPv6 packets.
+	ICMPType uint8
+	// ICMPCode is the code of ICMP and ICMPv6 packets.
+	ICMPCode uint8
+}
+
+// Result explains the verdict of the ingress node firewall for a packet.
+type Result struct {
+	// Verdict is Deny if the packet is dropped and Allow otherwise.
+	Verdict infv1alpha1.IngressNodeFirewallActionType
+	// SourceCIDR is the most specific source CIDR of the interface that contains the source address of the packet,
+	// or empty if there is none.
+	SourceCIDR string
+	// Rule is the rule that matches the packet, or nil if no rule matches and the packet is allowed.
+	Rule *infv1alpha1.IngressNodeFirewallProtocolRule
+	// RuleSourceCIDR is the source CIDR that Rule is defined for. It differs from SourceCIDR if the rule is
+	// inherited from a less specific source CIDR.
+	RuleSourceCIDR string
+	// Owners are the names of the IngressNodeFirewalls that define Rule, as recorded in the ruleOwners of the node
+	// state.
+	Owners []string
+	// Reason describes the verdict.
+	Reason string
+}
+
+// Options configure an Evaluator.
+type Options struct {
+	// RuleInheritance must match the ruleInheritance setting of the IngressNodeFirewallConfig.
+	RuleInheritance bool
+	// AllowEssentialICMPv6 must match the allowEssentialICMPv6 setting of the IngressNodeFirewallConfig.
+	AllowEssentialICMPv6 bool
+}
+
+// Evaluator explains the verdict of the ingress node firewall rules of a node for packets.
+type Evaluator struct {
+	// targets holds the source CIDRs of each interface with their rules.
+	targets map[string][]*target
+	// owners holds the names of the IngressNodeFirewalls that define each rule.
+	ruleOwners map[ruleKey][]string
+}
+
+// ruleKey identifies a rule of an IngressNodeFirewallNodeState by its interface, source CIDR and rule ID.
+type ruleKey struct {
+	iface  string
+	cidr   string
+	ruleID uint32
+}
+
+// target is a source CIDR of an interface with its rules, in the order in which they are evaluated.
+type target struct {
+	cidr string
+	// ip and prefixLen are the prefix of the source CIDR. Like the keys of the LPM table, an IPv4 prefix is stored in
+	// the first 4 bytes of ip.
+	ip        [net.IPv6len]byte
+	prefixLen int
+	rules     []rule
+}
+
+// rule is a rule in the format that the XDP program evaluates, together with the rule that it is built from.
+type rule struct {
+	cidr     string
+	rule     infv1alpha1.IngressNodeFirewallProtocolRule
+	protocol uint8
+	// intervals are the destination ports of TCP, UDP and SCTP rules, or the ICMP types and codes of ICMP and ICMPv6
+	// rules.
+	intervals []utils.Interval
+	deny      bool
+	// failSafe is true for the ICMPv6 fail safe rules that the daemon adds.
+	failSafe bool
+}
+
+// NewEvaluator returns an Evaluator for the provided IngressNodeFirewallNodeStateSpec. It returns an error if the
+// rules cannot be loaded by the daemon.
+func NewEvaluator(spec infv1alpha1.IngressNodeFirewallNodeStateSpec, options Options) (*Evaluator, error) {
+	e := &Evaluator{targets: make(map[string][]*target), ruleOwners: make(map[ruleKey][]string)}
+	for _, owner := range spec.RuleOwners {
+		key := ruleKey{iface: owner.Interface, cidr: owner.SourceCIDR, ruleID: owner.RuleID}
+		if !containsString(e.ruleOwners[key], owner.Firewall) {
+			e.ruleOwners[key] = append(e.ruleOwners[key], owner.Firewall)
+			sort.Strings(e.ruleOwners[key])
+		}
+	}
+	for iface, ingressRules := range spec.InterfaceIngressRules {
+		var targets []*target
+		for _, ingressRule := range ingressRules {
+			rules, err := buildRules(ingressRule.FirewallProtocolRules)
+			if err != nil {
+				return nil, fmt.Errorf("failed to build the rules of interface %s: %w", iface, err)
+			}
+			for _, cidr := range ingressRule.SourceCIDRs {
+				t, err := newTarget(cidr)
+				if err != nil {
+					return nil, fmt.Errorf("failed to build the rules of interface %s: %w", iface, err)
+				}
+				for _, r := range rules {
+					r.cidr = cidr
+					t.rules = append(t.rules, r)
+				}
+				// The rules of a prefix replace the rules of the same prefix that were defined before.
+				targets = replaceTarget(targets, t)
+			}
+		}
+		if options.RuleInheritance {
+			targets = inheritRules(targets)
+		}
+		if options.AllowEssentialICMPv6 {
+			var err error
+			if targets, err = addICMPv6FailSafeRules(targets); err != nil {
+				return nil, err
+			}
+		}
+		e.targets[iface] = targets
+	}
+	return e, nil
+}
+
+// Explain returns the verdict for the provided packet and explains it.
+func (e *Evaluator) Explain(packet Packet) (Result, error) {
+	result := Result{Verdict: infv1alpha1.IngressNodeFirewallAllow}
+	ip, addrBits := packetAddress(packet.SourceIP)
+	if addrBits == 0 {
+		return result, fmt.Errorf("invalid source IP %q", packet.SourceIP)
+	}
+	icmpProto := uint8(syscall.IPPROTO_ICMP)
+	if addrBits == net.IPv6len*8 {
+		icmpProto = syscall.IPPROTO_ICMPV6
+	}
+	t := e.lookup(packet.Interface, ip, addrBits)
+	if t == nil {
+		result.Reason = fmt.Sprintf("no source CIDR on interface %s contains %s", packet.Interface, packet.SourceIP)
+		return result, nil
+	}
+	result.SourceCIDR = t.cidr
+	for _, r := range t.rules {
+		if !r.matches(packet, icmpProto) {
+			continue
+		}
+		matched := r.rule
+		result.Rule = &matched
+		result.RuleSourceCIDR = r.cidr
+		result.Verdict = infv1alpha1.IngressNodeFirewallAllow
+		if r.deny {
+			result.Verdict = infv1alpha1.IngressNodeFirewallDeny
+		}
+		if failSafeRule, ok := failsaferules.GetICMPv6ByRuleID(r.rule.Order); ok && r.failSafe {
+			result.Reason = fmt.Sprintf("built-in rule allowing %s from %s matches", failSafeRule.GetServiceName(), r.cidr)
+			return result, nil
+		}
+		result.Owners = e.owners(packet.Interface, r)
+		result.Reason = fmt.Sprintf("rule with order %d of source CIDR %s matches", r.rule.Order, r.cidr)
+		return result, nil
+	}
+	result.Reason = fmt.Sprintf("no rule of source CIDR %s matches", t.cidr)
+	return result, nil
+}
+
+// RuleOwners returns the names of the IngressNodeFirewalls that define the rule with the provided ID, which the XDP
+// program reports in the events of the packets that the rule matches, for packets from sourceIP on the interface. It
+// returns nil if there is no such rule, for example for the packets of blocklisted sources.
+func (e *Evaluator) RuleOwners(iface string, sourceIP net.IP, ruleID uint32) []string {
+	ip, addrBits := packetAddress(sourceIP)
+	if addrBits == 0 {
+		return nil
+	}
+	t := e.lookup(iface, ip, addrBits)
+	if t == nil {
+		return nil
+	}
+	var owners []string
+	for _, r := range t.rules {
+		if r.rule.Order != ruleID || r.failSafe {
+			continue
+		}
+		for _, owner := range e.owners(iface, r) {
+			if !containsString(owners, owner) {
+				owners = append(owners, owner)
+			}
+		}
+	}
+	sort.Strings(owners)
+	return owners
+}
+
+// lookup returns the target of the interface with the longest prefix that contains ip, or nil.
+func (e *Evaluator) lookup(iface string, ip [net.IPv6len]byte, addrBits int) *target {
+	var longest *target
+	for _, t := range e.targets[iface] {
+		if t.prefixLen <= addrBits && prefixContains(t.ip, t.prefixLen, ip) &&
+			(longest == nil || t.prefixLen > longest.prefixLen) {
+			longest = t
+		}
+	}
+	return longest
+}
+
+// owners returns the names of the IngressNodeFirewalls that define rule r on the interface.
+func (e *Evaluator) owners(iface string, r rule) []string {
+	owners := e.ruleOwners[ruleKey{iface: iface, cidr: r.cidr, ruleID: r.rule.Order}]
+	return append([]string(nil), owners...)
+}
+
+// matches returns true if the rule matches the packet. icmpProto is the ICMP protocol of the address family of the
+// packet.
+func (r rule) matches(packet Packet, icmpProto uint8) bool {
+	if r.protocol == 0 {
+		return true
+	}
+	if r.protocol != packet.Protocol {
+		return false
+	}
+	switch r.protocol {
+	case syscall.IPPROTO_TCP, syscall.IPPROTO_UDP, syscall.IPPROTO_SCTP:
+		return utils.IntervalsContain(r.intervals, uint32(packet.DstPort))
+	case icmpProto:
+		return utils.IntervalsContain(r.intervals, utils.ICMPValue(packet.ICMPType, packet.ICMPCode))
+	case syscall.IPPROTO_ICMP, syscall.IPPROTO_ICMPV6:
+		// ICMP rules only match the ICMP version of the address family of the packet.
+		return false
+	}
+	// Rules of other protocols match on the protocol alone.
+	return true
+}
+
+// buildRules converts the protocol rules into the rules that the XDP program evaluates, ordered by their order.
+func buildRules(protocolRules []infv1alpha1.IngressNodeFirewallProtocolRule) ([]rule, error) {
+	var rules []rule
+	for _, protocolRule := range protocolRules {
+		// The XDP program skips rules with order 0.
+		if protocolRule.Order == 0 {
+			continue
+		}
+		r := rule{rule: protocolRule}
+		var err error
+		switch protocolRule.ProtocolConfig.Protocol {
+		case infv1alpha1.ProtocolTypeTCP:
+			r.protocol = syscall.IPPROTO_TCP
+			r.intervals, err = portIntervals(protocolRule.ProtocolConfig.TCP)
+		case infv1alpha1.ProtocolTypeUDP:
+			r.protocol = syscall.IPPROTO_UDP
+			r.intervals, err = portIntervals(protocolRule.ProtocolConfig.UDP)
+		case infv1alpha1.ProtocolTypeSCTP:
+			r.protocol = syscall.IPPROTO_SCTP
+			r.intervals, err = portIntervals(protocolRule.ProtocolConfig.SCTP)
+		case infv1alpha1.ProtocolTypeICMP:
+			r.protocol = syscall.IPPROTO_ICMP
+			r.intervals, err = icmpIntervals(protocolRule.ProtocolConfig.ICMP)
+		case infv1alpha1.ProtocolTypeICMP6:
+			r.protocol = syscall.IPPROTO_ICMPV6
+			r.intervals, err = icmpIntervals(protocolRule.ProtocolConfig.ICMPv6)
+		case infv1alpha1.ProtocolTypeIPProtocol:
+			if protocolRule.ProtocolConfig.IPProtocol == nil {
+				err = fmt.Errorf("missing ipProtocol")
+				break
+			}
+			r.protocol = *protocolRule.ProtocolConfig.IPProtocol
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule with order %d: %w", protocolRule.Order, err)
+		}
+		switch protocolRule.Action {
+		case infv1alpha1.IngressNodeFirewallAllow:
+		case infv1alpha1.IngressNodeFirewallDeny:
+			r.deny = true
+		default:
+			return nil, fmt.Errorf("invalid action %q of rule with order %d", protocolRule.Action, protocolRule.Order)
+		}
+		rules = append(rules, r)
+	}
+	sort.SliceStable(rules, func(i, j int) bool {
+		return rules[i].rule.Order < rules[j].rule.Order
+	})
+	return rules, nil
+}
+
+// portIntervals returns the destination ports that a rule matches.
+func portIntervals(protoRule *infv1alpha1.IngressNodeFirewallProtoRule) ([]utils.Interval, error) {
+	if protoRule == nil {
+		return nil, fmt.Errorf("missing ports")
+	}
+	if utils.IsRange(protoRule) {
+		start, end, err := utils.GetRange(protoRule)
+		if err != nil {
+			return nil, err
+		}
+		return utils.PortIntervals(start, end), nil
+	}
+	port, err := utils.GetPort(protoRule)
+	if err != nil {
+		return nil, err
+	}
+	return utils.PortIntervals(port, 0), nil
+}
+
+// icmpIntervals returns the ICMP types and codes that a rule matches.
+func icmpIntervals(icmpRule *infv1alpha1.IngressNodeFirewallICMPRule) ([]utils.Interval, error) {
+	if icmpRule == nil {
+		return nil, fmt.Errorf("missing ICMP type and code")
+	}
+	return utils.ICMPIntervals(icmpRule.ICMPType, icmpRule.ICMPTypeEnd, icmpRule.ICMPCode, icmpRule.ICMPAnyCode), nil
+}
+
+// newTarget returns a target without rules for the provided CIDR.
+func newTarget(cidr string) (*target, error) {
+	ip, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse source CIDR: %w", err)
+	}
+	t := &target{cidr: cidr}
+	t.ip, _ = packetAddress(ip)
+	t.prefixLen, _ = ipNet.Mask.Size()
+	return t, nil
+}
+
+// replaceTarget adds t to targets, replacing a target with the same prefix.
+func replaceTarget(targets []*target, t *target) []*target {
+	for idx, existing := range targets {
+		if existing.prefixLen == t.prefixLen && prefixContains(existing.ip, existing.prefixLen, t.ip) {
+			targets[idx] = t
+			return targets
+		}
+	}
+	return append(targets, t)
+}
+
+// inheritRules returns copies of the targets where the rules of each target are followed by the rules of all targets
+// with a less specific prefix that contains it, from the most to the least specific prefix.
+func inheritRules(targets []*target) []*target {
+	inherited := make([]*target, 0, len(targets))
+	for _, t := range targets {
+		var parents []*target
+		for _, candidate := range targets {
+			if candidate.prefixLen < t.prefixLen && prefixContains(candidate.ip, candidate.prefixLen, t.ip) {
+				parents = append(parents, candidate)
+			}
+		}
+		sort.Slice(parents, func(i, j int) bool { return parents[i].prefixLen > parents[j].prefixLen })
+		copied := *t
+		copied.rules = append([]rule{}, t.rules...)
+		for _, parent := range parents {
+			copied.rules = append(copied.rules, parent.rules...)
+		}
+		inherited = append(inherited, &copied)
+	}
+	return inherited
+}
+
+// addICMPv6FailSafeRules returns copies of the targets where the ICMPv6 fail safe rules are placed ahead of the rules
+// of each IPv6 target that their source CIDR contains. If an IPv6 target contains the source CIDR of a fail safe rule,
+// a target for the source CIDR is added with the rules of the most specific of these targets.
+func addICMPv6FailSafeRules(targets []*target) ([]*target, error) {
+	var ipv6Targets []*target
+	for _, t := range targets {
+		if ip, _, _ := net.ParseCIDR(t.cidr); ip.To4() == nil {
+			ipv6Targets = append(ipv6Targets, t)
+		}
+	}
+	if len(ipv6Targets) == 0 {
+		return targets, nil
+	}
+
+	var failSafeTargets []*target
+	for _, failSafeRule := range failsaferules.GetICMPv6() {
+		failSafeTarget, err := newTarget(failSafeRule.GetSourceCIDR())
+		if err != nil {
+			return nil, err
+		}
+		failSafeTarget.rules, err = buildRules([]infv1alpha1.IngressNodeFirewallProtocolRule{failSafeRule.GetProtocolRule()})
+		if err != nil {
+			return nil, err
+		}
+		failSafeTarget.rules[0].cidr, failSafeTarget.rules[0].failSafe = failSafeTarget.cidr, true
+		failSafeTargets = append(failSafeTargets, failSafeTarget)
+	}
+
+	withFailSafe := append(make([]*target, 0, len(targets)+len(failSafeTargets)), targets...)
+	for _, failSafeTarget := range failSafeTargets {
+		var parent *target
+		for _, t := range withFailSafe {
+			if t.prefixLen == failSafeTarget.prefixLen && prefixContains(t.ip, t.prefixLen, failSafeTarget.ip) {
+				parent = nil
+				break
+			}
+			if t.prefixLen < failSafeTarget.prefixLen && prefixContains(t.ip, t.prefixLen, failSafeTarget.ip) &&
+				containsTarget(ipv6Targets, t) && (parent == nil || t.prefixLen > parent.prefixLen) {
+				parent = t
+			}
+		}
+		if parent != nil {
+			added := &target{cidr: failSafeTarget.cidr, ip: failSafeTarget.ip, prefixLen: failSafeTarget.prefixLen,
+				rules: parent.rules}
+			withFailSafe = append(withFailSafe, added)
+			ipv6Targets = append(ipv6Targets, added)
+		}
+	}
+
+	for idx, t := range withFailSafe {
+		if !containsTarget(ipv6Targets, t) {
+			continue
+		}
+		copied := *t
+		copied.rules = nil
+		for _, failSafeTarget := range failSafeTargets {
+			if failSafeTarget.prefixLen <= t.prefixLen && prefixContains(failSafeTarget.ip, failSafeTarget.prefixLen, t.ip) {
+				copied.rules = append(copied.rules, failSafeTarget.rules...)
+			}
+		}
+		copied.rules = append(copied.rules, t.rules...)
+		withFailSafe[idx] = &copied
+	}
+	return withFailSafe, nil
+}
+
+func containsTarget(targets []*target, t *target) bool {
+	for _, candidate := range targets {
+		if candidate == t {
+			return true
+		}
+	}
+	return false
+}
+
+// packetAddress returns ip in the layout of the LPM table keys and the number of address bits, or 0 bits if ip is
+// invalid.
+func packetAddress(ip net.IP) ([net.IPv6len]byte, int) {
+	var addr [net.IPv6len]byte
+	if ip4 := ip.To4(); ip4 != nil {
+		copy(addr[:], ip4)
+		return addr, net.IPv4len * 8
+	}
+	if ip16 := ip.To16(); ip16 != nil {
+		copy(addr[:], ip16)
+		return addr, net.IPv6len * 8
+	}
+	return addr, 0
+}
+
+// prefixContains returns true if the first prefixLen bits of prefix and ip are equal. As in the LPM table, the
+// address family is not compared.
+func prefixContains(prefix [net.IPv6len]byte, prefixLen int, ip [net.IPv6len]byte) bool {
+	for bit := 0; bit < prefixLen; bit++ {
+		mask := byte(0x80) >> (bit % 8)
+		if prefix[bit/8]&mask != ip[bit/8]&mask {
+			return false
+		}
+	}
+	return true
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseProtocol returns the IP protocol number of a protocol name such as TCP or ICMPv6, or of a decimal number.
+func ParseProtocol(protocol string) (uint8, error) {
+	switch strings.ToUpper(protocol) {
+	case strings.ToUpper(string(infv1alpha1.ProtocolTypeTCP)):
+		return syscall.IPPROTO_TCP, nil
+	case strings.ToUpper(string(infv1alpha1.ProtocolTypeUDP)):
+		return syscall.IPPROTO_UDP, nil
+	case strings.ToUpper(string(infv1alpha1.ProtocolTypeSCTP)):
+		return syscall.IPPROTO_SCTP, nil
+	case strings.ToUpper(string(infv1alpha1.ProtocolTypeICMP)):
+		return syscall.IPPROTO_ICMP, nil
+	case strings.ToUpper(string(infv1alpha1.ProtocolTypeICMP6)):
+		return syscall.IPPROTO_ICMPV6, nil
+	}
+	number, err := strconv.ParseUint(protocol, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid protocol %q", protocol)
+	}
+	return uint8(number), nil
+}
@@ -0,0 +1,421 @@
+package explain
+
+import (
+	"net"
+	"reflect"
+	"syscall"
+	"testing"
+
+	infv1alpha1 "github.com/openshift/ingress-node-firewall/api/v1alpha1"
+
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func tcpRule(order uint32, ports string, action infv1alpha1.IngressNodeFirewallActionType) infv1alpha1.IngressNodeFirewallProtocolRule {
+	return infv1alpha1.IngressNodeFirewallProtocolRule{
+		Order: order,
+		ProtocolConfig: infv1alpha1.IngressNodeProtocolConfig{
+			Protocol: infv1alpha1.ProtocolTypeTCP,
+			TCP:      &infv1alpha1.IngressNodeFirewallProtoRule{Ports: intstr.FromString(ports)},
+		},
+		Action: action,
+	}
+}
+
+func icmpRule(order uint32, protocol infv1alpha1.IngressNodeFirewallRuleProtocolType, icmpType, icmpCode uint8,
+	action infv1alpha1.IngressNodeFirewallActionType) infv1alpha1.IngressNodeFirewallProtocolRule {
+	rule := infv1alpha1.IngressNodeFirewallProtocolRule{
+		Order:          order,
+		ProtocolConfig: infv1alpha1.IngressNodeProtocolConfig{Protocol: protocol},
+		Action:         action,
+	}
+	icmp := &infv1alpha1.IngressNodeFirewallICMPRule{ICMPType: icmpType, ICMPCode: icmpCode}
+	if protocol == infv1alpha1.ProtocolTypeICMP {
+		rule.ProtocolConfig.ICMP = icmp
+	} else {
+		rule.ProtocolConfig.ICMPv6 = icmp
+	}
+	return rule
+}
+
+func ipProtocolRule(order uint32, protocol uint8,
+	action infv1alpha1.IngressNodeFirewallActionType) infv1alpha1.IngressNodeFirewallProtocolRule {
+	return infv1alpha1.IngressNodeFirewallProtocolRule{
+		Order: order,
+		ProtocolConfig: infv1alpha1.IngressNodeProtocolConfig{
+			Protocol:   infv1alpha1.ProtocolTypeIPProtocol,
+			IPProtocol: &protocol,
+		},
+		Action: action,
+	}
+}
+
+func TestExplain(t *testing.T) {
+	spec := infv1alpha1.IngressNodeFirewallNodeStateSpec{
+		InterfaceIngressRules: map[string][]infv1alpha1.IngressNodeFirewallRules{
+			"eth0": {
+				{
+					SourceCIDRs: []string{"10.0.0.0/8"},
+					FirewallProtocolRules: []infv1alpha1.IngressNodeFirewallProtocolRule{
+						tcpRule(20, "8000-9000", infv1alpha1.IngressNodeFirewallDeny),
+						tcpRule(10, "22", infv1alpha1.IngressNodeFirewallDeny),
+						icmpRule(30, infv1alpha1.ProtocolTypeICMP, 8, 0, infv1alpha1.IngressNodeFirewallDeny),
+						ipProtocolRule(40, 112, infv1alpha1.IngressNodeFirewallDeny),
+						{
+							Order: 50,
+							ProtocolConfig: infv1alpha1.IngressNodeProtocolConfig{
+								Protocol: infv1alpha1.ProtocolTypeICMP,
+								ICMP:     &infv1alpha1.IngressNodeFirewallICMPRule{ICMPType: 3, ICMPTypeEnd: 5, ICMPAnyCode: true},
+							},
+							Action: infv1alpha1.IngressNodeFirewallDeny,
+						},
+						{
+							Order: 60,
+							ProtocolConfig: infv1alpha1.IngressNodeProtocolConfig{
+								Protocol: infv1alpha1.ProtocolTypeICMP,
+								ICMP:     &infv1alpha1.IngressNodeFirewallICMPRule{ICMPType: 12},
+							},
+							Action: infv1alpha1.IngressNodeFirewallDeny,
+						},
+					},
+				},
+				{
+					SourceCIDRs: []string{"10.1.0.0/16", "2001:db8::/32"},
+					FirewallProtocolRules: []infv1alpha1.IngressNodeFirewallProtocolRule{
+						tcpRule(1, "443", infv1alpha1.IngressNodeFirewallAllow),
+						icmpRule(2, infv1alpha1.ProtocolTypeICMP6, 128, 0, infv1alpha1.IngressNodeFirewallDeny),
+					},
+				},
+			},
+		},
+	}
+
+	tcs := []struct {
+		name               string
+		ruleInheritance    bool
+		packet             Packet
+		expectedVerdict    infv1alpha1.IngressNodeFirewallActionType
+		expectedSourceCIDR string
+		expectedOrder      uint32
+		expectedRuleCIDR   string
+	}{
+		{
+			name:               "exact port",
+			packet:             Packet{Interface: "eth0", SourceIP: net.ParseIP("10.2.0.1"), Protocol: syscall.IPPROTO_TCP, DstPort: 22},
+			expectedVerdict:    infv1alpha1.IngressNodeFirewallDeny,
+			expectedSourceCIDR: "10.0.0.0/8",
+			expectedOrder:      10,
+			expectedRuleCIDR:   "10.0.0.0/8",
+		},
+		{
+			name:               "start of port range",
+			packet:             Packet{Interface: "eth0", SourceIP: net.ParseIP("10.2.0.1"), Protocol: syscall.IPPROTO_TCP, DstPort: 8000},
+			expectedVerdict:    infv1alpha1.IngressNodeFirewallDeny,
+			expectedSourceCIDR: "10.0.0.0/8",
+			expectedOrder:      20,
+			expectedRuleCIDR:   "10.0.0.0/8",
+		},
+		{
+			name:               "end of port range is not matched",
+			packet:             Packet{Interface: "eth0", SourceIP: net.ParseIP("10.2.0.1"), Protocol: syscall.IPPROTO_TCP, DstPort: 9000},
+			expectedVerdict:    infv1alpha1.IngressNodeFirewallAllow,
+			expectedSourceCIDR: "10.0.0.0/8",
+		},
+		{
+			name:               "ICMP type and code",
+			packet:             Packet{Interface: "eth0", SourceIP: net.ParseIP("10.2.0.1"), Protocol: syscall.IPPROTO_ICMP, ICMPType: 8},
+			expectedVerdict:    infv1alpha1.IngressNodeFirewallDeny,
+			expectedSourceCIDR: "10.0.0.0/8",
+			expectedOrder:      30,
+			expectedRuleCIDR:   "10.0.0.0/8",
+		},
+		{
+			name:               "ICMP code mismatch",
+			packet:             Packet{Interface: "eth0", SourceIP: net.ParseIP("10.2.0.1"), Protocol: syscall.IPPROTO_ICMP, ICMPType: 8, ICMPCode: 1},
+			expectedVerdict:    infv1alpha1.IngressNodeFirewallAllow,
+			expectedSourceCIDR: "10.0.0.0/8",
+		},
+		{
+			name:               "ICMP type range with any code",
+			packet:             Packet{Interface: "eth0", SourceIP: net.ParseIP("10.2.0.1"), Protocol: syscall.IPPROTO_ICMP, ICMPType: 5, ICMPCode: 3},
+			expectedVerdict:    infv1alpha1.IngressNodeFirewallDeny,
+			expectedSourceCIDR: "10.0.0.0/8",
+			expectedOrder:      50,
+			expectedRuleCIDR:   "10.0.0.0/8",
+		},
+		{
+			name:               "ICMP rule without code matches code 0",
+			packet:             Packet{Interface: "eth0", SourceIP: net.ParseIP("10.2.0.1"), Protocol: syscall.IPPROTO_ICMP, ICMPType: 12},
+			expectedVerdict:    infv1alpha1.IngressNodeFirewallDeny,
+			expectedSourceCIDR: "10.0.0.0/8",
+			expectedOrder:      60,
+			expectedRuleCIDR:   "10.0.0.0/8",
+		},
+		{
+			name:               "ICMP rule without code does not match other codes",
+			packet:             Packet{Interface: "eth0", SourceIP: net.ParseIP("10.2.0.1"), Protocol: syscall.IPPROTO_ICMP, ICMPType: 12, ICMPCode: 1},
+			expectedVerdict:    infv1alpha1.IngressNodeFirewallAllow,
+			expectedSourceCIDR: "10.0.0.0/8",
+		},
+		{
+			name:               "ICMP type past range",
+			packet:             Packet{Interface: "eth0", SourceIP: net.ParseIP("10.2.0.1"), Protocol: syscall.IPPROTO_ICMP, ICMPType: 6},
+			expectedVerdict:    infv1alpha1.IngressNodeFirewallAllow,
+			expectedSourceCIDR: "10.0.0.0/8",
+		},
+		{
+			name:               "only the most specific source CIDR applies",
+			packet:             Packet{Interface: "eth0", SourceIP: net.ParseIP("10.1.2.3"), Protocol: syscall.IPPROTO_TCP, DstPort: 22},
+			expectedVerdict:    infv1alpha1.IngressNodeFirewallAllow,
+			expectedSourceCIDR: "10.1.0.0/16",
+		},
+		{
+			name:               "inherited rule",
+			ruleInheritance:    true,
+			packet:             Packet{Interface: "eth0", SourceIP: net.ParseIP("10.1.2.3"), Protocol: syscall.IPPROTO_TCP, DstPort: 22},
+			expectedVerdict:    infv1alpha1.IngressNodeFirewallDeny,
+			expectedSourceCIDR: "10.1.0.0/16",
+			expectedOrder:      10,
+			expectedRuleCIDR:   "10.0.0.0/8",
+		},
+		{
+			name:               "ICMPv6",
+			packet:             Packet{Interface: "eth0", SourceIP: net.ParseIP("2001:db8::1"), Protocol: syscall.IPPROTO_ICMPV6, ICMPType: 128},
+			expectedVerdict:    infv1alpha1.IngressNodeFirewallDeny,
+			expectedSourceCIDR: "2001:db8::/32",
+			expectedOrder:      2,
+			expectedRuleCIDR:   "2001:db8::/32",
+		},
+		{
+			name:               "ICMPv6 rules do not match ICMP packets",
+			packet:             Packet{Interface: "eth0", SourceIP: net.ParseIP("10.1.2.3"), Protocol: syscall.IPPROTO_ICMPV6, ICMPType: 128},
+			expectedVerdict:    infv1alpha1.IngressNodeFirewallAllow,
+			expectedSourceCIDR: "10.1.0.0/16",
+		},
+		{
+			name:            "other interface",
+			packet:          Packet{Interface: "eth1", SourceIP: net.ParseIP("10.2.0.1"), Protocol: syscall.IPPROTO_TCP, DstPort: 22},
+			expectedVerdict: infv1alpha1.IngressNodeFirewallAllow,
+		},
+		{
+			name:               "IP protocol",
+			packet:             Packet{Interface: "eth0", SourceIP: net.ParseIP("10.2.0.1"), Protocol: 112},
+			expectedVerdict:    infv1alpha1.IngressNodeFirewallDeny,
+			expectedSourceCIDR: "10.0.0.0/8",
+			expectedOrder:      40,
+			expectedRuleCIDR:   "10.0.0.0/8",
+		},
+		{
+			name:               "IP protocol mismatch",
+			packet:             Packet{Interface: "eth0", SourceIP: net.ParseIP("10.2.0.1"), Protocol: syscall.IPPROTO_GRE},
+			expectedVerdict:    infv1alpha1.IngressNodeFirewallAllow,
+			expectedSourceCIDR: "10.0.0.0/8",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			evaluator, err := NewEvaluator(spec, Options{RuleInheritance: tc.ruleInheritance})
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := evaluator.Explain(tc.packet)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Verdict != tc.expectedVerdict || result.SourceCIDR != tc.expectedSourceCIDR ||
+				result.RuleSourceCIDR != tc.expectedRuleCIDR {
+				t.Fatalf("unexpected result %+v", result)
+			}
+			if (result.Rule == nil) != (tc.expectedOrder == 0) ||
+				(result.Rule != nil && result.Rule.Order != tc.expectedOrder) {
+				t.Fatalf("expected rule with order %d, got %+v", tc.expectedOrder, result.Rule)
+			}
+			if result.Reason == "" {
+				t.Fatalf("missing reason in result %+v", result)
+			}
+		})
+	}
+}
+
+func TestExplainEssentialICMPv6(t *testing.T) {
+	denyAll := infv1alpha1.IngressNodeFirewallProtocolRule{Order: 1, Action: infv1alpha1.IngressNodeFirewallDeny}
+	spec := infv1alpha1.IngressNodeFirewallNodeStateSpec{
+		InterfaceIngressRules: map[string][]infv1alpha1.IngressNodeFirewallRules{
+			"eth0": {
+				{
+					SourceCIDRs:           []string{"10.0.0.0/8", "::/0"},
+					FirewallProtocolRules: []infv1alpha1.IngressNodeFirewallProtocolRule{denyAll},
+				},
+				{
+					SourceCIDRs: []string{"2001:db8::/32"},
+					FirewallProtocolRules: []infv1alpha1.IngressNodeFirewallProtocolRule{
+						tcpRule(1, "443", infv1alpha1.IngressNodeFirewallAllow),
+						icmpRule(2, infv1alpha1.ProtocolTypeICMP6, 135, 0, infv1alpha1.IngressNodeFirewallDeny),
+					},
+				},
+			},
+		},
+	}
+
+	tcs := []struct {
+		name                 string
+		allowEssentialICMPv6 bool
+		packet               Packet
+		expectedVerdict      infv1alpha1.IngressNodeFirewallActionType
+		expectedSourceCIDR   string
+		expectedOrder        uint32
+		expectedRuleCIDR     string
+	}{
+		{
+			name:               "neighbor solicitation denied",
+			packet:             Packet{Interface: "eth0", SourceIP: net.ParseIP("fe80::1"), Protocol: syscall.IPPROTO_ICMPV6, ICMPType: 135},
+			expectedVerdict:    infv1alpha1.IngressNodeFirewallDeny,
+			expectedSourceCIDR: "::/0",
+			expectedOrder:      1,
+			expectedRuleCIDR:   "::/0",
+		},
+		{
+			name:                 "neighbor solicitation from link-local source",
+			allowEssentialICMPv6: true,
+			packet:               Packet{Interface: "eth0", SourceIP: net.ParseIP("fe80::1"), Protocol: syscall.IPPROTO_ICMPV6, ICMPType: 135},
+			expectedVerdict:      infv1alpha1.IngressNodeFirewallAllow,
+			expectedSourceCIDR:   "fe80::/10",
+			expectedOrder:        65534,
+			expectedRuleCIDR:     "fe80::/10",
+		},
+		{
+			name:                 "other packets from link-local source",
+			allowEssentialICMPv6: true,
+			packet:               Packet{Interface: "eth0", SourceIP: net.ParseIP("fe80::1"), Protocol: syscall.IPPROTO_TCP, DstPort: 22},
+			expectedVerdict:      infv1alpha1.IngressNodeFirewallDeny,
+			expectedSourceCIDR:   "fe80::/10",
+			expectedOrder:        1,
+			expectedRuleCIDR:     "::/0",
+		},
+		{
+			name:                 "neighbor solicitation from global source",
+			allowEssentialICMPv6: true,
+			packet:               Packet{Interface: "eth0", SourceIP: net.ParseIP("2001:db8::1"), Protocol: syscall.IPPROTO_ICMPV6, ICMPType: 135},
+			expectedVerdict:      infv1alpha1.IngressNodeFirewallDeny,
+			expectedSourceCIDR:   "2001:db8::/32",
+			expectedOrder:        2,
+			expectedRuleCIDR:     "2001:db8::/32",
+		},
+		{
+			name:                 "packet too big from global source",
+			allowEssentialICMPv6: true,
+			packet:               Packet{Interface: "eth0", SourceIP: net.ParseIP("2001:db9::1"), Protocol: syscall.IPPROTO_ICMPV6, ICMPType: 2},
+			expectedVerdict:      infv1alpha1.IngressNodeFirewallAllow,
+			expectedSourceCIDR:   "::/0",
+			expectedOrder:        65535,
+			expectedRuleCIDR:     "::/0",
+		},
+		{
+			name:                 "IPv4 source CIDR",
+			allowEssentialICMPv6: true,
+			packet:               Packet{Interface: "eth0", SourceIP: net.ParseIP("10.0.0.1"), Protocol: syscall.IPPROTO_ICMP, ICMPType: 3},
+			expectedVerdict:      infv1alpha1.IngressNodeFirewallDeny,
+			expectedSourceCIDR:   "10.0.0.0/8",
+			expectedOrder:        1,
+			expectedRuleCIDR:     "10.0.0.0/8",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			evaluator, err := NewEvaluator(spec, Options{AllowEssentialICMPv6: tc.allowEssentialICMPv6})
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := evaluator.Explain(tc.packet)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Verdict != tc.expectedVerdict || result.SourceCIDR != tc.expectedSourceCIDR ||
+				result.RuleSourceCIDR != tc.expectedRuleCIDR || result.Rule == nil || result.Rule.Order != tc.expectedOrder {
+				t.Fatalf("unexpected result %+v", result)
+			}
+		})
+	}
+}
+
+func TestExplainOwners(t *testing.T) {
+	denySSH := tcpRule(10, "22", infv1alpha1.IngressNodeFirewallDeny)
+	spec := infv1alpha1.IngressNodeFirewallNodeStateSpec{
+		InterfaceIngressRules: map[string][]infv1alpha1.IngressNodeFirewallRules{
+			"eth0": {
+				{SourceCIDRs: []string{"10.0.0.0/8"}, FirewallProtocolRules: []infv1alpha1.IngressNodeFirewallProtocolRule{denySSH}},
+				{SourceCIDRs: []string{"10.1.0.0/16"}, FirewallProtocolRules: []infv1alpha1.IngressNodeFirewallProtocolRule{denySSH}},
+			},
+			"eth1": {
+				{SourceCIDRs: []string{"10.0.0.0/8"}, FirewallProtocolRules: []infv1alpha1.IngressNodeFirewallProtocolRule{denySSH}},
+			},
+		},
+		RuleOwners: []infv1alpha1.IngressNodeFirewallRuleOwner{
+			{Interface: "eth0", SourceCIDR: "10.0.0.0/8", RuleID: 10, Firewall: "cidr", Order: 10},
+			{Interface: "eth0", SourceCIDR: "10.0.0.0/8", RuleID: 10, Firewall: "address-set", Order: 10},
+			{Interface: "eth0", SourceCIDR: "10.1.0.0/16", RuleID: 10, Firewall: "other-cidr", Order: 10},
+			{Interface: "eth1", SourceCIDR: "10.0.0.0/8", RuleID: 10, Firewall: "other-interface", Order: 10},
+		},
+	}
+	evaluator, err := NewEvaluator(spec, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := evaluator.Explain(Packet{Interface: "eth0", SourceIP: net.ParseIP("10.0.0.1"), Protocol: syscall.IPPROTO_TCP, DstPort: 22})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"address-set", "cidr"}; !reflect.DeepEqual(result.Owners, expected) {
+		t.Fatalf("expected owners %v, got %v", expected, result.Owners)
+	}
+	if owners := evaluator.RuleOwners("eth0", net.ParseIP("10.0.0.1"), 10); !reflect.DeepEqual(owners, result.Owners) {
+		t.Fatalf("expected rule 10 to be owned by %v, got %v", result.Owners, owners)
+	}
+	if owners := evaluator.RuleOwners("eth0", net.ParseIP("10.1.0.1"), 10); !reflect.DeepEqual(owners, []string{"other-cidr"}) {
+		t.Fatalf("expected rule 10 of 10.1.0.0/16 to be owned by other-cidr, got %v", owners)
+	}
+	if owners := evaluator.RuleOwners("eth1", net.ParseIP("10.0.0.1"), 10); !reflect.DeepEqual(owners, []string{"other-interface"}) {
+		t.Fatalf("expected rule 10 of eth1 to be owned by other-interface, got %v", owners)
+	}
+	if owners := evaluator.RuleOwners("eth0", net.ParseIP("10.0.0.1"), 11); owners != nil {
+		t.Fatalf("expected no owner of rule 11, got %v", owners)
+	}
+	if owners := evaluator.RuleOwners("eth0", net.ParseIP("192.0.2.1"), 10); owners != nil {
+		t.Fatalf("expected no owner of rule 10 for a source outside of the source CIDRs, got %v", owners)
+	}
+}
+
+func TestNewEvaluatorInvalidRules(t *testing.T) {
+	spec := infv1alpha1.IngressNodeFirewallNodeStateSpec{
+		InterfaceIngressRules: map[string][]infv1alpha1.IngressNodeFirewallRules{
+			"eth0": {{
+				SourceCIDRs:           []string{"10.0.0.0/8"},
+				FirewallProtocolRules: []infv1alpha1.IngressNodeFirewallProtocolRule{tcpRule(1, "9000-8000", infv1alpha1.IngressNodeFirewallDeny)},
+			}},
+		},
+	}
+	if _, err := NewEvaluator(spec, Options{}); err == nil {
+		t.Fatal("expected an error for an invalid port range")
+	}
+}
+
+func TestParseProtocol(t *testing.T) {
+	tcs := []struct {
+		protocol    string
+		expected    uint8
+		expectedErr bool
+	}{
+		{protocol: "TCP", expected: syscall.IPPROTO_TCP},
+		{protocol: "udp", expected: syscall.IPPROTO_UDP},
+		{protocol: "ICMPv6", expected: syscall.IPPROTO_ICMPV6},
+		{protocol: "47", expected: 47},
+		{protocol: "256", expectedErr: true},
+		{protocol: "foo", expectedErr: true},
+	}
+	for _, tc := range tcs {
+		protocol, err := ParseProtocol(tc.protocol)
+		if (err != nil) != tc.expectedErr || protocol != tc.expected {
+			t.Fatalf("ParseProtocol(%q) = %d, %v", tc.protocol, protocol, err)
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package failsaferules
 
-var MAX_INGRESS_RULES = 100
+import "github.com/openshift/ingress-node-firewall/api/v1alpha1"
+
+// MAX_INGRESS_RULES is the default maximum number of rules per source CIDR. The effective maximum is configured
+// through the MaxRulesPerTarget field of the IngressNodeFirewallConfig.
+var MAX_INGRESS_RULES = v1alpha1.DefaultMaxRulesPerTarget
 
 type TransportProtoFailSafeRule struct {
 	serviceName string
@@ -60,3 +64,80 @@ func (t TransportProtoFailSafeRule) GetServiceName() string {
 func (t TransportProtoFailSafeRule) GetPort() uint16 {
 	return t.port
 }
+
+// ICMPv6FailSafeRule is an ICMPv6 message that IPv6 connectivity to the node depends on. If enabled through the
+// AllowEssentialICMPv6 field of the IngressNodeFirewallConfig, the daemon allows these messages ahead of the rules of
+// all source CIDRs that the source CIDR of the fail safe rule contains or is contained in.
+type ICMPv6FailSafeRule struct {
+	serviceName string
+	sourceCIDR  string
+	icmpType    uint8
+	icmpTypeEnd uint8
+	ruleID      uint32
+}
+
+// The fail safe rules use the highest rule IDs that the XDP program reports, which are not used by rules with a
+// sensible order. Their packets are not accounted in the rule statistics.
+var icmpv6 = []ICMPv6FailSafeRule{
+	{
+		"IPv6 neighbor discovery",
+		"fe80::/10",
+		133,
+		137,
+		65534,
+	},
+	{
+		"IPv6 path MTU discovery",
+		"::/0",
+		2,
+		2,
+		65535,
+	},
+}
+
+func GetICMPv6() []ICMPv6FailSafeRule {
+	return icmpv6
+}
+
+// GetICMPv6ByRuleID returns the ICMPv6 fail safe rule with the provided rule ID.
+func GetICMPv6ByRuleID(ruleID uint32) (ICMPv6FailSafeRule, bool) {
+	for _, rule := range icmpv6 {
+		if rule.ruleID == ruleID {
+			return rule, true
+		}
+	}
+	return ICMPv6FailSafeRule{}, false
+}
+
+func (i ICMPv6FailSafeRule) GetServiceName() string {
+	return i.serviceName
+}
+
+func (i ICMPv6FailSafeRule) GetSourceCIDR() string {
+	return i.sourceCIDR
+}
+
+func (i ICMPv6FailSafeRule) GetICMPType() uint8 {
+	return i.icmpType
+}
+
+func (i ICMPv6FailSafeRule) GetICMPTypeEnd() uint8 {
+	return i.icmpTypeEnd
+}
+
+func (i ICMPv6FailSafeRule) GetRuleID() uint32 {
+	return i.ruleID
+}
+
+// GetProtocolRule returns the fail safe rule as an allow rule for every code of its ICMPv6 types, with the rule ID as
+// order.
+func (i ICMPv6FailSafeRule) GetProtocolRule() v1alpha1.IngressNodeFirewallProtocolRule {
+	return v1alpha1.IngressNodeFirewallProtocolRule{
+		Order: i.ruleID,
+		ProtocolConfig: v1alpha1.IngressNodeProtocolConfig{
+			Protocol: v1alpha1.ProtocolTypeICMP6,
+			ICMPv6:   &v1alpha1.IngressNodeFirewallICMPRule{ICMPType: i.icmpType, ICMPTypeEnd: i.icmpTypeEnd, ICMPAnyCode: true},
+		},
+		Action: v1alpha1.IngressNodeFirewallAllow,
+	}
+}
@@ -0,0 +1,66 @@
+package icmppresets
+
+import (
+	"fmt"
+
+	infv1alpha1 "github.com/openshift/ingress-node-firewall/api/v1alpha1"
+)
+
+// Preset is a named set of ICMP and ICMPv6 messages that nodes need to receive for a network function to work.
+type Preset string
+
+const (
+	// NDP is IPv6 Neighbor Discovery (RFC 4861): router solicitation and advertisement, and neighbor solicitation and
+	// advertisement. Without them, the link layer addresses of IPv6 neighbors are not resolved and routers are not
+	// discovered. Redirects are not part of the preset.
+	NDP Preset = "NDP"
+	// PMTUD is path MTU discovery: ICMPv6 packet too big (RFC 8201) and ICMP fragmentation needed (RFC 1191).
+	// Without them, connections over a path with a smaller MTU stall.
+	PMTUD Preset = "PMTUD"
+)
+
+var presets = map[Preset][]infv1alpha1.IngressNodeProtocolConfig{
+	NDP: {
+		icmpv6Config(133, 136, 0),
+	},
+	PMTUD: {
+		icmpv6Config(2, 0, 0),
+		icmpConfig(3, 4),
+	},
+}
+
+// Presets returns the names of all presets.
+func Presets() []Preset {
+	return []Preset{NDP, PMTUD}
+}
+
+// Rules returns the rules that allow the messages of preset, with consecutive orders that start at firstOrder.
+func Rules(preset Preset, firstOrder uint32) ([]infv1alpha1.IngressNodeFirewallProtocolRule, error) {
+	configs, ok := presets[preset]
+	if !ok {
+		return nil, fmt.Errorf("unknown ICMP preset %q", preset)
+	}
+	rules := make([]infv1alpha1.IngressNodeFirewallProtocolRule, 0, len(configs))
+	for idx, config := range configs {
+		rules = append(rules, infv1alpha1.IngressNodeFirewallProtocolRule{
+			Order:          firstOrder + uint32(idx),
+			ProtocolConfig: *config.DeepCopy(),
+			Action:         infv1alpha1.IngressNodeFirewallAllow,
+		})
+	}
+	return rules, nil
+}
+
+func icmpv6Config(icmpType, icmpTypeEnd, icmpCode uint8) infv1alpha1.IngressNodeProtocolConfig {
+	return infv1alpha1.IngressNodeProtocolConfig{
+		Protocol: infv1alpha1.ProtocolTypeICMP6,
+		ICMPv6:   &infv1alpha1.IngressNodeFirewallICMPRule{ICMPType: icmpType, ICMPTypeEnd: icmpTypeEnd, ICMPCode: icmpCode},
+	}
+}
+
+func icmpConfig(icmpType, icmpCode uint8) infv1alpha1.IngressNodeProtocolConfig {
+	return infv1alpha1.IngressNodeProtocolConfig{
+		Protocol: infv1alpha1.ProtocolTypeICMP,
+		ICMP:     &infv1alpha1.IngressNodeFirewallICMPRule{ICMPType: icmpType, ICMPCode: icmpCode},
+	}
+}
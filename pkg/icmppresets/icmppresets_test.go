@@ -0,0 +1,103 @@
+package icmppresets
+
+import (
+	"net"
+	"os"
+	"reflect"
+	"syscall"
+	"testing"
+
+	infv1alpha1 "github.com/openshift/ingress-node-firewall/api/v1alpha1"
+	"github.com/openshift/ingress-node-firewall/pkg/explain"
+
+	"sigs.k8s.io/yaml"
+)
+
+// TestRules checks with the offline evaluator that the rules of each preset allow the messages of the preset ahead
+// of a rule that denies everything, and only these messages.
+func TestRules(t *testing.T) {
+	v4, v6 := net.ParseIP("192.0.2.1"), net.ParseIP("fe80::1")
+	icmp := func(ip net.IP, icmpType, icmpCode uint8) explain.Packet {
+		protocol := uint8(syscall.IPPROTO_ICMP)
+		if ip.To4() == nil {
+			protocol = syscall.IPPROTO_ICMPV6
+		}
+		return explain.Packet{Interface: "eth0", SourceIP: ip, Protocol: protocol, ICMPType: icmpType, ICMPCode: icmpCode}
+	}
+	tcs := []struct {
+		preset  Preset
+		allowed []explain.Packet
+		denied  []explain.Packet
+	}{
+		{
+			preset: NDP,
+			allowed: []explain.Packet{icmp(v6, 133, 0), icmp(v6, 134, 0), icmp(v6, 135, 0),
+				icmp(v6, 136, 0)},
+			denied: []explain.Packet{icmp(v6, 132, 0), icmp(v6, 135, 1), icmp(v6, 137, 0), icmp(v4, 135, 0)},
+		},
+		{
+			preset:  PMTUD,
+			allowed: []explain.Packet{icmp(v6, 2, 0), icmp(v4, 3, 4)},
+			denied:  []explain.Packet{icmp(v6, 1, 4), icmp(v6, 2, 1), icmp(v4, 3, 3), icmp(v4, 2, 0)},
+		},
+	}
+	for _, tc := range tcs {
+		rules, err := Rules(tc.preset, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rules = append(rules, infv1alpha1.IngressNodeFirewallProtocolRule{Order: 100,
+			Action: infv1alpha1.IngressNodeFirewallDeny})
+		evaluator, err := explain.NewEvaluator(infv1alpha1.IngressNodeFirewallNodeStateSpec{
+			InterfaceIngressRules: map[string][]infv1alpha1.IngressNodeFirewallRules{
+				"eth0": {{SourceCIDRs: []string{"0.0.0.0/0", "::/0"}, FirewallProtocolRules: rules}},
+			},
+		}, explain.Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := map[infv1alpha1.IngressNodeFirewallActionType][]explain.Packet{
+			infv1alpha1.IngressNodeFirewallAllow: tc.allowed,
+			infv1alpha1.IngressNodeFirewallDeny:  tc.denied,
+		}
+		for verdict, packets := range expected {
+			for _, packet := range packets {
+				result, err := evaluator.Explain(packet)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result.Verdict != verdict {
+					t.Fatalf("%s: %+v got verdict %s instead of %s: %s", tc.preset, packet, result.Verdict, verdict,
+						result.Reason)
+				}
+			}
+		}
+	}
+
+	if _, err := Rules("foo", 1); err == nil {
+		t.Fatal("expected an error for an unknown preset")
+	}
+}
+
+// TestSample checks that the sample manifest holds the rules of the presets.
+func TestSample(t *testing.T) {
+	data, err := os.ReadFile("../../config/samples/ingressnodefirewall-icmp-presets.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var inf infv1alpha1.IngressNodeFirewall
+	if err := yaml.UnmarshalStrict(data, &inf); err != nil {
+		t.Fatal(err)
+	}
+	var expected []infv1alpha1.IngressNodeFirewallProtocolRule
+	for _, preset := range Presets() {
+		rules, err := Rules(preset, uint32(len(expected)+1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected = append(expected, rules...)
+	}
+	if rules := inf.Spec.Ingress[0].FirewallProtocolRules; !reflect.DeepEqual(rules, expected) {
+		t.Fatalf("sample rules %+v differ from the rules of the presets %+v", rules, expected)
+	}
+}
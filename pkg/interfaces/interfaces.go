@@ -49,6 +49,21 @@ func GetInterfacesWithXDPAttached() ([]string, error) {
 	return ifsList, nil
 }
 
+// GetXDPProgramIDs returns the ID of the XDP program that is attached to each interface with XDP attached.
+func GetXDPProgramIDs() (map[string]uint32, error) {
+	links, err := netlink.LinkList()
+	if err != nil {
+		return nil, err
+	}
+	programIDs := make(map[string]uint32)
+	for _, l := range links {
+		if l.Attrs().Xdp != nil && l.Attrs().Xdp.Attached {
+			programIDs[l.Attrs().Name] = l.Attrs().Xdp.ProgId
+		}
+	}
+	return programIDs, nil
+}
+
 // GetInterfaceIndex returns the interface index of the interface with the given name.
 func GetInterfaceIndex(interfaceName string) (uint32, error) {
 	iface, err := net.InterfaceByName(interfaceName)
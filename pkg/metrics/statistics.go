@@ -8,7 +8,6 @@ import (
 	"time"
 
 	nodefwloader "github.com/openshift/ingress-node-firewall/pkg/ebpf"
-	"github.com/openshift/ingress-node-firewall/pkg/failsaferules"
 
 	"github.com/cilium/ebpf"
 	"github.com/prometheus/client_golang/prometheus"
@@ -43,9 +42,53 @@ var metricDenyBytesCount = prometheus.NewGauge(prometheus.GaugeOpts{
 	Help:      "The number of bytes for packets which results in an deny IP packet result",
 })
 
+var metricBannedSources = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: MetricINFNamespace,
+	Subsystem: MetricINFSubsystemNode,
+	Name:      "banned_sources",
+	Help:      "The number of sources which are currently banned by rules with autoBan",
+})
+
+var metricEventsSampledOutCount = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: MetricINFNamespace,
+	Subsystem: MetricINFSubsystemNode,
+	Name:      "events_sampled_out_total",
+	Help:      "The number of events of denied packets which were not generated because of event sampling",
+})
+
+var metricEventsRateLimitedCount = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: MetricINFNamespace,
+	Subsystem: MetricINFSubsystemNode,
+	Name:      "events_rate_limited_total",
+	Help:      "The number of events of denied packets which were not generated because of the event rate limit",
+})
+
+var metricTopSourceDenyCount = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: MetricINFNamespace,
+	Subsystem: MetricINFSubsystemNode,
+	Name:      "top_source_packet_deny_total",
+	Help:      "The number of denied packets of the sources with the most denied packets per interface",
+}, []string{"interface", "source"})
+
+var metricTopSourceDenyBytesCount = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: MetricINFNamespace,
+	Subsystem: MetricINFSubsystemNode,
+	Name:      "top_source_packet_deny_bytes",
+	Help:      "The number of bytes of denied packets of the sources with the most denied packets per interface",
+}, []string{"interface", "source"})
+
+var metricHealthCheck = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: MetricINFNamespace,
+	Subsystem: MetricINFSubsystemNode,
+	Name:      "health_check",
+	Help:      "The result of the last run of each health check of the daemon, 1 if it passed and 0 if it failed",
+}, []string{"check"})
+
 const (
 	MetricINFNamespace     = "ingressnodefirewall"
 	MetricINFSubsystemNode = "node"
+	// topSourcesMetricCount is the number of sources per interface that are exported as metrics.
+	topSourcesMetricCount = 10
 )
 
 // GetPrometheusStatisticNames returns all statistic metric names - to aid testing only.
@@ -55,6 +98,12 @@ func GetPrometheusStatisticNames() []string {
 		MetricINFNamespace + "_" + MetricINFSubsystemNode + "_" + "packet_allow_bytes",
 		MetricINFNamespace + "_" + MetricINFSubsystemNode + "_" + "packet_deny_total",
 		MetricINFNamespace + "_" + MetricINFSubsystemNode + "_" + "packet_deny_bytes",
+		MetricINFNamespace + "_" + MetricINFSubsystemNode + "_" + "banned_sources",
+		MetricINFNamespace + "_" + MetricINFSubsystemNode + "_" + "events_sampled_out_total",
+		MetricINFNamespace + "_" + MetricINFSubsystemNode + "_" + "events_rate_limited_total",
+		MetricINFNamespace + "_" + MetricINFSubsystemNode + "_" + "top_source_packet_deny_total",
+		MetricINFNamespace + "_" + MetricINFSubsystemNode + "_" + "top_source_packet_deny_bytes",
+		MetricINFNamespace + "_" + MetricINFSubsystemNode + "_" + "health_check",
 	}
 }
 
@@ -66,6 +115,9 @@ type Statistics struct {
 	mapStopCh       chan struct{}
 	isMapPollActive bool
 	pollPeriod      time.Duration
+	// sourceStatisticsMu controls access to sourceStatisticsMap, which is read by the top sources handler.
+	sourceStatisticsMu  sync.Mutex
+	sourceStatisticsMap *ebpf.Map
 }
 
 func NewStatistics(pollPeriod string) (*Statistics, error) {
@@ -82,10 +134,25 @@ func (m *Statistics) Register() {
 		controllerruntimemetrics.Registry.MustRegister(metricAllowBytesCount)
 		controllerruntimemetrics.Registry.MustRegister(metricDenyCount)
 		controllerruntimemetrics.Registry.MustRegister(metricDenyBytesCount)
+		controllerruntimemetrics.Registry.MustRegister(metricBannedSources)
+		controllerruntimemetrics.Registry.MustRegister(metricEventsSampledOutCount)
+		controllerruntimemetrics.Registry.MustRegister(metricEventsRateLimitedCount)
+		controllerruntimemetrics.Registry.MustRegister(metricTopSourceDenyCount)
+		controllerruntimemetrics.Registry.MustRegister(metricTopSourceDenyBytesCount)
+		controllerruntimemetrics.Registry.MustRegister(metricHealthCheck)
 	})
 }
 
-func (m *Statistics) StartPoll(statsMap *ebpf.Map) {
+// SetHealthCheck records the result of the last run of a health check of the daemon.
+func SetHealthCheck(check string, healthy bool) {
+	val := 0.0
+	if healthy {
+		val = 1
+	}
+	metricHealthCheck.WithLabelValues(check).Set(val)
+}
+
+func (m *Statistics) StartPoll(statsMap, banMap, sourceStatisticsMap *ebpf.Map) {
 	if m.isMapPollActive {
 		log.Println("Metrics are already being polled")
 		return
@@ -93,10 +160,11 @@ func (m *Statistics) StartPoll(statsMap *ebpf.Map) {
 	m.mapWG.Add(1)
 	m.mapStopCh = make(chan struct{})
 	m.isMapPollActive = true
+	m.setSourceStatisticsMap(sourceStatisticsMap)
 
 	go func() {
 		defer m.mapWG.Done()
-		updateMetrics(m.mapStopCh, statsMap, m.pollPeriod)
+		updateMetrics(m.mapStopCh, statsMap, banMap, sourceStatisticsMap, m.pollPeriod)
 		m.isMapPollActive = false
 	}()
 }
@@ -105,14 +173,15 @@ func (m *Statistics) StopPoll() {
 	if !m.isMapPollActive {
 		return
 	}
+	m.setSourceStatisticsMap(nil)
 	close(m.mapStopCh)
 	m.mapWG.Wait()
 }
 
-func updateMetrics(stopCh <-chan struct{}, statsMap *ebpf.Map, period time.Duration) {
+func updateMetrics(stopCh <-chan struct{}, statsMap, banMap, sourceStatisticsMap *ebpf.Map, period time.Duration) {
 	log.Println("Starting node metrics updater. Metrics will be polled periodically and presented as prometheus metrics")
 	ticker := time.NewTicker(period)
-	var allowCount, allowBytesCount, denyCount, denyBytesCount, result uint64
+	var allowCount, allowBytesCount, denyCount, denyBytesCount, sampledOutCount, rateLimitedCount, result uint64
 	var ruleStats []nodefwloader.BpfRuleStatisticsSt
 	var ok bool
 	var err error
@@ -121,10 +190,11 @@ func updateMetrics(stopCh <-chan struct{}, statsMap *ebpf.Map, period time.Durat
 	for {
 		select {
 		case <-ticker.C:
-			allowCount, allowBytesCount, denyCount, denyBytesCount = 0, 0, 0, 0
+			allowCount, allowBytesCount, denyCount, denyBytesCount, sampledOutCount, rateLimitedCount = 0, 0, 0, 0, 0, 0
 
-			for rule := 1; rule < failsaferules.MAX_INGRESS_RULES; rule++ {
-				if err = statsMap.Lookup(uint32(rule), &ruleStats); err != nil {
+			// Packets of blocklisted sources are counted under the invalid rule ID 0.
+			for rule := uint32(0); rule < statsMap.MaxEntries(); rule++ {
+				if err = statsMap.Lookup(rule, &ruleStats); err != nil {
 					log.Printf("Failed to lookup statistics for rule %d: %v\n", rule, err)
 					continue
 				}
@@ -153,12 +223,47 @@ func updateMetrics(stopCh <-chan struct{}, statsMap *ebpf.Map, period time.Durat
 					} else {
 						denyBytesCount = result
 					}
+
+					if result, ok = addUInt64(stat.EventStats.SampledOut, sampledOutCount); !ok {
+						log.Println("Overflow occurred during addition of sampled out event statistic")
+					} else {
+						sampledOutCount = result
+					}
+
+					if result, ok = addUInt64(stat.EventStats.RateLimited, rateLimitedCount); !ok {
+						log.Println("Overflow occurred during addition of rate limited event statistic")
+					} else {
+						rateLimitedCount = result
+					}
 				}
 			}
 			metricAllowCount.Set(float64(allowCount))
 			metricAllowBytesCount.Set(float64(allowBytesCount))
 			metricDenyCount.Set(float64(denyCount))
 			metricDenyBytesCount.Set(float64(denyBytesCount))
+			metricEventsSampledOutCount.Set(float64(sampledOutCount))
+			metricEventsRateLimitedCount.Set(float64(rateLimitedCount))
+
+			if bans, err := nodefwloader.ActiveBans(banMap); err != nil {
+				log.Printf("Failed to list banned sources: %v\n", err)
+			} else {
+				metricBannedSources.Set(float64(len(bans)))
+			}
+
+			if topSources, err := nodefwloader.TopSources(sourceStatisticsMap, topSourcesMetricCount); err != nil {
+				log.Printf("Failed to list top sources of denied packets: %v\n", err)
+			} else {
+				// Sources that are no longer among the top sources must not keep their last value.
+				metricTopSourceDenyCount.Reset()
+				metricTopSourceDenyBytesCount.Reset()
+				for ifIndex, sources := range topSources {
+					ifName := interfaceName(ifIndex)
+					for _, source := range sources {
+						metricTopSourceDenyCount.WithLabelValues(ifName, source.Source.String()).Set(float64(source.Packets))
+						metricTopSourceDenyBytesCount.WithLabelValues(ifName, source.Source.String()).Set(float64(source.Bytes))
+					}
+				}
+			}
 		case <-stopCh:
 			log.Println("Stopped node metric updates")
 			return
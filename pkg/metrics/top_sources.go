@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+
+	nodefwloader "github.com/openshift/ingress-node-firewall/pkg/ebpf"
+
+	"github.com/cilium/ebpf"
+)
+
+const (
+	// TopSourcesPath is the path of the debug endpoint that reports the sources with the most denied packets.
+	TopSourcesPath = "/debug/top-sources"
+	// defaultTopSourcesCount is the number of sources per interface that the debug endpoint reports when the request
+	// does not set the n query parameter.
+	defaultTopSourcesCount = 10
+)
+
+// TopSource is the number of packets and bytes that were denied from a source.
+type TopSource struct {
+	Source  string `json:"source"`
+	Packets uint64 `json:"packets"`
+	Bytes   uint64 `json:"bytes"`
+}
+
+func (m *Statistics) setSourceStatisticsMap(sourceStatisticsMap *ebpf.Map) {
+	m.sourceStatisticsMu.Lock()
+	defer m.sourceStatisticsMu.Unlock()
+	m.sourceStatisticsMap = sourceStatisticsMap
+}
+
+// TopSourcesHandler returns a handler that reports per interface name the sources with the most denied packets as
+// JSON. The n query parameter sets the number of sources per interface.
+func (m *Statistics) TopSourcesHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := defaultTopSourcesCount
+		if value := r.URL.Query().Get("n"); value != "" {
+			var err error
+			if n, err = strconv.Atoi(value); err != nil || n < 1 {
+				http.Error(w, fmt.Sprintf("invalid number of sources %q", value), http.StatusBadRequest)
+				return
+			}
+		}
+
+		m.sourceStatisticsMu.Lock()
+		defer m.sourceStatisticsMu.Unlock()
+		if m.sourceStatisticsMap == nil {
+			http.Error(w, "the XDP program is not loaded", http.StatusServiceUnavailable)
+			return
+		}
+		topSources, err := nodefwloader.TopSources(m.sourceStatisticsMap, n)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to list top sources: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		response := make(map[string][]TopSource, len(topSources))
+		for ifIndex, sources := range topSources {
+			ifName := interfaceName(ifIndex)
+			for _, source := range sources {
+				response[ifName] = append(response[ifName], TopSource{Source: source.Source.String(),
+					Packets: source.Packets, Bytes: source.Bytes})
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// interfaceName returns the name of the interface with the provided index, or the index if the interface no longer
+// exists.
+func interfaceName(ifIndex uint32) string {
+	iface, err := net.InterfaceByIndex(int(ifIndex))
+	if err != nil {
+		return strconv.FormatUint(uint64(ifIndex), 10)
+	}
+	return iface.Name
+}
@@ -0,0 +1,180 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSearch bounds the search for the next start of a cron expression, which never matches for expressions such as
+// "0 0 31 2 *".
+const maxSearch = 5 * 366 * 24 * time.Hour
+
+// Cron is a parsed cron expression with the five standard fields: minute, hour, day of month, month and day of week.
+type Cron struct {
+	minute, hour, dom, month, dow uint64
+	// domAny and dowAny are set when the day of month and day of week fields are "*". As in cron, when both are
+	// restricted a day matches if either of them matches.
+	domAny, dowAny bool
+}
+
+type field struct {
+	name     string
+	min, max int
+}
+
+var fields = []field{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// ParseCron parses a cron expression such as "0 22 * * 1-5". Each field is "*", a value, a range "a-b", or a comma
+// separated list of them, optionally followed by a step "/n". Day of week 0 and 7 are both Sunday.
+func ParseCron(expr string) (*Cron, error) {
+	parts := strings.Fields(expr)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("cron expression %q must have %d fields, got %d", expr, len(fields), len(parts))
+	}
+	var bits [5]uint64
+	for i, part := range parts {
+		var err error
+		if bits[i], err = parseField(part, fields[i]); err != nil {
+			return nil, fmt.Errorf("cron expression %q: %w", expr, err)
+		}
+	}
+	c := &Cron{minute: bits[0], hour: bits[1], dom: bits[2], month: bits[3], dow: bits[4],
+		domAny: parts[2] == "*", dowAny: parts[4] == "*"}
+	// Sunday is both 0 and 7.
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	return c, nil
+}
+
+func parseField(s string, f field) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(s, ",") {
+		rangePart, step := item, 1
+		if idx := strings.Index(item, "/"); idx >= 0 {
+			var err error
+			rangePart = item[:idx]
+			if step, err = strconv.Atoi(item[idx+1:]); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step in %s %q", f.name, item)
+			}
+		}
+		start, end := f.min, f.max
+		if rangePart != "*" {
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if start, err = parseValue(bounds[0], f); err != nil {
+				return 0, err
+			}
+			end = start
+			if len(bounds) == 2 {
+				if end, err = parseValue(bounds[1], f); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				end = f.max
+			}
+			if end < start {
+				return 0, fmt.Errorf("invalid range in %s %q, %d is greater than %d", f.name, item, start, end)
+			}
+		}
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func parseValue(s string, f field) (int, error) {
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid %s %q, must be between %d and %d", f.name, s, f.min, f.max)
+	}
+	return v, nil
+}
+
+func (c *Cron) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dow
+	case c.dowAny:
+		return dom
+	}
+	return dom || dow
+}
+
+// Next returns the first minute strictly after t that matches the expression, in the location of t. It returns the
+// zero time if there is none within five years.
+func (c *Cron) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(maxSearch)
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Truncate(time.Minute).Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// Window is a recurring time window that opens at each start of a cron expression and stays open for a duration.
+type Window struct {
+	start    *Cron
+	duration time.Duration
+	location *time.Location
+}
+
+// NewWindow returns the window that opens at each start of the cron expression start, evaluated in the IANA time
+// zone timeZone or UTC if it is empty, and stays open for duration.
+func NewWindow(start string, duration time.Duration, timeZone string) (*Window, error) {
+	cron, err := ParseCron(start)
+	if err != nil {
+		return nil, err
+	}
+	if duration <= 0 {
+		return nil, fmt.Errorf("window duration %s must be positive", duration)
+	}
+	location := time.UTC
+	if timeZone != "" {
+		if location, err = time.LoadLocation(timeZone); err != nil {
+			return nil, fmt.Errorf("invalid time zone %q: %w", timeZone, err)
+		}
+	}
+	return &Window{start: cron, duration: duration, location: location}, nil
+}
+
+// Active returns whether the window is open at t, and the next time after t at which it may open or close. The
+// returned time is zero if the window never opens again.
+func (w *Window) Active(t time.Time) (bool, time.Time) {
+	t = t.In(w.location)
+	// The window is open if it opened within the last duration, at the first start after t - duration - 1m at the
+	// latest, since starts are on minute boundaries.
+	start := w.start.Next(t.Add(-w.duration - time.Minute))
+	for !start.IsZero() && !start.After(t) {
+		if end := start.Add(w.duration); end.After(t) {
+			return true, end
+		}
+		start = w.start.Next(start)
+	}
+	return false, start
+}
@@ -0,0 +1,87 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	for _, expr := range []string{"* * * * *", "0 22 * * 1-5", "*/15 8-18 1,15 * 0,6", "30 2 * 1-12/3 7"} {
+		if _, err := ParseCron(expr); err != nil {
+			t.Errorf("ParseCron(%q) returned %v", expr, err)
+		}
+	}
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *",
+		"* * * * 8", "5-1 * * * *", "*/0 * * * *", "a * * * *"} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) succeeded, expected an error", expr)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	// 2026-01-05 is a Monday.
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2026, month, day, hour, minute, 0, 0, time.UTC)
+	}
+	tcs := []struct {
+		expr     string
+		from     time.Time
+		expected time.Time
+	}{
+		{"* * * * *", at(1, 5, 10, 0).Add(30 * time.Second), at(1, 5, 10, 1)},
+		{"0 22 * * 1-5", at(1, 5, 22, 0), at(1, 6, 22, 0)},
+		{"0 22 * * 1-5", at(1, 9, 23, 0), at(1, 12, 22, 0)},
+		{"*/15 8 * * *", at(1, 5, 8, 16), at(1, 5, 8, 30)},
+		{"0 0 1 */3 *", at(1, 5, 0, 0), at(4, 1, 0, 0)},
+		{"0 0 13 * 7", at(1, 5, 0, 0), at(1, 11, 0, 0)},
+		{"0 0 13 * 7", at(1, 11, 0, 0), at(1, 13, 0, 0)},
+		{"0 0 31 2 *", at(1, 5, 0, 0), time.Time{}},
+	}
+	for _, tc := range tcs {
+		cron, err := ParseCron(tc.expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q) returned %v", tc.expr, err)
+		}
+		if next := cron.Next(tc.from); !next.Equal(tc.expected) {
+			t.Errorf("Next(%q, %s) = %s, expected %s", tc.expr, tc.from, next, tc.expected)
+		}
+	}
+}
+
+func TestWindowActive(t *testing.T) {
+	window, err := NewWindow("0 22 * * 1-5", 2*time.Hour, "Europe/Paris")
+	if err != nil {
+		t.Fatalf("NewWindow returned %v", err)
+	}
+	paris, _ := time.LoadLocation("Europe/Paris")
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 1, day, hour, minute, 0, 0, paris)
+	}
+	tcs := []struct {
+		at       time.Time
+		active   bool
+		boundary time.Time
+	}{
+		{at(5, 21, 59), false, at(5, 22, 0)},
+		{at(5, 22, 0), true, at(6, 0, 0)},
+		{at(5, 23, 30).In(time.UTC), true, at(6, 0, 0)},
+		{at(6, 0, 0), false, at(6, 22, 0)},
+		// Friday's window ends at midnight, the next one opens on Monday.
+		{at(9, 23, 0), true, at(10, 0, 0)},
+		{at(10, 0, 0), false, at(12, 22, 0)},
+	}
+	for _, tc := range tcs {
+		active, boundary := window.Active(tc.at)
+		if active != tc.active || !boundary.Equal(tc.boundary) {
+			t.Errorf("Active(%s) = %t, %s, expected %t, %s", tc.at, active, boundary, tc.active, tc.boundary)
+		}
+	}
+
+	if _, err := NewWindow("0 22 * * *", 0, ""); err == nil {
+		t.Errorf("NewWindow with a zero duration succeeded, expected an error")
+	}
+	if _, err := NewWindow("0 22 * * *", time.Hour, "Nowhere/City"); err == nil {
+		t.Errorf("NewWindow with an unknown time zone succeeded, expected an error")
+	}
+}
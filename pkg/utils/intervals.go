@@ -0,0 +1,63 @@
+package utils
+
+// Interval is an inclusive interval of the values that a rule matches, the way the XDP program evaluates it: the
+// destination ports of TCP, UDP and SCTP rules, or the ICMP types and codes of ICMP and ICMPv6 rules as returned by
+// ICMPValue.
+type Interval struct {
+	Start, End uint32
+}
+
+// Contains returns true if value is in the interval.
+func (i Interval) Contains(value uint32) bool {
+	return i.Start <= value && value <= i.End
+}
+
+// IntervalsContain returns true if value is in one of the intervals.
+func IntervalsContain(intervals []Interval, value uint32) bool {
+	for _, interval := range intervals {
+		if interval.Contains(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// PortIntervals returns the destination ports that a rule with the provided start and end port matches. An end port
+// of 0 matches the start port alone, and the end port of a range is not matched. It returns nil if the rule matches
+// no port.
+func PortIntervals(start, end uint16) []Interval {
+	if end == 0 {
+		return []Interval{{Start: uint32(start), End: uint32(start)}}
+	}
+	if end <= start {
+		return nil
+	}
+	return []Interval{{Start: uint32(start), End: uint32(end) - 1}}
+}
+
+// ICMPValue returns the value of an ICMP type and code in the intervals of ICMPIntervals: the type in the high byte
+// and the code in the low byte.
+func ICMPValue(icmpType, icmpCode uint8) uint32 {
+	return uint32(icmpType)<<8 | uint32(icmpCode)
+}
+
+// ICMPIntervals returns the ICMP types and codes that a rule with the provided types and code matches. An end type
+// of 0 matches the start type alone, and the end type of a range is matched. A rule with anyCode matches every code
+// of its types, otherwise it matches icmpCode alone. It returns nil if the rule matches no type.
+func ICMPIntervals(icmpType, icmpTypeEnd, icmpCode uint8, anyCode bool) []Interval {
+	if icmpTypeEnd == 0 {
+		icmpTypeEnd = icmpType
+	}
+	if icmpTypeEnd < icmpType {
+		return nil
+	}
+	if anyCode {
+		return []Interval{{Start: ICMPValue(icmpType, 0), End: ICMPValue(icmpTypeEnd, 0xff)}}
+	}
+	var intervals []Interval
+	for t := uint32(icmpType); t <= uint32(icmpTypeEnd); t++ {
+		value := ICMPValue(uint8(t), icmpCode)
+		intervals = append(intervals, Interval{Start: value, End: value})
+	}
+	return intervals
+}
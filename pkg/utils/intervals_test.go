@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPortIntervals(t *testing.T) {
+	tcs := []struct {
+		start, end uint16
+		expected   []Interval
+	}{
+		{start: 80, expected: []Interval{{Start: 80, End: 80}}},
+		{start: 80, end: 90, expected: []Interval{{Start: 80, End: 89}}},
+		{start: 1, end: 65535, expected: []Interval{{Start: 1, End: 65534}}},
+		{start: 90, end: 80},
+		{start: 80, end: 80},
+	}
+	for _, tc := range tcs {
+		if intervals := PortIntervals(tc.start, tc.end); !reflect.DeepEqual(intervals, tc.expected) {
+			t.Fatalf("PortIntervals(%d, %d) = %v, expected %v", tc.start, tc.end, intervals, tc.expected)
+		}
+	}
+}
+
+func TestICMPIntervals(t *testing.T) {
+	tcs := []struct {
+		icmpType, icmpTypeEnd, icmpCode uint8
+		anyCode                         bool
+		expected                        []Interval
+	}{
+		{icmpType: 3, icmpCode: 1, expected: []Interval{{Start: 0x301, End: 0x301}}},
+		{icmpType: 3, icmpTypeEnd: 4, icmpCode: 1, expected: []Interval{{Start: 0x301, End: 0x301},
+			{Start: 0x401, End: 0x401}}},
+		{icmpType: 3, anyCode: true, expected: []Interval{{Start: 0x300, End: 0x3ff}}},
+		{icmpType: 3, icmpTypeEnd: 4, anyCode: true, expected: []Interval{{Start: 0x300, End: 0x4ff}}},
+		{icmpType: 255, icmpCode: 255, expected: []Interval{{Start: 0xffff, End: 0xffff}}},
+		{icmpType: 4, icmpTypeEnd: 3},
+	}
+	for _, tc := range tcs {
+		intervals := ICMPIntervals(tc.icmpType, tc.icmpTypeEnd, tc.icmpCode, tc.anyCode)
+		if !reflect.DeepEqual(intervals, tc.expected) {
+			t.Fatalf("ICMPIntervals(%d, %d, %d, %t) = %v, expected %v", tc.icmpType, tc.icmpTypeEnd, tc.icmpCode,
+				tc.anyCode, intervals, tc.expected)
+		}
+		for _, interval := range tc.expected {
+			if !IntervalsContain(intervals, interval.Start) || !IntervalsContain(intervals, interval.End) {
+				t.Fatalf("intervals %v do not contain %v", intervals, interval)
+			}
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+
+	ingressnodefwv1alpha1 "github.com/openshift/ingress-node-firewall/api/v1alpha1"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// IngressNodeFirewallAddressSetWebhook validates the CIDRs of IngressNodeFirewallAddressSets and that they do not
+// create order conflicts between the IngressNodeFirewalls that reference them.
+type IngressNodeFirewallAddressSetWebhook struct{}
+
+// +kubebuilder:webhook:path=/validate-ingressnodefirewall-openshift-io-v1alpha1-ingressnodefirewalladdressset,mutating=false,failurePolicy=fail,sideEffects=None,groups=ingressnodefirewall.openshift.io,resources=ingressnodefirewalladdresssets,verbs=create;update,versions=v1alpha1,name=vingressnodefirewalladdressset.kb.io,admissionReviewVersions=v1
+var _ webhook.CustomValidator = &IngressNodeFirewallAddressSetWebhook{}
+
+func (r *IngressNodeFirewallAddressSetWebhook) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	kubeClient = mgr.GetClient()
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&ingressnodefwv1alpha1.IngressNodeFirewallAddressSet{}).
+		WithValidator(&IngressNodeFirewallAddressSetWebhook{}).
+		Complete()
+}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *IngressNodeFirewallAddressSetWebhook) ValidateCreate(ctx context.Context, newObj runtime.Object) (warnings admission.Warnings, err error) {
+	addressSet, ok := newObj.(*ingressnodefwv1alpha1.IngressNodeFirewallAddressSet)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected an IngressNodeFirewallAddressSet but got a %T", newObj))
+	}
+
+	return nil, validateAddressSet(ctx, addressSet, kubeClient)
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *IngressNodeFirewallAddressSetWebhook) ValidateUpdate(ctx context.Context, _, newObj runtime.Object) (warnings admission.Warnings, err error) {
+	addressSet, ok := newObj.(*ingressnodefwv1alpha1.IngressNodeFirewallAddressSet)
+	if !ok {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected an IngressNodeFirewallAddressSet but got a %T", newObj))
+	}
+
+	return nil, validateAddressSet(ctx, addressSet, kubeClient)
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *IngressNodeFirewallAddressSetWebhook) ValidateDelete(_ context.Context, _ runtime.Object) (warnings admission.Warnings, err error) {
+	return nil, nil
+}
+
+// validateAddressSet returns an error if a CIDR of the address set is invalid or if the CIDRs create an order conflict
+// between the IngressNodeFirewalls that reference the address set and other IngressNodeFirewalls.
+func validateAddressSet(ctx context.Context, addressSet *ingressnodefwv1alpha1.IngressNodeFirewallAddressSet,
+	kubeClient client.Client) error {
+	var allErrs field.ErrorList
+	for cidrIndex, cidr := range addressSet.Spec.CIDRs {
+		if isValid, reason := validateSourceCIDR(cidr); !isValid {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("cidrs").Index(cidrIndex),
+				addressSet.Name, fmt.Sprintf("must be a valid IPV4 or IPV6 CIDR: %s", reason)))
+		}
+	}
+	if len(allErrs) == 0 {
+		allErrs = validateAddressSetReferences(ctx, addressSet, kubeClient)
+	}
+	if len(allErrs) > 0 {
+		return apierrors.NewInvalid(
+			schema.GroupKind{Group: ingressnodefwv1alpha1.GroupVersion.Group, Kind: "IngressNodeFirewallAddressSet"},
+			addressSet.Name, allErrs)
+	}
+	return nil
+}
+
+// validateAddressSetReferences runs the order conflict check of validateAgainstExistingINFs with the CIDRs of the
+// address set for each ingress rule that references it. An address set change can otherwise create the same conflict
+// that is rejected when the IngressNodeFirewall itself is created or updated.
+func validateAddressSetReferences(ctx context.Context, addressSet *ingressnodefwv1alpha1.IngressNodeFirewallAddressSet,
+	kubeClient client.Client) field.ErrorList {
+	var allErrs field.ErrorList
+	infList, newErr := getINFList(ctx, kubeClient)
+	if newErr != nil {
+		allErrs = append(allErrs, newErr)
+		return allErrs
+	}
+	nodeList, newErr := getNodeList(ctx, kubeClient)
+	if newErr != nil {
+		allErrs = append(allErrs, newErr)
+		return allErrs
+	}
+	addressSets, newErr := getAddressSets(ctx, kubeClient)
+	if newErr != nil {
+		allErrs = append(allErrs, newErr)
+		return allErrs
+	}
+	addressSets[addressSet.Name] = addressSet.Spec.CIDRs
+
+	for infIndex := range infList.Items {
+		inf := &infList.Items[infIndex]
+		for infRulesIndex, infRule := range inf.Spec.Ingress {
+			if !referencesAddressSet(infRule, addressSet.Name) {
+				continue
+			}
+			for _, conflict := range validateAgainstExistingINFs(nil, infList, nodeList, addressSets, inf,
+				expandAddressSets(infRule, addressSets), infRule.FirewallProtocolRules, infRulesIndex) {
+				allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("cidrs"), addressSet.Name,
+					fmt.Sprintf("creates an order conflict in %s of IngressNodeFirewall %q: %s",
+						conflict.Field, inf.Name, conflict.Detail)))
+			}
+		}
+	}
+	return allErrs
+}
+
+// referencesAddressSet returns true if the ingress rules reference the address set.
+func referencesAddressSet(infRule ingressnodefwv1alpha1.IngressNodeFirewallRules, name string) bool {
+	for _, ref := range infRule.SourceAddressSetRefs {
+		if ref == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,306 @@
+package webhook
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	ingressnodefwv1alpha1 "github.com/openshift/ingress-node-firewall/api/v1alpha1"
+	"github.com/openshift/ingress-node-firewall/pkg/utils"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// ruleMatch is the set of packets from the source CIDRs of a rule that the rule matches, the way the XDP program
+// evaluates it.
+type ruleMatch struct {
+	order  uint32
+	index  int
+	action ingressnodefwv1alpha1.IngressNodeFirewallActionType
+	// all is set for rules without protocol, which match every packet.
+	all      bool
+	protocol ingressnodefwv1alpha1.IngressNodeFirewallRuleProtocolType
+	// ipProtocol is the protocol number of IPProtocol rules.
+	ipProtocol uint8
+	// intervals are the matched destination ports of TCP, UDP and SCTP rules, or the matched ICMP types and codes of
+	// ICMP rules as the type in the high byte and the code in the low byte. Rules of other protocols match the
+	// interval of all values.
+	intervals []utils.Interval
+	// scheduled is set for rules that are only applied during the windows of their schedule.
+	scheduled bool
+}
+
+// ruleFinding is a rule that never matches a packet or whose packets partially overlap an earlier rule with the
+// opposite action. scheduleDependent is set if that is only the case while earlier rules with a schedule are applied.
+type ruleFinding struct {
+	index             int
+	message           string
+	scheduleDependent bool
+}
+
+// newRuleMatch returns the packets that a rule matches. It returns false for invalid rules, which are reported by
+// validateRule.
+func newRuleMatch(rule ingressnodefwv1alpha1.IngressNodeFirewallProtocolRule, index int) (ruleMatch, bool) {
+	m := ruleMatch{order: rule.Order, index: index, action: rule.Action, protocol: rule.ProtocolConfig.Protocol,
+		scheduled: rule.Schedule != nil}
+	var ports *ingressnodefwv1alpha1.IngressNodeFirewallProtoRule
+	var icmpRule *ingressnodefwv1alpha1.IngressNodeFirewallICMPRule
+	switch rule.ProtocolConfig.Protocol {
+	case "":
+		m.all = true
+		return m, true
+	case ingressnodefwv1alpha1.ProtocolTypeTCP:
+		ports = rule.ProtocolConfig.TCP
+	case ingressnodefwv1alpha1.ProtocolTypeUDP:
+		ports = rule.ProtocolConfig.UDP
+	case ingressnodefwv1alpha1.ProtocolTypeSCTP:
+		ports = rule.ProtocolConfig.SCTP
+	case ingressnodefwv1alpha1.ProtocolTypeICMP:
+		icmpRule = rule.ProtocolConfig.ICMP
+	case ingressnodefwv1alpha1.ProtocolTypeICMP6:
+		icmpRule = rule.ProtocolConfig.ICMPv6
+	case ingressnodefwv1alpha1.ProtocolTypeIPProtocol:
+		if rule.ProtocolConfig.IPProtocol == nil {
+			return m, false
+		}
+		m.ipProtocol = *rule.ProtocolConfig.IPProtocol
+		m.intervals = []utils.Interval{{Start: 0, End: 0}}
+		return m, true
+	default:
+		return m, false
+	}
+
+	if icmpRule != nil {
+		m.intervals = utils.ICMPIntervals(icmpRule.ICMPType, icmpRule.ICMPTypeEnd, icmpRule.ICMPCode, icmpRule.ICMPAnyCode)
+		return m, m.intervals != nil
+	}
+	if ports == nil {
+		return m, false
+	}
+	if utils.IsRange(ports) {
+		start, end, err := utils.GetRange(ports)
+		if err != nil {
+			return m, false
+		}
+		m.intervals = utils.PortIntervals(start, end)
+		return m, m.intervals != nil
+	}
+	port, err := utils.GetPort(ports)
+	if err != nil {
+		return m, false
+	}
+	m.intervals = utils.PortIntervals(port, 0)
+	return m, true
+}
+
+// sameProtocol returns true if both rules match packets of the same protocol.
+func (m ruleMatch) sameProtocol(other ruleMatch) bool {
+	return m.protocol == other.protocol && m.ipProtocol == other.ipProtocol
+}
+
+// overlaps returns true if a packet can match both rules.
+func (m ruleMatch) overlaps(other ruleMatch) bool {
+	if m.all || other.all {
+		return true
+	}
+	if !m.sameProtocol(other) {
+		return false
+	}
+	for _, a := range m.intervals {
+		for _, b := range other.intervals {
+			if a.Start <= b.End && b.Start <= a.End {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// contains returns true if every packet that other matches is matched by m.
+func (m ruleMatch) contains(other ruleMatch) bool {
+	if m.all {
+		return true
+	}
+	if other.all || !m.sameProtocol(other) {
+		return false
+	}
+	return covered(other.intervals, m.intervals)
+}
+
+// coveredBy returns true if every packet that m matches is matched by one of the rules.
+func (m ruleMatch) coveredBy(rules []ruleMatch) bool {
+	var intervals []utils.Interval
+	for _, rule := range rules {
+		if rule.all {
+			return true
+		}
+		if m.all || !rule.sameProtocol(m) {
+			continue
+		}
+		intervals = append(intervals, rule.intervals...)
+	}
+	if m.all {
+		return false
+	}
+	return covered(m.intervals, intervals)
+}
+
+// covered returns true if every interval of intervals is covered by the union of by.
+func covered(intervals, by []utils.Interval) bool {
+	by = append([]utils.Interval(nil), by...)
+	sort.Slice(by, func(i, j int) bool { return by[i].Start < by[j].Start })
+	for _, interval := range intervals {
+		next := interval.Start
+		done := false
+		for _, b := range by {
+			if b.Start > next {
+				break
+			}
+			if b.End >= next {
+				next = b.End + 1
+			}
+			if next > interval.End {
+				done = true
+				break
+			}
+		}
+		if !done {
+			return false
+		}
+	}
+	return true
+}
+
+// orders returns the orders of the rules as a readable list.
+func orders(rules []ruleMatch) string {
+	var strs []string
+	for _, rule := range rules {
+		strs = append(strs, fmt.Sprint(rule.order))
+	}
+	if len(strs) == 1 {
+		return "order " + strs[0]
+	}
+	return "orders " + strings.Join(strs, ", ")
+}
+
+// analyzeRules returns the rules that are shadowed by earlier rules with a different action, the rules that are
+// redundant because earlier rules with the same action match all of their packets, and the rules that partially
+// overlap an earlier rule with the opposite action. Rules are evaluated by their order. Earlier rules with a schedule
+// are only applied during their windows, the findings that depend on them are marked as schedule dependent.
+func analyzeRules(rules []ingressnodefwv1alpha1.IngressNodeFirewallProtocolRule) []ruleFinding {
+	var matches []ruleMatch
+	for index, rule := range rules {
+		if m, ok := newRuleMatch(rule, index); ok {
+			matches = append(matches, m)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].order < matches[j].order })
+
+	var findings []ruleFinding
+	for idx, m := range matches {
+		var overlapping, conflicting []ruleMatch
+		for _, earlier := range matches[:idx] {
+			if !earlier.overlaps(m) {
+				continue
+			}
+			overlapping = append(overlapping, earlier)
+			// Earlier rules that are contained in the rule are exceptions to it, which is how rules are meant to be
+			// combined, such as an allow-all rule after rules that deny some ports.
+			if earlier.action != m.action && !m.contains(earlier) {
+				conflicting = append(conflicting, earlier)
+			}
+		}
+		if message, ok := analyzeRule(m, unscheduled(overlapping), unscheduled(conflicting)); ok {
+			findings = append(findings, ruleFinding{index: m.index, message: message})
+		} else if message, ok := analyzeRule(m, overlapping, conflicting); ok {
+			findings = append(findings, ruleFinding{index: m.index, scheduleDependent: true, message: fmt.Sprintf(
+				"%s, while the schedules of the rules with %s are active", message,
+				orders(withSchedule(overlapping)))})
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].index < findings[j].index })
+	return findings
+}
+
+// analyzeRule returns the finding of a rule given the earlier rules that overlap it and those among them that
+// conflict with it, or false if there is none.
+func analyzeRule(m ruleMatch, overlapping, conflicting []ruleMatch) (string, bool) {
+	if len(overlapping) == 0 {
+		return "", false
+	}
+	switch {
+	case m.coveredBy(overlapping) && hasOtherAction(overlapping, m.action):
+		return fmt.Sprintf("rule with order %d never matches, it is shadowed by the rules with %s, and its action "+
+			"%s is overridden by the rules with %s", m.order, orders(overlapping), m.action,
+			orders(withOtherAction(overlapping, m.action))), true
+	case m.coveredBy(overlapping):
+		return fmt.Sprintf("rule with order %d is redundant, the rules with %s already %s all of its packets",
+			m.order, orders(overlapping), strings.ToLower(string(m.action))), true
+	case len(conflicting) > 0:
+		return fmt.Sprintf("rule with order %d conflicts with the rules with %s, the packets that both match are "+
+			"%s by them instead", m.order, orders(conflicting), actionPastTense(conflicting[0].action)), true
+	}
+	return "", false
+}
+
+// unscheduled returns the rules without a schedule, which are always applied.
+func unscheduled(rules []ruleMatch) []ruleMatch {
+	var always []ruleMatch
+	for _, rule := range rules {
+		if !rule.scheduled {
+			always = append(always, rule)
+		}
+	}
+	return always
+}
+
+// withSchedule returns the rules with a schedule.
+func withSchedule(rules []ruleMatch) []ruleMatch {
+	var scheduled []ruleMatch
+	for _, rule := range rules {
+		if rule.scheduled {
+			scheduled = append(scheduled, rule)
+		}
+	}
+	return scheduled
+}
+
+// withOtherAction returns the rules whose action differs from action.
+func withOtherAction(rules []ruleMatch, action ingressnodefwv1alpha1.IngressNodeFirewallActionType) []ruleMatch {
+	var others []ruleMatch
+	for _, rule := range rules {
+		if rule.action != action {
+			others = append(others, rule)
+		}
+	}
+	return others
+}
+
+func hasOtherAction(rules []ruleMatch, action ingressnodefwv1alpha1.IngressNodeFirewallActionType) bool {
+	return len(withOtherAction(rules, action)) > 0
+}
+
+func actionPastTense(action ingressnodefwv1alpha1.IngressNodeFirewallActionType) string {
+	if action == ingressnodefwv1alpha1.IngressNodeFirewallAllow {
+		return "allowed"
+	}
+	return "denied"
+}
+
+// validateRuleAnalysis returns the findings of analyzeRules for the rules of an IngressNodeFirewallRules as warnings,
+// or as errors if reject is set. Schedule dependent findings are always returned as warnings, as rules with a
+// schedule are meant to override later rules during their windows only.
+func validateRuleAnalysis(rules []ingressnodefwv1alpha1.IngressNodeFirewallProtocolRule, infRulesIndex int,
+	infName string, reject bool) ([]string, field.ErrorList) {
+	var warnings []string
+	var allErrs field.ErrorList
+	for _, finding := range analyzeRules(rules) {
+		path := field.NewPath("spec").Child("ingress").Index(infRulesIndex).Key("rules").Index(finding.index)
+		if reject && !finding.scheduleDependent {
+			allErrs = append(allErrs, field.Invalid(path, infName, finding.message))
+		} else {
+			warnings = append(warnings, fmt.Sprintf("%s: %s", path, finding.message))
+		}
+	}
+	return warnings, allErrs
+}
@@ -3,17 +3,23 @@ package webhook
 import (
 	"context"
 	"fmt"
+	"math"
 	"net"
 	"reflect"
+	"sort"
 	"strings"
+	"time"
 
 	ingressnodefwv1alpha1 "github.com/openshift/ingress-node-firewall/api/v1alpha1"
 	"github.com/openshift/ingress-node-firewall/pkg/failsaferules"
+	"github.com/openshift/ingress-node-firewall/pkg/schedule"
 	"github.com/openshift/ingress-node-firewall/pkg/utils"
 
 	"golang.org/x/sys/unix"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/validation/field"
@@ -27,6 +33,9 @@ type IngressNodeFirewallWebhook struct {
 	ingressnodefwv1alpha1.IngressNodeFirewall
 }
 
+// ingressNodeFirewallConfigName is the name of the IngressNodeFirewallConfig that the operator acts upon.
+const ingressNodeFirewallConfigName = "ingressnodefirewallconfig"
+
 type (
 	empty     struct{}
 	uint32Set map[uint32]empty
@@ -53,7 +62,7 @@ func (r *IngressNodeFirewallWebhook) ValidateCreate(ctx context.Context, newObj
 		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected an IngressNodeFirewall but got a %T", newObj))
 	}
 
-	return nil, validateIngressNodeFirewall(ctx, newINF, kubeClient)
+	return validateIngressNodeFirewall(ctx, newINF, kubeClient)
 }
 
 // ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
@@ -63,7 +72,7 @@ func (r *IngressNodeFirewallWebhook) ValidateUpdate(ctx context.Context, _, newO
 		return nil, apierrors.NewBadRequest(fmt.Sprintf("expected an IngressNodeFirewall but got a %T", newObj))
 	}
 
-	return nil, validateIngressNodeFirewall(ctx, newINF, kubeClient)
+	return validateIngressNodeFirewall(ctx, newINF, kubeClient)
 }
 
 // ValidateDelete implements webhook.Validator so a webhook will be registered for the type
@@ -71,18 +80,34 @@ func (r *IngressNodeFirewallWebhook) ValidateDelete(_ context.Context, _ runtime
 	return nil, nil
 }
 
-func validateIngressNodeFirewall(ctx context.Context, inf *ingressnodefwv1alpha1.IngressNodeFirewall, kubeClient client.Client) error {
-	if allErrs := validateINFRules(ctx, inf.Spec.Ingress, inf.Name, inf.Spec.NodeSelector, kubeClient); len(allErrs) > 0 {
-		return apierrors.NewInvalid(
+func validateIngressNodeFirewall(ctx context.Context, inf *ingressnodefwv1alpha1.IngressNodeFirewall,
+	kubeClient client.Client) (admission.Warnings, error) {
+	warnings, allErrs := validateINFRules(ctx, inf, kubeClient)
+	if len(allErrs) > 0 {
+		return warnings, apierrors.NewInvalid(
 			schema.GroupKind{Group: ingressnodefwv1alpha1.GroupVersion.Group, Kind: ingressnodefwv1alpha1.IngressNodeFirewall{}.Kind},
 			inf.Name, allErrs)
 	}
 	if allErrs := validateINFInterfaces(ctx, inf.Spec.Interfaces, inf.Name, kubeClient); len(allErrs) > 0 {
-		return apierrors.NewInvalid(
+		return warnings, apierrors.NewInvalid(
 			schema.GroupKind{Group: ingressnodefwv1alpha1.GroupVersion.Group, Kind: ingressnodefwv1alpha1.IngressNodeFirewall{}.Kind},
 			inf.Name, allErrs)
 	}
-	return nil
+	if allErrs := validateINFNodeSelector(inf.Spec.NodeSelector, inf.Name); len(allErrs) > 0 {
+		return warnings, apierrors.NewInvalid(
+			schema.GroupKind{Group: ingressnodefwv1alpha1.GroupVersion.Group, Kind: ingressnodefwv1alpha1.IngressNodeFirewall{}.Kind},
+			inf.Name, allErrs)
+	}
+	return warnings, nil
+}
+
+func validateINFNodeSelector(nodeSelector v1.LabelSelector, infName string) field.ErrorList {
+	var allErrs field.ErrorList
+	if _, err := v1.LabelSelectorAsSelector(&nodeSelector); err != nil {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("spec").Child("nodeSelector"),
+			infName, fmt.Sprintf("must be a valid label selector: %v", err)))
+	}
+	return allErrs
 }
 
 func validateINFInterfaces(ctx context.Context, infInterfaces []string, infName string, kubeClient client.Client) field.ErrorList {
@@ -108,53 +133,98 @@ func validateINFInterfaces(ctx context.Context, infInterfaces []string, infName
 	return allErrs
 }
 
-func validateINFRules(ctx context.Context, infRules []ingressnodefwv1alpha1.IngressNodeFirewallRules, infName string,
-	nodeSelector v1.LabelSelector, kubeClient client.Client) field.ErrorList {
+// validateINFRules validates the rules and returns warnings for shadowed, redundant and conflicting rules.
+func validateINFRules(ctx context.Context, inf *ingressnodefwv1alpha1.IngressNodeFirewall,
+	kubeClient client.Client) (admission.Warnings, field.ErrorList) {
 	var allErrs field.ErrorList
+	var warnings admission.Warnings
+	infRules, infName := inf.Spec.Ingress, inf.Name
 
 	infList, newErr := getINFList(ctx, kubeClient)
 	if newErr != nil {
 		allErrs = append(allErrs, newErr)
-		return allErrs
+		return nil, allErrs
+	}
+	nodeList, newErr := getNodeList(ctx, kubeClient)
+	if newErr != nil {
+		allErrs = append(allErrs, newErr)
+		return nil, allErrs
 	}
+	configSpec, newErr := getConfigSpec(ctx, kubeClient)
+	if newErr != nil {
+		allErrs = append(allErrs, newErr)
+		return nil, allErrs
+	}
+	addressSets, newErr := getAddressSets(ctx, kubeClient)
+	if newErr != nil {
+		allErrs = append(allErrs, newErr)
+		return nil, allErrs
+	}
+	maxRulesPerTarget := configSpec.GetMaxRulesPerTarget()
+	rejectFindings := configSpec.RuleAnalysis == ingressnodefwv1alpha1.RuleAnalysisReject
+	allowEssentialICMPv6 := configSpec.AllowEssentialICMPv6 != nil && *configSpec.AllowEssentialICMPv6
 
 	for infRulesIndex, infRule := range infRules {
-		if newErrs := validatesourceCIDRs(allErrs, infRule.SourceCIDRs, infRulesIndex, infName); len(newErrs) > 0 {
+		if newErrs := validatesourceCIDRs(allErrs, infRule, infRulesIndex, infName); len(newErrs) > 0 {
 			allErrs = append(allErrs, newErrs...)
 		}
 
-		if newErrs := validateRules(allErrs, infRule.FirewallProtocolRules, infRulesIndex, infName); len(newErrs) > 0 {
+		if newErrs := validateRules(allErrs, infRule.FirewallProtocolRules, infRulesIndex, infName, maxRulesPerTarget); len(newErrs) > 0 {
 			allErrs = append(allErrs, newErrs...)
 		}
 
-		if newErrs := validateAgainstExistingINFs(allErrs, infList, infRule.SourceCIDRs, infRule.FirewallProtocolRules,
-			infRulesIndex, infName, nodeSelector); len(newErrs) > 0 {
+		if newErrs := validateAgainstExistingINFs(allErrs, infList, nodeList, addressSets, inf,
+			expandAddressSets(infRule, addressSets), infRule.FirewallProtocolRules, infRulesIndex); len(newErrs) > 0 {
 			allErrs = append(allErrs, newErrs...)
 		}
+
+		newWarnings, newErrs := validateRuleAnalysis(infRule.FirewallProtocolRules, infRulesIndex, infName, rejectFindings)
+		warnings = append(warnings, newWarnings...)
+		allErrs = append(allErrs, newErrs...)
+
+		if !allowEssentialICMPv6 {
+			warnings = append(warnings, validateEssentialICMPv6(infRule, infRulesIndex)...)
+		}
 	}
-	return allErrs
+	return warnings, allErrs
 }
 
-func validatesourceCIDRs(allErrs field.ErrorList, sourceCIDRs []string, infRulesIndex int, infName string) field.ErrorList {
-	if len(sourceCIDRs) == 0 {
+func validatesourceCIDRs(allErrs field.ErrorList, infRule ingressnodefwv1alpha1.IngressNodeFirewallRules, infRulesIndex int,
+	infName string) field.ErrorList {
+	if len(infRule.SourceCIDRs) == 0 && len(infRule.SourceAddressSetRefs) == 0 && infRule.FromNodes == nil &&
+		len(infRule.FromClusterNetworks) == 0 {
 		allErrs = append(allErrs,
 			field.Invalid(field.NewPath("spec").Child("ingress").Index(infRulesIndex).Key("sourceCIDRs"),
-				infName, "must be at least one sourceCIDRs"))
+				infName, "must be at least one sourceCIDRs, sourceAddressSetRefs, fromNodes or fromClusterNetworks"))
 	} else {
-		for sourceCIDRSIndex, sourceCIDR := range sourceCIDRs {
+		for sourceCIDRSIndex, sourceCIDR := range infRule.SourceCIDRs {
 			if isValid, reason := validateSourceCIDR(sourceCIDR); !isValid {
 				allErrs = append(allErrs, field.Invalid(
 					field.NewPath("spec").Child("ingress").Index(infRulesIndex).Key("sourceCIDRs").Index(sourceCIDRSIndex),
 					infName, fmt.Sprintf("must be a valid IPV4 or IPV6 CIDR: %s", reason)))
 			}
 		}
+		for refIndex, ref := range infRule.SourceAddressSetRefs {
+			if strings.TrimSpace(ref) == "" {
+				allErrs = append(allErrs, field.Invalid(
+					field.NewPath("spec").Child("ingress").Index(infRulesIndex).Key("sourceAddressSetRefs").Index(refIndex),
+					infName, "must be the name of an IngressNodeFirewallAddressSet"))
+			}
+		}
+		if infRule.FromNodes != nil {
+			if _, err := v1.LabelSelectorAsSelector(infRule.FromNodes); err != nil {
+				allErrs = append(allErrs, field.Invalid(
+					field.NewPath("spec").Child("ingress").Index(infRulesIndex).Key("fromNodes"),
+					infName, fmt.Sprintf("must be a valid label selector: %v", err)))
+			}
+		}
 	}
 	return allErrs
 }
 
 func validateRules(allErrs field.ErrorList, rules []ingressnodefwv1alpha1.IngressNodeFirewallProtocolRule, infRulesIndex int,
-	infName string) field.ErrorList {
-	if err := validateRuleLength(rules, infRulesIndex, infName); err != nil {
+	infName string, maxRulesPerTarget int) field.ErrorList {
+	if err := validateRuleLength(rules, infRulesIndex, infName, maxRulesPerTarget); err != nil {
 		allErrs = append(allErrs, err)
 	}
 	if !orderIsUnique(rules) {
@@ -184,6 +254,13 @@ func validateRule(rule ingressnodefwv1alpha1.IngressNodeFirewallProtocolRule, in
 		}
 	}
 
+	if rule.ProtocolConfig.Protocol == ingressnodefwv1alpha1.ProtocolTypeIPProtocol {
+		if isValid, reason := isValidIPProtocolRule(rule); !isValid {
+			return field.Invalid(field.NewPath("spec").Child("ingress").Index(infRulesIndex).Key("rules").Index(ruleIndex),
+				infName, fmt.Sprintf("must be a valid IPProtocol rule: %s", reason))
+		}
+	}
+
 	if rule.ProtocolConfig.Protocol == ingressnodefwv1alpha1.ProtocolTypeTCP || rule.ProtocolConfig.Protocol == ingressnodefwv1alpha1.ProtocolTypeUDP {
 		if isConflict, err := isConflictWithSafeRulesTransport(rule); !isConflict && err != nil {
 			return field.Invalid(field.NewPath("spec").Child("ingress").Index(infRulesIndex).Key("rules").Index(ruleIndex),
@@ -193,9 +270,39 @@ func validateRule(rule ingressnodefwv1alpha1.IngressNodeFirewallProtocolRule, in
 				err.Error())
 		}
 	}
+
+	if rule.Schedule != nil {
+		if _, err := schedule.NewWindow(rule.Schedule.Start, rule.Schedule.Duration.Duration, rule.Schedule.TimeZone); err != nil {
+			return field.Invalid(field.NewPath("spec").Child("ingress").Index(infRulesIndex).Key("rules").Index(ruleIndex).Child("schedule"),
+				infName, fmt.Sprintf("must be a valid schedule: %v", err))
+		}
+	}
+
+	if rule.AutoBan != nil {
+		if isValid, reason := isValidAutoBan(rule); !isValid {
+			return field.Invalid(field.NewPath("spec").Child("ingress").Index(infRulesIndex).Key("rules").Index(ruleIndex).Child("autoBan"),
+				infName, fmt.Sprintf("must be a valid autoBan: %s", reason))
+		}
+	}
 	return nil
 }
 
+func isValidAutoBan(rule ingressnodefwv1alpha1.IngressNodeFirewallProtocolRule) (bool, string) {
+	if rule.Action != ingressnodefwv1alpha1.IngressNodeFirewallDeny {
+		return false, "autoBan requires the Deny action"
+	}
+	if rule.AutoBan.Threshold == 0 {
+		return false, "threshold must be at least 1"
+	}
+	if rule.AutoBan.Period.Duration < time.Second || rule.AutoBan.Period.Duration.Seconds() > math.MaxUint32 {
+		return false, "period must be at least 1s and at most 4294967295s"
+	}
+	if rule.AutoBan.BanDuration.Duration < time.Second || rule.AutoBan.BanDuration.Duration.Seconds() > math.MaxUint32 {
+		return false, "banDuration must be at least 1s and at most 4294967295s"
+	}
+	return true, ""
+}
+
 func isConflictWithSafeRulesTransport(rule ingressnodefwv1alpha1.IngressNodeFirewallProtocolRule) (bool, error) {
 	var failSafeRules []failsaferules.TransportProtoFailSafeRule
 	var err error
@@ -242,10 +349,66 @@ func isConflictWithSafeRulesTransport(rule ingressnodefwv1alpha1.IngressNodeFire
 	return false, nil
 }
 
-func validateRuleLength(infRules []ingressnodefwv1alpha1.IngressNodeFirewallProtocolRule, infRulesIndex int, infName string) *field.Error {
-	if len(infRules) > failsaferules.MAX_INGRESS_RULES {
+// validateEssentialICMPv6 returns warnings for the rules that deny the ICMPv6 messages of the ICMPv6 fail safe rules
+// from the source CIDRs of an IngressNodeFirewallRules, which breaks IPv6 connectivity to the nodes unless the daemon
+// allows these messages ahead of the rules.
+func validateEssentialICMPv6(infRule ingressnodefwv1alpha1.IngressNodeFirewallRules, infRulesIndex int) []string {
+	var matches []ruleMatch
+	for index, rule := range infRule.FirewallProtocolRules {
+		if m, ok := newRuleMatch(rule, index); ok {
+			matches = append(matches, m)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].order < matches[j].order })
+
+	var warnings []string
+	for _, failSafeRule := range failsaferules.GetICMPv6() {
+		_, failSafeNet, err := net.ParseCIDR(failSafeRule.GetSourceCIDR())
+		if err != nil || !overlapsAnyCIDR(infRule.SourceCIDRs, failSafeNet) {
+			continue
+		}
+		denied := make(map[int]bool)
+		// The messages of the fail safe rules are sent with code 0.
+		for icmpType := uint32(failSafeRule.GetICMPType()); icmpType <= uint32(failSafeRule.GetICMPTypeEnd()); icmpType++ {
+			packet := ruleMatch{protocol: ingressnodefwv1alpha1.ProtocolTypeICMP6,
+				intervals: utils.ICMPIntervals(uint8(icmpType), 0, 0, false)}
+			for _, m := range matches {
+				if !m.contains(packet) {
+					continue
+				}
+				if m.action == ingressnodefwv1alpha1.IngressNodeFirewallDeny && !denied[m.index] {
+					denied[m.index] = true
+					path := field.NewPath("spec").Child("ingress").Index(infRulesIndex).Key("rules").Index(m.index)
+					warnings = append(warnings, fmt.Sprintf("%s: rule with order %d denies %s from %s, set "+
+						"allowEssentialICMPv6 in the IngressNodeFirewallConfig to allow it", path, m.order,
+						failSafeRule.GetServiceName(), failSafeRule.GetSourceCIDR()))
+				}
+				break
+			}
+		}
+	}
+	return warnings
+}
+
+// overlapsAnyCIDR returns true if one of the CIDRs contains ipNet or is contained in it.
+func overlapsAnyCIDR(cidrs []string, ipNet *net.IPNet) bool {
+	for _, cidr := range cidrs {
+		ip, cidrNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			continue
+		}
+		if cidrNet.Contains(ipNet.IP) || ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func validateRuleLength(infRules []ingressnodefwv1alpha1.IngressNodeFirewallProtocolRule, infRulesIndex int, infName string,
+	maxRulesPerTarget int) *field.Error {
+	if len(infRules) > maxRulesPerTarget {
 		return field.Invalid(field.NewPath("spec").Child("ingress").Index(infRulesIndex).Key("rules"),
-			infName, fmt.Sprintf("must be no more than %d rules", failsaferules.MAX_INGRESS_RULES))
+			infName, fmt.Sprintf("must be no more than %d rules", maxRulesPerTarget))
 	}
 	return nil
 }
@@ -266,9 +429,22 @@ func isValidICMPICMPV6Rule(rule ingressnodefwv1alpha1.IngressNodeFirewallProtoco
 		(rule.ProtocolConfig.ICMPv6 == nil || rule.ProtocolConfig.ICMP != nil) {
 		return false, "no ICMPv6 rules defined. Define icmpType/icmpCode"
 	}
+	icmpRule := rule.ProtocolConfig.ICMP
+	if icmpRule == nil {
+		icmpRule = rule.ProtocolConfig.ICMPv6
+	}
+	if icmpRule.ICMPTypeEnd != 0 && icmpRule.ICMPTypeEnd < icmpRule.ICMPType {
+		return false, "icmpTypeEnd must not be less than icmpType"
+	}
+	if icmpRule.ICMPAnyCode && icmpRule.ICMPCode != 0 {
+		return false, "icmpCode and icmpAnyCode are mutually exclusive"
+	}
 	if rule.ProtocolConfig.TCP != nil || rule.ProtocolConfig.UDP != nil || rule.ProtocolConfig.SCTP != nil {
 		return false, "ports are erroneously defined"
 	}
+	if rule.ProtocolConfig.IPProtocol != nil {
+		return false, "ipProtocol defined for a non-IPProtocol rule"
+	}
 	return true, ""
 }
 
@@ -298,6 +474,36 @@ func isValidTCPUDPSCTPRule(rule ingressnodefwv1alpha1.IngressNodeFirewallProtoco
 		}
 	}
 
+	if rule.ProtocolConfig.ICMP != nil || rule.ProtocolConfig.ICMPv6 != nil {
+		return false, "ICMP type/code defined for a non-ICMP(V6) rule"
+	}
+	if rule.ProtocolConfig.IPProtocol != nil {
+		return false, "ipProtocol defined for a non-IPProtocol rule"
+	}
+	return true, ""
+}
+
+func isValidIPProtocolRule(rule ingressnodefwv1alpha1.IngressNodeFirewallProtocolRule) (bool, string) {
+	if rule.ProtocolConfig.IPProtocol == nil {
+		return false, "no ipProtocol defined"
+	}
+	switch *rule.ProtocolConfig.IPProtocol {
+	case 0:
+		return false, "ipProtocol must be between 1 and 255"
+	case unix.IPPROTO_TCP:
+		return false, "use protocol TCP for ipProtocol 6"
+	case unix.IPPROTO_UDP:
+		return false, "use protocol UDP for ipProtocol 17"
+	case unix.IPPROTO_SCTP:
+		return false, "use protocol SCTP for ipProtocol 132"
+	case unix.IPPROTO_ICMP:
+		return false, "use protocol ICMP for ipProtocol 1"
+	case unix.IPPROTO_ICMPV6:
+		return false, "use protocol ICMPv6 for ipProtocol 58"
+	}
+	if rule.ProtocolConfig.TCP != nil || rule.ProtocolConfig.UDP != nil || rule.ProtocolConfig.SCTP != nil {
+		return false, "ports are erroneously defined"
+	}
 	if rule.ProtocolConfig.ICMP != nil || rule.ProtocolConfig.ICMPv6 != nil {
 		return false, "ICMP type/code defined for a non-ICMP(V6) rule"
 	}
@@ -327,25 +533,164 @@ func getINFList(ctx context.Context, kubeClient client.Client) (*ingressnodefwv1
 	return infList, nil
 }
 
-func validateAgainstExistingINFs(allErrs field.ErrorList, infList *ingressnodefwv1alpha1.IngressNodeFirewallList, newSourceCIDRs []string,
-	newRules []ingressnodefwv1alpha1.IngressNodeFirewallProtocolRule, newINFRulesIndex int, newINFName string, newNodeSelector v1.LabelSelector) field.ErrorList {
+// getAddressSets returns the CIDRs of each IngressNodeFirewallAddressSet by name.
+func getAddressSets(ctx context.Context, kubeClient client.Client) (map[string][]string, *field.Error) {
+	addressSetList := &ingressnodefwv1alpha1.IngressNodeFirewallAddressSetList{}
+	if err := kubeClient.List(ctx, addressSetList, &client.ListOptions{}); err != nil {
+		return nil, field.InternalError(field.NewPath("spec").Child("ingress"),
+			fmt.Errorf("failed to get list of IngressNodeFirewallAddressSets from Kubernetes API server and therefore"+
+				" unable to validate IngressNodeFirewall against existing IngressNodeFirewall: %v", err))
+	}
+	addressSets := make(map[string][]string, len(addressSetList.Items))
+	for _, addressSet := range addressSetList.Items {
+		addressSets[addressSet.Name] = addressSet.Spec.CIDRs
+	}
+	return addressSets, nil
+}
+
+// expandAddressSets returns the distinct sourceCIDRs of the ingress rules and the CIDRs of the address sets that they
+// reference. References to address sets that do not exist are skipped, the operator reports them when it applies the
+// rules.
+func expandAddressSets(infRule ingressnodefwv1alpha1.IngressNodeFirewallRules, addressSets map[string][]string) []string {
+	if len(infRule.SourceAddressSetRefs) == 0 {
+		return infRule.SourceCIDRs
+	}
+	var sourceCIDRs []string
+	seen := make(map[string]empty)
+	add := func(cidrs []string) {
+		for _, cidr := range cidrs {
+			cidr = strings.TrimSpace(cidr)
+			if _, ok := seen[cidr]; !ok {
+				seen[cidr] = empty{}
+				sourceCIDRs = append(sourceCIDRs, cidr)
+			}
+		}
+	}
+	add(infRule.SourceCIDRs)
+	for _, ref := range infRule.SourceAddressSetRefs {
+		add(addressSets[ref])
+	}
+	return sourceCIDRs
+}
+
+// getConfigSpec returns the spec of the IngressNodeFirewallConfig, or an empty spec with the defaults if no
+// IngressNodeFirewallConfig exists.
+func getConfigSpec(ctx context.Context, kubeClient client.Client) (ingressnodefwv1alpha1.IngressNodeFirewallConfigSpec, *field.Error) {
+	configList := &ingressnodefwv1alpha1.IngressNodeFirewallConfigList{}
+	if err := kubeClient.List(ctx, configList, &client.ListOptions{}); err != nil {
+		return ingressnodefwv1alpha1.IngressNodeFirewallConfigSpec{}, field.InternalError(field.NewPath("spec").Child("ingress"),
+			fmt.Errorf("failed to get list of IngressNodeFirewallConfigs from Kubernetes API server and therefore unable"+
+				" to validate the rules: %v", err))
+	}
+	for _, config := range configList.Items {
+		if config.Name == ingressNodeFirewallConfigName {
+			return config.Spec, nil
+		}
+	}
+	return ingressnodefwv1alpha1.IngressNodeFirewallConfigSpec{}, nil
+}
+
+// getNodeList returns the nodes of the cluster.
+func getNodeList(ctx context.Context, kubeClient client.Client) (*corev1.NodeList, *field.Error) {
+	nodeList := &corev1.NodeList{}
+	if err := kubeClient.List(ctx, nodeList, &client.ListOptions{}); err != nil {
+		return nil, field.InternalError(field.NewPath("spec").Child("ingress"),
+			fmt.Errorf("failed to get list of Nodes from Kubernetes API server and therefore unable"+
+				" to validate IngressNodeFirewall against existing IngressNodeFirewall: %v", err))
+	}
+	return nodeList, nil
+}
+
+// selectedNodes returns the names of the nodes that match nodeSelector, nil if nodeSelector is invalid.
+func selectedNodes(nodeList *corev1.NodeList, nodeSelector v1.LabelSelector) map[string]empty {
+	selector, err := v1.LabelSelectorAsSelector(&nodeSelector)
+	if err != nil {
+		return nil
+	}
+	nodes := make(map[string]empty)
+	for _, node := range nodeList.Items {
+		if selector.Matches(labels.Set(node.Labels)) {
+			nodes[node.Name] = empty{}
+		}
+	}
+	return nodes
+}
+
+// sharedNodes returns the sorted names of the nodes in both sets.
+func sharedNodes(a, b map[string]empty) []string {
+	var shared []string
+	for name := range a {
+		if _, ok := b[name]; ok {
+			shared = append(shared, name)
+		}
+	}
+	sort.Strings(shared)
+	return shared
+}
+
+// sharesInterface returns true if both lists of interfaces have an interface in common.
+func sharesInterface(a, b []string) bool {
+	for _, ifaceA := range a {
+		for _, ifaceB := range b {
+			if ifaceA == ifaceB {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// nodeNames returns the names of the nodes as a readable list of at most maxListedNodes names.
+func nodeNames(names []string) string {
+	const maxListedNodes = 5
+	if len(names) > maxListedNodes {
+		return fmt.Sprintf("%s and %d more", strings.Join(names[:maxListedNodes], ", "), len(names)-maxListedNodes)
+	}
+	return strings.Join(names, ", ")
+}
+
+// validateAgainstExistingINFs rejects rules whose order is already used for the same sourceCIDR by an existing
+// IngressNodeFirewall with the same priority that applies to the same interfaces of any node. Such rules cannot be
+// merged into the IngressNodeFirewallNodeStates of the shared nodes. IngressNodeFirewalls with the same node selector
+// always conflict, also if the selector does not match any node yet. The sourceCIDRs of the existing rules are
+// compared with the CIDRs of the address sets that they reference, newSourceCIDRs must include them as well.
+func validateAgainstExistingINFs(allErrs field.ErrorList, infList *ingressnodefwv1alpha1.IngressNodeFirewallList,
+	nodeList *corev1.NodeList, addressSets map[string][]string, newINF *ingressnodefwv1alpha1.IngressNodeFirewall,
+	newSourceCIDRs []string, newRules []ingressnodefwv1alpha1.IngressNodeFirewallProtocolRule,
+	newINFRulesIndex int) field.ErrorList {
+	newINFName := newINF.Name
+	newNodes := selectedNodes(nodeList, newINF.Spec.NodeSelector)
 
 	for _, existingINF := range infList.Items {
 		existingINFName := existingINF.Name
-		// Need to validate rules only if they are applied to the same Nodes
-		if reflect.DeepEqual(existingINF.Spec.NodeSelector, newNodeSelector) {
-			for _, existingRules := range existingINF.Spec.Ingress {
-				for _, existingSourceCIDR := range existingRules.SourceCIDRs {
-					for _, newSourceCIDR := range newSourceCIDRs {
-						if strings.TrimSpace(newSourceCIDR) == strings.TrimSpace(existingSourceCIDR) {
-							if existingINFName != newINFName && isOrderOverlapping(existingRules.FirewallProtocolRules, newRules) {
-								allErrs = append(allErrs,
-									field.Invalid(field.NewPath("spec").Child("ingress").Index(newINFRulesIndex).Key("rules"),
-										newINFName, fmt.Sprintf("order is not unique for sourceCIDR %q and conflicts with "+
-											"IngressNodeFirewall %q", newSourceCIDR, existingINF.Name)))
-							}
-						}
+		// Need to validate rules only if they are applied to the same interfaces of the same Nodes with the same
+		// priority. Rules of different priorities are ordered by their priority first.
+		if existingINFName == newINFName || existingINF.Spec.Priority != newINF.Spec.Priority ||
+			!sharesInterface(existingINF.Spec.Interfaces, newINF.Spec.Interfaces) {
+			continue
+		}
+		sameSelector := reflect.DeepEqual(existingINF.Spec.NodeSelector, newINF.Spec.NodeSelector)
+		nodes := sharedNodes(newNodes, selectedNodes(nodeList, existingINF.Spec.NodeSelector))
+		if !sameSelector && len(nodes) == 0 {
+			continue
+		}
+		for _, existingRules := range existingINF.Spec.Ingress {
+			for _, existingSourceCIDR := range expandAddressSets(existingRules, addressSets) {
+				for _, newSourceCIDR := range newSourceCIDRs {
+					if strings.TrimSpace(newSourceCIDR) != strings.TrimSpace(existingSourceCIDR) ||
+						!isOrderOverlapping(existingRules.FirewallProtocolRules, newRules) {
+						continue
+					}
+					msg := fmt.Sprintf("order is not unique for sourceCIDR %q and conflicts with IngressNodeFirewall %q",
+						newSourceCIDR, existingINF.Name)
+					if len(nodes) > 0 {
+						msg += fmt.Sprintf(" on nodes %s", nodeNames(nodes))
+					} else {
+						msg += " with the same nodeSelector"
 					}
+					allErrs = append(allErrs,
+						field.Invalid(field.NewPath("spec").Child("ingress").Index(newINFRulesIndex).Key("rules"),
+							newINFName, msg))
 				}
 			}
 		}
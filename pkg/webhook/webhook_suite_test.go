@@ -32,6 +32,7 @@ import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
 	//+kubebuilder:scaffold:imports
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -67,6 +68,7 @@ const (
 	invalidPortRangeA = "90-80"
 	invalidPortRangeB = "90-90"
 	invalidPortRangeC = "-90"
+	vrrpProtocol      = 112
 )
 
 func TestAPIs(t *testing.T) {
@@ -103,6 +105,9 @@ var _ = BeforeSuite(func() {
 	err = admissionv1beta1.AddToScheme(scheme)
 	Expect(err).NotTo(HaveOccurred())
 
+	err = corev1.AddToScheme(scheme)
+	Expect(err).NotTo(HaveOccurred())
+
 	//+kubebuilder:scaffold:scheme
 
 	k8sClient, err = client.New(cfg, client.Options{Scheme: scheme})
@@ -127,6 +132,8 @@ var _ = BeforeSuite(func() {
 
 	err = (&IngressNodeFirewallWebhook{}).SetupWebhookWithManager(mgr)
 	Expect(err).NotTo(HaveOccurred())
+	err = (&IngressNodeFirewallAddressSetWebhook{}).SetupWebhookWithManager(mgr)
+	Expect(err).NotTo(HaveOccurred())
 
 	//+kubebuilder:scaffold:webhook
 
@@ -182,6 +189,36 @@ var _ = Describe("Interfaces", func() {
 	})
 })
 
+var _ = Describe("Node selector", func() {
+	var inf *ingressnodefwv1alpha1.IngressNodeFirewall
+
+	BeforeEach(func() {
+		inf = getIngressNodeFirewall("nodeselector")
+		configInterfaces(inf, []string{"eth0"})
+		initCIDRICMPRule(inf, ipv4CIDR, validOrder, false, icmpTypeEchoReply, icmpTypeEchoReply, ingressnodefwv1alpha1.IngressNodeFirewallAllow)
+	})
+
+	It("allows selector with match expressions", func() {
+		inf.Spec.NodeSelector = metav1.LabelSelector{
+			MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "node-role.kubernetes.io/worker", Operator: metav1.LabelSelectorOpExists},
+				{Key: "zone", Operator: metav1.LabelSelectorOpIn, Values: []string{"a", "b"}},
+			},
+		}
+		Expect(createIngressNodeFirewall(inf)).To(Succeed())
+		Expect(deleteIngressNodeFirewall(inf)).To(Succeed())
+	})
+
+	It("rejects selector with invalid match expression", func() {
+		inf.Spec.NodeSelector = metav1.LabelSelector{
+			MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "zone", Operator: metav1.LabelSelectorOpIn},
+			},
+		}
+		Expect(createIngressNodeFirewall(inf)).ToNot(Succeed())
+	})
+})
+
 var _ = Describe("Rules", func() {
 	Context("protocol is ICMPv4", func() {
 		var inf *ingressnodefwv1alpha1.IngressNodeFirewall
@@ -213,6 +250,25 @@ var _ = Describe("Rules", func() {
 			inf.Spec.Ingress[0].FirewallProtocolRules[0].ProtocolConfig.ICMPv6 = icmp6Rule
 			Expect(createIngressNodeFirewall(inf)).ToNot(Succeed())
 		})
+
+		It("allows rule with a type range and any code", func() {
+			icmpRule := inf.Spec.Ingress[0].FirewallProtocolRules[0].ProtocolConfig.ICMP
+			icmpRule.ICMPType, icmpRule.ICMPTypeEnd, icmpRule.ICMPCode, icmpRule.ICMPAnyCode = 3, 5, 0, true
+			Expect(createIngressNodeFirewall(inf)).To(Succeed())
+			Expect(deleteIngressNodeFirewall(inf)).To(Succeed())
+		})
+
+		It("rejects rule with a code and any code", func() {
+			icmpRule := inf.Spec.Ingress[0].FirewallProtocolRules[0].ProtocolConfig.ICMP
+			icmpRule.ICMPType, icmpRule.ICMPCode, icmpRule.ICMPAnyCode = 3, 1, true
+			Expect(createIngressNodeFirewall(inf)).ToNot(Succeed())
+		})
+
+		It("rejects rule with a type range ending before its start", func() {
+			icmpRule := inf.Spec.Ingress[0].FirewallProtocolRules[0].ProtocolConfig.ICMP
+			icmpRule.ICMPType, icmpRule.ICMPTypeEnd = 5, 3
+			Expect(createIngressNodeFirewall(inf)).ToNot(Succeed())
+		})
 	})
 
 	Context("protocol is ICMPv6", func() {
@@ -382,6 +438,53 @@ var _ = Describe("Rules", func() {
 		})
 	})
 
+	Context("protocol is IPProtocol", func() {
+		var inf *ingressnodefwv1alpha1.IngressNodeFirewall
+		BeforeEach(func() {
+			inf = getIngressNodeFirewall("rulesipprotocol")
+			configInterfaces(inf, []string{"eth0"})
+			initCIDRIPProtocolRule(inf, ipv4CIDR, validOrder, vrrpProtocol, ingressnodefwv1alpha1.IngressNodeFirewallDeny)
+		})
+
+		It("allows valid rule", func() {
+			Expect(createIngressNodeFirewall(inf)).To(Succeed())
+			Expect(deleteIngressNodeFirewall(inf)).To(Succeed())
+		})
+
+		It("rejects rule with no ipProtocol defined", func() {
+			inf.Spec.Ingress[0].FirewallProtocolRules[0].ProtocolConfig.IPProtocol = nil
+			Expect(createIngressNodeFirewall(inf)).ToNot(Succeed())
+		})
+
+		It("rejects rule with ipProtocol as 0", func() {
+			*inf.Spec.Ingress[0].FirewallProtocolRules[0].ProtocolConfig.IPProtocol = 0
+			Expect(createIngressNodeFirewall(inf)).ToNot(Succeed())
+		})
+
+		It("rejects rule with the ipProtocol of TCP", func() {
+			*inf.Spec.Ingress[0].FirewallProtocolRules[0].ProtocolConfig.IPProtocol = 6
+			Expect(createIngressNodeFirewall(inf)).ToNot(Succeed())
+		})
+
+		It("rejects rule with the ipProtocol of ICMPv6", func() {
+			*inf.Spec.Ingress[0].FirewallProtocolRules[0].ProtocolConfig.IPProtocol = 58
+			Expect(createIngressNodeFirewall(inf)).ToNot(Succeed())
+		})
+
+		It("rejects rule with port defined", func() {
+			portRule := &ingressnodefwv1alpha1.IngressNodeFirewallProtoRule{Ports: intstr.FromString(validPort)}
+			inf.Spec.Ingress[0].FirewallProtocolRules[0].ProtocolConfig.TCP = portRule
+			Expect(createIngressNodeFirewall(inf)).ToNot(Succeed())
+		})
+
+		It("rejects ipProtocol for another protocol", func() {
+			initCIDRTransportRule(inf, ipv4CIDR, validOrder+1, ingressnodefwv1alpha1.ProtocolTypeTCP, validPort, ingressnodefwv1alpha1.IngressNodeFirewallAllow)
+			protocol := uint8(vrrpProtocol)
+			inf.Spec.Ingress[1].FirewallProtocolRules[0].ProtocolConfig.IPProtocol = &protocol
+			Expect(createIngressNodeFirewall(inf)).ToNot(Succeed())
+		})
+	})
+
 	Context("Meta", func() {
 		var inf *ingressnodefwv1alpha1.IngressNodeFirewall
 
@@ -450,6 +553,178 @@ var _ = Describe("Rules", func() {
 			Expect(createIngressNodeFirewall(inf2)).ToNot(Succeed())
 			Expect(deleteIngressNodeFirewall(inf)).To(Succeed())
 		})
+		It("validate rules with the same node selector and different priorities", func() {
+			inf.Spec.NodeSelector = metav1.LabelSelector{
+				MatchLabels: map[string]string{consts.IngressNodeFirewallNodeLabel: "label1"},
+			}
+			configInterfaces(inf, []string{"eth0", "eth1"})
+			Expect(createIngressNodeFirewall(inf)).To(Succeed())
+			// again, create inf which has sourceCIRDR X order one and expect to succeed because its priority differs
+			inf2 := inf.DeepCopy()
+			inf2.Name = "different-priorities"
+			inf2.ResourceVersion = ""
+			inf2.Spec.Priority = 10
+			Expect(createIngressNodeFirewall(inf2)).To(Succeed())
+			Expect(deleteIngressNodeFirewall(inf2)).To(Succeed())
+			Expect(deleteIngressNodeFirewall(inf)).To(Succeed())
+		})
+		It("allows rule with a valid schedule", func() {
+			inf.Spec.Ingress[0].FirewallProtocolRules[0].Schedule = &ingressnodefwv1alpha1.IngressNodeFirewallSchedule{
+				Start:    "0 22 * * 1-5",
+				Duration: metav1.Duration{Duration: 2 * time.Hour},
+				TimeZone: "Europe/Paris",
+			}
+			Expect(createIngressNodeFirewall(inf)).To(Succeed())
+			Expect(deleteIngressNodeFirewall(inf)).To(Succeed())
+		})
+		It("rejects rule with an invalid schedule", func() {
+			inf.Spec.Ingress[0].FirewallProtocolRules[0].Schedule = &ingressnodefwv1alpha1.IngressNodeFirewallSchedule{
+				Start:    "0 22 * *",
+				Duration: metav1.Duration{Duration: 2 * time.Hour},
+			}
+			Expect(createIngressNodeFirewall(inf)).ToNot(Succeed())
+			inf.Spec.Ingress[0].FirewallProtocolRules[0].Schedule.Start = "0 22 * * 1-5"
+			inf.Spec.Ingress[0].FirewallProtocolRules[0].Schedule.TimeZone = "Nowhere/City"
+			Expect(createIngressNodeFirewall(inf)).ToNot(Succeed())
+		})
+		It("allows deny rule with autoBan", func() {
+			inf.Spec.Ingress[0].FirewallProtocolRules[0].Action = ingressnodefwv1alpha1.IngressNodeFirewallDeny
+			inf.Spec.Ingress[0].FirewallProtocolRules[0].AutoBan = &ingressnodefwv1alpha1.IngressNodeFirewallAutoBan{
+				Threshold:   5,
+				Period:      metav1.Duration{Duration: time.Minute},
+				BanDuration: metav1.Duration{Duration: 10 * time.Minute},
+			}
+			Expect(createIngressNodeFirewall(inf)).To(Succeed())
+			Expect(deleteIngressNodeFirewall(inf)).To(Succeed())
+		})
+		It("rejects invalid autoBan", func() {
+			inf.Spec.Ingress[0].FirewallProtocolRules[0].AutoBan = &ingressnodefwv1alpha1.IngressNodeFirewallAutoBan{
+				Threshold:   5,
+				Period:      metav1.Duration{Duration: time.Minute},
+				BanDuration: metav1.Duration{Duration: 10 * time.Minute},
+			}
+			// autoBan on an allow rule.
+			Expect(createIngressNodeFirewall(inf)).ToNot(Succeed())
+			inf.Spec.Ingress[0].FirewallProtocolRules[0].Action = ingressnodefwv1alpha1.IngressNodeFirewallDeny
+			inf.Spec.Ingress[0].FirewallProtocolRules[0].AutoBan.Period.Duration = 0
+			Expect(createIngressNodeFirewall(inf)).ToNot(Succeed())
+		})
+	})
+})
+
+var _ = Describe("Order conflicts on shared nodes", func() {
+	var inf, inf2 *ingressnodefwv1alpha1.IngressNodeFirewall
+	nodes := []*corev1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "worker-a", Labels: map[string]string{"role": "worker", "zone": "a"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "worker-b", Labels: map[string]string{"role": "worker", "zone": "b"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "infra-c", Labels: map[string]string{"role": "infra", "zone": "c"}}},
+	}
+
+	BeforeEach(func() {
+		for _, node := range nodes {
+			Expect(k8sClient.Create(ctx, node.DeepCopy())).To(Succeed())
+		}
+		inf = getIngressNodeFirewall("workers")
+		initCIDRTransportRule(inf, ipv4CIDR, validOrder, ingressnodefwv1alpha1.ProtocolTypeTCP, validPort, ingressnodefwv1alpha1.IngressNodeFirewallAllow)
+		configInterfaces(inf, []string{"eth0"})
+		inf.Spec.NodeSelector = metav1.LabelSelector{MatchLabels: map[string]string{"role": "worker"}}
+		Expect(createIngressNodeFirewall(inf)).To(Succeed())
+		inf2 = getIngressNodeFirewall("zone")
+		initCIDRTransportRule(inf2, ipv4CIDR, validOrder, ingressnodefwv1alpha1.ProtocolTypeTCP, "443", ingressnodefwv1alpha1.IngressNodeFirewallAllow)
+		configInterfaces(inf2, []string{"eth0"})
+	})
+
+	AfterEach(func() {
+		Expect(deleteIngressNodeFirewall(inf)).To(Succeed())
+		for _, node := range nodes {
+			Expect(k8sClient.Delete(ctx, node.DeepCopy())).To(Succeed())
+		}
+	})
+
+	It("rejects rules with the same order on nodes that both selectors match and names the nodes", func() {
+		inf2.Spec.NodeSelector = metav1.LabelSelector{MatchLabels: map[string]string{"zone": "a"}}
+		err := createIngressNodeFirewall(inf2)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("on nodes worker-a"))
+		Expect(err.Error()).NotTo(ContainSubstring("worker-b"))
+	})
+
+	It("allows rules with the same order if the selectors match different nodes", func() {
+		inf2.Spec.NodeSelector = metav1.LabelSelector{MatchLabels: map[string]string{"zone": "c"}}
+		Expect(createIngressNodeFirewall(inf2)).To(Succeed())
+		Expect(deleteIngressNodeFirewall(inf2)).To(Succeed())
+	})
+
+	It("allows rules with the same order on shared nodes if the interfaces differ", func() {
+		inf2.Spec.NodeSelector = metav1.LabelSelector{MatchLabels: map[string]string{"zone": "a"}}
+		inf2.Spec.Interfaces = []string{"eth1"}
+		Expect(createIngressNodeFirewall(inf2)).To(Succeed())
+		Expect(deleteIngressNodeFirewall(inf2)).To(Succeed())
+	})
+
+	It("rejects rules with the same order for a CIDR of a referenced address set", func() {
+		addressSet := &ingressnodefwv1alpha1.IngressNodeFirewallAddressSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "trusted"},
+			Spec:       ingressnodefwv1alpha1.IngressNodeFirewallAddressSetSpec{CIDRs: []string{ipv4CIDR}},
+		}
+		Expect(k8sClient.Create(ctx, addressSet)).To(Succeed())
+		defer func() {
+			Expect(k8sClient.Delete(ctx, addressSet)).To(Succeed())
+		}()
+		inf2.Spec.NodeSelector = metav1.LabelSelector{MatchLabels: map[string]string{"zone": "a"}}
+		inf2.Spec.Ingress[0].SourceCIDRs = nil
+		inf2.Spec.Ingress[0].SourceAddressSetRefs = []string{"trusted"}
+		err := createIngressNodeFirewall(inf2)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("on nodes worker-a"))
+	})
+
+	It("rejects an address set change that creates an order conflict for the rules that reference it", func() {
+		addressSet := &ingressnodefwv1alpha1.IngressNodeFirewallAddressSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "trusted"},
+			Spec:       ingressnodefwv1alpha1.IngressNodeFirewallAddressSetSpec{CIDRs: []string{"10.0.0.0/8"}},
+		}
+		Expect(k8sClient.Create(ctx, addressSet)).To(Succeed())
+		defer func() {
+			Expect(k8sClient.Delete(ctx, addressSet)).To(Succeed())
+		}()
+		inf2.Spec.NodeSelector = metav1.LabelSelector{MatchLabels: map[string]string{"zone": "a"}}
+		inf2.Spec.Ingress[0].SourceCIDRs = nil
+		inf2.Spec.Ingress[0].SourceAddressSetRefs = []string{"trusted"}
+		Expect(createIngressNodeFirewall(inf2)).To(Succeed())
+		defer func() {
+			Expect(deleteIngressNodeFirewall(inf2)).To(Succeed())
+		}()
+
+		addressSet.Spec.CIDRs = []string{ipv4CIDR}
+		err := k8sClient.Update(ctx, addressSet)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring(`order conflict in spec.ingress[0][rules] of IngressNodeFirewall "zone"`))
+		Expect(err.Error()).To(ContainSubstring("on nodes worker-a"))
+
+		addressSet.Spec.CIDRs = []string{"10.0.0.0/8", "172.16.0.0/12"}
+		Expect(k8sClient.Update(ctx, addressSet)).To(Succeed())
+	})
+})
+
+var _ = Describe("Address sets", func() {
+	It("rejects an address set with an invalid CIDR", func() {
+		addressSet := &ingressnodefwv1alpha1.IngressNodeFirewallAddressSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "invalid"},
+			Spec:       ingressnodefwv1alpha1.IngressNodeFirewallAddressSetSpec{CIDRs: []string{ipv4CIDR, badIPV6CIDR}},
+		}
+		err := k8sClient.Create(ctx, addressSet)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("spec.cidrs[1]"))
+	})
+
+	It("allows an address set with valid CIDRs", func() {
+		addressSet := &ingressnodefwv1alpha1.IngressNodeFirewallAddressSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "valid"},
+			Spec:       ingressnodefwv1alpha1.IngressNodeFirewallAddressSetSpec{CIDRs: []string{ipv4CIDR}},
+		}
+		Expect(k8sClient.Create(ctx, addressSet)).To(Succeed())
+		Expect(k8sClient.Delete(ctx, addressSet)).To(Succeed())
 	})
 })
 
@@ -486,6 +761,30 @@ var _ = Describe("sourceCIDRs", func() {
 			Expect(createIngressNodeFirewall(inf)).ToNot(Succeed())
 		})
 	})
+
+	Context("and its replaced by address set references or dynamic sources", func() {
+		It("allows rule with only address set references", func() {
+			initCIDRTransportRule(inf, ipv4CIDR, validOrder, ingressnodefwv1alpha1.ProtocolTypeTCP, validPort, ingressnodefwv1alpha1.IngressNodeFirewallAllow)
+			inf.Spec.Ingress[0].SourceCIDRs = nil
+			inf.Spec.Ingress[0].SourceAddressSetRefs = []string{"trusted"}
+			Expect(createIngressNodeFirewall(inf)).To(Succeed())
+			Expect(deleteIngressNodeFirewall(inf)).To(Succeed())
+		})
+
+		It("allows rule with only a node selector", func() {
+			initCIDRTransportRule(inf, ipv4CIDR, validOrder, ingressnodefwv1alpha1.ProtocolTypeTCP, validPort, ingressnodefwv1alpha1.IngressNodeFirewallAllow)
+			inf.Spec.Ingress[0].SourceCIDRs = nil
+			inf.Spec.Ingress[0].FromNodes = &metav1.LabelSelector{}
+			Expect(createIngressNodeFirewall(inf)).To(Succeed())
+			Expect(deleteIngressNodeFirewall(inf)).To(Succeed())
+		})
+
+		It("rejects rule without any source", func() {
+			initCIDRTransportRule(inf, ipv4CIDR, validOrder, ingressnodefwv1alpha1.ProtocolTypeTCP, validPort, ingressnodefwv1alpha1.IngressNodeFirewallAllow)
+			inf.Spec.Ingress[0].SourceCIDRs = nil
+			Expect(createIngressNodeFirewall(inf)).ToNot(Succeed())
+		})
+	})
 })
 
 var _ = Describe("Pin holes", func() {
@@ -554,6 +853,138 @@ var _ = Describe("Pin holes", func() {
 	})
 })
 
+var _ = Describe("Rule analysis", func() {
+	allow, deny := ingressnodefwv1alpha1.IngressNodeFirewallAllow, ingressnodefwv1alpha1.IngressNodeFirewallDeny
+	tcp := ingressnodefwv1alpha1.ProtocolTypeTCP
+	allRule := func(order uint32, action ingressnodefwv1alpha1.IngressNodeFirewallActionType) ingressnodefwv1alpha1.IngressNodeFirewallProtocolRule {
+		return ingressnodefwv1alpha1.IngressNodeFirewallProtocolRule{Order: order, Action: action}
+	}
+	findingIndices := func(rules ...ingressnodefwv1alpha1.IngressNodeFirewallProtocolRule) []int {
+		var indices []int
+		for _, finding := range analyzeRules(rules) {
+			indices = append(indices, finding.index)
+		}
+		return indices
+	}
+
+	It("reports rules after an allow-all rule as shadowed or redundant", func() {
+		findings := analyzeRules([]ingressnodefwv1alpha1.IngressNodeFirewallProtocolRule{
+			allRule(1, allow), getTCPRule(2, tcp, "80", deny), getTCPRule(3, tcp, "443", allow)})
+		Expect(findings).To(HaveLen(2))
+		Expect(findings[0].message).To(ContainSubstring("rule with order 2 never matches"))
+		Expect(findings[1].message).To(ContainSubstring("rule with order 3 is redundant"))
+	})
+
+	It("evaluates rules by order instead of by position", func() {
+		Expect(findingIndices(getTCPRule(2, tcp, "80", deny), allRule(1, allow))).To(Equal([]int{0}))
+		Expect(findingIndices(getTCPRule(1, tcp, "80", deny), allRule(2, allow))).To(BeEmpty())
+	})
+
+	It("reports a rule within an earlier port range with the opposite action as shadowed", func() {
+		findings := analyzeRules([]ingressnodefwv1alpha1.IngressNodeFirewallProtocolRule{
+			getTCPRule(1, tcp, "8000-9000", allow), getTCPRule(2, tcp, "8080", deny)})
+		Expect(findings).To(HaveLen(1))
+		Expect(findings[0].message).To(ContainSubstring("never matches"))
+	})
+
+	It("reports a rule covered by several earlier rules", func() {
+		Expect(findingIndices(getTCPRule(1, tcp, "80-90", deny), getTCPRule(2, tcp, "90-100", deny),
+			getTCPRule(3, tcp, "85-99", deny))).To(Equal([]int{2}))
+		Expect(findingIndices(getTCPRule(1, tcp, "80-90", deny), getTCPRule(2, tcp, "91-100", deny),
+			getTCPRule(3, tcp, "85-99", deny))).To(BeEmpty())
+	})
+
+	It("does not match the end of a port range", func() {
+		Expect(findingIndices(getTCPRule(1, tcp, "80-90", deny), getTCPRule(2, tcp, "90", allow))).To(BeEmpty())
+		Expect(findingIndices(getTCPRule(1, tcp, "80-90", deny), getTCPRule(2, tcp, "89", allow))).To(Equal([]int{1}))
+	})
+
+	It("reports partially overlapping rules with the opposite action as conflicting", func() {
+		findings := analyzeRules([]ingressnodefwv1alpha1.IngressNodeFirewallProtocolRule{
+			getTCPRule(1, tcp, "80-90", allow), getTCPRule(2, tcp, "85-95", deny)})
+		Expect(findings).To(HaveLen(1))
+		Expect(findings[0].message).To(ContainSubstring("conflicts with the rules with order 1"))
+		Expect(findingIndices(getTCPRule(1, tcp, "80-90", allow), getTCPRule(2, tcp, "85-95", allow))).To(BeEmpty())
+	})
+
+	It("distinguishes protocols and ICMP types", func() {
+		Expect(findingIndices(getTCPRule(1, tcp, "80", deny),
+			getUDPRule(2, ingressnodefwv1alpha1.ProtocolTypeUDP, "80", allow))).To(BeEmpty())
+		Expect(findingIndices(getICMPRule(1, ingressnodefwv1alpha1.ProtocolTypeICMP, 8, 0, deny),
+			getICMPRule(2, ingressnodefwv1alpha1.ProtocolTypeICMP, 0, 0, allow),
+			getICMPRule(3, ingressnodefwv1alpha1.ProtocolTypeICMP, 8, 0, allow))).To(Equal([]int{2}))
+	})
+
+	It("covers rules with an ICMP type range and any code", func() {
+		icmpRangeRule := getICMPRule(1, ingressnodefwv1alpha1.ProtocolTypeICMP, 3, 0, deny)
+		icmpRangeRule.ProtocolConfig.ICMP.ICMPTypeEnd, icmpRangeRule.ProtocolConfig.ICMP.ICMPAnyCode = 5, true
+		Expect(findingIndices(icmpRangeRule, getICMPRule(2, ingressnodefwv1alpha1.ProtocolTypeICMP, 4, 1, allow),
+			getICMPRule(3, ingressnodefwv1alpha1.ProtocolTypeICMP, 6, 0, allow))).To(Equal([]int{1}))
+		Expect(findingIndices(getICMPRule(1, ingressnodefwv1alpha1.ProtocolTypeICMP, 4, 1, deny),
+			icmpRangeRule)).To(BeEmpty())
+	})
+
+	It("distinguishes IP protocol numbers", func() {
+		ipProtocolRule := func(order uint32, protocol uint8,
+			action ingressnodefwv1alpha1.IngressNodeFirewallActionType) ingressnodefwv1alpha1.IngressNodeFirewallProtocolRule {
+			return ingressnodefwv1alpha1.IngressNodeFirewallProtocolRule{Order: order, Action: action,
+				ProtocolConfig: ingressnodefwv1alpha1.IngressNodeProtocolConfig{
+					Protocol: ingressnodefwv1alpha1.ProtocolTypeIPProtocol, IPProtocol: &protocol}}
+		}
+		Expect(findingIndices(ipProtocolRule(1, vrrpProtocol, deny), ipProtocolRule(2, 50, allow),
+			ipProtocolRule(3, vrrpProtocol, allow))).To(Equal([]int{2}))
+		Expect(findingIndices(ipProtocolRule(1, vrrpProtocol, deny), getTCPRule(2, tcp, "80", allow))).To(BeEmpty())
+	})
+
+	It("warns about rules that deny essential ICMPv6 messages", func() {
+		ingress := ingressnodefwv1alpha1.IngressNodeFirewallRules{SourceCIDRs: []string{ipv4CIDR, "::/0"},
+			FirewallProtocolRules: []ingressnodefwv1alpha1.IngressNodeFirewallProtocolRule{
+				getICMPv6Rule(1, ingressnodefwv1alpha1.ProtocolTypeICMP6, 135, 0, allow), allRule(2, deny)}}
+		Expect(validateEssentialICMPv6(ingress, 0)).To(ConsistOf(
+			ContainSubstring("spec.ingress[0][rules][1]: rule with order 2 denies IPv6 neighbor discovery from fe80::/10"),
+			ContainSubstring("spec.ingress[0][rules][1]: rule with order 2 denies IPv6 path MTU discovery from ::/0")))
+
+		ingress.SourceCIDRs = []string{"2001:db8::/32"}
+		Expect(validateEssentialICMPv6(ingress, 0)).To(ConsistOf(ContainSubstring("path MTU discovery")))
+		ingress.SourceCIDRs = []string{ipv4CIDR}
+		Expect(validateEssentialICMPv6(ingress, 0)).To(BeEmpty())
+	})
+
+	It("treats the findings that depend on earlier scheduled rules as warnings", func() {
+		// Deny SSH at night on weekdays, and allow it otherwise.
+		nightly := getTCPRule(1, tcp, "22", deny)
+		nightly.Schedule = &ingressnodefwv1alpha1.IngressNodeFirewallSchedule{Start: "0 22 * * 1-5",
+			Duration: metav1.Duration{Duration: 8 * time.Hour}}
+		rules := []ingressnodefwv1alpha1.IngressNodeFirewallProtocolRule{nightly, getTCPRule(2, tcp, "22", allow)}
+		findings := analyzeRules(rules)
+		Expect(findings).To(HaveLen(1))
+		Expect(findings[0].scheduleDependent).To(BeTrue())
+		Expect(findings[0].message).To(ContainSubstring("while the schedules of the rules with order 1 are active"))
+		warnings, errs := validateRuleAnalysis(rules, 0, "analysis", true)
+		Expect(errs).To(BeEmpty())
+		Expect(warnings).To(ConsistOf(ContainSubstring("spec.ingress[0][rules][1]: rule with order 2 never matches")))
+
+		// A later rule that an earlier rule without schedule shadows is still rejected.
+		rules = append(rules, allRule(0, allow))
+		findings = analyzeRules(rules)
+		Expect(findings).To(HaveLen(2))
+		Expect(findings[0].scheduleDependent).To(BeFalse())
+		Expect(findings[1].scheduleDependent).To(BeFalse())
+		_, errs = validateRuleAnalysis(rules, 0, "analysis", true)
+		Expect(errs).To(HaveLen(2))
+	})
+
+	It("returns the findings as warnings or errors", func() {
+		rules := []ingressnodefwv1alpha1.IngressNodeFirewallProtocolRule{allRule(1, allow), getTCPRule(2, tcp, "80", deny)}
+		warnings, errs := validateRuleAnalysis(rules, 0, "analysis", false)
+		Expect(errs).To(BeEmpty())
+		Expect(warnings).To(ConsistOf(ContainSubstring("spec.ingress[0][rules][1]: rule with order 2 never matches")))
+		warnings, errs = validateRuleAnalysis(rules, 0, "analysis", true)
+		Expect(warnings).To(BeEmpty())
+		Expect(errs).To(HaveLen(1))
+	})
+})
+
 var _ = AfterSuite(func() {
 	cancel()
 	By("tearing down the test environment")
@@ -711,6 +1142,25 @@ func getICMPv6Rule(order uint32, protocol ingressnodefwv1alpha1.IngressNodeFirew
 	}
 }
 
+func initCIDRIPProtocolRule(inf *ingressnodefwv1alpha1.IngressNodeFirewall, cidr string, order uint32, ipProtocol uint8,
+	action ingressnodefwv1alpha1.IngressNodeFirewallActionType) {
+
+	rule := ingressnodefwv1alpha1.IngressNodeFirewallRules{
+		SourceCIDRs: []string{cidr},
+		FirewallProtocolRules: []ingressnodefwv1alpha1.IngressNodeFirewallProtocolRule{
+			{
+				Order: order,
+				ProtocolConfig: ingressnodefwv1alpha1.IngressNodeProtocolConfig{
+					Protocol:   ingressnodefwv1alpha1.ProtocolTypeIPProtocol,
+					IPProtocol: &ipProtocol,
+				},
+				Action: action,
+			},
+		},
+	}
+	inf.Spec.Ingress = append(inf.Spec.Ingress, rule)
+}
+
 func configInterfaces(inf *ingressnodefwv1alpha1.IngressNodeFirewall, intfs []string) {
 	inf.Spec.Interfaces = append(inf.Spec.Interfaces, intfs...)
 }